@@ -13,6 +13,12 @@ const (
 	OpIn   Op = "in"
 	OpNin  Op = "nin"
 	OpLike Op = "like"
+
+	OpJsonContains Op = "json_contains" // JSON 包含
+	OpJsonHasKey   Op = "json_has_key"  // JSON key 存在
+	OpSearch       Op = "search"        // 全文检索
+	OpAnyIn        Op = "any_in"        // 以单个数组参数匹配（PostgreSQL = ANY）
+	OpAnyNin       Op = "any_nin"       // 以单个数组参数排除（PostgreSQL <> ALL）
 )
 
 // MatchMode 模糊匹配模式
@@ -40,6 +46,8 @@ type LogicalGroup struct {
 type QueryConditions struct {
 	// Fields 存储字段条件，key 为字段名，value 为该字段的所有条件
 	Fields map[string][]Condition
+	// Keys 字段的添加顺序，保证构建结果稳定
+	Keys []string
 	// LogicalGroups 存储逻辑组
 	LogicalGroups []LogicalGroup
 }
@@ -54,6 +62,9 @@ func NewQueryConditions() *QueryConditions {
 
 // AddCondition 添加字段条件
 func (qc *QueryConditions) AddCondition(key string, op Op, value any) {
+	if _, ok := qc.Fields[key]; !ok {
+		qc.Keys = append(qc.Keys, key)
+	}
 	qc.Fields[key] = append(qc.Fields[key], Condition{Op: op, Value: value})
 }
 
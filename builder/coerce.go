@@ -0,0 +1,124 @@
+package builder
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// CoerceFunc 字段值转换函数，无法转换时应原样返回
+type CoerceFunc func(value any) any
+
+// FieldType 字段类型，用于按 schema 转换字符串值
+type FieldType int
+
+const (
+	FieldObjectID FieldType = iota + 1 // hex 字符串 -> bson.ObjectID
+	FieldTime                          // RFC3339 字符串 -> time.Time
+	FieldInt                           // 数字字符串 -> int64
+	FieldFloat                         // 数字字符串 -> float64
+)
+
+// Coercer 返回字段类型对应的转换函数
+func (t FieldType) Coercer() CoerceFunc {
+	switch t {
+	case FieldObjectID:
+		return CoerceObjectID
+	case FieldTime:
+		return CoerceTime
+	case FieldInt:
+		return CoerceInt
+	case FieldFloat:
+		return CoerceFloat
+	default:
+		return nil
+	}
+}
+
+// Schema 字段类型定义，key 为字段名
+type Schema map[string]FieldType
+
+var (
+	coercerMu sync.RWMutex
+	// defaultCoercers 全局字段转换函数；_id 的类型因集合而异，不做全局转换，按构建器使用 WithObjectId 开启
+	defaultCoercers = map[string]CoerceFunc{}
+)
+
+// RegisterCoercer 注册全局字段转换函数，fn 为 nil 时移除
+func RegisterCoercer(field string, fn CoerceFunc) {
+	coercerMu.Lock()
+	defer coercerMu.Unlock()
+	if fn == nil {
+		delete(defaultCoercers, field)
+		return
+	}
+	defaultCoercers[field] = fn
+}
+
+// RegisterSchema 按 schema 批量注册全局字段转换函数
+func RegisterSchema(schema Schema) {
+	for field, typ := range schema {
+		RegisterCoercer(field, typ.Coercer())
+	}
+}
+
+// lookupCoercer 查找全局字段转换函数
+func lookupCoercer(field string) CoerceFunc {
+	coercerMu.RLock()
+	defer coercerMu.RUnlock()
+	return defaultCoercers[field]
+}
+
+// CoerceObjectID 将合法的 hex 字符串转换为 bson.ObjectID
+func CoerceObjectID(value any) any {
+	s, ok := value.(string)
+	if !ok {
+		return value
+	}
+	oid, err := bson.ObjectIDFromHex(s)
+	if err != nil {
+		return value
+	}
+	return oid
+}
+
+// CoerceTime 将 RFC3339 字符串转换为 time.Time
+func CoerceTime(value any) any {
+	s, ok := value.(string)
+	if !ok {
+		return value
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return value
+	}
+	return t
+}
+
+// CoerceInt 将数字字符串转换为 int64
+func CoerceInt(value any) any {
+	s, ok := value.(string)
+	if !ok {
+		return value
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return value
+	}
+	return n
+}
+
+// CoerceFloat 将数字字符串转换为 float64
+func CoerceFloat(value any) any {
+	s, ok := value.(string)
+	if !ok {
+		return value
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return value
+	}
+	return f
+}
@@ -0,0 +1,197 @@
+package builder
+
+import (
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// Dialect SQL 方言
+type Dialect int
+
+const (
+	DialectMySQL Dialect = iota
+	DialectPostgres
+)
+
+// ILike 不区分大小写的模糊匹配（PostgreSQL）
+type ILike clause.Eq
+
+func (like ILike) Build(builder clause.Builder) {
+	builder.WriteQuoted(like.Column)
+	builder.WriteString(" ILIKE ")
+	builder.AddVar(builder, like.Value)
+}
+
+func (like ILike) NegationBuild(builder clause.Builder) {
+	builder.WriteQuoted(like.Column)
+	builder.WriteString(" NOT ILIKE ")
+	builder.AddVar(builder, like.Value)
+}
+
+// AnyIn 以单个数组参数渲染的 IN 条件（PostgreSQL）：column = ANY($1)
+type AnyIn struct {
+	Column any
+	Values []any
+}
+
+func (in AnyIn) Build(builder clause.Builder) {
+	builder.WriteQuoted(in.Column)
+	builder.WriteString(" = ANY(")
+	builder.AddVar(builder, pgArray(in.Values))
+	builder.WriteByte(')')
+}
+
+func (in AnyIn) NegationBuild(builder clause.Builder) {
+	builder.WriteQuoted(in.Column)
+	builder.WriteString(" <> ALL(")
+	builder.AddVar(builder, pgArray(in.Values))
+	builder.WriteByte(')')
+}
+
+// JsonContains JSON 包含条件
+// MySQL: JSON_CONTAINS(column, ?)；PostgreSQL: column @> ?::jsonb
+type JsonContains struct {
+	Column  any
+	Value   any
+	Dialect Dialect
+}
+
+func (j JsonContains) Build(builder clause.Builder) {
+	if j.Dialect == DialectPostgres {
+		builder.WriteQuoted(j.Column)
+		builder.WriteString(" @> ")
+		builder.AddVar(builder, toJsonString(j.Value))
+		builder.WriteString("::jsonb")
+		return
+	}
+	builder.WriteString("JSON_CONTAINS(")
+	builder.WriteQuoted(j.Column)
+	builder.WriteString(", ")
+	builder.AddVar(builder, toJsonString(j.Value))
+	builder.WriteByte(')')
+}
+
+// JsonHasKey JSON 顶层 key 存在条件
+// MySQL: JSON_CONTAINS_PATH(column, 'one', '$.key')；PostgreSQL: column ? 'key'
+type JsonHasKey struct {
+	Column  any
+	Key     string
+	Dialect Dialect
+}
+
+func (j JsonHasKey) Build(builder clause.Builder) {
+	if j.Dialect == DialectPostgres {
+		builder.WriteQuoted(j.Column)
+		builder.WriteString(" ? ")
+		builder.AddVar(builder, j.Key)
+		return
+	}
+	builder.WriteString("JSON_CONTAINS_PATH(")
+	builder.WriteQuoted(j.Column)
+	builder.WriteString(", 'one', ")
+	builder.AddVar(builder, "$."+j.Key)
+	builder.WriteByte(')')
+}
+
+// FullText 全文检索条件
+// MySQL: MATCH(column) AGAINST(? IN NATURAL LANGUAGE MODE)；PostgreSQL: to_tsvector(column) @@ plainto_tsquery(?)
+type FullText struct {
+	Column  any
+	Query   string
+	Dialect Dialect
+	// Config PostgreSQL 全文检索配置（如 simple、english），为空时使用数据库默认配置
+	Config string
+}
+
+func (f FullText) Build(builder clause.Builder) {
+	if f.Dialect == DialectPostgres {
+		builder.WriteString("to_tsvector(")
+		if f.Config != "" {
+			builder.AddVar(builder, f.Config)
+			builder.WriteString("::regconfig, ")
+		}
+		builder.WriteQuoted(f.Column)
+		builder.WriteString(") @@ plainto_tsquery(")
+		if f.Config != "" {
+			builder.AddVar(builder, f.Config)
+			builder.WriteString("::regconfig, ")
+		}
+		builder.AddVar(builder, f.Query)
+		builder.WriteByte(')')
+		return
+	}
+	builder.WriteString("MATCH(")
+	builder.WriteQuoted(f.Column)
+	builder.WriteString(") AGAINST(")
+	builder.AddVar(builder, f.Query)
+	builder.WriteString(" IN NATURAL LANGUAGE MODE)")
+}
+
+// toJsonString 将值转换为 JSON 字符串，字符串和字节切片视为已编码的 JSON
+func toJsonString(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
+
+// pgArray 以 PostgreSQL 数组字面量绑定的值列表，使 IN 条件只占用一个参数
+type pgArray []any
+
+// Value 实现 driver.Valuer，输出形如 {1,"a",NULL} 的数组字面量
+func (a pgArray) Value() (driver.Value, error) {
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, v := range a {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		if valuer, ok := v.(driver.Valuer); ok {
+			var err error
+			if v, err = valuer.Value(); err != nil {
+				return nil, err
+			}
+		}
+		switch e := v.(type) {
+		case nil:
+			sb.WriteString("NULL")
+		case bool:
+			sb.WriteString(strconv.FormatBool(e))
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+			sb.WriteString(fmt.Sprint(e))
+		case time.Time:
+			writePgArrayString(&sb, e.Format(time.RFC3339Nano))
+		case []byte:
+			// bytea 的 hex 输入格式
+			writePgArrayString(&sb, `\x`+hex.EncodeToString(e))
+		default:
+			writePgArrayString(&sb, fmt.Sprint(e))
+		}
+	}
+	sb.WriteByte('}')
+	return sb.String(), nil
+}
+
+// writePgArrayString 写入带引号并转义的数组元素
+func writePgArrayString(sb *strings.Builder, s string) {
+	sb.WriteByte('"')
+	for _, r := range s {
+		if r == '"' || r == '\\' {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(r)
+	}
+	sb.WriteByte('"')
+}
@@ -1,6 +1,9 @@
 package builder
 
 import (
+	"maps"
+	"slices"
+
 	"gorm.io/gorm/clause"
 )
 
@@ -8,9 +11,11 @@ import (
 type GormQueryBuilder struct {
 	conditions *QueryConditions
 	idField    string
+	dialect    Dialect
+	tsConfig   string
 }
 
-// NewGormQueryBuilder 创建 GORM 查询构建器
+// NewGormQueryBuilder 创建 GORM 查询构建器，默认 MySQL 方言
 func NewGormQueryBuilder() *GormQueryBuilder {
 	return &GormQueryBuilder{
 		conditions: NewQueryConditions(),
@@ -18,6 +23,23 @@ func NewGormQueryBuilder() *GormQueryBuilder {
 	}
 }
 
+// NewPostgresQueryBuilder 创建 PostgreSQL 方言的 GORM 查询构建器
+func NewPostgresQueryBuilder() *GormQueryBuilder {
+	return NewGormQueryBuilder().WithDialect(DialectPostgres)
+}
+
+// WithDialect 设置 SQL 方言
+func (b *GormQueryBuilder) WithDialect(dialect Dialect) *GormQueryBuilder {
+	b.dialect = dialect
+	return b
+}
+
+// WithTextSearchConfig 设置 PostgreSQL 全文检索配置（如 simple、english）
+func (b *GormQueryBuilder) WithTextSearchConfig(config string) *GormQueryBuilder {
+	b.tsConfig = config
+	return b
+}
+
 // Id 设置 ID 条件
 func (b *GormQueryBuilder) Id(id any) QBuilder {
 	b.conditions.AddCondition(b.idField, OpEq, id)
@@ -93,6 +115,36 @@ func (b *GormQueryBuilder) buildPattern(value string, mode MatchMode) string {
 	}
 }
 
+// JsonContains JSON 列包含指定值，value 为字符串时视为已编码的 JSON
+func (b *GormQueryBuilder) JsonContains(key string, value any) *GormQueryBuilder {
+	b.conditions.AddCondition(key, OpJsonContains, value)
+	return b
+}
+
+// JsonHasKey JSON 列包含指定的顶层 key
+func (b *GormQueryBuilder) JsonHasKey(key string, jsonKey string) *GormQueryBuilder {
+	b.conditions.AddCondition(key, OpJsonHasKey, jsonKey)
+	return b
+}
+
+// AnyIn 包含条件，PostgreSQL 以单个数组参数渲染为 column = ANY($1)，用于值很多的列表；MySQL 与 In 相同
+func (b *GormQueryBuilder) AnyIn(key string, value ...any) *GormQueryBuilder {
+	b.conditions.AddCondition(key, OpAnyIn, value)
+	return b
+}
+
+// AnyNin 不包含条件，PostgreSQL 渲染为 column <> ALL($1)；MySQL 与 Nin 相同
+func (b *GormQueryBuilder) AnyNin(key string, value ...any) *GormQueryBuilder {
+	b.conditions.AddCondition(key, OpAnyNin, value)
+	return b
+}
+
+// Search 全文检索条件
+func (b *GormQueryBuilder) Search(key string, query string) *GormQueryBuilder {
+	b.conditions.AddCondition(key, OpSearch, query)
+	return b
+}
+
 // And 逻辑与
 func (b *GormQueryBuilder) And(conditions ...any) QBuilder {
 	b.conditions.AddLogicalGroup("and", conditions)
@@ -109,10 +161,10 @@ func (b *GormQueryBuilder) Or(conditions ...any) QBuilder {
 func (b *GormQueryBuilder) Build() any {
 	var exprs []clause.Expression
 
-	// 处理字段条件
-	for field, conditions := range b.conditions.Fields {
+	// 处理字段条件，按添加顺序生成
+	for _, field := range b.conditions.Keys {
 		col := clause.Column{Name: field}
-		for _, cond := range conditions {
+		for _, cond := range b.conditions.Fields[field] {
 			exprs = append(exprs, b.buildConditionExpr(col, cond))
 		}
 	}
@@ -155,9 +207,32 @@ func (b *GormQueryBuilder) buildConditionExpr(col clause.Column, cond Condition)
 	case OpNin:
 		values, _ := cond.Value.([]any)
 		return clause.Not(clause.IN{Column: col, Values: values})
+	case OpAnyIn:
+		values, _ := cond.Value.([]any)
+		if b.dialect == DialectPostgres {
+			return AnyIn{Column: col, Values: values}
+		}
+		return clause.IN{Column: col, Values: values}
+	case OpAnyNin:
+		values, _ := cond.Value.([]any)
+		if b.dialect == DialectPostgres {
+			return clause.Not(AnyIn{Column: col, Values: values})
+		}
+		return clause.Not(clause.IN{Column: col, Values: values})
 	case OpLike:
 		pattern, _ := cond.Value.(string)
+		if b.dialect == DialectPostgres {
+			return ILike{Column: col, Value: pattern}
+		}
 		return clause.Like{Column: col, Value: pattern}
+	case OpJsonContains:
+		return JsonContains{Column: col, Value: cond.Value, Dialect: b.dialect}
+	case OpJsonHasKey:
+		key, _ := cond.Value.(string)
+		return JsonHasKey{Column: col, Key: key, Dialect: b.dialect}
+	case OpSearch:
+		query, _ := cond.Value.(string)
+		return FullText{Column: col, Query: query, Dialect: b.dialect, Config: b.tsConfig}
 	default:
 		return clause.Eq{Column: col, Value: cond.Value}
 	}
@@ -194,8 +269,8 @@ func (b *GormQueryBuilder) convertToExpr(cond any) clause.Expression {
 		return v
 	case map[string]any:
 		var exprs []clause.Expression
-		for key, value := range v {
-			exprs = append(exprs, clause.Eq{Column: clause.Column{Name: key}, Value: value})
+		for _, key := range slices.Sorted(maps.Keys(v)) {
+			exprs = append(exprs, clause.Eq{Column: clause.Column{Name: key}, Value: v[key]})
 		}
 		if len(exprs) == 1 {
 			return exprs[0]
@@ -1,8 +1,11 @@
 package builder
 
 import (
+	"reflect"
 	"testing"
 
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
 
@@ -289,6 +292,21 @@ func TestGormQueryBuilder_MultipleFields(t *testing.T) {
 	}
 }
 
+func TestGormQueryBuilder_FieldOrder(t *testing.T) {
+	// 字段条件按添加顺序生成，map 条件按 key 排序
+	for i := 0; i < 20; i++ {
+		sql, vars := buildPostgresSQL(t, NewGormQueryBuilder().Eq("name", "bob").Gt("id", 7).Lt("age", 30).Eq("name", "x").
+			And(map[string]any{"c": 3, "b": 2, "a": 1}).Build())
+		want := `SELECT * FROM "users" WHERE "name" = $1 AND "name" = $2 AND "id" > $3 AND "age" < $4 AND ("a" = $5 AND "b" = $6 AND "c" = $7)`
+		if sql != want {
+			t.Fatalf("expected %s, got %s", want, sql)
+		}
+		if !reflect.DeepEqual(vars, []any{"bob", "x", 7, 30, 1, 2, 3}) {
+			t.Fatalf("unexpected vars %v", vars)
+		}
+	}
+}
+
 func TestGormQueryBuilder_Or(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -688,3 +706,123 @@ func TestGormQueryBuilder_Like_EmptyValue(t *testing.T) {
 		t.Errorf("expected pattern '%%%%', got '%v'", likeExpr.Value)
 	}
 }
+
+// buildPostgresSQL 使用 PostgreSQL 方言 DryRun 渲染 where 条件
+func buildPostgresSQL(t *testing.T, expr any) (string, []any) {
+	t.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+		DryRun:                 true,
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+	})
+	if err != nil {
+		t.Fatalf("open dry run db failed: %v", err)
+	}
+	var rows []map[string]any
+	stmt := db.Table("users").Where(expr).Find(&rows).Statement
+	return stmt.SQL.String(), stmt.Vars
+}
+
+func TestGormQueryBuilder_Postgres(t *testing.T) {
+	tests := []struct {
+		name     string
+		build    func(b *GormQueryBuilder) any
+		expected string
+		vars     []any
+	}{
+		{
+			name:     "ilike",
+			build:    func(b *GormQueryBuilder) any { return b.Like("name", "Tom", MatchStartsWith).Build() },
+			expected: `SELECT * FROM "users" WHERE "name" ILIKE $1`,
+			vars:     []any{"Tom%"},
+		},
+		{
+			name:     "in",
+			build:    func(b *GormQueryBuilder) any { return b.In("status", 1, 2).Build() },
+			expected: `SELECT * FROM "users" WHERE "status" IN ($1,$2)`,
+			vars:     []any{1, 2},
+		},
+		{
+			name:     "any in",
+			build:    func(b *GormQueryBuilder) any { return b.AnyIn("status", 1, 2).Build() },
+			expected: `SELECT * FROM "users" WHERE "status" = ANY($1)`,
+			vars:     []any{pgArray{1, 2}},
+		},
+		{
+			name:     "any nin as all",
+			build:    func(b *GormQueryBuilder) any { return b.AnyNin("tag", "a", `b"c`).Build() },
+			expected: `SELECT * FROM "users" WHERE "tag" <> ALL($1)`,
+			vars:     []any{pgArray{"a", `b"c`}},
+		},
+		{
+			name:     "json contains",
+			build:    func(b *GormQueryBuilder) any { return b.JsonContains("attrs", map[string]any{"vip": true}).Build() },
+			expected: `SELECT * FROM "users" WHERE "attrs" @> $1::jsonb`,
+			vars:     []any{`{"vip":true}`},
+		},
+		{
+			name:     "json has key",
+			build:    func(b *GormQueryBuilder) any { return b.JsonHasKey("attrs", "vip").Build() },
+			expected: `SELECT * FROM "users" WHERE "attrs" ? $1`,
+			vars:     []any{"vip"},
+		},
+		{
+			name:     "full text",
+			build:    func(b *GormQueryBuilder) any { return b.Search("title", "hello world").Build() },
+			expected: `SELECT * FROM "users" WHERE to_tsvector("title") @@ plainto_tsquery($1)`,
+			vars:     []any{"hello world"},
+		},
+		{
+			name: "full text with config",
+			build: func(b *GormQueryBuilder) any {
+				return b.WithTextSearchConfig("english").Search("title", "hello").Build()
+			},
+			expected: `SELECT * FROM "users" WHERE to_tsvector($1::regconfig, "title") @@ plainto_tsquery($2::regconfig, $3)`,
+			vars:     []any{"english", "english", "hello"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, vars := buildPostgresSQL(t, tt.build(NewPostgresQueryBuilder()))
+			if sql != tt.expected {
+				t.Errorf("expected sql %q, got %q", tt.expected, sql)
+			}
+			if !reflect.DeepEqual(tt.vars, vars) {
+				t.Errorf("expected vars %v, got %v", tt.vars, vars)
+			}
+		})
+	}
+}
+
+func TestGormQueryBuilder_MysqlDialectOps(t *testing.T) {
+	result := NewGormQueryBuilder().Like("name", "Tom", MatchContains).Build()
+	if _, ok := result.(clause.Like); !ok {
+		t.Errorf("expected clause.Like, got %T", result)
+	}
+
+	result = NewGormQueryBuilder().AnyIn("status", 1, 2).Build()
+	if expr, ok := result.(clause.IN); !ok || len(expr.Values) != 2 {
+		t.Errorf("expected clause.IN, got %#v", result)
+	}
+
+	result = NewGormQueryBuilder().JsonHasKey("attrs", "vip").Build()
+	if expr, ok := result.(JsonHasKey); !ok || expr.Dialect != DialectMySQL || expr.Key != "vip" {
+		t.Errorf("expected mysql JsonHasKey, got %#v", result)
+	}
+
+	result = NewGormQueryBuilder().Search("title", "hello").Build()
+	if expr, ok := result.(FullText); !ok || expr.Dialect != DialectMySQL || expr.Query != "hello" {
+		t.Errorf("expected mysql FullText, got %#v", result)
+	}
+}
+
+func TestPgArray_Value(t *testing.T) {
+	v, err := pgArray{1, "a\\b", nil, true, []byte{0xde, 0xad}}.Value()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v != `{1,"a\\b",NULL,true,"\\xdead"}` {
+		t.Errorf("unexpected array literal %v", v)
+	}
+}
@@ -30,6 +30,7 @@ var mongoOpMap = map[Op]string{
 type MongoQueryBuilder struct {
 	conditions *QueryConditions
 	idField    string
+	coercers   map[string]CoerceFunc
 }
 
 // NewMongoQueryBuilder 创建 MongoDB 查询构建器
@@ -40,6 +41,28 @@ func NewMongoQueryBuilder() *MongoQueryBuilder {
 	}
 }
 
+// Coerce 设置字段转换函数，优先于全局注册的转换函数，fn 为 nil 时禁用该字段的转换
+func (b *MongoQueryBuilder) Coerce(field string, fn CoerceFunc) *MongoQueryBuilder {
+	if b.coercers == nil {
+		b.coercers = make(map[string]CoerceFunc)
+	}
+	b.coercers[field] = fn
+	return b
+}
+
+// WithObjectId 将 ID 字段的 hex 字符串转换为 bson.ObjectID，用于 _id 为 ObjectID 的集合
+func (b *MongoQueryBuilder) WithObjectId() *MongoQueryBuilder {
+	return b.Coerce(b.idField, CoerceObjectID)
+}
+
+// WithSchema 按 schema 设置字段转换函数
+func (b *MongoQueryBuilder) WithSchema(schema Schema) *MongoQueryBuilder {
+	for field, typ := range schema {
+		b.Coerce(field, typ.Coercer())
+	}
+	return b
+}
+
 // Id 设置 ID 条件
 func (b *MongoQueryBuilder) Id(id any) QBuilder {
 	b.conditions.AddCondition(b.idField, OpEq, id)
@@ -135,6 +158,7 @@ func (b *MongoQueryBuilder) Build() any {
 
 	// 处理字段条件
 	for field, conditions := range b.conditions.Fields {
+		conditions = b.coerceConditions(field, conditions)
 		if len(conditions) == 1 {
 			cond := conditions[0]
 			if cond.Op == OpEq {
@@ -189,6 +213,36 @@ func (b *MongoQueryBuilder) Build() any {
 	return result
 }
 
+// coerceConditions 对字段条件的值应用转换函数，In/Nin 逐个元素转换
+func (b *MongoQueryBuilder) coerceConditions(field string, conditions []Condition) []Condition {
+	fn, ok := b.coercers[field]
+	if !ok {
+		fn = lookupCoercer(field)
+	}
+	if fn == nil {
+		return conditions
+	}
+
+	coerced := make([]Condition, len(conditions))
+	for i, cond := range conditions {
+		switch cond.Op {
+		case OpLike:
+		case OpIn, OpNin:
+			if values, ok := cond.Value.([]any); ok {
+				converted := make([]any, len(values))
+				for j, v := range values {
+					converted[j] = fn(v)
+				}
+				cond.Value = converted
+			}
+		default:
+			cond.Value = fn(cond.Value)
+		}
+		coerced[i] = cond
+	}
+	return coerced
+}
+
 // convertCondition 转换条件为 bson.M
 func (b *MongoQueryBuilder) convertCondition(cond any) any {
 	switch v := cond.(type) {
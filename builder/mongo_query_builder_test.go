@@ -1,7 +1,9 @@
 package builder
 
 import (
+	"reflect"
 	"testing"
+	"time"
 
 	"go.mongodb.org/mongo-driver/v2/bson"
 )
@@ -695,3 +697,98 @@ func TestMongoQueryBuilder_Like_WithOtherConditions(t *testing.T) {
 		}
 	}
 }
+
+func TestMongoQueryBuilder_CoerceId(t *testing.T) {
+	hex := "0102030405060708090a0b0c"
+	oid, _ := bson.ObjectIDFromHex(hex)
+
+	tests := []struct {
+		name     string
+		build    func(b *MongoQueryBuilder) any
+		expected bson.M
+	}{
+		{
+			name:     "hex string id",
+			build:    func(b *MongoQueryBuilder) any { return b.WithObjectId().Id(hex).Build() },
+			expected: bson.M{"_id": oid},
+		},
+		{
+			name:     "not coerced by default",
+			build:    func(b *MongoQueryBuilder) any { return b.Id(hex).Build() },
+			expected: bson.M{"_id": hex},
+		},
+		{
+			name:     "non hex string id",
+			build:    func(b *MongoQueryBuilder) any { return b.WithObjectId().Id("123").Build() },
+			expected: bson.M{"_id": "123"},
+		},
+		{
+			name:     "in ids",
+			build:    func(b *MongoQueryBuilder) any { return b.WithObjectId().In("_id", hex, "abc").Build() },
+			expected: bson.M{"_id": bson.M{"$in": []any{oid, "abc"}}},
+		},
+		{
+			name:     "nin ids",
+			build:    func(b *MongoQueryBuilder) any { return b.WithObjectId().Nin("_id", hex).Build() },
+			expected: bson.M{"_id": bson.M{"$nin": []any{oid}}},
+		},
+		{
+			name:     "disabled",
+			build:    func(b *MongoQueryBuilder) any { return b.WithObjectId().Coerce("_id", nil).Id(hex).Build() },
+			expected: bson.M{"_id": hex},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := tt.build(NewMongoQueryBuilder())
+			if !reflect.DeepEqual(tt.expected, result) {
+				t.Errorf("expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestMongoQueryBuilder_CoerceSchema(t *testing.T) {
+	ts := "2024-01-02T03:04:05Z"
+	tm, _ := time.Parse(time.RFC3339, ts)
+
+	b := NewMongoQueryBuilder().WithSchema(Schema{
+		"created_at": FieldTime,
+		"age":        FieldInt,
+		"score":      FieldFloat,
+	})
+	result := b.
+		Gte("created_at", ts).
+		In("age", "18", "20").
+		Lt("score", "9.5").
+		Like("name", "18", MatchContains).
+		Build()
+
+	expected := bson.M{
+		"created_at": bson.M{"$gte": tm},
+		"age":        bson.M{"$in": []any{int64(18), int64(20)}},
+		"score":      bson.M{"$lt": 9.5},
+		"name":       bson.M{"$regex": "18", "$options": "i"},
+	}
+	if !reflect.DeepEqual(expected, result) {
+		t.Errorf("expected %v, got %v", expected, result)
+	}
+}
+
+func TestMongoQueryBuilder_RegisterSchema(t *testing.T) {
+	RegisterSchema(Schema{"user_id": FieldObjectID, "level": FieldInt})
+	defer func() {
+		RegisterCoercer("user_id", nil)
+		RegisterCoercer("level", nil)
+	}()
+
+	hex := "0102030405060708090a0b0c"
+	oid, _ := bson.ObjectIDFromHex(hex)
+
+	result := NewMongoQueryBuilder().Eq("user_id", hex).Eq("level", "abc").Build()
+	expected := bson.M{"user_id": oid, "level": "abc"}
+	if !reflect.DeepEqual(expected, result) {
+		t.Errorf("expected %v, got %v", expected, result)
+	}
+}
@@ -28,6 +28,7 @@ type BuilderType int
 const (
 	BuilderTypeMongo BuilderType = iota
 	BuilderTypeGorm
+	BuilderTypePostgres
 )
 
 var (
@@ -44,6 +45,8 @@ func NewQueryBuilder() QBuilder {
 	switch defaultBuilderType {
 	case BuilderTypeGorm:
 		return NewGormQueryBuilder()
+	case BuilderTypePostgres:
+		return NewPostgresQueryBuilder()
 	default:
 		return NewMongoQueryBuilder()
 	}
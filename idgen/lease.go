@@ -0,0 +1,173 @@
+package idgen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/mbeoliero/kit/log"
+	"github.com/mbeoliero/kit/redisx"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultLeasePrefix = "idgen:worker"
+	defaultLeaseTTL    = 30 * time.Second
+)
+
+var ErrNoWorkerId = errors.New("no worker id available")
+
+// LeaseOptions workerId 租约配置
+type LeaseOptions struct {
+	Prefix        string        // key 前缀，不同业务使用不同前缀时 workerId 互不影响，默认 idgen:worker，key 为 <prefix>:<workerId>
+	MaxWorkerId   int64         // 可分配的最大 workerId，默认 1023
+	TTL           time.Duration // 租约有效期，默认 30s
+	RenewInterval time.Duration // 续约间隔，默认为 TTL 的 1/3
+}
+
+// WorkerLease 从 redis 租用的 workerId，后台定期续约
+// 续约时发现 key 已被其他实例持有，或超过 TTL 没有续约成功时租约失效，此时不能再使用该 workerId
+type WorkerLease struct {
+	cli   redis.UniversalClient
+	key   string
+	id    int64
+	token string
+	ttl   time.Duration
+
+	mu      sync.Mutex
+	expires time.Time
+	lost    bool
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// LeaseWorkerId 从 redis 租用一个未被占用的 workerId 并开始自动续约，使用完毕后调用 Release 释放
+// 从随机位置开始依次尝试 SET NX，所有 workerId 均被占用时返回 ErrNoWorkerId
+func LeaseWorkerId(ctx context.Context, cli redis.UniversalClient, opts LeaseOptions) (*WorkerLease, error) {
+	if opts.Prefix == "" {
+		opts.Prefix = defaultLeasePrefix
+	}
+	if opts.MaxWorkerId <= 0 {
+		opts.MaxWorkerId = MaxWorkerId(defaultWorkerBits)
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = defaultLeaseTTL
+	}
+	if opts.RenewInterval <= 0 || opts.RenewInterval >= opts.TTL {
+		opts.RenewInterval = opts.TTL / 3
+	}
+
+	token := redisx.OwnerToken()
+	n := opts.MaxWorkerId + 1
+	start := rand.Int64N(n)
+	for i := range n {
+		id := (start + i) % n
+		key := fmt.Sprintf("%s:%d", opts.Prefix, id)
+		now := time.Now()
+		ok, err := redisx.SetNXByClient(ctx, cli, key, token, opts.TTL)
+		if err != nil {
+			return nil, fmt.Errorf("idgen: lease worker id: %w", err)
+		}
+		if !ok {
+			continue
+		}
+		l := &WorkerLease{
+			cli:     cli,
+			key:     key,
+			id:      id,
+			token:   token,
+			ttl:     opts.TTL,
+			expires: now.Add(opts.TTL),
+			stop:    make(chan struct{}),
+			done:    make(chan struct{}),
+		}
+		go l.keepAlive(opts.RenewInterval)
+		return l, nil
+	}
+	return nil, ErrNoWorkerId
+}
+
+// NewLeasedSnowflake 租用 workerId 并创建雪花算法生成器，租约失效后 Next 返回 ErrLeaseLost
+// 租约的 MaxWorkerId 由 SnowflakeOptions.WorkerBits 决定，关闭生成器时释放租约
+func NewLeasedSnowflake(ctx context.Context, cli redis.UniversalClient, lease LeaseOptions, opts SnowflakeOptions) (*Snowflake, error) {
+	lease.MaxWorkerId = MaxWorkerId(opts.WorkerBits)
+	l, err := LeaseWorkerId(ctx, cli, lease)
+	if err != nil {
+		return nil, err
+	}
+	s, err := NewSnowflake(l.Id(), opts)
+	if err != nil {
+		_ = l.Release(ctx)
+		return nil, err
+	}
+	s.lease = l
+	return s, nil
+}
+
+// Id 返回租用的 workerId
+func (l *WorkerLease) Id() int64 {
+	return l.id
+}
+
+// Valid 判断租约是否仍然有效
+func (l *WorkerLease) Valid() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return !l.lost && time.Now().Before(l.expires)
+}
+
+// Release 停止续约并释放 workerId，只释放仍由自己持有的 key
+func (l *WorkerLease) Release(ctx context.Context) error {
+	l.once.Do(func() { close(l.stop) })
+	<-l.done
+
+	l.mu.Lock()
+	l.lost = true
+	l.mu.Unlock()
+	_, err := redisx.DelIfEqualByClient(ctx, l.cli, l.key, l.token)
+	return err
+}
+
+// keepAlive 定期续约直到 Release
+func (l *WorkerLease) keepAlive(interval time.Duration) {
+	defer close(l.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			if !l.renew() {
+				return
+			}
+		}
+	}
+}
+
+// renew 续约一次，租约被其他实例持有时标记失效并返回 false；网络错误时保留租约等待下次续约
+func (l *WorkerLease) renew() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), l.ttl/3)
+	defer cancel()
+	now := time.Now()
+	ok, err := redisx.ExpireIfEqualByClient(ctx, l.cli, l.key, l.token, l.ttl)
+	if err != nil {
+		log.Warn("idgen: renew worker id %d failed: %v", l.id, err)
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !ok {
+		l.lost = true
+		log.Error("idgen: worker id %d lease lost", l.id)
+		return false
+	}
+	l.expires = now.Add(l.ttl)
+	return true
+}
@@ -0,0 +1,69 @@
+package idgen
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLeaseWorkerId(t *testing.T) {
+	mr := miniredis.RunT(t)
+	cli := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	ctx := context.Background()
+	opts := LeaseOptions{Prefix: "svc", MaxWorkerId: 2, TTL: time.Minute}
+
+	// 所有 workerId 被占用后返回 ErrNoWorkerId
+	ids := make(map[int64]*WorkerLease)
+	for range 3 {
+		l, err := LeaseWorkerId(ctx, cli, opts)
+		require.NoError(t, err)
+		ids[l.Id()] = l
+		assert.True(t, mr.Exists("svc:"+strconv.FormatInt(l.Id(), 10)))
+	}
+	assert.Len(t, ids, 3)
+	_, err := LeaseWorkerId(ctx, cli, opts)
+	assert.ErrorIs(t, err, ErrNoWorkerId)
+
+	// 释放后可以重新租用
+	require.NoError(t, ids[1].Release(ctx))
+	assert.False(t, ids[1].Valid())
+	assert.False(t, mr.Exists("svc:1"))
+	l, err := LeaseWorkerId(ctx, cli, opts)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), l.Id())
+}
+
+func TestWorkerLease_Renew(t *testing.T) {
+	mr := miniredis.RunT(t)
+	cli := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	ctx := context.Background()
+
+	s, err := NewLeasedSnowflake(ctx, cli, LeaseOptions{MaxWorkerId: 1, TTL: time.Second, RenewInterval: 20 * time.Millisecond}, SnowflakeOptions{WorkerBits: 1})
+	require.NoError(t, err)
+	key := "idgen:worker:" + strconv.FormatInt(s.WorkerId(), 10)
+
+	// 续约刷新 TTL
+	mr.SetTTL(key, 10*time.Millisecond)
+	time.Sleep(60 * time.Millisecond)
+	assert.Greater(t, mr.TTL(key), 500*time.Millisecond)
+	_, err = s.Next()
+	require.NoError(t, err)
+
+	// key 被其他实例持有时租约失效
+	require.NoError(t, mr.Set(key, "other"))
+	assert.Eventually(t, func() bool { return !s.lease.Valid() }, time.Second, 10*time.Millisecond)
+	_, err = s.Next()
+	assert.ErrorIs(t, err, ErrLeaseLost)
+
+	// 关闭时不删除其他实例的 key
+	require.NoError(t, s.Close(ctx))
+	got, err := mr.Get(key)
+	require.NoError(t, err)
+	assert.Equal(t, "other", got)
+}
@@ -0,0 +1,155 @@
+package idgen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	defaultWorkerBits   = 10
+	defaultSequenceBits = 12
+	defaultMaxBackward  = 10 * time.Millisecond
+)
+
+var (
+	ErrClockRollback = errors.New("clock moved backwards")
+	ErrLeaseLost     = errors.New("worker id lease lost")
+)
+
+// DefaultEpoch 默认的起始时间 2020-01-01 UTC
+var DefaultEpoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// SnowflakeOptions 雪花算法配置，零值使用默认配置：
+// 起始时间 DefaultEpoch、10 位 workerId、12 位序列号，其余位为毫秒时间戳，可使用约 69 年
+type SnowflakeOptions struct {
+	Epoch        time.Time     // 时间戳的起始时间，上线后不能修改
+	WorkerBits   int           // workerId 的位数，默认 10
+	SequenceBits int           // 每毫秒序列号的位数，默认 12
+	MaxBackward  time.Duration // 时钟回拨不超过该值时等待时钟追上，超过时返回 ErrClockRollback，默认 10ms，小于 0 时不等待
+}
+
+// Snowflake 64 位有序整数 ID 生成器，并发安全
+// ID 由符号位 0、毫秒时间戳、workerId 和序列号组成，同一 workerId 生成的 ID 严格递增
+type Snowflake struct {
+	mu        sync.Mutex
+	epoch     int64
+	worker    int64
+	workerBit int
+	seqBits   int
+	maxSeq    int64
+	backward  time.Duration
+	now       func() time.Time
+	lease     *WorkerLease
+
+	ms  int64
+	seq int64
+}
+
+// NewSnowflake 创建雪花算法生成器，多实例部署时每个实例的 workerId 必须不同，可以通过 LeaseWorkerId 分配
+func NewSnowflake(workerId int64, opts SnowflakeOptions) (*Snowflake, error) {
+	if opts.Epoch.IsZero() {
+		opts.Epoch = DefaultEpoch
+	}
+	if opts.WorkerBits == 0 {
+		opts.WorkerBits = defaultWorkerBits
+	}
+	if opts.SequenceBits == 0 {
+		opts.SequenceBits = defaultSequenceBits
+	}
+	if opts.MaxBackward == 0 {
+		opts.MaxBackward = defaultMaxBackward
+	}
+	if opts.WorkerBits < 0 || opts.SequenceBits <= 0 || opts.WorkerBits+opts.SequenceBits > 22 {
+		return nil, fmt.Errorf("idgen: worker bits %d and sequence bits %d leave too few bits for the timestamp", opts.WorkerBits, opts.SequenceBits)
+	}
+	if maxWorker := MaxWorkerId(opts.WorkerBits); workerId < 0 || workerId > maxWorker {
+		return nil, fmt.Errorf("idgen: worker id %d out of range [0, %d]", workerId, maxWorker)
+	}
+	if opts.Epoch.After(time.Now()) {
+		return nil, fmt.Errorf("idgen: epoch %s is in the future", opts.Epoch)
+	}
+	return &Snowflake{
+		epoch:     opts.Epoch.UnixMilli(),
+		worker:    workerId,
+		workerBit: opts.WorkerBits,
+		seqBits:   opts.SequenceBits,
+		maxSeq:    1<<opts.SequenceBits - 1,
+		backward:  opts.MaxBackward,
+		now:       time.Now,
+	}, nil
+}
+
+// MaxWorkerId 返回指定位数下的最大 workerId
+func MaxWorkerId(workerBits int) int64 {
+	if workerBits == 0 {
+		workerBits = defaultWorkerBits
+	}
+	return 1<<workerBits - 1
+}
+
+// WorkerId 返回生成器的 workerId
+func (s *Snowflake) WorkerId() int64 {
+	return s.worker
+}
+
+// Next 生成下一个 ID
+// 同一毫秒内序列号用尽时等待下一毫秒；时钟回拨时等待时钟追上或返回 ErrClockRollback；
+// workerId 来自租约且租约已失效时返回 ErrLeaseLost
+func (s *Snowflake) Next() (int64, error) {
+	if s.lease != nil && !s.lease.Valid() {
+		return 0, ErrLeaseLost
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ms := s.now().UnixMilli()
+	if ms < s.ms {
+		if diff := time.Duration(s.ms-ms) * time.Millisecond; diff > s.backward {
+			return 0, fmt.Errorf("%w by %s", ErrClockRollback, diff)
+		}
+		ms = s.waitAfter(s.ms - 1)
+	}
+	if ms == s.ms {
+		s.seq = (s.seq + 1) & s.maxSeq
+		if s.seq == 0 {
+			ms = s.waitAfter(s.ms)
+		}
+	} else {
+		s.seq = 0
+	}
+	s.ms = ms
+	return (ms-s.epoch)<<(s.workerBit+s.seqBits) | s.worker<<s.seqBits | s.seq, nil
+}
+
+// NextId 生成下一个 ID，使 Snowflake 可以作为 repox.IdGenerator 使用
+func (s *Snowflake) NextId(context.Context) (any, error) {
+	return s.Next()
+}
+
+// Decompose 解析 ID 的生成时间、workerId 和序列号
+func (s *Snowflake) Decompose(id int64) (t time.Time, workerId, seq int64) {
+	ms := id>>(s.workerBit+s.seqBits) + s.epoch
+	return time.UnixMilli(ms), id >> s.seqBits & MaxWorkerId(s.workerBit), id & s.maxSeq
+}
+
+// Close 释放 workerId 租约，没有租约时不做任何操作
+func (s *Snowflake) Close(ctx context.Context) error {
+	if s.lease == nil {
+		return nil
+	}
+	return s.lease.Release(ctx)
+}
+
+// waitAfter 等待时钟超过 ms，调用方需持有锁
+func (s *Snowflake) waitAfter(ms int64) int64 {
+	now := s.now().UnixMilli()
+	for now <= ms {
+		time.Sleep(100 * time.Microsecond)
+		now = s.now().UnixMilli()
+	}
+	return now
+}
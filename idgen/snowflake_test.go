@@ -0,0 +1,113 @@
+package idgen
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnowflake_Next(t *testing.T) {
+	s, err := NewSnowflake(7, SnowflakeOptions{})
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	seen := make(map[int64]struct{})
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var last int64
+			for range 5000 {
+				id, err := s.Next()
+				require.NoError(t, err)
+				assert.Greater(t, id, last)
+				last = id
+				mu.Lock()
+				seen[id] = struct{}{}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Len(t, seen, 20000)
+
+	id, err := s.NextId(context.Background())
+	require.NoError(t, err)
+	ts, worker, _ := s.Decompose(id.(int64))
+	assert.Equal(t, int64(7), worker)
+	assert.WithinDuration(t, time.Now(), ts, time.Second)
+}
+
+func TestSnowflake_Options(t *testing.T) {
+	epoch := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s, err := NewSnowflake(3, SnowflakeOptions{Epoch: epoch, WorkerBits: 4, SequenceBits: 6})
+	require.NoError(t, err)
+	now := epoch.Add(1500 * time.Millisecond)
+	s.now = func() time.Time { return now }
+
+	id, err := s.Next()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1500<<10|3<<6), id)
+
+	_, err = NewSnowflake(16, SnowflakeOptions{WorkerBits: 4})
+	assert.Error(t, err)
+	_, err = NewSnowflake(0, SnowflakeOptions{WorkerBits: 12, SequenceBits: 12})
+	assert.Error(t, err)
+	_, err = NewSnowflake(0, SnowflakeOptions{Epoch: time.Now().Add(time.Hour)})
+	assert.Error(t, err)
+}
+
+func TestSnowflake_ClockRollback(t *testing.T) {
+	s, err := NewSnowflake(1, SnowflakeOptions{MaxBackward: 5 * time.Millisecond})
+	require.NoError(t, err)
+	var mu sync.Mutex
+	now := time.Now()
+	s.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	set := func(t time.Time) {
+		mu.Lock()
+		now = t
+		mu.Unlock()
+	}
+
+	first, err := s.Next()
+	require.NoError(t, err)
+
+	// 小幅回拨时等待时钟追上
+	base := now
+	set(base.Add(-3 * time.Millisecond))
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		set(base.Add(time.Millisecond))
+	}()
+	second, err := s.Next()
+	require.NoError(t, err)
+	assert.Greater(t, second, first)
+
+	// 超过 MaxBackward 时返回错误
+	set(base.Add(-time.Second))
+	_, err = s.Next()
+	assert.ErrorIs(t, err, ErrClockRollback)
+}
+
+func TestSnowflake_SequenceExhausted(t *testing.T) {
+	s, err := NewSnowflake(0, SnowflakeOptions{SequenceBits: 2})
+	require.NoError(t, err)
+	var last int64
+	for range 20 {
+		id, err := s.Next()
+		require.NoError(t, err)
+		assert.Greater(t, id, last)
+		_, _, seq := s.Decompose(id)
+		assert.LessOrEqual(t, seq, int64(3))
+		last = id
+	}
+}
@@ -0,0 +1,187 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mbeoliero/kit/log"
+	"github.com/mbeoliero/kit/redisx"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultLockTTL   = 30 * time.Second
+	defaultLockRetry = time.Second
+)
+
+var ErrLockLost = errors.New("migration lock lost")
+
+// Locker 分布式锁，Lock 阻塞直到获取锁或 ctx 结束，返回持有锁期间使用的 ctx 和释放锁的函数
+// 锁丢失（如续期失败）时返回的 ctx 被取消，原因为 ErrLockLost
+type Locker interface {
+	Lock(ctx context.Context) (held context.Context, release func(ctx context.Context) error, err error)
+}
+
+// LockerFunc 函数形式的分布式锁
+type LockerFunc func(ctx context.Context) (context.Context, func(ctx context.Context) error, error)
+
+// Lock 调用函数获取锁
+func (f LockerFunc) Lock(ctx context.Context) (context.Context, func(ctx context.Context) error, error) {
+	return f(ctx)
+}
+
+// NoLock 不加锁，只用于单实例部署或测试
+var NoLock Locker = LockerFunc(func(ctx context.Context) (context.Context, func(context.Context) error, error) {
+	return ctx, func(context.Context) error { return nil }, nil
+})
+
+// RedisLocker 基于 redis SET NX 的分布式锁，持有期间后台定期续期
+type RedisLocker struct {
+	cli   redis.UniversalClient
+	key   string
+	ttl   time.Duration
+	retry time.Duration
+}
+
+// NewRedisLocker 创建 redis 分布式锁，锁的有效期为 30s，持有期间每 10s 续期一次，未获取到锁时每秒重试
+func NewRedisLocker(cli redis.UniversalClient, key string) *RedisLocker {
+	return &RedisLocker{cli: cli, key: key, ttl: defaultLockTTL, retry: defaultLockRetry}
+}
+
+// Lock 获取锁，锁被其他实例持有时等待其释放或过期
+// 续期时发现锁被其他实例持有，或超过有效期没有续期成功时，返回的 ctx 以 ErrLockLost 取消
+func (l *RedisLocker) Lock(ctx context.Context) (context.Context, func(ctx context.Context) error, error) {
+	token := redisx.OwnerToken()
+	for {
+		ok, err := redisx.SetNXByClient(ctx, l.cli, l.key, token, l.ttl)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-time.After(l.retry):
+		}
+	}
+
+	held, cancel := context.WithCancelCause(ctx)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go l.keepAlive(token, cancel, stop, done)
+	var once sync.Once
+	return held, func(ctx context.Context) error {
+		once.Do(func() { close(stop) })
+		<-done
+		cancel(context.Canceled)
+		_, err := redisx.DelIfEqualByClient(ctx, l.cli, l.key, token)
+		return err
+	}, nil
+}
+
+// keepAlive 每 ttl/3 续期一次直到 stop 关闭，锁被其他实例持有或超过有效期没有续期成功时以 ErrLockLost 取消持有锁的 ctx
+func (l *RedisLocker) keepAlive(token string, lost context.CancelCauseFunc, stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+	expires := time.Now().Add(l.ttl)
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			now := time.Now()
+			ctx, cancel := context.WithTimeout(context.Background(), l.ttl/3)
+			ok, err := redisx.ExpireIfEqualByClient(ctx, l.cli, l.key, token, l.ttl)
+			cancel()
+			switch {
+			case err != nil && now.Before(expires):
+				log.Warn("migrate: renew lock %s failed: %v", l.key, err)
+			case err != nil || !ok:
+				log.Error("migrate: lock %s lost", l.key)
+				lost(ErrLockLost)
+				return
+			default:
+				expires = now.Add(l.ttl)
+			}
+		}
+	}
+}
+
+// MySQLLocker 基于 MySQL GET_LOCK 的分布式锁，锁与数据库连接绑定，连接断开时自动释放
+type MySQLLocker struct {
+	db    *gorm.DB
+	name  string
+	check time.Duration
+}
+
+// NewMySQLLocker 创建 MySQL 分布式锁，name 为锁名，持有期间每 10s 检查一次锁是否仍被当前连接持有
+func NewMySQLLocker(db *gorm.DB, name string) *MySQLLocker {
+	return &MySQLLocker{db: db, name: name, check: defaultLockTTL / 3}
+}
+
+// Lock 在独占的连接上执行 GET_LOCK 并一直等待，直到获取锁或 ctx 结束
+// 连接断开导致锁被释放时，返回的 ctx 以 ErrLockLost 取消
+func (l *MySQLLocker) Lock(ctx context.Context) (context.Context, func(ctx context.Context) error, error) {
+	sqlDB, err := l.db.DB()
+	if err != nil {
+		return nil, nil, err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	var got sql.NullInt64
+	if err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, -1)", l.name).Scan(&got); err != nil {
+		_ = conn.Close()
+		return nil, nil, err
+	}
+	if got.Int64 != 1 {
+		_ = conn.Close()
+		return nil, nil, fmt.Errorf("get lock %s failed", l.name)
+	}
+
+	held, cancel := context.WithCancelCause(ctx)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go l.keepAlive(conn, cancel, stop, done)
+	var once sync.Once
+	return held, func(ctx context.Context) error {
+		once.Do(func() { close(stop) })
+		<-done
+		cancel(context.Canceled)
+		defer func() { _ = conn.Close() }()
+		var released sql.NullInt64
+		return conn.QueryRowContext(ctx, "SELECT RELEASE_LOCK(?)", l.name).Scan(&released)
+	}, nil
+}
+
+// keepAlive 定期在持有锁的连接上检查锁是否仍属于该连接直到 stop 关闭，检查失败（连接断开或锁已释放）时以 ErrLockLost 取消持有锁的 ctx
+func (l *MySQLLocker) keepAlive(conn *sql.Conn, lost context.CancelCauseFunc, stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(l.check)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), l.check)
+			var owned sql.NullBool
+			err := conn.QueryRowContext(ctx, "SELECT IS_USED_LOCK(?) = CONNECTION_ID()", l.name).Scan(&owned)
+			cancel()
+			if err != nil || !owned.Bool {
+				log.Error("migrate: lock %s lost: %v", l.name, err)
+				lost(ErrLockLost)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package migrate
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisLocker(t *testing.T) {
+	mr := miniredis.RunT(t)
+	cli := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	ctx := context.Background()
+	a := NewRedisLocker(cli, "migrate:lock")
+	b := NewRedisLocker(cli, "migrate:lock")
+	b.retry = 10 * time.Millisecond
+
+	_, release, err := a.Lock(ctx)
+	require.NoError(t, err)
+	assert.True(t, mr.Exists("migrate:lock"))
+
+	// 锁被持有时等待，ctx 结束后返回
+	wctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, _, err = b.Lock(wctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// 释放后其他实例可以获取
+	acquired := make(chan func(context.Context) error)
+	go func() {
+		_, r, err := b.Lock(ctx)
+		assert.NoError(t, err)
+		acquired <- r
+	}()
+	require.NoError(t, release(ctx))
+	select {
+	case r := <-acquired:
+		require.NoError(t, r(ctx))
+	case <-time.After(time.Second):
+		t.Fatal("lock not acquired after release")
+	}
+	assert.False(t, mr.Exists("migrate:lock"))
+}
+
+func TestRedisLocker_Lost(t *testing.T) {
+	mr := miniredis.RunT(t)
+	cli := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	l := NewRedisLocker(cli, "migrate:lock")
+	l.ttl = 30 * time.Millisecond
+
+	held, release, err := l.Lock(context.Background())
+	require.NoError(t, err)
+	defer func() { _ = release(context.Background()) }()
+
+	// 锁被其他实例持有后，持有锁期间的 ctx 以 ErrLockLost 取消
+	mr.Set("migrate:lock", "other")
+	select {
+	case <-held.Done():
+		assert.ErrorIs(t, context.Cause(held), ErrLockLost)
+	case <-time.After(time.Second):
+		t.Fatal("ctx not cancelled after lock lost")
+	}
+	// 释放时不删除其他实例的锁
+	require.NoError(t, release(context.Background()))
+	got, err := mr.Get("migrate:lock")
+	require.NoError(t, err)
+	assert.Equal(t, "other", got)
+}
+
+func TestMySQLLocker_Lost(t *testing.T) {
+	db, mock := newMockDB(t)
+	l := NewMySQLLocker(db, "migrate:lock")
+	l.check = 10 * time.Millisecond
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT GET_LOCK(?, -1)")).WithArgs("migrate:lock").
+		WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(1))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT IS_USED_LOCK(?) = CONNECTION_ID()")).WithArgs("migrate:lock").
+		WillReturnRows(sqlmock.NewRows([]string{"owned"}).AddRow(1))
+	// 连接断开后锁被释放，IS_USED_LOCK 返回 NULL
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT IS_USED_LOCK(?) = CONNECTION_ID()")).WithArgs("migrate:lock").
+		WillReturnRows(sqlmock.NewRows([]string{"owned"}).AddRow(nil))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT RELEASE_LOCK(?)")).WithArgs("migrate:lock").
+		WillReturnRows(sqlmock.NewRows([]string{"released"}).AddRow(nil))
+
+	held, release, err := l.Lock(context.Background())
+	require.NoError(t, err)
+	select {
+	case <-held.Done():
+		assert.ErrorIs(t, context.Cause(held), ErrLockLost)
+	case <-time.After(time.Second):
+		t.Fatal("ctx not cancelled after lock lost")
+	}
+	require.NoError(t, release(context.Background()))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,245 @@
+// Package migrate 按版本顺序执行数据库迁移，支持 MySQL（GORM）和 MongoDB
+// 已执行的版本记录在表或集合中，执行前获取分布式锁，多个实例同时启动时只有一个实例执行迁移
+package migrate
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/mbeoliero/kit/log"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"gorm.io/gorm"
+)
+
+const defaultTable = "schema_migrations"
+
+var (
+	ErrIrreversible   = errors.New("migration has no down step")
+	ErrUnknownVersion = errors.New("applied version has no migration")
+)
+
+// Func 迁移函数，db 为 *gorm.DB 或 *mongo.Database
+type Func[D any] func(ctx context.Context, db D) error
+
+// Migration 一个版本的迁移，Version 越小越先执行
+type Migration[D any] struct {
+	Version int64
+	Name    string
+	Up      Func[D]
+	Down    Func[D] // 回滚函数，为 nil 时该版本不能回滚
+}
+
+// Status 一个版本的执行状态
+type Status struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	Orphan    bool // 已执行但代码中没有对应的迁移
+}
+
+// String 返回状态的描述，如 "20240101 create_users applied at 2024-01-01T00:00:00Z"
+func (s Status) String() string {
+	switch {
+	case s.Orphan:
+		return fmt.Sprintf("%d %s orphan, applied at %s", s.Version, s.Name, s.AppliedAt.Format(time.RFC3339))
+	case s.Applied:
+		return fmt.Sprintf("%d %s applied at %s", s.Version, s.Name, s.AppliedAt.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("%d %s pending", s.Version, s.Name)
+}
+
+// Options 迁移配置
+type Options struct {
+	Table  string // 记录已执行版本的表或集合，默认 schema_migrations
+	Locker Locker // 分布式锁，GORM 默认使用 MySQL 的 GET_LOCK，MongoDB 必须指定（如 NewRedisLocker）
+}
+
+// Migrator 迁移执行器
+type Migrator[D any] struct {
+	db         D
+	store      Store
+	locker     Locker
+	migrations []Migration[D]
+}
+
+// New 创建迁移执行器，迁移按版本排序，版本必须大于 0 且不能重复
+func New[D any](db D, store Store, locker Locker, migrations ...Migration[D]) (*Migrator[D], error) {
+	sorted := slices.Clone(migrations)
+	slices.SortFunc(sorted, func(a, b Migration[D]) int { return cmp.Compare(a.Version, b.Version) })
+	for i, m := range sorted {
+		if m.Version <= 0 {
+			return nil, fmt.Errorf("migrate: invalid version %d", m.Version)
+		}
+		if m.Up == nil {
+			return nil, fmt.Errorf("migrate: version %d has no up step", m.Version)
+		}
+		if i > 0 && sorted[i-1].Version == m.Version {
+			return nil, fmt.Errorf("migrate: duplicate version %d", m.Version)
+		}
+	}
+	if store == nil || locker == nil {
+		return nil, errors.New("migrate: store and locker are required")
+	}
+	return &Migrator[D]{db: db, store: store, locker: locker, migrations: sorted}, nil
+}
+
+// NewGorm 创建 MySQL 迁移执行器，已执行的版本记录在 Options.Table 表中
+func NewGorm(db *gorm.DB, opts Options, migrations ...Migration[*gorm.DB]) (*Migrator[*gorm.DB], error) {
+	if opts.Table == "" {
+		opts.Table = defaultTable
+	}
+	if opts.Locker == nil {
+		opts.Locker = NewMySQLLocker(db, "migrate:"+opts.Table)
+	}
+	return New(db, NewGormStore(db, opts.Table), opts.Locker, migrations...)
+}
+
+// NewMongo 创建 MongoDB 迁移执行器，已执行的版本记录在 Options.Table 集合中
+func NewMongo(db *mongo.Database, opts Options, migrations ...Migration[*mongo.Database]) (*Migrator[*mongo.Database], error) {
+	if opts.Table == "" {
+		opts.Table = defaultTable
+	}
+	if opts.Locker == nil {
+		return nil, errors.New("migrate: mongo migrations require a locker")
+	}
+	return New(db, NewMongoStore(db.Collection(opts.Table)), opts.Locker, migrations...)
+}
+
+// Up 按版本顺序执行未执行的迁移，steps 为 0 时执行全部，返回本次执行的版本
+// 版本小于已执行版本的迁移（如合并的分支）同样会执行
+func (m *Migrator[D]) Up(ctx context.Context, steps int) ([]int64, error) {
+	var done []int64
+	err := m.locked(ctx, func(ctx context.Context, applied map[int64]Record) error {
+		for _, mig := range m.migrations {
+			if steps > 0 && len(done) >= steps {
+				break
+			}
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+			if ctx.Err() != nil {
+				return context.Cause(ctx)
+			}
+			log.CtxInfo(ctx, "migrate: up %d %s", mig.Version, mig.Name)
+			if err := mig.Up(ctx, m.db); err != nil {
+				return fmt.Errorf("migrate: up %d %s: %w", mig.Version, mig.Name, err)
+			}
+			if err := m.store.Insert(ctx, Record{Version: mig.Version, Name: mig.Name, AppliedAt: time.Now()}); err != nil {
+				return fmt.Errorf("migrate: record %d: %w", mig.Version, err)
+			}
+			done = append(done, mig.Version)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down 从最新的版本开始回滚 steps 个已执行的迁移，返回本次回滚的版本
+// 已执行的版本没有对应的迁移时返回 ErrUnknownVersion，没有回滚函数时返回 ErrIrreversible
+func (m *Migrator[D]) Down(ctx context.Context, steps int) ([]int64, error) {
+	if steps <= 0 {
+		return nil, fmt.Errorf("migrate: invalid down steps %d", steps)
+	}
+	var done []int64
+	err := m.locked(ctx, func(ctx context.Context, applied map[int64]Record) error {
+		versions := make([]int64, 0, len(applied))
+		for v := range applied {
+			versions = append(versions, v)
+		}
+		slices.SortFunc(versions, func(a, b int64) int { return cmp.Compare(b, a) })
+		for _, v := range versions[:min(steps, len(versions))] {
+			if ctx.Err() != nil {
+				return context.Cause(ctx)
+			}
+			i := slices.IndexFunc(m.migrations, func(mig Migration[D]) bool { return mig.Version == v })
+			if i < 0 {
+				return fmt.Errorf("migrate: down %d: %w", v, ErrUnknownVersion)
+			}
+			mig := m.migrations[i]
+			if mig.Down == nil {
+				return fmt.Errorf("migrate: down %d %s: %w", v, mig.Name, ErrIrreversible)
+			}
+			log.CtxInfo(ctx, "migrate: down %d %s", mig.Version, mig.Name)
+			if err := mig.Down(ctx, m.db); err != nil {
+				return fmt.Errorf("migrate: down %d %s: %w", mig.Version, mig.Name, err)
+			}
+			if err := m.store.Delete(ctx, v); err != nil {
+				return fmt.Errorf("migrate: remove record %d: %w", v, err)
+			}
+			done = append(done, v)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Status 返回所有迁移的执行状态，按版本排序，包括已执行但代码中不存在的版本
+func (m *Migrator[D]) Status(ctx context.Context) ([]Status, error) {
+	if err := m.store.Init(ctx); err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		s := Status{Version: mig.Version, Name: mig.Name}
+		if r, ok := applied[mig.Version]; ok {
+			s.Applied, s.AppliedAt = true, r.AppliedAt
+			delete(applied, mig.Version)
+		}
+		statuses = append(statuses, s)
+	}
+	for _, r := range applied {
+		statuses = append(statuses, Status{Version: r.Version, Name: r.Name, Applied: true, AppliedAt: r.AppliedAt, Orphan: true})
+	}
+	slices.SortFunc(statuses, func(a, b Status) int { return cmp.Compare(a.Version, b.Version) })
+	return statuses, nil
+}
+
+// locked 持有锁时读取已执行的版本并执行 fn，fn 使用的 ctx 在锁丢失时被取消
+func (m *Migrator[D]) locked(ctx context.Context, fn func(ctx context.Context, applied map[int64]Record) error) error {
+	if err := m.store.Init(ctx); err != nil {
+		return err
+	}
+	held, release, err := m.locker.Lock(ctx)
+	if err != nil {
+		return fmt.Errorf("migrate: lock: %w", err)
+	}
+	defer func() {
+		// 使用新的 ctx 释放锁，避免 ctx 取消后锁要等到过期才释放
+		rctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+		if rerr := release(rctx); rerr != nil {
+			log.CtxError(ctx, "migrate: release lock: %v", rerr)
+		}
+	}()
+
+	applied, err := m.applied(held)
+	if err == nil {
+		err = fn(held, applied)
+	}
+	if err != nil && errors.Is(context.Cause(held), ErrLockLost) {
+		return fmt.Errorf("migrate: %w: %w", ErrLockLost, err)
+	}
+	return err
+}
+
+// applied 读取已执行的版本
+func (m *Migrator[D]) applied(ctx context.Context) (map[int64]Record, error) {
+	records, err := m.store.Applied(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("migrate: read applied versions: %w", err)
+	}
+	applied := make(map[int64]Record, len(records))
+	for _, r := range records {
+		applied[r.Version] = r
+	}
+	return applied, nil
+}
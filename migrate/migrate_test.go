@@ -0,0 +1,184 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	gormmysql "gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// memStore 内存版本存储
+type memStore struct {
+	records []Record
+}
+
+func (s *memStore) Init(context.Context) error { return nil }
+
+func (s *memStore) Applied(context.Context) ([]Record, error) { return slices.Clone(s.records), nil }
+
+func (s *memStore) Insert(_ context.Context, r Record) error {
+	s.records = append(s.records, r)
+	return nil
+}
+
+func (s *memStore) Delete(_ context.Context, version int64) error {
+	s.records = slices.DeleteFunc(s.records, func(r Record) bool { return r.Version == version })
+	return nil
+}
+
+func TestMigrator(t *testing.T) {
+	ctx := context.Background()
+	var log []string
+	step := func(name string) Func[*[]string] {
+		return func(_ context.Context, db *[]string) error {
+			*db = append(*db, name)
+			return nil
+		}
+	}
+	store := &memStore{records: []Record{{Version: 1, Name: "removed"}}}
+	m, err := New(&log, store, NoLock,
+		Migration[*[]string]{Version: 3, Name: "c", Up: step("up c")},
+		Migration[*[]string]{Version: 2, Name: "b", Up: step("up b"), Down: step("down b")},
+		Migration[*[]string]{Version: 4, Name: "d", Up: step("up d"), Down: step("down d")},
+	)
+	require.NoError(t, err)
+
+	done, err := m.Up(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{2, 3}, done)
+	done, err = m.Up(ctx, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{4}, done)
+
+	statuses, err := m.Status(ctx)
+	require.NoError(t, err)
+	require.Len(t, statuses, 4)
+	assert.True(t, statuses[0].Orphan)
+	assert.True(t, statuses[3].Applied)
+	assert.Contains(t, statuses[1].String(), "2 b applied at")
+
+	// 回滚到没有 down 的版本时停止
+	done, err = m.Down(ctx, 3)
+	assert.ErrorIs(t, err, ErrIrreversible)
+	assert.Equal(t, []int64{4}, done)
+	assert.Equal(t, []string{"up b", "up c", "up d", "down d"}, log)
+
+	_, err = New(&log, store, NoLock, Migration[*[]string]{Version: 1, Up: step("")}, Migration[*[]string]{Version: 1, Up: step("")})
+	assert.Error(t, err)
+}
+
+func TestMigrator_UpFailure(t *testing.T) {
+	ctx := context.Background()
+	store := &memStore{}
+	released := false
+	locker := LockerFunc(func(ctx context.Context) (context.Context, func(context.Context) error, error) {
+		return ctx, func(context.Context) error {
+			released = true
+			return nil
+		}, nil
+	})
+	m, err := New(0, store, locker,
+		Migration[int]{Version: 1, Up: func(context.Context, int) error { return nil }},
+		Migration[int]{Version: 2, Up: func(context.Context, int) error { return assert.AnError }},
+		Migration[int]{Version: 3, Up: func(context.Context, int) error { return nil }},
+	)
+	require.NoError(t, err)
+
+	// 失败的版本不记录，后续版本不执行
+	done, err := m.Up(ctx, 0)
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.Equal(t, []int64{1}, done)
+	assert.Len(t, store.records, 1)
+	assert.True(t, released)
+
+	failing := LockerFunc(func(context.Context) (context.Context, func(context.Context) error, error) {
+		return nil, nil, errors.New("busy")
+	})
+	m, err = New(0, store, failing, Migration[int]{Version: 1, Up: func(context.Context, int) error { return nil }})
+	require.NoError(t, err)
+	_, err = m.Up(ctx, 0)
+	assert.ErrorContains(t, err, "busy")
+}
+
+func TestMigrator_LockLost(t *testing.T) {
+	store := &memStore{}
+	var lost context.CancelCauseFunc
+	locker := LockerFunc(func(ctx context.Context) (context.Context, func(context.Context) error, error) {
+		held, cancel := context.WithCancelCause(ctx)
+		lost = cancel
+		return held, func(context.Context) error { return nil }, nil
+	})
+	m, err := New(0, store, locker,
+		Migration[int]{Version: 1, Up: func(context.Context, int) error {
+			lost(ErrLockLost)
+			return nil
+		}},
+		Migration[int]{Version: 2, Up: func(context.Context, int) error { return nil }},
+	)
+	require.NoError(t, err)
+
+	// 锁丢失后不再执行后续版本
+	done, err := m.Up(context.Background(), 0)
+	assert.ErrorIs(t, err, ErrLockLost)
+	assert.Equal(t, []int64{1}, done)
+}
+
+func newMockDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	t.Helper()
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	db, err := gorm.Open(gormmysql.New(gormmysql.Config{
+		Conn:                      sqlDB,
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{SkipDefaultTransaction: true, Logger: logger.Discard})
+	require.NoError(t, err)
+	return db, mock
+}
+
+func TestNewGorm(t *testing.T) {
+	db, mock := newMockDB(t)
+	ctx := context.Background()
+	m, err := NewGorm(db, Options{}, Migration[*gorm.DB]{
+		Version: 20240101,
+		Name:    "create_users",
+		Up: func(ctx context.Context, db *gorm.DB) error {
+			return db.WithContext(ctx).Exec("CREATE TABLE users (id BIGINT)").Error
+		},
+	})
+	require.NoError(t, err)
+
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS `schema_migrations`")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT GET_LOCK(?, -1)")).WithArgs("migrate:schema_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(1))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `schema_migrations` ORDER BY version")).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "name", "applied_at"}))
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE users (id BIGINT)")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `schema_migrations` (`version`,`name`,`applied_at`) VALUES (?,?,?)")).
+		WithArgs(20240101, "create_users", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT RELEASE_LOCK(?)")).WithArgs("migrate:schema_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"released"}).AddRow(1))
+
+	done, err := m.Up(ctx, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{20240101}, done)
+
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT").
+		WillReturnRows(sqlmock.NewRows([]string{"version", "name", "applied_at"}).AddRow(20240101, "create_users", time.Now()))
+	statuses, err := m.Status(ctx)
+	require.NoError(t, err)
+	assert.True(t, statuses[0].Applied)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,142 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// SQLFiles 读取 fsys 中 dir 目录下的 SQL 迁移文件，通常配合 embed.FS 使用
+// 文件名格式为 <version>_<name>.up.sql 和 <version>_<name>.down.sql，down 文件可以省略；
+// 文件中的多条语句以分号分隔，逐条执行
+func SQLFiles(fsys fs.FS, dir string) ([]Migration[*gorm.DB], error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int64]*Migration[*gorm.DB])
+	var migrations []Migration[*gorm.DB]
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".sql") {
+			continue
+		}
+		base := strings.TrimSuffix(e.Name(), ".sql")
+		base, direction, ok := cutLast(base, ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("migrate: sql file %s must end with .up.sql or .down.sql", e.Name())
+		}
+		v, name, _ := strings.Cut(base, "_")
+		version, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migrate: invalid version of sql file %s: %w", e.Name(), err)
+		}
+		content, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration[*gorm.DB]{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		fn := execSQL(string(content))
+		if direction == "up" {
+			m.Up = fn
+		} else {
+			m.Down = fn
+		}
+	}
+	for _, m := range byVersion {
+		if m.Up == nil {
+			return nil, fmt.Errorf("migrate: version %d has no up sql file", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	return migrations, nil
+}
+
+// execSQL 返回逐条执行 SQL 语句的迁移函数
+func execSQL(content string) Func[*gorm.DB] {
+	stmts := splitSQL(content)
+	return func(ctx context.Context, db *gorm.DB) error {
+		for _, stmt := range stmts {
+			if err := db.WithContext(ctx).Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// splitSQL 按分号拆分 SQL 语句，忽略引号和注释中的分号，去掉只有注释的语句
+func splitSQL(content string) []string {
+	var (
+		stmts []string
+		cur   strings.Builder
+		quote byte
+		code  bool // 当前语句是否包含注释以外的内容
+	)
+	flush := func() {
+		if s := strings.TrimSpace(cur.String()); s != "" && code {
+			stmts = append(stmts, s)
+		}
+		cur.Reset()
+		code = false
+	}
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		switch {
+		case quote != 0:
+			cur.WriteByte(c)
+			if c == '\\' && quote != '`' && i+1 < len(content) {
+				i++
+				cur.WriteByte(content[i])
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+			code = true
+			cur.WriteByte(c)
+		case c == '-' && strings.HasPrefix(content[i:], "--"), c == '#':
+			end := strings.IndexByte(content[i:], '\n')
+			if end < 0 {
+				end = len(content) - i
+			}
+			cur.WriteString(content[i : i+end])
+			i += end - 1
+		case c == '/' && strings.HasPrefix(content[i:], "/*"):
+			end := strings.Index(content[i+2:], "*/")
+			if end < 0 {
+				end = len(content) - i - 2
+			} else {
+				end += 2
+			}
+			cur.WriteString(content[i : i+2+end])
+			i += 1 + end
+		case c == ';':
+			flush()
+		default:
+			if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+				code = true
+			}
+			cur.WriteByte(c)
+		}
+	}
+	flush()
+	return stmts
+}
+
+// cutLast 按最后一个 sep 拆分字符串
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
@@ -0,0 +1,56 @@
+package migrate
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"testing/fstest"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitSQL(t *testing.T) {
+	stmts := splitSQL(`
+-- create table; with comment
+CREATE TABLE t (a VARCHAR(10) DEFAULT ';');
+/* block; comment */
+INSERT INTO t VALUES ('it\'s;'), ("x;y");
+# trailing comment only;
+`)
+	assert.Equal(t, []string{
+		"-- create table; with comment\nCREATE TABLE t (a VARCHAR(10) DEFAULT ';')",
+		"/* block; comment */\nINSERT INTO t VALUES ('it\\'s;'), (\"x;y\")",
+	}, stmts)
+}
+
+func TestSQLFiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"sql/20240101_create_users.up.sql":   {Data: []byte("CREATE TABLE users (id BIGINT);\nCREATE INDEX idx_id ON users (id);")},
+		"sql/20240101_create_users.down.sql": {Data: []byte("DROP TABLE users;")},
+		"sql/20240102_seed.up.sql":           {Data: []byte("INSERT INTO users VALUES (1)")},
+		"sql/README.md":                      {Data: []byte("ignored")},
+	}
+	migrations, err := SQLFiles(fsys, "sql")
+	require.NoError(t, err)
+	require.Len(t, migrations, 2)
+
+	db, mock := newMockDB(t)
+	m, err := New(db, &memStore{}, NoLock, migrations...)
+	require.NoError(t, err)
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE users (id BIGINT)")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("CREATE INDEX idx_id ON users (id)")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO users VALUES (1)")).WillReturnResult(sqlmock.NewResult(0, 1))
+	done, err := m.Up(context.Background(), 0)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{20240101, 20240102}, done)
+
+	// 20240102 没有 down 文件
+	_, err = m.Down(context.Background(), 1)
+	assert.ErrorIs(t, err, ErrIrreversible)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	_, err = SQLFiles(fstest.MapFS{"sql/1_a.sql": {Data: []byte("")}}, "sql")
+	assert.Error(t, err)
+}
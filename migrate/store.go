@@ -0,0 +1,102 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+// Record 已执行的版本
+type Record struct {
+	Version   int64     `gorm:"column:version;primaryKey;autoIncrement:false" bson:"_id"`
+	Name      string    `gorm:"column:name" bson:"name"`
+	AppliedAt time.Time `gorm:"column:applied_at" bson:"applied_at"`
+}
+
+// Store 已执行版本的存储
+type Store interface {
+	// Init 创建存储所需的表，已存在时不做任何操作
+	Init(ctx context.Context) error
+	// Applied 返回所有已执行的版本
+	Applied(ctx context.Context) ([]Record, error)
+	Insert(ctx context.Context, r Record) error
+	Delete(ctx context.Context, version int64) error
+}
+
+// GormStore 基于 MySQL 表的版本存储
+type GormStore struct {
+	db    *gorm.DB
+	table string
+}
+
+// NewGormStore 创建 MySQL 版本存储
+func NewGormStore(db *gorm.DB, table string) *GormStore {
+	return &GormStore{db: db, table: table}
+}
+
+// Init 通过 CREATE TABLE IF NOT EXISTS 创建记录表
+func (s *GormStore) Init(ctx context.Context) error {
+	db := s.db.WithContext(ctx).Clauses(dbresolver.Write)
+	return db.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s ("+
+		"`version` BIGINT NOT NULL PRIMARY KEY, "+
+		"`name` VARCHAR(255) NOT NULL DEFAULT '', "+
+		"`applied_at` DATETIME(3) NOT NULL)", db.Statement.Quote(s.table))).Error
+}
+
+// Applied 按版本顺序返回已执行的版本
+func (s *GormStore) Applied(ctx context.Context) ([]Record, error) {
+	var records []Record
+	// 从主库读取，避免从库延迟导致重复执行已执行的版本
+	err := s.db.WithContext(ctx).Clauses(dbresolver.Write).Table(s.table).Order("version").Find(&records).Error
+	return records, err
+}
+
+func (s *GormStore) Insert(ctx context.Context, r Record) error {
+	return s.db.WithContext(ctx).Clauses(dbresolver.Write).Table(s.table).Create(&r).Error
+}
+
+func (s *GormStore) Delete(ctx context.Context, version int64) error {
+	return s.db.WithContext(ctx).Clauses(dbresolver.Write).Table(s.table).Where("version = ?", version).Delete(&Record{}).Error
+}
+
+// MongoStore 基于 MongoDB 集合的版本存储，版本号作为 _id
+type MongoStore struct {
+	coll *mongo.Collection
+}
+
+// NewMongoStore 创建 MongoDB 版本存储
+func NewMongoStore(coll *mongo.Collection) *MongoStore {
+	return &MongoStore{coll: coll}
+}
+
+// Init 集合在第一次写入时自动创建
+func (s *MongoStore) Init(context.Context) error {
+	return nil
+}
+
+// Applied 按版本顺序返回已执行的版本
+func (s *MongoStore) Applied(ctx context.Context) ([]Record, error) {
+	cursor, err := s.coll.Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	var records []Record
+	err = cursor.All(ctx, &records)
+	return records, err
+}
+
+func (s *MongoStore) Insert(ctx context.Context, r Record) error {
+	_, err := s.coll.InsertOne(ctx, r)
+	return err
+}
+
+func (s *MongoStore) Delete(ctx context.Context, version int64) error {
+	_, err := s.coll.DeleteOne(ctx, bson.D{{Key: "_id", Value: version}})
+	return err
+}
@@ -0,0 +1,65 @@
+package redisx
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mbeoliero/kit/utils/typex"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	expireIfEqualScript = redis.NewScript(`
+    if redis.call("GET", KEYS[1]) == ARGV[1] then
+        return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+    end
+    return 0
+`)
+	delIfEqualScript = redis.NewScript(`
+    if redis.call("GET", KEYS[1]) == ARGV[1] then
+        return redis.call("DEL", KEYS[1])
+    end
+    return 0
+`)
+)
+
+// SetNX key 不存在时写入，返回是否写入成功
+func SetNX[T any](ctx context.Context, key string, value T, expire time.Duration) (bool, error) {
+	return SetNXByClient[T](ctx, GlobalClient, key, value, expire)
+}
+
+// ExpireIfEqual key 的值等于 value 时重新设置过期时间，返回是否设置成功
+func ExpireIfEqual[T any](ctx context.Context, key string, value T, expire time.Duration) (bool, error) {
+	return ExpireIfEqualByClient[T](ctx, GlobalClient, key, value, expire)
+}
+
+// DelIfEqual key 的值等于 value 时删除，返回是否删除成功
+func DelIfEqual[T any](ctx context.Context, key string, value T) (bool, error) {
+	return DelIfEqualByClient[T](ctx, GlobalClient, key, value)
+}
+
+func SetNXByClient[T any](ctx context.Context, cli redis.UniversalClient, key string, value T, expire time.Duration) (bool, error) {
+	return cli.SetNX(ctx, key, typex.ToString(value), expire).Result()
+}
+
+func ExpireIfEqualByClient[T any](ctx context.Context, cli redis.UniversalClient, key string, value T, expire time.Duration) (bool, error) {
+	n, err := expireIfEqualScript.Run(ctx, cli, []string{key}, typex.ToString(value), expire.Milliseconds()).Int64()
+	return n == 1, err
+}
+
+func DelIfEqualByClient[T any](ctx context.Context, cli redis.UniversalClient, key string, value T) (bool, error) {
+	n, err := delIfEqualScript.Run(ctx, cli, []string{key}, typex.ToString(value)).Int64()
+	return n == 1, err
+}
+
+// OwnerToken 生成锁或租约持有者标识，由主机名、进程号和随机数组成，用于 SetNX、ExpireIfEqual 和 DelIfEqual
+func OwnerToken() string {
+	host, _ := os.Hostname()
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(b))
+}
@@ -17,8 +17,13 @@ func Set[T any](ctx context.Context, key string, value T, expire time.Duration)
 	return SetByClient[T](ctx, GlobalClient, key, value, expire)
 }
 
-func Del(ctx context.Context, key string) error {
-	return DelByClient(ctx, GlobalClient, key)
+// GetExist 与 Get 相同，额外返回 key 是否存在
+func GetExist[T any](ctx context.Context, key string) (T, bool, error) {
+	return GetExistByClient[T](ctx, GlobalClient, key)
+}
+
+func Del(ctx context.Context, keys ...string) error {
+	return DelByClient(ctx, GlobalClient, keys...)
 }
 
 func GetByClient[T any](ctx context.Context, cli redis.UniversalClient, key string) (T, error) {
@@ -34,10 +39,28 @@ func GetByClient[T any](ctx context.Context, cli redis.UniversalClient, key stri
 	return typex.ToAnyE[T](resStr)
 }
 
+// GetExistByClient 与 GetByClient 相同，额外返回 key 是否存在，用于区分 key 不存在和值为零值
+func GetExistByClient[T any](ctx context.Context, cli redis.UniversalClient, key string) (T, bool, error) {
+	var res T
+	resStr, err := cli.Get(ctx, key).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return res, false, nil
+		}
+		return res, false, err
+	}
+
+	res, err = typex.ToAnyE[T](resStr)
+	return res, true, err
+}
+
 func SetByClient[T any](ctx context.Context, cli redis.UniversalClient, key string, value T, expire time.Duration) error {
 	return cli.Set(ctx, key, typex.ToString(value), expire).Err()
 }
 
-func DelByClient(ctx context.Context, cli redis.UniversalClient, key string) error {
-	return cli.Del(ctx, key).Err()
+func DelByClient(ctx context.Context, cli redis.UniversalClient, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	return cli.Del(ctx, keys...).Err()
 }
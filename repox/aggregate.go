@@ -0,0 +1,189 @@
+package repox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var ErrAggregateUnsupported = errors.New("repository does not support aggregation")
+
+// AccOp 聚合函数
+type AccOp string
+
+const (
+	AccCount AccOp = "count"
+	AccSum   AccOp = "sum"
+	AccAvg   AccOp = "avg"
+	AccMin   AccOp = "min"
+	AccMax   AccOp = "max"
+)
+
+// Accumulator 聚合计算，结果写入结果行的 As 字段
+type Accumulator struct {
+	Op    AccOp
+	Field string // 参与计算的字段，AccCount 不需要
+	As    string // 结果字段名，对应结果类型的 gorm column 或 bson 名
+}
+
+// Count 统计每组的记录数
+func Count(as string) Accumulator {
+	return Accumulator{Op: AccCount, As: as}
+}
+
+// Sum 计算每组字段值的和
+func Sum(field, as string) Accumulator {
+	return Accumulator{Op: AccSum, Field: field, As: as}
+}
+
+// Avg 计算每组字段值的平均值
+func Avg(field, as string) Accumulator {
+	return Accumulator{Op: AccAvg, Field: field, As: as}
+}
+
+// Min 计算每组字段的最小值
+func Min(field, as string) Accumulator {
+	return Accumulator{Op: AccMin, Field: field, As: as}
+}
+
+// Max 计算每组字段的最大值
+func Max(field, as string) Accumulator {
+	return Accumulator{Op: AccMax, Field: field, As: as}
+}
+
+// AggregateOptions 存储聚合配置
+type AggregateOptions struct {
+	GroupBy      []string
+	Accumulators []Accumulator
+	// Sort 结果排序，字段为分组字段或 Accumulator.As
+	Sort  *Sort
+	Limit int64
+	// Deleted 启用软删除时已删除记录的范围，默认排除
+	Deleted DeletedScope
+}
+
+// AggregateOptionsBuilder 链式构建器
+type AggregateOptionsBuilder struct {
+	Opts []func(*AggregateOptions)
+}
+
+// Agg 创建新的构建器
+func Agg() *AggregateOptionsBuilder {
+	return &AggregateOptionsBuilder{}
+}
+
+// List 返回所有配置函数
+func (a *AggregateOptionsBuilder) List() []func(*AggregateOptions) {
+	return a.Opts
+}
+
+func (a *AggregateOptionsBuilder) SetGroupBy(fields ...string) *AggregateOptionsBuilder {
+	a.Opts = append(a.Opts, func(opts *AggregateOptions) {
+		opts.GroupBy = fields
+	})
+	return a
+}
+
+// Add 追加聚合计算
+func (a *AggregateOptionsBuilder) Add(accs ...Accumulator) *AggregateOptionsBuilder {
+	a.Opts = append(a.Opts, func(opts *AggregateOptions) {
+		opts.Accumulators = append(opts.Accumulators, accs...)
+	})
+	return a
+}
+
+func (a *AggregateOptionsBuilder) SetSort(sort *Sort) *AggregateOptionsBuilder {
+	a.Opts = append(a.Opts, func(opts *AggregateOptions) {
+		opts.Sort = sort
+	})
+	return a
+}
+
+func (a *AggregateOptionsBuilder) SetLimit(limit int64) *AggregateOptionsBuilder {
+	a.Opts = append(a.Opts, func(opts *AggregateOptions) {
+		opts.Limit = limit
+	})
+	return a
+}
+
+// WithDeleted 聚合包含已软删除的记录
+func (a *AggregateOptionsBuilder) WithDeleted() *AggregateOptionsBuilder {
+	a.Opts = append(a.Opts, func(opts *AggregateOptions) {
+		opts.Deleted = DeletedIncluded
+	})
+	return a
+}
+
+// aggregateRepo 仓库的内部能力：执行聚合和去重查询，并将结果解码到 dest（*[]R 或 *[]V）
+type aggregateRepo interface {
+	aggregate(ctx context.Context, filter any, o *AggregateOptions, dest any) error
+	distinct(ctx context.Context, field string, filter any, dest any) error
+}
+
+// Aggregate 按分组字段对匹配记录做聚合计算，每组一行，分组字段和 Accumulator.As 按名称解码到 R
+// 分组字段在结果中的名称与仓库使用的字段名一致（GORM 为列名，MongoDB 为 bson 名），R 可以是结构体或 map[string]any；
+// 未指定分组字段时对所有匹配记录计算一行，没有匹配记录时 SQL 仍返回一行而 MongoDB 不返回
+func Aggregate[T, R any](ctx context.Context, repo IFinder[T], filter any, opts ...IList[AggregateOptions]) ([]R, error) {
+	a, ok := repo.(aggregateRepo)
+	if !ok {
+		return nil, ErrAggregateUnsupported
+	}
+	o := NewOptions(opts...)
+	if len(o.GroupBy) == 0 && len(o.Accumulators) == 0 {
+		return nil, errors.New("repox: aggregate requires group-by fields or accumulators")
+	}
+	var rows []R
+	if err := a.aggregate(ctx, filter, o, &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// Distinct 返回匹配记录中字段的不同取值，不包含已软删除的记录
+func Distinct[T, V any](ctx context.Context, repo IFinder[T], field string, filter any) ([]V, error) {
+	a, ok := repo.(aggregateRepo)
+	if !ok {
+		return nil, ErrAggregateUnsupported
+	}
+	var values []V
+	if err := a.distinct(ctx, field, filter, &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// aggregatePlan 解析后的聚合字段，名称均为仓库使用的字段名
+type aggregatePlan struct {
+	groups []string
+	accs   []Accumulator
+}
+
+// newAggregatePlan 将分组字段和聚合字段解析为仓库使用的字段名
+func newAggregatePlan(schema *entitySchema, o *AggregateOptions, name func(*fieldInfo) string) (*aggregatePlan, error) {
+	p := &aggregatePlan{}
+	for _, g := range o.GroupBy {
+		f, ok := schema.Field(g)
+		if !ok {
+			return nil, fmt.Errorf("repox: unknown group field %s of %s", g, schema.Type)
+		}
+		p.groups = append(p.groups, name(f))
+	}
+	for _, acc := range o.Accumulators {
+		if acc.As == "" {
+			return nil, fmt.Errorf("repox: accumulator %s requires a result name", acc.Op)
+		}
+		switch acc.Op {
+		case AccCount:
+		case AccSum, AccAvg, AccMin, AccMax:
+			f, ok := schema.Field(acc.Field)
+			if !ok {
+				return nil, fmt.Errorf("repox: unknown aggregate field %s of %s", acc.Field, schema.Type)
+			}
+			acc.Field = name(f)
+		default:
+			return nil, fmt.Errorf("repox: unknown accumulator %s", acc.Op)
+		}
+		p.accs = append(p.accs, acc)
+	}
+	return p, nil
+}
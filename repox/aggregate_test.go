@@ -0,0 +1,130 @@
+package repox
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/mbeoliero/kit/builder"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+type ageStat struct {
+	Age   int     `bson:"age"`
+	N     int64   `bson:"n"`
+	Total int64   `bson:"total"`
+	Avg   float64 `bson:"avg"`
+	First string  `bson:"first"`
+}
+
+func TestAggregate_Memory(t *testing.T) {
+	ctx := context.Background()
+	repo := newMemUsers(t)
+
+	stats, err := Aggregate[memUser, ageStat](ctx, repo, nil, Agg().
+		SetGroupBy("age").
+		Add(Count("n"), Sum("age", "total"), Avg("Age", "avg"), Min("name", "first")).
+		SetSort(NewSort().Desc("n").Asc("age")))
+	require.NoError(t, err)
+	assert.Equal(t, []ageStat{
+		{Age: 30, N: 2, Total: 60, Avg: 30, First: "bob"},
+		{Age: 20, N: 1, Total: 20, Avg: 20, First: "alice"},
+		{Age: 25, N: 1, Total: 25, Avg: 25, First: "carol"},
+	}, stats)
+
+	// 不分组时对所有匹配记录计算一行，结果可以解码到 map
+	rows, err := Aggregate[memUser, map[string]any](ctx, repo, bson.M{"age": bson.M{"$gte": 25}}, Agg().Add(Max("age", "oldest"), Count("n")))
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	assert.EqualValues(t, 30, rows[0]["oldest"])
+	assert.EqualValues(t, 3, rows[0]["n"])
+
+	_, err = Aggregate[memUser, ageStat](ctx, repo, nil, Agg().SetGroupBy("missing"))
+	assert.Error(t, err)
+	_, err = Aggregate[memUser, ageStat](ctx, repo, nil)
+	assert.Error(t, err)
+}
+
+func TestDistinct_Memory(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo[memUser](Options().SetSoftDelete(""))
+	require.NoError(t, repo.CreateMany(ctx, []*memUser{{Name: "a", Age: 1}, {Name: "b", Age: 2}, {Name: "c", Age: 1}, {Name: "d", Age: 3}}))
+	_, err := repo.DeleteOne(ctx, bson.M{"name": "d"})
+	require.NoError(t, err)
+
+	ages, err := Distinct[memUser, int](ctx, repo, "age", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, ages)
+
+	// 经过拦截器时可以看到操作和字段
+	var seen []string
+	wrapped := Wrap[memUser, []*memUser](repo, InterceptorFunc(func(ctx context.Context, op *Operation, next Invoker) error {
+		seen = append(seen, op.Name)
+		return next(ctx, op)
+	}))
+	names, err := Distinct[memUser, string](ctx, wrapped, "name", bson.M{"age": 1})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "c"}, names)
+	_, err = Aggregate[memUser, ageStat](ctx, wrapped, nil, Agg().Add(Count("n")))
+	require.NoError(t, err)
+	assert.Equal(t, []string{OpDistinct, OpAggregate}, seen)
+}
+
+func TestAggregate_Gorm(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewGormRepo[claimJob](db)
+	ctx := context.Background()
+
+	type statusStat struct {
+		Status string
+		N      int64
+		Top    int
+	}
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT `status`, COUNT(*) AS `n`, MAX(`priority`) AS `top` FROM `claim_jobs` "+
+		"WHERE `priority` > ? GROUP BY `status` ORDER BY n DESC LIMIT ?")).
+		WithArgs(0, 10).
+		WillReturnRows(sqlmock.NewRows([]string{"status", "n", "top"}).AddRow("pending", 3, 9).AddRow("running", 1, 2))
+	stats, err := Aggregate[claimJob, statusStat](ctx, repo, builder.NewGormQueryBuilder().Gt("priority", 0).Build(), Agg().
+		SetGroupBy("Status").
+		Add(Count("n"), Max("priority", "top")).
+		SetSort(NewSort().Desc("n")).
+		SetLimit(10))
+	require.NoError(t, err)
+	assert.Equal(t, []statusStat{{Status: "pending", N: 3, Top: 9}, {Status: "running", N: 1, Top: 2}}, stats)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT DISTINCT `status` FROM `claim_jobs` WHERE `claim_jobs`.`priority` = ?")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("pending").AddRow("running"))
+	statuses, err := Distinct[claimJob, string](ctx, repo, "status", map[string]any{"priority": 1})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"pending", "running"}, statuses)
+}
+
+func TestAggregate_MongoPipeline(t *testing.T) {
+	repo := NewMongoRepo[tenantDoc](nil, Options().SetTenant("", nil))
+	ctx := WithTenant(context.Background(), "a")
+
+	pipeline, err := repo.aggregatePipeline(ctx, nil, &AggregateOptions{
+		GroupBy:      []string{"Title"},
+		Accumulators: []Accumulator{Count("n"), Max("id", "last")},
+		Limit:        5,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"tenant_id": "a"}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.D{{Key: "title", Value: "$title"}}},
+			{Key: "n", Value: bson.M{"$sum": 1}},
+			{Key: "last", Value: bson.M{"$max": "$_id"}},
+		}}},
+		{{Key: "$project", Value: bson.D{{Key: "_id", Value: 0}, {Key: "title", Value: "$_id.title"}, {Key: "n", Value: 1}, {Key: "last", Value: 1}}}},
+		{{Key: "$limit", Value: int64(5)}},
+	}, pipeline)
+
+	_, err = repo.aggregatePipeline(context.Background(), nil, &AggregateOptions{Accumulators: []Accumulator{Count("n")}})
+	assert.ErrorIs(t, err, ErrTenantRequired)
+}
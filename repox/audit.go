@@ -0,0 +1,142 @@
+package repox
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// 审计字段通过 repox tag 声明，例如 `repox:"created_at"`；
+// 时间字段类型应为 time.Time 或 *time.Time，操作人字段类型与 WithActor 传入的值一致或可转换
+const (
+	roleCreatedAt = "created_at"
+	roleUpdatedAt = "updated_at"
+	roleCreatedBy = "created_by"
+	roleUpdatedBy = "updated_by"
+)
+
+type actorKey struct{}
+
+// WithActor 在 ctx 中携带当前操作人，仓库写入时用于填充 created_by/updated_by 字段
+func WithActor(ctx context.Context, actor any) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext 获取 ctx 中携带的操作人
+func ActorFromContext(ctx context.Context) (any, bool) {
+	actor := ctx.Value(actorKey{})
+	return actor, actor != nil
+}
+
+// auditor 实体的审计字段
+type auditor struct {
+	createdAt, updatedAt, createdBy, updatedBy *fieldInfo
+}
+
+// auditorOf 获取实体的审计字段，未声明的字段为 nil
+func auditorOf(s *entitySchema) auditor {
+	return auditor{
+		createdAt: s.Role(roleCreatedAt),
+		updatedAt: s.Role(roleUpdatedAt),
+		createdBy: s.Role(roleCreatedBy),
+		updatedBy: s.Role(roleUpdatedBy),
+	}
+}
+
+// stampCreate 为新建的实体填充零值的审计字段
+func (a auditor) stampCreate(ctx context.Context, entity any, now time.Time) error {
+	actor, hasActor := ActorFromContext(ctx)
+	for _, kv := range []struct {
+		f     *fieldInfo
+		value any
+		ok    bool
+	}{
+		{a.createdAt, now, true},
+		{a.updatedAt, now, true},
+		{a.createdBy, actor, hasActor},
+		{a.updatedBy, actor, hasActor},
+	} {
+		if kv.f == nil || !kv.ok {
+			continue
+		}
+		if err := setAuditField(kv.f, entity, kv.value, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stampUpdate 为更新的实体设置 updated_at/updated_by
+func (a auditor) stampUpdate(ctx context.Context, entity any, now time.Time) error {
+	if a.updatedAt != nil {
+		if err := setAuditField(a.updatedAt, entity, now, true); err != nil {
+			return err
+		}
+	}
+	if actor, ok := ActorFromContext(ctx); ok && a.updatedBy != nil {
+		return setAuditField(a.updatedBy, entity, actor, true)
+	}
+	return nil
+}
+
+// updateValues 返回更新时需要设置的审计字段，name 决定使用的字段名
+func (a auditor) updateValues(ctx context.Context, now time.Time, name func(*fieldInfo) string) map[string]any {
+	return a.values(ctx, now, a.updatedAt, a.updatedBy, name)
+}
+
+// insertValues 返回插入时需要设置的创建审计字段，name 决定使用的字段名
+func (a auditor) insertValues(ctx context.Context, now time.Time, name func(*fieldInfo) string) map[string]any {
+	return a.values(ctx, now, a.createdAt, a.createdBy, name)
+}
+
+func (a auditor) values(ctx context.Context, now time.Time, at, by *fieldInfo, name func(*fieldInfo) string) map[string]any {
+	ret := make(map[string]any, 2)
+	if at != nil {
+		ret[name(at)] = now
+	}
+	if actor, ok := ActorFromContext(ctx); ok && by != nil {
+		ret[name(by)] = actor
+	}
+	return ret
+}
+
+// setAuditField 设置实体的审计字段，overwrite 为 false 时只填充零值字段
+func setAuditField(f *fieldInfo, entity any, value any, overwrite bool) error {
+	fv, ok := f.reflectValue(reflect.ValueOf(entity), true)
+	if !ok {
+		return fmt.Errorf("repox: audit field %s is not addressable", f.Name)
+	}
+	if !overwrite && !fv.IsZero() {
+		return nil
+	}
+	if err := assignValue(fv, value); err != nil {
+		return fmt.Errorf("repox: set audit field %s: %w", f.Name, err)
+	}
+	return nil
+}
+
+// mergeValues 返回合并了 extra 的新 map，update 中已存在的字段不会被覆盖
+func mergeValues(update map[string]any, extra map[string]any) map[string]any {
+	if len(extra) == 0 {
+		return update
+	}
+	ret := make(map[string]any, len(update)+len(extra))
+	for k, v := range extra {
+		ret[k] = v
+	}
+	for k, v := range update {
+		ret[k] = v
+	}
+	return ret
+}
+
+// gormColumn 返回字段的 SQL 列名
+func gormColumn(f *fieldInfo) string {
+	return f.GormName
+}
+
+// bsonField 返回字段的 MongoDB 字段名
+func bsonField(f *fieldInfo) string {
+	return f.BsonName
+}
@@ -0,0 +1,88 @@
+package repox
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+type auditDoc struct {
+	Id        int64      `bson:"_id" gorm:"primaryKey"`
+	Title     string     `bson:"title"`
+	CreatedAt time.Time  `bson:"created_at" repox:"created_at"`
+	UpdatedAt *time.Time `bson:"updated_at" repox:"updated_at"`
+	CreatedBy string     `bson:"created_by" repox:"created_by"`
+	UpdatedBy string     `bson:"updated_by" repox:"updated_by"`
+}
+
+func TestAudit_Memory(t *testing.T) {
+	repo := NewMemoryRepo[auditDoc]()
+	ctx := WithActor(context.Background(), "alice")
+
+	doc := &auditDoc{Title: "a"}
+	require.NoError(t, repo.Create(ctx, doc))
+	assert.False(t, doc.CreatedAt.IsZero())
+	require.NotNil(t, doc.UpdatedAt)
+	assert.Equal(t, "alice", doc.CreatedBy)
+	assert.Equal(t, "alice", doc.UpdatedBy)
+	createdAt := doc.CreatedAt
+
+	bobCtx := WithActor(context.Background(), "bob")
+	_, err := repo.UpdateOne(bobCtx, bson.M{"_id": doc.Id}, map[string]any{"title": "b"})
+	require.NoError(t, err)
+	got, err := repo.FindOne(ctx, bson.M{"_id": doc.Id})
+	require.NoError(t, err)
+	assert.Equal(t, "alice", got.CreatedBy)
+	assert.Equal(t, "bob", got.UpdatedBy)
+	assert.True(t, createdAt.Equal(got.CreatedAt))
+
+	// 整体覆盖的 upsert 保留创建审计字段
+	require.NoError(t, repo.UpsertOne(bobCtx, auditDoc{Title: "b"}, UpsertOptions{ConflictKvs: map[string]any{"title": "b"}}))
+	got, err = repo.FindOne(ctx, bson.M{"_id": doc.Id})
+	require.NoError(t, err)
+	assert.Equal(t, "alice", got.CreatedBy)
+	assert.True(t, createdAt.Equal(got.CreatedAt))
+
+	require.NoError(t, repo.UpsertOne(bobCtx, auditDoc{}, UpsertOptions{
+		ConflictKvs: map[string]any{"title": "c"},
+		Set:         map[string]any{"title": "c"},
+	}))
+	inserted, err := repo.FindOne(ctx, bson.M{"title": "c"})
+	require.NoError(t, err)
+	assert.Equal(t, "bob", inserted.CreatedBy)
+	assert.False(t, inserted.CreatedAt.IsZero())
+}
+
+func TestAudit_MongoUpsertDoc(t *testing.T) {
+	repo := &MongoRepo[auditDoc]{}
+	now := time.Now()
+	set, created, err := repo.splitUpsertDoc(WithActor(context.Background(), "alice"), &auditDoc{Id: 1, Title: "a"}, now)
+	require.NoError(t, err)
+
+	assert.Equal(t, "a", set["title"])
+	assert.Equal(t, "alice", set["updated_by"])
+	assert.Contains(t, set, "updated_at")
+	assert.NotContains(t, set, "created_at")
+	assert.NotContains(t, set, "created_by")
+	assert.Equal(t, "alice", created["created_by"])
+	assert.Contains(t, created, "created_at")
+}
+
+func TestAudit_Gorm(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewGormRepo[auditDoc](db)
+	ctx := WithActor(context.Background(), "alice")
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `audit_docs` SET `title`=?,`updated_at`=?,`updated_by`=? WHERE `audit_docs`.`id` = ?")).
+		WithArgs("b", sqlmock.AnyArg(), "alice", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	_, err := repo.UpdateMany(ctx, map[string]any{"id": 1}, map[string]any{"title": "b"})
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
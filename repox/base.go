@@ -3,18 +3,59 @@ package repox
 import (
 	"context"
 	"errors"
+	"iter"
+	"time"
+
+	"github.com/mbeoliero/kit/builder"
 )
 
 var DataNotFound = errors.New("data not found")
 
+// defaultBatchSize FindInBatches 和批量插入未指定批大小时的默认值
+const defaultBatchSize = 500
+
 // FindOptions 存储查询配置
 type FindOptions struct {
 	ReturnFields []string
 	Skip         int64
 	Limit        int64
 	Sort         *Sort
+	// EstimatedCountThreshold 统计总数时，估算值超过该阈值则直接返回估算值，0 表示始终精确统计
+	EstimatedCountThreshold int64
+	// Deleted 启用软删除时已删除记录的查询范围，默认排除
+	Deleted DeletedScope
+	// Read 读取的节点，默认由连接配置决定；事务中始终使用事务所在的连接
+	Read ReadMode
+	// MaxStaleness 读取从节点时允许的最大延迟，0 表示不限制（仅 MongoDB，最小 90s）
+	MaxStaleness time.Duration
+	// ReadConcern 读关注级别，为空时使用集合的配置（仅 MongoDB）
+	ReadConcern ReadConcern
+	// MaxTime 单次查询的最长执行时间，0 表示不限制
+	// MongoDB 发送 maxTimeMS，Find、Iterate 和 FindInBatches 改用等价的聚合管道执行，时间限制作用于游标的整个生命周期；
+	// MySQL 追加 MAX_EXECUTION_TIME 优化器提示。Iterate 和 FindInBatches 不设置客户端的整体超时
+	MaxTime time.Duration
 }
 
+// ReadMode 读取的节点
+type ReadMode int
+
+const (
+	ReadDefault ReadMode = iota // 由连接配置决定，GORM 读写分离时读取从库，MongoDB 使用集合的读偏好
+	ReadPrimary                 // 读取主库/主节点，用于读取刚写入的数据
+	ReadReplica                 // 优先读取从库/从节点
+)
+
+// ReadConcern MongoDB 读关注级别
+type ReadConcern string
+
+const (
+	ReadConcernLocal        ReadConcern = "local"
+	ReadConcernAvailable    ReadConcern = "available"
+	ReadConcernMajority     ReadConcern = "majority"
+	ReadConcernLinearizable ReadConcern = "linearizable"
+	ReadConcernSnapshot     ReadConcern = "snapshot"
+)
+
 // FindOptionsBuilder 链式构建器
 type FindOptionsBuilder struct {
 	Opts []func(*FindOptions)
@@ -58,8 +99,71 @@ func (f *FindOptionsBuilder) SetSort(sort *Sort) *FindOptionsBuilder {
 	return f
 }
 
+func (f *FindOptionsBuilder) SetEstimatedCountThreshold(threshold int64) *FindOptionsBuilder {
+	f.Opts = append(f.Opts, func(opts *FindOptions) {
+		opts.EstimatedCountThreshold = threshold
+	})
+	return f
+}
+
+// WithDeleted 查询结果包含已软删除的记录
+func (f *FindOptionsBuilder) WithDeleted() *FindOptionsBuilder {
+	f.Opts = append(f.Opts, func(opts *FindOptions) {
+		opts.Deleted = DeletedIncluded
+	})
+	return f
+}
+
+// OnlyDeleted 只查询已软删除的记录
+func (f *FindOptionsBuilder) OnlyDeleted() *FindOptionsBuilder {
+	f.Opts = append(f.Opts, func(opts *FindOptions) {
+		opts.Deleted = DeletedOnly
+	})
+	return f
+}
+
+// ReadFromPrimary 从主库/主节点读取，GORM 使用 dbresolver.Write，MongoDB 使用 primary 读偏好
+func (f *FindOptionsBuilder) ReadFromPrimary() *FindOptionsBuilder {
+	f.Opts = append(f.Opts, func(opts *FindOptions) {
+		opts.Read = ReadPrimary
+		opts.MaxStaleness = 0
+	})
+	return f
+}
+
+// ReadFromReplica 优先从从库/从节点读取，GORM 使用 dbresolver.Read，MongoDB 使用 secondaryPreferred 读偏好
+// maxStaleness 为从节点允许的最大延迟，0 表示不限制，仅 MongoDB 支持
+func (f *FindOptionsBuilder) ReadFromReplica(maxStaleness time.Duration) *FindOptionsBuilder {
+	f.Opts = append(f.Opts, func(opts *FindOptions) {
+		opts.Read = ReadReplica
+		opts.MaxStaleness = maxStaleness
+	})
+	return f
+}
+
+// SetReadConcern 设置读关注级别，仅 MongoDB 支持
+func (f *FindOptionsBuilder) SetReadConcern(level ReadConcern) *FindOptionsBuilder {
+	f.Opts = append(f.Opts, func(opts *FindOptions) {
+		opts.ReadConcern = level
+	})
+	return f
+}
+
+// SetMaxTime 设置单次查询的最长执行时间，超时后返回 context.DeadlineExceeded 或数据库的超时错误
+// MongoDB 服务端超时返回 MaxTimeMSExpired 错误；MongoDB 的 Find、Iterate 和 FindInBatches 设置后通过 aggregate 命令执行
+func (f *FindOptionsBuilder) SetMaxTime(d time.Duration) *FindOptionsBuilder {
+	f.Opts = append(f.Opts, func(opts *FindOptions) {
+		opts.MaxTime = d
+	})
+	return f
+}
+
 // UpdateOptions 存储更新配置
 type UpdateOptions struct {
+	ReturnAfter bool          // FindOneAndUpdate 返回更新后的记录，默认返回更新前的记录
+	Upsert      bool          // FindOneAndUpdate 没有匹配的记录时插入新记录
+	Sort        *Sort         // FindOneAndUpdate 匹配多条记录时按排序更新第一条
+	MaxTime     time.Duration // 单次更新的最长执行时间，0 表示不限制，MongoDB 设置 maxTimeMS
 }
 
 // UpdateOptionsBuilder 链式构建器
@@ -77,12 +181,144 @@ func (u *UpdateOptionsBuilder) List() []func(*UpdateOptions) {
 	return u.Opts
 }
 
+func (u *UpdateOptionsBuilder) SetReturnAfter(after bool) *UpdateOptionsBuilder {
+	u.Opts = append(u.Opts, func(opts *UpdateOptions) {
+		opts.ReturnAfter = after
+	})
+	return u
+}
+
+func (u *UpdateOptionsBuilder) SetUpsert(upsert bool) *UpdateOptionsBuilder {
+	u.Opts = append(u.Opts, func(opts *UpdateOptions) {
+		opts.Upsert = upsert
+	})
+	return u
+}
+
+func (u *UpdateOptionsBuilder) SetSort(sort *Sort) *UpdateOptionsBuilder {
+	u.Opts = append(u.Opts, func(opts *UpdateOptions) {
+		opts.Sort = sort
+	})
+	return u
+}
+
+// SetMaxTime 设置单次更新的最长执行时间
+// MySQL 的 MAX_EXECUTION_TIME 只对 SELECT 生效，更新语句只在客户端超时
+func (u *UpdateOptionsBuilder) SetMaxTime(d time.Duration) *UpdateOptionsBuilder {
+	u.Opts = append(u.Opts, func(opts *UpdateOptions) {
+		opts.MaxTime = d
+	})
+	return u
+}
+
+// RepoOptions 仓库级配置，在创建仓库时传入
+type RepoOptions struct {
+	// SoftDeleteField 软删除字段，非空时启用软删除
+	SoftDeleteField string
+	// TenantField 租户字段，非空时启用租户隔离
+	TenantField string
+	// TenantExtractor 从 ctx 中获取当前租户，为 nil 时使用 TenantFromContext
+	TenantExtractor TenantExtractor
+	// BatchSize GORM 批量插入时每条 INSERT 语句的记录数，0 表示使用 defaultBatchSize
+	BatchSize int
+	// IdGenerator 主键生成器，非空时 Create/CreateMany 为零值的主键生成值并回写到实体
+	IdGenerator IdGenerator
+	// MaxUnboundedFind 未设置 Limit 的 Find 最多返回的记录数，0 表示不限制
+	MaxUnboundedFind int64
+	// RejectUnboundedFind 未设置 Limit 的 Find 超过 MaxUnboundedFind 时返回 ErrUnboundedFind，否则截断到 MaxUnboundedFind
+	RejectUnboundedFind bool
+}
+
+// RepoOptionsBuilder 链式构建器
+type RepoOptionsBuilder struct {
+	Opts []func(*RepoOptions)
+}
+
+// Options 创建新的构建器
+func Options() *RepoOptionsBuilder {
+	return &RepoOptionsBuilder{}
+}
+
+// List 返回所有配置函数
+func (b *RepoOptionsBuilder) List() []func(*RepoOptions) {
+	return b.Opts
+}
+
+// SetSoftDelete 启用软删除，field 为空时使用 deleted_at
+// 删除操作改为将该字段设置为当前时间，查询、更新和删除自动排除已删除的记录
+// 字段类型应为 *time.Time 或 gorm.DeletedAt，未删除的记录该字段为 NULL
+func (b *RepoOptionsBuilder) SetSoftDelete(field string) *RepoOptionsBuilder {
+	if field == "" {
+		field = defaultSoftDeleteField
+	}
+	b.Opts = append(b.Opts, func(opts *RepoOptions) {
+		opts.SoftDeleteField = field
+	})
+	return b
+}
+
+// SetTenant 启用租户隔离，field 为空时使用 tenant_id，extractor 为 nil 时使用 TenantFromContext
+// 查询、统计、更新和删除自动追加当前租户条件，创建和 upsert 时自动写入当前租户；
+// ctx 中没有租户时返回 ErrTenantRequired，需要跨租户访问时使用 CrossTenant
+func (b *RepoOptionsBuilder) SetTenant(field string, extractor TenantExtractor) *RepoOptionsBuilder {
+	if field == "" {
+		field = defaultTenantField
+	}
+	b.Opts = append(b.Opts, func(opts *RepoOptions) {
+		opts.TenantField = field
+		opts.TenantExtractor = extractor
+	})
+	return b
+}
+
+// SetBatchSize 设置 GORM 的 CreateMany 和 BulkWrite 批量插入时每条 INSERT 语句的记录数
+func (b *RepoOptionsBuilder) SetBatchSize(size int) *RepoOptionsBuilder {
+	b.Opts = append(b.Opts, func(opts *RepoOptions) {
+		opts.BatchSize = size
+	})
+	return b
+}
+
+// SetUnboundedFindLimit 限制未设置 Limit 的 Find 最多返回 max 条记录，超过时记录调用方
+// reject 为 true 时返回 ErrUnboundedFind，否则截断到 max 条；需要读取全部记录时使用 Iterate 或 FindInBatches
+func (b *RepoOptionsBuilder) SetUnboundedFindLimit(max int64, reject bool) *RepoOptionsBuilder {
+	b.Opts = append(b.Opts, func(opts *RepoOptions) {
+		opts.MaxUnboundedFind = max
+		opts.RejectUnboundedFind = reject
+	})
+	return b
+}
+
+// SetIdGenerator 设置主键生成器，实体必须有主键字段（gorm primaryKey、bson _id 或名为 Id/ID 的字段）
+func (b *RepoOptionsBuilder) SetIdGenerator(gen IdGenerator) *RepoOptionsBuilder {
+	b.Opts = append(b.Opts, func(opts *RepoOptions) {
+		opts.IdGenerator = gen
+	})
+	return b
+}
+
 type UpsertOptions struct {
 	ConflictKvs map[string]any   // 冲突字段（唯一索引），用作filter
 	Set         map[string]any   // 普通赋值
 	Inc         map[string]int64 // 自增
 }
 
+// UpsertManyOptions UpsertMany 的配置
+type UpsertManyOptions struct {
+	// ConflictFields 冲突字段（唯一索引），以每条记录中这些字段的值匹配已有记录；启用租户隔离时自动附加租户字段
+	ConflictFields []string
+	// UpdateFields 命中时用记录中的值覆盖的字段，为空时覆盖除主键、冲突字段、created_at/created_by 和 Inc 以外的所有字段
+	UpdateFields []string
+	// Inc 命中时在原值上自增的字段，插入时字段值为增量本身
+	Inc map[string]int64
+}
+
+// UpsertResult UpsertMany 的结果
+type UpsertResult struct {
+	InsertCount int64
+	UpdateCount int64
+}
+
 type ICreator[T any] interface {
 	Create(context.Context, *T) error
 	CreateMany(context.Context, []*T) error
@@ -91,7 +327,20 @@ type ICreator[T any] interface {
 type IFinder[T any] interface {
 	FindOne(ctx context.Context, filter any, opts ...IList[FindOptions]) (*T, error)
 	Find(ctx context.Context, filter any, opts ...IList[FindOptions]) ([]*T, error)
+	// Count 统计记录数，设置 Skip/Limit 时只统计该范围内的记录
 	Count(ctx context.Context, filter any, opts ...IList[FindOptions]) (int64, error)
+	// FindWithTotal 查询一页数据并同时统计满足条件的总数
+	FindWithTotal(ctx context.Context, filter any, opts ...IList[FindOptions]) (*Page[T], error)
+	// FindPage 基于游标的分页查询，cursor 为空时查询第一页
+	FindPage(ctx context.Context, filter any, sort *Sort, cursor string, limit int64) (*CursorPage[T], error)
+}
+
+// IIterator 流式遍历大结果集，内存占用与批大小相关而与结果总数无关
+type IIterator[T any] interface {
+	// Iterate 逐条遍历查询结果，出错时产出一次 error 后结束
+	Iterate(ctx context.Context, filter any, opts ...IList[FindOptions]) iter.Seq2[*T, error]
+	// FindInBatches 分批查询并对每批调用 fn，fn 返回错误时停止
+	FindInBatches(ctx context.Context, filter any, batchSize int, fn func(batch []*T) error, opts ...IList[FindOptions]) error
 }
 
 type UpdateResult struct {
@@ -103,7 +352,12 @@ type IUpdater[T any] interface {
 	Incr(ctx context.Context, filter any, incr map[string]int, opts ...IList[UpdateOptions]) error
 	UpdateOne(ctx context.Context, filter any, update map[string]any, opts ...IList[UpdateOptions]) (*UpdateResult, error)
 	UpsertOne(ctx context.Context, create T, opt UpsertOptions) error
+	// UpsertMany 批量插入或更新记录，按冲突字段区分插入和更新，实体的冲突键重复时返回 ErrDuplicateKey
+	UpsertMany(ctx context.Context, entities []*T, opt UpsertManyOptions) (*UpsertResult, error)
 	UpdateMany(ctx context.Context, filter any, update map[string]any, opts ...IList[UpdateOptions]) (*UpdateResult, error)
+	// FindOneAndUpdate 原子地更新第一条匹配记录并返回更新前（或 ReturnAfter 时更新后）的记录
+	// 没有匹配记录时返回 DataNotFound；Upsert 插入新记录且返回更新前的记录时返回 nil, nil
+	FindOneAndUpdate(ctx context.Context, filter any, update map[string]any, opts ...IList[UpdateOptions]) (*T, error)
 }
 
 type DeleteResult struct {
@@ -113,6 +367,10 @@ type DeleteResult struct {
 type IDeleter[T any] interface {
 	DeleteOne(ctx context.Context, filter any) (*DeleteResult, error)
 	DeleteMany(ctx context.Context, filter any) (*DeleteResult, error)
+	// FindOneAndDelete 原子地删除第一条匹配记录并返回该记录，仅使用查询选项中的 Sort；没有匹配记录时返回 DataNotFound
+	FindOneAndDelete(ctx context.Context, filter any, opts ...IList[FindOptions]) (*T, error)
+	// Restore 恢复匹配的已软删除记录，未启用软删除时返回 ErrSoftDeleteDisabled
+	Restore(ctx context.Context, filter any) (*UpdateResult, error)
 }
 
 // INative 提供访问底层数据库连接的能力
@@ -122,10 +380,25 @@ type INative[C any] interface {
 	Native() C
 }
 
+// queryBuilderRepo 仓库的内部能力：创建与仓库匹配的查询构建器，返回主键字段名和字段在过滤条件中的名称
+// 装饰器通过它构造能被底层仓库识别的过滤条件
+type queryBuilderRepo interface {
+	newQueryBuilder() builder.QBuilder
+	idField() string
+	fieldName(f *fieldInfo) string
+}
+
+// tenantScopedRepo 仓库的内部能力：返回仓库的租户隔离配置，装饰器通过它区分不同租户的数据
+type tenantScopedRepo interface {
+	tenantScope() tenancy
+}
+
 type Repo[T any, C any] interface {
 	ICreator[T]
 	IFinder[T]
+	IIterator[T]
 	IUpdater[T]
 	IDeleter[T]
+	IBulkWriter[T]
 	INative[C]
 }
@@ -0,0 +1,310 @@
+package repox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrInvalidWriteOp = errors.New("invalid write op")
+	ErrWriteSkipped   = errors.New("write skipped after previous failure")
+)
+
+// WriteKind 批量写入的操作类型
+type WriteKind int
+
+const (
+	WriteInsert WriteKind = iota + 1
+	WriteUpdateOne
+	WriteUpdateMany
+	WriteReplaceOne
+	WriteUpsert
+	WriteDeleteOne
+	WriteDeleteMany
+)
+
+// WriteOp 批量写入中的一个操作，通过 InsertOp、UpdateOneOp 等函数创建
+type WriteOp[T any] struct {
+	Kind   WriteKind
+	Filter any            // 更新、替换和删除的过滤条件
+	Entity *T             // Insert 插入的实体、ReplaceOne 的替换内容、Upsert 未命中时插入的实体
+	Update map[string]any // UpdateOne/UpdateMany 的更新内容
+	Upsert UpsertOptions  // Upsert 的冲突字段和更新内容，语义与 UpsertOne 一致
+}
+
+// InsertOp 插入一条记录，填充审计字段和租户
+func InsertOp[T any](entity *T) WriteOp[T] {
+	return WriteOp[T]{Kind: WriteInsert, Entity: entity}
+}
+
+// UpdateOneOp 更新第一条匹配记录
+func UpdateOneOp[T any](filter any, update map[string]any) WriteOp[T] {
+	return WriteOp[T]{Kind: WriteUpdateOne, Filter: filter, Update: update}
+}
+
+// UpdateManyOp 更新所有匹配记录
+func UpdateManyOp[T any](filter any, update map[string]any) WriteOp[T] {
+	return WriteOp[T]{Kind: WriteUpdateMany, Filter: filter, Update: update}
+}
+
+// ReplaceOneOp 用 entity 整体覆盖第一条匹配记录，保留原记录的主键和 created_at/created_by
+func ReplaceOneOp[T any](filter any, entity *T) WriteOp[T] {
+	return WriteOp[T]{Kind: WriteReplaceOne, Filter: filter, Entity: entity}
+}
+
+// UpsertOp 插入或更新单条记录，语义与 UpsertOne 一致
+func UpsertOp[T any](create T, opt UpsertOptions) WriteOp[T] {
+	return WriteOp[T]{Kind: WriteUpsert, Entity: &create, Upsert: opt}
+}
+
+// DeleteOneOp 删除第一条匹配记录，启用软删除时设置删除字段
+func DeleteOneOp[T any](filter any) WriteOp[T] {
+	return WriteOp[T]{Kind: WriteDeleteOne, Filter: filter}
+}
+
+// DeleteManyOp 删除所有匹配记录，启用软删除时设置删除字段
+func DeleteManyOp[T any](filter any) WriteOp[T] {
+	return WriteOp[T]{Kind: WriteDeleteMany, Filter: filter}
+}
+
+// validate 检查操作是否完整
+func (op WriteOp[T]) validate() error {
+	switch op.Kind {
+	case WriteInsert, WriteReplaceOne, WriteUpsert:
+		if op.Entity == nil {
+			return fmt.Errorf("%w: entity is required", ErrInvalidWriteOp)
+		}
+	case WriteUpdateOne, WriteUpdateMany:
+		if len(op.Update) == 0 {
+			return fmt.Errorf("%w: update is required", ErrInvalidWriteOp)
+		}
+	case WriteDeleteOne, WriteDeleteMany:
+	default:
+		return fmt.Errorf("%w: unknown kind %d", ErrInvalidWriteOp, op.Kind)
+	}
+	return nil
+}
+
+// BulkOptions 存储批量写入配置
+type BulkOptions struct {
+	// Ordered 按顺序执行，某个操作失败后不再执行后续操作，默认开启；关闭时失败的操作不影响其它操作
+	Ordered bool
+	// Verbose MongoDB 返回每个更新、替换和删除操作的匹配、修改和删除数量，基于客户端级别的 bulkWrite 命令，需要 MongoDB 8.0 以上；
+	// 未开启时 MongoDB 的 Results 只包含插入和 upsert 插入的数量。GORM 和内存仓库总是返回每个操作的结果
+	Verbose bool
+}
+
+// BulkOptionsBuilder 链式构建器
+type BulkOptionsBuilder struct {
+	Opts []func(*BulkOptions)
+}
+
+// Bulk 创建新的构建器
+func Bulk() *BulkOptionsBuilder {
+	return &BulkOptionsBuilder{}
+}
+
+// List 返回所有配置函数
+func (b *BulkOptionsBuilder) List() []func(*BulkOptions) {
+	return b.Opts
+}
+
+func (b *BulkOptionsBuilder) SetOrdered(ordered bool) *BulkOptionsBuilder {
+	b.Opts = append(b.Opts, func(opts *BulkOptions) {
+		opts.Ordered = ordered
+	})
+	return b
+}
+
+func (b *BulkOptionsBuilder) SetVerbose(verbose bool) *BulkOptionsBuilder {
+	b.Opts = append(b.Opts, func(opts *BulkOptions) {
+		opts.Verbose = verbose
+	})
+	return b
+}
+
+// newBulkOptions 合并批量写入选项，默认按顺序执行
+func newBulkOptions(opts []IList[BulkOptions]) *BulkOptions {
+	return NewOptions(append([]IList[BulkOptions]{Bulk().SetOrdered(true)}, opts...)...)
+}
+
+// WriteResult 批量写入中单个操作的结果
+type WriteResult struct {
+	InsertedCount int64 // 插入的记录数
+	MatchedCount  int64 // 更新和替换匹配的记录数
+	ModifiedCount int64 // 更新和替换修改的记录数
+	DeletedCount  int64 // 删除的记录数
+	// UpsertedCount upsert 插入的记录数；GORM 和内存仓库无法区分 upsert 是插入还是更新，成功的 upsert 均计入此项
+	UpsertedCount int64
+}
+
+// BulkResult 批量写入的结果，计数为所有成功操作之和
+type BulkResult struct {
+	InsertedCount int64 // 插入的记录数
+	MatchedCount  int64 // 更新和替换匹配的记录数
+	ModifiedCount int64 // 更新和替换修改的记录数
+	DeletedCount  int64 // 删除的记录数
+	// UpsertedCount upsert 插入的记录数；GORM 和内存仓库无法区分 upsert 是插入还是更新，成功的 upsert 均计入此项
+	UpsertedCount int64
+	// Results 与 ops 一一对应的结果，失败和跳过的操作为零值
+	Results []WriteResult
+	// Errors 与 ops 一一对应的错误，成功的操作为 nil；Ordered 时失败操作之后的操作为 ErrWriteSkipped
+	Errors []error
+}
+
+// newBulkResult 创建对应 n 个操作的结果
+func newBulkResult(n int) *BulkResult {
+	return &BulkResult{Results: make([]WriteResult, n), Errors: make([]error, n)}
+}
+
+// set 记录第 i 个操作的结果并累加到总数
+func (b *BulkResult) set(i int, w WriteResult) {
+	b.Results[i] = w
+	b.InsertedCount += w.InsertedCount
+	b.MatchedCount += w.MatchedCount
+	b.ModifiedCount += w.ModifiedCount
+	b.DeletedCount += w.DeletedCount
+	b.UpsertedCount += w.UpsertedCount
+}
+
+// fail 记录 ops[from:to] 的错误，ordered 时将之后的操作标记为跳过
+func (b *BulkResult) fail(from, to int, err error, ordered bool) {
+	for i := from; i < to; i++ {
+		b.Errors[i] = err
+	}
+	if ordered {
+		for i := to; i < len(b.Errors); i++ {
+			b.Errors[i] = ErrWriteSkipped
+		}
+	}
+}
+
+// Err 合并所有失败操作的错误，全部成功时返回 nil
+func (b *BulkResult) Err() error {
+	var errs []error
+	for i, err := range b.Errors {
+		if err != nil && !errors.Is(err, ErrWriteSkipped) {
+			errs = append(errs, fmt.Errorf("op %d: %w", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// IBulkWriter 在一次调用中执行多个写入操作
+type IBulkWriter[T any] interface {
+	// BulkWrite 批量执行写入操作，返回的结果总是非 nil，其中包含每个操作的错误；
+	// 任一操作失败时同时返回合并后的错误
+	BulkWrite(ctx context.Context, ops []WriteOp[T], opts ...IList[BulkOptions]) (*BulkResult, error)
+}
+
+// bulkTarget 逐个执行批量写入操作的仓库，GormRepo 和 MemoryRepo 通过它复用 runBulk
+type bulkTarget[T any] interface {
+	ICreator[T]
+	IUpdater[T]
+	IDeleter[T]
+	// updateOne 只更新第一条匹配记录
+	updateOne(ctx context.Context, filter any, update map[string]any) (WriteResult, error)
+	replaceOne(ctx context.Context, filter any, entity *T) (WriteResult, error)
+}
+
+// runBulk 按顺序逐个执行写入操作，连续的插入按 batchSize 合并为一次 CreateMany
+// step 执行其中的一步，返回错误时该步的所有操作记为失败
+func runBulk[T any](ctx context.Context, repo bulkTarget[T], ops []WriteOp[T], o *BulkOptions, batchSize int,
+	step func(ctx context.Context, fn func(ctx context.Context) error) error) *BulkResult {
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+	result := newBulkResult(len(ops))
+	for i := 0; i < len(ops); {
+		if err := ops[i].validate(); err != nil {
+			result.fail(i, i+1, err, o.Ordered)
+			if o.Ordered {
+				break
+			}
+			i++
+			continue
+		}
+		j := i + 1
+		if ops[i].Kind == WriteInsert {
+			for j < len(ops) && j-i < batchSize && ops[j].Kind == WriteInsert && ops[j].validate() == nil {
+				j++
+			}
+		}
+
+		results := make([]WriteResult, j-i)
+		err := step(ctx, func(ctx context.Context) error {
+			clear(results)
+			return applyWrites(ctx, repo, ops[i:j], results)
+		})
+		if err != nil {
+			result.fail(i, j, err, o.Ordered)
+			if o.Ordered {
+				break
+			}
+		} else {
+			for k, w := range results {
+				result.set(i+k, w)
+			}
+		}
+		i = j
+	}
+	return result
+}
+
+// applyWrites 执行一步中的操作：一组连续的插入或单个其它操作，结果写入与 ops 一一对应的 results
+func applyWrites[T any](ctx context.Context, repo bulkTarget[T], ops []WriteOp[T], results []WriteResult) error {
+	op := ops[0]
+	switch op.Kind {
+	case WriteInsert:
+		entities := make([]*T, len(ops))
+		for i := range ops {
+			entities[i] = ops[i].Entity
+		}
+		if err := repo.CreateMany(ctx, entities); err != nil {
+			return err
+		}
+		for i := range results {
+			results[i].InsertedCount = 1
+		}
+	case WriteUpdateOne:
+		res, err := repo.updateOne(ctx, op.Filter, op.Update)
+		if err != nil {
+			return err
+		}
+		results[0] = res
+	case WriteReplaceOne:
+		res, err := repo.replaceOne(ctx, op.Filter, op.Entity)
+		if err != nil {
+			return err
+		}
+		results[0] = res
+	case WriteUpdateMany:
+		// UpdateMany 只返回受影响的记录数，同时作为匹配数和修改数
+		res, err := repo.UpdateMany(ctx, op.Filter, op.Update)
+		if err != nil {
+			return err
+		}
+		results[0] = WriteResult{MatchedCount: res.UpdateCount, ModifiedCount: res.UpdateCount}
+	case WriteUpsert:
+		if err := repo.UpsertOne(ctx, *op.Entity, op.Upsert); err != nil {
+			return err
+		}
+		results[0].UpsertedCount = 1
+	case WriteDeleteOne, WriteDeleteMany:
+		var (
+			res *DeleteResult
+			err error
+		)
+		if op.Kind == WriteDeleteOne {
+			res, err = repo.DeleteOne(ctx, op.Filter)
+		} else {
+			res, err = repo.DeleteMany(ctx, op.Filter)
+		}
+		if err != nil {
+			return err
+		}
+		results[0].DeletedCount = res.DeleteCount
+	}
+	return nil
+}
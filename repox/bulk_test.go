@@ -0,0 +1,202 @@
+package repox
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+func TestBulkWrite_Memory(t *testing.T) {
+	ctx := context.Background()
+	repo := newMemUsers(t)
+
+	res, err := repo.BulkWrite(ctx, []WriteOp[memUser]{
+		InsertOp(&memUser{Name: "erin", Age: 40}),
+		InsertOp(&memUser{Name: "frank", Age: 41}),
+		UpdateManyOp[memUser](bson.M{"age": 30}, map[string]any{"age": 31}),
+		ReplaceOneOp(bson.M{"name": "alice"}, &memUser{Name: "alice2", Age: 21}),
+		UpsertOp(memUser{Name: "gina"}, UpsertOptions{ConflictKvs: map[string]any{"name": "gina"}, Set: map[string]any{"age": 50}}),
+		DeleteOneOp[memUser](bson.M{"name": "carol"}),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), res.InsertedCount)
+	assert.Equal(t, int64(3), res.ModifiedCount)
+	assert.Equal(t, int64(1), res.UpsertedCount)
+	assert.Equal(t, int64(1), res.DeletedCount)
+	assert.Equal(t, make([]error, 6), res.Errors)
+	assert.Equal(t, []WriteResult{
+		{InsertedCount: 1},
+		{InsertedCount: 1},
+		{MatchedCount: 2, ModifiedCount: 2},
+		{MatchedCount: 1, ModifiedCount: 1},
+		{UpsertedCount: 1},
+		{DeletedCount: 1},
+	}, res.Results)
+
+	// 替换保留原记录的主键
+	u, err := repo.FindOne(ctx, bson.M{"name": "alice2"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), u.Id)
+	n, err := repo.Count(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), n)
+}
+
+func TestBulkWrite_Ordered(t *testing.T) {
+	ctx := context.Background()
+	repo := newMemUsers(t)
+
+	ops := []WriteOp[memUser]{
+		UpdateOneOp[memUser](bson.M{"name": "bob"}, map[string]any{"age": 1}),
+		InsertOp(&memUser{Id: 1, Name: "dup"}),
+		{Kind: WriteInsert},
+		DeleteManyOp[memUser](bson.M{"name": "dave"}),
+	}
+	res, err := repo.BulkWrite(ctx, ops)
+	assert.ErrorIs(t, err, ErrDuplicateKey)
+	assert.NoError(t, res.Errors[0])
+	assert.ErrorIs(t, res.Errors[1], ErrDuplicateKey)
+	assert.ErrorIs(t, res.Errors[2], ErrWriteSkipped)
+	assert.ErrorIs(t, res.Errors[3], ErrWriteSkipped)
+	assert.Equal(t, int64(1), res.ModifiedCount)
+	assert.Equal(t, int64(0), res.DeletedCount)
+	assert.Equal(t, []WriteResult{{MatchedCount: 1, ModifiedCount: 1}, {}, {}, {}}, res.Results)
+
+	// 关闭 Ordered 时失败的操作不影响后续操作
+	res, err = repo.BulkWrite(ctx, ops, Bulk().SetOrdered(false))
+	assert.ErrorIs(t, err, ErrDuplicateKey)
+	assert.ErrorIs(t, err, ErrInvalidWriteOp)
+	assert.ErrorIs(t, res.Errors[1], ErrDuplicateKey)
+	assert.ErrorIs(t, res.Errors[2], ErrInvalidWriteOp)
+	assert.NoError(t, res.Errors[3])
+	assert.Equal(t, int64(1), res.DeletedCount)
+}
+
+func TestBulkWrite_Gorm(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewGormRepo[claimJob](db, Options().SetBatchSize(2))
+	ctx := context.Background()
+
+	mock.ExpectBegin()
+	// 连续的插入按批大小合并，每批在各自的 savepoint 中执行
+	mock.ExpectExec("SAVEPOINT").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `claim_jobs` (`status`,`priority`) VALUES (?,?),(?,?)")).
+		WithArgs("new", 1, "new", 2).
+		WillReturnResult(sqlmock.NewResult(1, 2))
+	mock.ExpectExec("SAVEPOINT").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `claim_jobs` (`status`,`priority`) VALUES (?,?)")).
+		WithArgs("new", 3).
+		WillReturnResult(sqlmock.NewResult(3, 1))
+	mock.ExpectExec("SAVEPOINT").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `claim_jobs` SET `status`=? WHERE `claim_jobs`.`status` = ?")).
+		WithArgs("done", "running").
+		WillReturnError(errors.New("boom"))
+	mock.ExpectExec("ROLLBACK TO SAVEPOINT").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("SAVEPOINT").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `claim_jobs` WHERE `claim_jobs`.`status` = ?")).
+		WithArgs("done").
+		WillReturnResult(sqlmock.NewResult(0, 4))
+	// UpdateOne 锁定第一条匹配记录后按主键更新，不会更新其它匹配记录
+	mock.ExpectExec("SAVEPOINT").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `claim_jobs` WHERE `claim_jobs`.`status` = ? ORDER BY `id` LIMIT ? FOR UPDATE")).
+		WithArgs("new", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status", "priority"}).AddRow(2, "new", 2))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `claim_jobs` SET `status`=? WHERE `id` = ?")).
+		WithArgs("running", int64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	res, err := repo.BulkWrite(ctx, []WriteOp[claimJob]{
+		InsertOp(&claimJob{Status: "new", Priority: 1}),
+		InsertOp(&claimJob{Status: "new", Priority: 2}),
+		InsertOp(&claimJob{Status: "new", Priority: 3}),
+		UpdateManyOp[claimJob](map[string]any{"status": "running"}, map[string]any{"status": "done"}),
+		DeleteManyOp[claimJob](map[string]any{"status": "done"}),
+		UpdateOneOp[claimJob](map[string]any{"status": "new"}, map[string]any{"status": "running"}),
+	}, Bulk().SetOrdered(false))
+	assert.EqualError(t, err, "op 3: boom")
+	assert.Equal(t, []error{nil, nil, nil, res.Errors[3], nil, nil}, res.Errors)
+	assert.Equal(t, int64(3), res.InsertedCount)
+	assert.Equal(t, int64(4), res.DeletedCount)
+	assert.Equal(t, WriteResult{}, res.Results[3])
+	assert.Equal(t, WriteResult{MatchedCount: 1, ModifiedCount: 1}, res.Results[5])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBulkWrite_MongoModels(t *testing.T) {
+	repo := NewMongoRepo[tenantDoc](nil, Options().SetTenant("", nil).SetSoftDelete(""))
+	ctx := WithTenant(context.Background(), "a")
+
+	doc := &tenantDoc{Title: "t"}
+	model, err := repo.writeModel(ctx, InsertOp(doc))
+	require.NoError(t, err)
+	assert.Equal(t, mongo.NewInsertOneModel().SetDocument(doc), model)
+	assert.Equal(t, "a", doc.TenantId)
+
+	model, err = repo.writeModel(ctx, DeleteManyOp[tenantDoc](bson.M{"title": "t"}))
+	require.NoError(t, err)
+	update, ok := model.(*mongo.UpdateManyModel)
+	require.True(t, ok)
+	assert.Equal(t, bson.M{"$and": bson.A{
+		bson.M{"$and": bson.A{bson.M{"title": "t"}, bson.M{"deleted_at": nil}}},
+		bson.M{"tenant_id": "a"},
+	}}, update.Filter)
+
+	model, err = repo.writeModel(ctx, ReplaceOneOp(bson.M{"_id": 1}, &tenantDoc{Id: 9, Title: "r"}))
+	require.NoError(t, err)
+	set := model.(*mongo.UpdateOneModel).Update.(bson.M)["$set"].(bson.M)
+	assert.NotContains(t, set, "_id")
+	assert.Equal(t, "r", set["title"])
+
+	_, err = repo.writeModel(context.Background(), UpdateOneOp[tenantDoc](nil, map[string]any{"title": "x"}))
+	assert.ErrorIs(t, err, ErrTenantRequired)
+
+	// 构建失败的操作不会发送到服务端
+	res, err := repo.BulkWrite(context.Background(), []WriteOp[tenantDoc]{DeleteOneOp[tenantDoc](nil), DeleteOneOp[tenantDoc](nil)})
+	assert.ErrorIs(t, err, ErrTenantRequired)
+	assert.ErrorIs(t, res.Errors[0], ErrTenantRequired)
+	assert.ErrorIs(t, res.Errors[1], ErrWriteSkipped)
+}
+
+func TestBulkWrite_MongoResults(t *testing.T) {
+	// 有序执行时第 1 个模型失败，之后的操作都被跳过
+	result := newBulkResult(4)
+	succeeded := failBulk(result, []int{0, 1, 3}, errors.New("bulk"), map[int]error{1: errors.New("dup")}, true)
+	assert.Equal(t, []int{0}, succeeded)
+	assert.NoError(t, result.Errors[0])
+	assert.EqualError(t, result.Errors[1], "dup")
+	assert.ErrorIs(t, result.Errors[2], ErrWriteSkipped)
+	assert.ErrorIs(t, result.Errors[3], ErrWriteSkipped)
+
+	result = newBulkResult(3)
+	assert.Equal(t, []int{0, 2}, failBulk(result, []int{0, 1, 2}, errors.New("bulk"), map[int]error{1: errors.New("dup")}, false))
+	// 无法定位到单个操作的错误使所有操作失败
+	result = newBulkResult(2)
+	assert.Empty(t, failBulk(result, []int{0, 1}, errors.New("wc"), nil, false))
+	assert.EqualError(t, result.Errors[1], "wc")
+
+	res := &mongo.ClientBulkWriteResult{
+		InsertResults: map[int]mongo.ClientBulkWriteInsertResult{0: {InsertedID: 1}},
+		UpdateResults: map[int]mongo.ClientBulkWriteUpdateResult{
+			1: {MatchedCount: 1, ModifiedCount: 1},
+			2: {UpsertedID: 9},
+			3: {MatchedCount: 2, ModifiedCount: 2},
+		},
+		DeleteResults: map[int]mongo.ClientBulkWriteDeleteResult{4: {DeletedCount: 3}},
+	}
+	assert.Equal(t, WriteResult{InsertedCount: 1}, clientWriteResult(res, 0, WriteInsert, false))
+	assert.Equal(t, WriteResult{MatchedCount: 1, ModifiedCount: 1}, clientWriteResult(res, 1, WriteUpdateOne, false))
+	assert.Equal(t, WriteResult{UpsertedCount: 1}, clientWriteResult(res, 2, WriteUpsert, false))
+	assert.Equal(t, WriteResult{DeletedCount: 2}, clientWriteResult(res, 3, WriteDeleteMany, true))
+	assert.Equal(t, WriteResult{DeletedCount: 3}, clientWriteResult(res, 4, WriteDeleteOne, false))
+
+	assert.Equal(t, &mongo.ClientUpdateOneModel{Filter: bson.M{"a": 1}, Update: bson.M{"$set": bson.M{"b": 2}}},
+		clientWriteModel(mongo.NewUpdateOneModel().SetFilter(bson.M{"a": 1}).SetUpdate(bson.M{"$set": bson.M{"b": 2}})))
+}
@@ -0,0 +1,736 @@
+package repox
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mbeoliero/kit/builder"
+	"github.com/mbeoliero/kit/redisx"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	defaultCacheTTL          = 10 * time.Minute
+	defaultNotFoundTTL       = time.Minute
+	defaultDoubleDeleteDelay = 500 * time.Millisecond
+	defaultInvalidateLimit   = 1000
+	// cacheDeleteTimeout 延迟删除使用的超时时间
+	cacheDeleteTimeout = 3 * time.Second
+)
+
+// CacheOptions 缓存配置
+type CacheOptions struct {
+	Prefix            string        // key 前缀，默认为 repox:<实体类型名>
+	TTL               time.Duration // 记录的缓存时间，默认 10 分钟
+	NotFoundTTL       time.Duration // DataNotFound 的缓存时间，默认 1 分钟，小于 0 时不缓存
+	DoubleDeleteDelay time.Duration // 延迟双删的延迟时间，默认 500ms，小于 0 时不做延迟删除
+	UniqueKeys        [][]string    // 主键之外可用于缓存的唯一键，每个唯一键由一个或多个字段组成
+	// InvalidateLimit 按过滤条件写入时最多读取的受影响记录数，默认 1000；
+	// 超过时（或查询出错时）不再逐条删除，改为递增缓存代数使该实体的所有缓存失效
+	InvalidateLimit int64
+}
+
+// CacheOptionsBuilder 链式构建器
+type CacheOptionsBuilder struct {
+	Opts []func(*CacheOptions)
+}
+
+// Cache 创建新的构建器
+func Cache() *CacheOptionsBuilder {
+	return &CacheOptionsBuilder{}
+}
+
+// List 返回所有配置函数
+func (b *CacheOptionsBuilder) List() []func(*CacheOptions) {
+	return b.Opts
+}
+
+func (b *CacheOptionsBuilder) SetPrefix(prefix string) *CacheOptionsBuilder {
+	b.Opts = append(b.Opts, func(opts *CacheOptions) {
+		opts.Prefix = prefix
+	})
+	return b
+}
+
+func (b *CacheOptionsBuilder) SetTTL(ttl time.Duration) *CacheOptionsBuilder {
+	b.Opts = append(b.Opts, func(opts *CacheOptions) {
+		opts.TTL = ttl
+	})
+	return b
+}
+
+func (b *CacheOptionsBuilder) SetNotFoundTTL(ttl time.Duration) *CacheOptionsBuilder {
+	b.Opts = append(b.Opts, func(opts *CacheOptions) {
+		opts.NotFoundTTL = ttl
+	})
+	return b
+}
+
+func (b *CacheOptionsBuilder) SetDoubleDeleteDelay(delay time.Duration) *CacheOptionsBuilder {
+	b.Opts = append(b.Opts, func(opts *CacheOptions) {
+		opts.DoubleDeleteDelay = delay
+	})
+	return b
+}
+
+func (b *CacheOptionsBuilder) SetInvalidateLimit(limit int64) *CacheOptionsBuilder {
+	b.Opts = append(b.Opts, func(opts *CacheOptions) {
+		opts.InvalidateLimit = limit
+	})
+	return b
+}
+
+// AddUniqueKey 添加一个可用于缓存的唯一键，fields 为组成唯一键的字段
+func (b *CacheOptionsBuilder) AddUniqueKey(fields ...string) *CacheOptionsBuilder {
+	b.Opts = append(b.Opts, func(opts *CacheOptions) {
+		opts.UniqueKeys = append(opts.UniqueKeys, fields)
+	})
+	return b
+}
+
+// CachedRepo 基于 redis 的读穿透缓存装饰器
+// FindOne 的过滤条件是主键或唯一键的等值条件（map、bson.M、bson.D 或 GORM 的 clause.Eq）时从缓存读取，
+// 并发的未命中通过 singleflight 合并为一次查询，DataNotFound 也会被缓存；
+// 写操作在执行前后删除受影响记录的缓存，并在延迟后再删除一次（延迟双删），避免并发读取把旧值写回缓存。
+// 按过滤条件写入时会先查询受影响记录的主键和唯一键以计算缓存 key，超过 InvalidateLimit 时改为使所有缓存失效；
+// 事务中、跨租户和要求读取主节点的读取不走缓存；其它操作直接透传。
+// 缓存值使用 gob 编码，保留 json:"-" 等字段和完整的时间精度；无法 gob 编码的实体不会被缓存。
+// 底层仓库启用租户隔离时缓存 key 包含租户
+type CachedRepo[T any, C any] struct {
+	Repo[T, C]
+	cli     redis.UniversalClient
+	opts    *CacheOptions
+	schema  *entitySchema
+	keys    [][]*fieldInfo // 可用于缓存的键，第一个为主键
+	fields  []string       // 计算缓存 key 需要读取的字段
+	tenancy tenancy
+	group   singleflight.Group
+}
+
+// 确保 CachedRepo 实现了 Repo 接口
+var _ Repo[any, any] = (*CachedRepo[any, any])(nil)
+
+// NewCachedRepo 创建缓存装饰器，唯一键中包含实体不存在的字段时 panic
+func NewCachedRepo[T any, C any](repo Repo[T, C], cli redis.UniversalClient, opts ...IList[CacheOptions]) *CachedRepo[T, C] {
+	o := NewOptions(opts...)
+	schema := schemaFor[T]()
+	if o.Prefix == "" {
+		o.Prefix = "repox:" + schema.Type.Name()
+	}
+	if o.TTL <= 0 {
+		o.TTL = defaultCacheTTL
+	}
+	if o.NotFoundTTL == 0 {
+		o.NotFoundTTL = defaultNotFoundTTL
+	}
+	if o.DoubleDeleteDelay == 0 {
+		o.DoubleDeleteDelay = defaultDoubleDeleteDelay
+	}
+	if o.InvalidateLimit <= 0 {
+		o.InvalidateLimit = defaultInvalidateLimit
+	}
+
+	c := &CachedRepo[T, C]{Repo: repo, cli: cli, opts: o, schema: schema}
+	if schema.Primary != nil {
+		c.keys = append(c.keys, []*fieldInfo{schema.Primary})
+	}
+	for _, names := range o.UniqueKeys {
+		fields := make([]*fieldInfo, len(names))
+		for i, name := range names {
+			f, ok := schema.Field(name)
+			if !ok {
+				panic(fmt.Sprintf("repox: unknown cache key field %s of %s", name, schema.Type))
+			}
+			fields[i] = f
+		}
+		c.keys = append(c.keys, fields)
+	}
+	if p, ok := repo.(tenantScopedRepo); ok {
+		c.tenancy = p.tenantScope()
+		if c.tenancy.enabled() && c.tenancy.field.Index == nil {
+			// 无法从实体中取得租户，不能按租户区分缓存
+			c.keys = nil
+		}
+	}
+
+	var keyFields []*fieldInfo
+	for _, fields := range c.keys {
+		keyFields = append(keyFields, fields...)
+	}
+	if c.tenancy.enabled() && c.tenancy.field.Index != nil {
+		keyFields = append(keyFields, c.tenancy.field)
+	}
+	for _, f := range keyFields {
+		if name := c.fieldName(f); !slices.Contains(c.fields, name) {
+			c.fields = append(c.fields, name)
+		}
+	}
+	return c
+}
+
+// FindOne 查询单条记录，按主键或唯一键查询时走缓存
+func (c *CachedRepo[T, C]) FindOne(ctx context.Context, filter any, opts ...IList[FindOptions]) (*T, error) {
+	key, ok := c.filterKey(ctx, filter, opts)
+	if !ok {
+		return c.Repo.FindOne(ctx, filter, opts...)
+	}
+	item, hit, gen := c.get(ctx, key)
+	if hit {
+		if item == nil {
+			return nil, DataNotFound
+		}
+		return item, nil
+	}
+
+	v, err, _ := c.group.Do(key, func() (any, error) {
+		// 查询结果由多个调用方共享，不受单个调用方取消的影响
+		ctx := context.WithoutCancel(ctx)
+		item, err := c.Repo.FindOne(ctx, filter, opts...)
+		switch {
+		case err == nil:
+			c.set(ctx, key, gen, item)
+		case errors.Is(err, DataNotFound):
+			c.set(ctx, key, gen, nil)
+		}
+		return item, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return clonePtr(v.(*T)), nil
+}
+
+// Create 创建单条记录，并删除该记录可能存在的负缓存
+func (c *CachedRepo[T, C]) Create(ctx context.Context, entity *T) error {
+	return c.invalidate(ctx, nil, true, func() error {
+		return c.Repo.Create(ctx, entity)
+	}, func() ([]*T, bool) {
+		return []*T{entity}, true
+	})
+}
+
+// CreateMany 批量创建记录，并删除这些记录可能存在的负缓存
+func (c *CachedRepo[T, C]) CreateMany(ctx context.Context, entities []*T) error {
+	return c.invalidate(ctx, nil, true, func() error {
+		return c.Repo.CreateMany(ctx, entities)
+	}, func() ([]*T, bool) {
+		return entities, true
+	})
+}
+
+// Update 更新整个实体，失效更新前后的缓存
+func (c *CachedRepo[T, C]) Update(ctx context.Context, entity *T) error {
+	var before []*T
+	complete := true
+	if id, ok := c.schema.PrimaryValue(entity); ok {
+		if filter, ok := c.idsFilter([]any{id}); ok {
+			before, complete = c.find(ctx, filter)
+		}
+	}
+	return c.invalidate(ctx, before, complete, func() error {
+		return c.Repo.Update(ctx, entity)
+	}, func() ([]*T, bool) {
+		return []*T{entity}, true
+	})
+}
+
+func (c *CachedRepo[T, C]) Incr(ctx context.Context, filter any, incr map[string]int, opts ...IList[UpdateOptions]) error {
+	return c.invalidateFilter(ctx, filter, false, func() error {
+		return c.Repo.Incr(ctx, filter, incr, opts...)
+	})
+}
+
+func (c *CachedRepo[T, C]) UpdateOne(ctx context.Context, filter any, update map[string]any, opts ...IList[UpdateOptions]) (*UpdateResult, error) {
+	var result *UpdateResult
+	err := c.invalidateFilter(ctx, filter, false, func() (err error) {
+		result, err = c.Repo.UpdateOne(ctx, filter, update, opts...)
+		return err
+	})
+	return result, err
+}
+
+func (c *CachedRepo[T, C]) UpsertOne(ctx context.Context, create T, opt UpsertOptions) error {
+	filter := make(map[string]any, len(opt.ConflictKvs))
+	for k, v := range opt.ConflictKvs {
+		filter[k] = v
+	}
+	return c.invalidateFilter(ctx, filter, true, func() error {
+		return c.Repo.UpsertOne(ctx, create, opt)
+	})
+}
+
+// UpsertMany 批量插入或更新，按第一个冲突字段查询写入前后受影响的记录并失效其缓存（包括负缓存）
+func (c *CachedRepo[T, C]) UpsertMany(ctx context.Context, entities []*T, opt UpsertManyOptions) (*UpsertResult, error) {
+	var filter any
+	if _, ok := c.Repo.(queryBuilderRepo); ok && len(opt.ConflictFields) > 0 && len(entities) > 0 {
+		if f, ok := c.schema.Field(opt.ConflictFields[0]); ok {
+			values := make([]any, 0, len(entities))
+			for _, entity := range entities {
+				v, _ := f.Value(reflect.ValueOf(entity))
+				values = append(values, v)
+			}
+			filter = c.newQueryBuilder().In(c.fieldName(f), values...).Build()
+		}
+	}
+
+	var before []*T
+	complete := true
+	if filter != nil {
+		before, complete = c.find(ctx, filter)
+	}
+	var result *UpsertResult
+	err := c.invalidate(ctx, before, complete, func() (err error) {
+		result, err = c.Repo.UpsertMany(ctx, entities, opt)
+		return err
+	}, func() ([]*T, bool) {
+		after := slices.Clone(entities)
+		if filter == nil {
+			return after, true
+		}
+		found, ok := c.find(ctx, filter)
+		return append(after, found...), ok
+	})
+	return result, err
+}
+
+func (c *CachedRepo[T, C]) UpdateMany(ctx context.Context, filter any, update map[string]any, opts ...IList[UpdateOptions]) (*UpdateResult, error) {
+	var result *UpdateResult
+	err := c.invalidateFilter(ctx, filter, false, func() (err error) {
+		result, err = c.Repo.UpdateMany(ctx, filter, update, opts...)
+		return err
+	})
+	return result, err
+}
+
+// FindOneAndUpdate 更新后失效返回记录在更新前后的缓存，Upsert 插入时按过滤条件重新查询
+func (c *CachedRepo[T, C]) FindOneAndUpdate(ctx context.Context, filter any, update map[string]any, opts ...IList[UpdateOptions]) (*T, error) {
+	var result *T
+	err := c.invalidate(ctx, nil, true, func() (err error) {
+		result, err = c.Repo.FindOneAndUpdate(ctx, filter, update, opts...)
+		return err
+	}, func() ([]*T, bool) {
+		if result == nil {
+			return c.find(ctx, filter)
+		}
+		found, ok := c.reload(ctx, []*T{result})
+		return append(found, result), ok
+	})
+	return result, err
+}
+
+func (c *CachedRepo[T, C]) DeleteOne(ctx context.Context, filter any) (*DeleteResult, error) {
+	var result *DeleteResult
+	err := c.invalidateFilter(ctx, filter, false, func() (err error) {
+		result, err = c.Repo.DeleteOne(ctx, filter)
+		return err
+	})
+	return result, err
+}
+
+func (c *CachedRepo[T, C]) DeleteMany(ctx context.Context, filter any) (*DeleteResult, error) {
+	var result *DeleteResult
+	err := c.invalidateFilter(ctx, filter, false, func() (err error) {
+		result, err = c.Repo.DeleteMany(ctx, filter)
+		return err
+	})
+	return result, err
+}
+
+// FindOneAndDelete 删除后失效返回记录的缓存
+func (c *CachedRepo[T, C]) FindOneAndDelete(ctx context.Context, filter any, opts ...IList[FindOptions]) (*T, error) {
+	var result *T
+	err := c.invalidate(ctx, nil, true, func() (err error) {
+		result, err = c.Repo.FindOneAndDelete(ctx, filter, opts...)
+		return err
+	}, func() ([]*T, bool) {
+		return []*T{result}, true
+	})
+	return result, err
+}
+
+func (c *CachedRepo[T, C]) Restore(ctx context.Context, filter any) (*UpdateResult, error) {
+	var result *UpdateResult
+	err := c.invalidateFilter(ctx, filter, false, func() (err error) {
+		result, err = c.Repo.Restore(ctx, filter)
+		return err
+	})
+	return result, err
+}
+
+// BulkWrite 批量写入，写入前后失效所有操作涉及记录的缓存；部分操作失败时同样失效
+func (c *CachedRepo[T, C]) BulkWrite(ctx context.Context, ops []WriteOp[T], opts ...IList[BulkOptions]) (*BulkResult, error) {
+	var before, inserted []*T
+	var refind []any
+	complete := true
+	for _, op := range ops {
+		if !complete {
+			// 已经需要使所有缓存失效，不再逐个查询
+			break
+		}
+		var found []*T
+		switch op.Kind {
+		case WriteInsert:
+			if op.Entity != nil {
+				inserted = append(inserted, op.Entity)
+			}
+		case WriteUpsert:
+			filter := make(map[string]any, len(op.Upsert.ConflictKvs))
+			for k, v := range op.Upsert.ConflictKvs {
+				filter[k] = v
+			}
+			found, complete = c.find(ctx, filter)
+			refind = append(refind, filter)
+		default:
+			found, complete = c.find(ctx, op.Filter)
+		}
+		before = append(before, found...)
+	}
+	keys := c.entityKeys(before)
+	c.del(ctx, keys)
+	if !complete {
+		c.flush(ctx)
+	}
+
+	result, err := c.Repo.BulkWrite(ctx, ops, opts...)
+
+	if complete {
+		var after []*T
+		after, complete = c.reload(ctx, before)
+		after = append(after, inserted...)
+		for _, filter := range refind {
+			found, ok := c.find(ctx, filter)
+			after, complete = append(after, found...), complete && ok
+		}
+		keys = append(keys, c.entityKeys(after)...)
+	}
+	c.evict(ctx, keys, !complete)
+	return result, err
+}
+
+// invalidateFilter 按过滤条件写入：写入前查询受影响的记录，写入后按主键重新读取，
+// refind 为 true 时还会按过滤条件重新查询（用于可能插入新记录的 upsert）
+func (c *CachedRepo[T, C]) invalidateFilter(ctx context.Context, filter any, refind bool, write func() error) error {
+	before, complete := c.find(ctx, filter)
+	return c.invalidate(ctx, before, complete, write, func() ([]*T, bool) {
+		if !complete {
+			return nil, false
+		}
+		after, ok := c.reload(ctx, before)
+		if refind {
+			found, foundOk := c.find(ctx, filter)
+			after, ok = append(after, found...), ok && foundOk
+		}
+		return after, ok
+	})
+}
+
+// reload 按主键重新读取记录的当前状态
+func (c *CachedRepo[T, C]) reload(ctx context.Context, items []*T) ([]*T, bool) {
+	ids := make([]any, 0, len(items))
+	for _, item := range items {
+		if id, ok := c.schema.PrimaryValue(item); ok {
+			ids = append(ids, id)
+		}
+	}
+	if f, ok := c.idsFilter(ids); ok {
+		return c.find(ctx, f)
+	}
+	return nil, true
+}
+
+// invalidate 删除 before 的缓存后执行写入，写入成功后删除 before 和 after 的缓存，并在延迟后再删除一次；
+// complete 为 false 表示没能得到全部受影响的记录，改为使所有缓存失效
+// 缓存删除失败不影响写入结果，依赖过期时间和延迟删除兜底
+func (c *CachedRepo[T, C]) invalidate(ctx context.Context, before []*T, complete bool, write func() error, after func() ([]*T, bool)) error {
+	keys := c.entityKeys(before)
+	c.del(ctx, keys)
+	if !complete {
+		c.flush(ctx)
+	}
+	if err := write(); err != nil {
+		return err
+	}
+
+	items, ok := after()
+	keys = append(keys, c.entityKeys(items)...)
+	c.evict(ctx, keys, !complete || !ok)
+	return nil
+}
+
+// evict 写入后删除缓存并延迟再删除一次，all 为 true 时使所有缓存失效
+func (c *CachedRepo[T, C]) evict(ctx context.Context, keys []string, all bool) {
+	c.del(ctx, keys)
+	if all {
+		c.flush(ctx)
+	}
+	c.delLater(ctx, keys, all)
+}
+
+// find 查询包括已软删除在内的记录，只读取计算缓存 key 需要的字段，最多读取 InvalidateLimit 条；
+// 超过上限或查询出错时返回 false，调用方需要使所有缓存失效
+// 通过 Iterate 读取，不受底层仓库 SetUnboundedFindLimit 的限制
+func (c *CachedRepo[T, C]) find(ctx context.Context, filter any) ([]*T, bool) {
+	var items []*T
+	limit := c.opts.InvalidateLimit
+	for item, err := range c.Repo.Iterate(ctx, filter, Find().WithDeleted().SetReturnFields(c.fields...).SetLimit(limit+1)) {
+		if err != nil || int64(len(items)) == limit {
+			return nil, false
+		}
+		items = append(items, item)
+	}
+	return items, true
+}
+
+// newQueryBuilder 转发底层仓库的查询构建器
+func (c *CachedRepo[T, C]) newQueryBuilder() builder.QBuilder {
+	if p, ok := c.Repo.(queryBuilderRepo); ok {
+		return p.newQueryBuilder()
+	}
+	return builder.NewMongoQueryBuilder()
+}
+
+// idField 转发底层仓库的主键字段名
+func (c *CachedRepo[T, C]) idField() string {
+	if p, ok := c.Repo.(queryBuilderRepo); ok {
+		return p.idField()
+	}
+	return "_id"
+}
+
+// fieldName 转发底层仓库的字段名
+func (c *CachedRepo[T, C]) fieldName(f *fieldInfo) string {
+	if p, ok := c.Repo.(queryBuilderRepo); ok {
+		return p.fieldName(f)
+	}
+	return f.BsonName
+}
+
+// aggregate 转发底层仓库的聚合，不使用缓存
+func (c *CachedRepo[T, C]) aggregate(ctx context.Context, filter any, o *AggregateOptions, dest any) error {
+	if a, ok := c.Repo.(aggregateRepo); ok {
+		return a.aggregate(ctx, filter, o, dest)
+	}
+	return ErrAggregateUnsupported
+}
+
+// distinct 转发底层仓库的去重查询，不使用缓存
+func (c *CachedRepo[T, C]) distinct(ctx context.Context, field string, filter any, dest any) error {
+	if a, ok := c.Repo.(aggregateRepo); ok {
+		return a.distinct(ctx, field, filter, dest)
+	}
+	return ErrAggregateUnsupported
+}
+
+// resolveIndex 转发底层仓库的索引解析
+func (c *CachedRepo[T, C]) resolveIndex(idx Index) (Index, error) {
+	if ir, ok := c.Repo.(indexRepo); ok {
+		return ir.resolveIndex(idx)
+	}
+	return idx, ErrIndexUnsupported
+}
+
+// listIndexes 转发底层仓库的索引查询
+func (c *CachedRepo[T, C]) listIndexes(ctx context.Context) ([]Index, error) {
+	if ir, ok := c.Repo.(indexRepo); ok {
+		return ir.listIndexes(ctx)
+	}
+	return nil, ErrIndexUnsupported
+}
+
+// createIndex 转发底层仓库的索引创建
+func (c *CachedRepo[T, C]) createIndex(ctx context.Context, idx Index) error {
+	if ir, ok := c.Repo.(indexRepo); ok {
+		return ir.createIndex(ctx, idx)
+	}
+	return ErrIndexUnsupported
+}
+
+// tenantScope 转发底层仓库的租户隔离配置
+func (c *CachedRepo[T, C]) tenantScope() tenancy {
+	return c.tenancy
+}
+
+// idsFilter 构建按主键查询的过滤条件，底层仓库不支持时返回 false
+func (c *CachedRepo[T, C]) idsFilter(ids []any) (any, bool) {
+	if _, ok := c.Repo.(queryBuilderRepo); !ok || len(ids) == 0 {
+		return nil, false
+	}
+	return c.newQueryBuilder().In(c.idField(), ids...).Build(), true
+}
+
+// filterKey 判断查询能否走缓存并返回缓存 key
+func (c *CachedRepo[T, C]) filterKey(ctx context.Context, filter any, opts []IList[FindOptions]) (string, bool) {
+	if ctx.Value(gormTxKey{}) != nil || mongo.SessionFromContext(ctx) != nil {
+		return "", false
+	}
+	o := NewOptions(opts...)
+	// 要求读取主节点或指定读关注时需要最新数据，不走缓存
+	if len(o.ReturnFields) > 0 || o.Deleted != DeletedExcluded || o.Read == ReadPrimary || o.ReadConcern != "" {
+		return "", false
+	}
+
+	tenant, scoped, err := c.tenancy.current(ctx)
+	if err != nil || (c.tenancy.enabled() && !scoped) {
+		return "", false
+	}
+	kvs, ok := equalityConditions(filter)
+	if !ok {
+		return "", false
+	}
+	values := make(map[*fieldInfo]any, len(kvs))
+	for k, v := range kvs {
+		f, ok := c.schema.Field(k)
+		if !ok {
+			return "", false
+		}
+		values[f] = v
+	}
+	for _, fields := range c.keys {
+		if len(fields) != len(values) {
+			continue
+		}
+		vs := make([]any, len(fields))
+		for i, f := range fields {
+			if vs[i], ok = values[f]; !ok {
+				break
+			}
+		}
+		if ok {
+			return c.key(tenant, fields, vs), true
+		}
+	}
+	return "", false
+}
+
+// entityKeys 返回实体所有可能的缓存 key
+func (c *CachedRepo[T, C]) entityKeys(items []*T) []string {
+	var keys []string
+	for _, item := range items {
+		rv := reflect.ValueOf(item)
+		var tenant any
+		if c.tenancy.enabled() {
+			tenant, _ = c.tenancy.field.Value(rv)
+		}
+		for _, fields := range c.keys {
+			vs := make([]any, len(fields))
+			for i, f := range fields {
+				vs[i], _ = f.Value(rv)
+			}
+			keys = append(keys, c.key(tenant, fields, vs))
+		}
+	}
+	return keys
+}
+
+// key 由租户、字段名和值组成缓存 key，如 repox:User:Id=1，启用租户隔离时为 repox:User:TenantId=t1:Id=1
+func (c *CachedRepo[T, C]) key(tenant any, fields []*fieldInfo, values []any) string {
+	var sb strings.Builder
+	sb.WriteString(c.opts.Prefix)
+	if c.tenancy.enabled() {
+		sb.WriteString(":")
+		sb.WriteString(c.tenancy.field.Name)
+		sb.WriteString("=")
+		sb.WriteString(fmt.Sprint(normalizeValue(tenant)))
+	}
+	for i, f := range fields {
+		sb.WriteString(":")
+		sb.WriteString(f.Name)
+		sb.WriteString("=")
+		sb.WriteString(fmt.Sprint(normalizeValue(values[i])))
+	}
+	return sb.String()
+}
+
+// cacheEntry 缓存值，Gen 为写入时的缓存代数，Item 为 nil 表示负缓存
+type cacheEntry[T any] struct {
+	Gen   int64
+	Found bool
+	Item  *T
+}
+
+// genKey 缓存代数的 key，递增后之前写入的缓存全部失效
+func (c *CachedRepo[T, C]) genKey() string {
+	return c.opts.Prefix + ":gen"
+}
+
+// get 读取缓存和当前的缓存代数，hit 为 true 且 item 为 nil 表示命中负缓存；
+// 读取或解码失败、缓存代数不一致视为未命中
+func (c *CachedRepo[T, C]) get(ctx context.Context, key string) (item *T, hit bool, gen int64) {
+	values, err := c.cli.MGet(ctx, c.genKey(), key).Result()
+	if err != nil {
+		return nil, false, 0
+	}
+	if s, ok := values[0].(string); ok {
+		gen, _ = strconv.ParseInt(s, 10, 64)
+	}
+	data, ok := values[1].(string)
+	if !ok {
+		return nil, false, gen
+	}
+	var entry cacheEntry[T]
+	if err = gob.NewDecoder(strings.NewReader(data)).Decode(&entry); err != nil || entry.Gen != gen {
+		return nil, false, gen
+	}
+	if !entry.Found {
+		return nil, true, gen
+	}
+	if entry.Item == nil {
+		// gob 不传输零值，所有字段为零值的记录解码后为 nil
+		entry.Item = new(T)
+	}
+	return entry.Item, true, gen
+}
+
+// set 写入缓存，item 为 nil 时写入负缓存；gen 为查询前读取的缓存代数
+func (c *CachedRepo[T, C]) set(ctx context.Context, key string, gen int64, item *T) {
+	ttl := c.opts.TTL
+	if item == nil {
+		if ttl = c.opts.NotFoundTTL; ttl <= 0 {
+			return
+		}
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(cacheEntry[T]{Gen: gen, Found: item != nil, Item: item}); err != nil {
+		return
+	}
+	_ = redisx.SetByClient(ctx, c.cli, key, buf.String(), ttl)
+}
+
+// flush 递增缓存代数，使该实体的所有缓存失效
+func (c *CachedRepo[T, C]) flush(ctx context.Context) {
+	_ = c.cli.Incr(ctx, c.genKey()).Err()
+}
+
+func (c *CachedRepo[T, C]) del(ctx context.Context, keys []string) {
+	if len(keys) == 0 {
+		return
+	}
+	_ = redisx.DelByClient(ctx, c.cli, keys...)
+}
+
+// delLater 延迟删除，覆盖写入前后并发读取到旧值并回填缓存的情况；all 为 true 时延迟后再次递增缓存代数
+func (c *CachedRepo[T, C]) delLater(ctx context.Context, keys []string, all bool) {
+	if (len(keys) == 0 && !all) || c.opts.DoubleDeleteDelay < 0 {
+		return
+	}
+	keys = slices.Compact(slices.Sorted(slices.Values(keys)))
+	ctx = context.WithoutCancel(ctx)
+	time.AfterFunc(c.opts.DoubleDeleteDelay, func() {
+		ctx, cancel := context.WithTimeout(ctx, cacheDeleteTimeout)
+		defer cancel()
+		c.del(ctx, keys)
+		if all {
+			c.flush(ctx)
+		}
+	})
+}
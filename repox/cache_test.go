@@ -0,0 +1,279 @@
+package repox
+
+import (
+	"context"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/mbeoliero/kit/builder"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"gorm.io/gorm"
+)
+
+// newCachedUsers 返回缓存装饰器和底层 FindOne 的调用次数
+func newCachedUsers(t *testing.T, opts ...IList[CacheOptions]) (*CachedRepo[memUser, []*memUser], *miniredis.Miniredis, *atomic.Int32) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	cli := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = cli.Close() })
+
+	calls := &atomic.Int32{}
+	counter := InterceptorFunc(func(ctx context.Context, op *Operation, next Invoker) error {
+		if op.Name == OpFindOne {
+			calls.Add(1)
+			// 放大查询耗时，让并发的未命中落在同一次查询内
+			time.Sleep(20 * time.Millisecond)
+		}
+		return next(ctx, op)
+	})
+	repo := Wrap[memUser, []*memUser](newMemUsers(t), counter)
+	return NewCachedRepo(repo, cli, opts...), mr, calls
+}
+
+func TestCachedRepo_FindOne(t *testing.T) {
+	ctx := context.Background()
+	repo, mr, calls := newCachedUsers(t, Cache().AddUniqueKey("name"))
+
+	for range 3 {
+		u, err := repo.FindOne(ctx, bson.M{"_id": 1})
+		require.NoError(t, err)
+		assert.Equal(t, "alice", u.Name)
+	}
+	assert.Equal(t, int32(1), calls.Load())
+	assert.True(t, mr.Exists("repox:memUser:Id=1"))
+
+	u, err := repo.FindOne(ctx, bson.D{{Key: "name", Value: "bob"}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), u.Id)
+	_, err = repo.FindOne(ctx, map[string]any{"name": "bob"})
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), calls.Load())
+
+	// 非主键、唯一键或包含操作符的条件不走缓存
+	_, err = repo.FindOne(ctx, bson.M{"age": 30})
+	require.NoError(t, err)
+	_, err = repo.FindOne(ctx, bson.M{"_id": bson.M{"$gte": 1}})
+	require.NoError(t, err)
+	_, err = repo.FindOne(ctx, bson.M{"_id": 1}, Find().SetReturnFields("name"))
+	require.NoError(t, err)
+	assert.Equal(t, int32(5), calls.Load())
+
+	// 要求读取主节点时不走缓存，读取从节点仍然走缓存
+	_, err = repo.FindOne(ctx, bson.M{"_id": 1}, Find().ReadFromPrimary())
+	require.NoError(t, err)
+	_, err = repo.FindOne(ctx, bson.M{"_id": 1}, Find().ReadFromReplica(0))
+	require.NoError(t, err)
+	assert.Equal(t, int32(6), calls.Load())
+}
+
+func TestCachedRepo_NotFound(t *testing.T) {
+	ctx := context.Background()
+	repo, mr, calls := newCachedUsers(t, Cache().AddUniqueKey("name"))
+
+	for range 2 {
+		_, err := repo.FindOne(ctx, bson.M{"name": "erin"})
+		assert.ErrorIs(t, err, DataNotFound)
+	}
+	assert.Equal(t, int32(1), calls.Load())
+	assert.Equal(t, defaultNotFoundTTL, mr.TTL("repox:memUser:Name=erin"))
+
+	// 创建记录后负缓存失效
+	require.NoError(t, repo.Create(ctx, &memUser{Name: "erin"}))
+	u, err := repo.FindOne(ctx, bson.M{"name": "erin"})
+	require.NoError(t, err)
+	assert.Equal(t, "erin", u.Name)
+}
+
+func TestCachedRepo_Singleflight(t *testing.T) {
+	ctx := context.Background()
+	repo, _, calls := newCachedUsers(t)
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			u, err := repo.FindOne(ctx, bson.M{"_id": 3})
+			assert.NoError(t, err)
+			assert.Equal(t, "carol", u.Name)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestCachedRepo_Invalidate(t *testing.T) {
+	ctx := context.Background()
+	repo, mr, _ := newCachedUsers(t, Cache().AddUniqueKey("name").SetDoubleDeleteDelay(20*time.Millisecond))
+
+	_, err := repo.FindOne(ctx, bson.M{"_id": 1})
+	require.NoError(t, err)
+	_, err = repo.FindOne(ctx, bson.M{"name": "alice"})
+	require.NoError(t, err)
+
+	// 修改唯一键后新旧 key 都会失效
+	_, err = repo.UpdateOne(ctx, bson.M{"name": "alice"}, map[string]any{"name": "alice2"})
+	require.NoError(t, err)
+	assert.False(t, mr.Exists("repox:memUser:Id=1"))
+	assert.False(t, mr.Exists("repox:memUser:Name=alice"))
+	u, err := repo.FindOne(ctx, bson.M{"_id": 1})
+	require.NoError(t, err)
+	assert.Equal(t, "alice2", u.Name)
+
+	u.Age = 21
+	require.NoError(t, repo.Update(ctx, u))
+	// 延迟双删清理写入后被并发读取回填的旧值
+	require.NoError(t, mr.Set("repox:memUser:Id=1", `{"Id":1,"Name":"alice2","Age":20}`))
+	assert.Eventually(t, func() bool { return !mr.Exists("repox:memUser:Id=1") }, time.Second, 5*time.Millisecond)
+	got, err := repo.FindOne(ctx, bson.M{"_id": 1})
+	require.NoError(t, err)
+	assert.Equal(t, 21, got.Age)
+
+	_, err = repo.DeleteOne(ctx, bson.M{"_id": 1})
+	require.NoError(t, err)
+	_, err = repo.FindOne(ctx, bson.M{"_id": 1})
+	assert.ErrorIs(t, err, DataNotFound)
+}
+
+func TestCachedRepo_BulkWrite(t *testing.T) {
+	ctx := context.Background()
+	repo, mr, _ := newCachedUsers(t, Cache().AddUniqueKey("name"))
+
+	_, err := repo.FindOne(ctx, bson.M{"_id": 2})
+	require.NoError(t, err)
+	_, err = repo.FindOne(ctx, bson.M{"name": "erin"})
+	assert.ErrorIs(t, err, DataNotFound)
+
+	// 部分操作失败时已完成操作涉及的缓存同样失效
+	_, err = repo.BulkWrite(ctx, []WriteOp[memUser]{
+		InsertOp(&memUser{Name: "erin"}),
+		UpdateOneOp[memUser](bson.M{"_id": 2}, map[string]any{"age": 99}),
+		InsertOp(&memUser{Id: 1}),
+	}, Bulk().SetOrdered(false))
+	assert.ErrorIs(t, err, ErrDuplicateKey)
+	assert.False(t, mr.Exists("repox:memUser:Id=2"))
+	assert.False(t, mr.Exists("repox:memUser:Name=erin"))
+
+	u, err := repo.FindOne(ctx, bson.M{"_id": 2})
+	require.NoError(t, err)
+	assert.Equal(t, 99, u.Age)
+	_, err = repo.FindOne(ctx, bson.M{"name": "erin"})
+	require.NoError(t, err)
+}
+
+func TestCachedRepo_Tenant(t *testing.T) {
+	mr := miniredis.RunT(t)
+	cli := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = cli.Close() })
+	repo := NewCachedRepo[tenantDoc, []*tenantDoc](NewMemoryRepo[tenantDoc](Options().SetTenant("", nil)), cli)
+	a := WithTenant(context.Background(), "a")
+	b := WithTenant(context.Background(), "b")
+	require.NoError(t, repo.Create(a, &tenantDoc{Title: "a1"}))
+
+	_, err := repo.FindOne(a, bson.M{"_id": 1})
+	require.NoError(t, err)
+	assert.True(t, mr.Exists("repox:tenantDoc:TenantId=a:Id=1"))
+
+	// 其它租户不会命中该租户的缓存，跨租户读取不走缓存
+	_, err = repo.FindOne(b, bson.M{"_id": 1})
+	assert.ErrorIs(t, err, DataNotFound)
+	got, err := repo.FindOne(CrossTenant(context.Background()), bson.M{"_id": 1})
+	require.NoError(t, err)
+	assert.Equal(t, "a1", got.Title)
+	_, err = repo.FindOne(context.Background(), bson.M{"_id": 1})
+	assert.ErrorIs(t, err, ErrTenantRequired)
+}
+
+func TestCachedRepo_InvalidateLimit(t *testing.T) {
+	ctx := context.Background()
+	repo, mr, calls := newCachedUsers(t, Cache().SetInvalidateLimit(2).SetDoubleDeleteDelay(-1))
+
+	_, err := repo.FindOne(ctx, bson.M{"_id": 1})
+	require.NoError(t, err)
+	_, err = repo.FindOne(ctx, bson.M{"_id": 2})
+	require.NoError(t, err)
+
+	// 影响的记录不超过上限时逐条删除
+	_, err = repo.UpdateMany(ctx, bson.M{"age": 30}, map[string]any{"age": 31})
+	require.NoError(t, err)
+	assert.False(t, mr.Exists("repox:memUser:Id=2"))
+	assert.False(t, mr.Exists("repox:memUser:gen"))
+
+	// 超过上限时递增缓存代数，之前的缓存全部失效
+	_, err = repo.FindOne(ctx, bson.M{"_id": 2})
+	require.NoError(t, err)
+	require.Equal(t, int32(3), calls.Load())
+	_, err = repo.UpdateMany(ctx, bson.M{"age": bson.M{"$gte": 0}}, map[string]any{"age": 40})
+	require.NoError(t, err)
+	assert.True(t, mr.Exists("repox:memUser:Id=1"))
+	gen, err := mr.Get("repox:memUser:gen")
+	require.NoError(t, err)
+	assert.Equal(t, "2", gen)
+	for _, id := range []int64{1, 2} {
+		u, err := repo.FindOne(ctx, bson.M{"_id": id})
+		require.NoError(t, err)
+		assert.Equal(t, 40, u.Age)
+	}
+	assert.Equal(t, int32(5), calls.Load())
+}
+
+type secretUser struct {
+	Id        int64     `bson:"_id" gorm:"primaryKey"`
+	Name      string    `bson:"name"`
+	Hash      string    `bson:"hash" json:"-"`
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+func TestCachedRepo_Encoding(t *testing.T) {
+	mr := miniredis.RunT(t)
+	cli := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = cli.Close() })
+	ctx := context.Background()
+	mem := NewMemoryRepo[secretUser]()
+	repo := NewCachedRepo[secretUser, []*secretUser](mem, cli)
+	at := time.Date(2024, 5, 1, 10, 0, 0, 123456789, time.UTC)
+	require.NoError(t, mem.Create(ctx, &secretUser{Name: "alice", Hash: "h", CreatedAt: at}))
+
+	for range 2 {
+		u, err := repo.FindOne(ctx, bson.M{"_id": 1})
+		require.NoError(t, err)
+		// json:"-" 字段和纳秒精度的时间在命中缓存时保留
+		assert.Equal(t, "h", u.Hash)
+		assert.True(t, at.Equal(u.CreatedAt))
+	}
+	assert.True(t, mr.Exists("repox:secretUser:Id=1"))
+}
+
+func TestCachedRepo_GormClause(t *testing.T) {
+	mr := miniredis.RunT(t)
+	cli := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = cli.Close() })
+	db, mock := newMockDB(t)
+	repo := NewCachedRepo[txUser, *gorm.DB](NewGormRepo[txUser](db), cli)
+	ctx := context.Background()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `tx_users` WHERE `id` = ? ORDER BY `tx_users`.`id` LIMIT ?")).
+		WithArgs(1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "alice"))
+	for range 2 {
+		u, err := repo.FindOne(ctx, builder.NewGormQueryBuilder().Id(1).Build())
+		require.NoError(t, err)
+		assert.Equal(t, "alice", u.Name)
+	}
+	assert.True(t, mr.Exists("repox:txUser:Id=1"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	kvs, ok := equalityConditions(builder.NewGormQueryBuilder().Eq("name", "a").Eq("id", 1).Build())
+	assert.True(t, ok)
+	assert.Equal(t, map[string]any{"name": "a", "id": 1}, kvs)
+	_, ok = equalityConditions(builder.NewGormQueryBuilder().Eq("name", "a").Gt("id", 1).Build())
+	assert.False(t, ok)
+}
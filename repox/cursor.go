@@ -0,0 +1,242 @@
+package repox
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/mbeoliero/kit/builder"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// defaultPageLimit FindPage 未指定 limit 时的默认页大小
+const defaultPageLimit = 20
+
+// CursorPage 游标分页结果
+type CursorPage[T any] struct {
+	Items []*T
+	Next  string // 下一页游标，没有更多数据时为空
+	Prev  string // 上一页游标，当前为第一页时为空
+}
+
+// pageCursor 游标内容：一行记录的排序键值（最后一个为 id）及翻页方向
+type pageCursor struct {
+	Values   []any `bson:"v"`
+	Backward bool  `bson:"b"`
+}
+
+// cursorTimeKey 游标中时间值的编码 key，bson DateTime 只保留毫秒，时间以 RFC3339Nano 字符串保存完整精度
+const cursorTimeKey = "$time"
+
+// encodeCursor 将游标编码为不透明字符串，使用 bson 编码以保留 ObjectID 等值的类型
+func encodeCursor(c pageCursor) (string, error) {
+	values := make([]any, len(c.Values))
+	for i, v := range c.Values {
+		if t, ok := v.(time.Time); ok {
+			v = bson.D{{Key: cursorTimeKey, Value: t.Format(time.RFC3339Nano)}}
+		}
+		values[i] = v
+	}
+	c.Values = values
+	data, err := bson.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCursor 解码游标
+func decodeCursor(s string) (pageCursor, error) {
+	var c pageCursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	var raw struct {
+		Values bson.A `bson:"v"`
+		B      bool   `bson:"b"`
+	}
+	if err = bson.Unmarshal(data, &raw); err != nil {
+		return c, ErrInvalidCursor
+	}
+	c.Backward = raw.B
+	c.Values = make([]any, len(raw.Values))
+	for i, v := range raw.Values {
+		switch tv := v.(type) {
+		case bson.D:
+			s, ok := "", len(tv) == 1 && tv[0].Key == cursorTimeKey
+			if ok {
+				s, ok = tv[0].Value.(string)
+			}
+			if !ok {
+				return c, ErrInvalidCursor
+			}
+			t, err := time.Parse(time.RFC3339Nano, s)
+			if err != nil {
+				return c, ErrInvalidCursor
+			}
+			v = t
+		case bson.DateTime:
+			v = tv.Time()
+		}
+		c.Values[i] = v
+	}
+	return c, nil
+}
+
+// pager 基于排序键的游标分页实现，各仓库提供查询函数、查询构建器和 id 字段名
+type pager[T any] struct {
+	find       func(ctx context.Context, filter any, opts ...IList[FindOptions]) ([]*T, error)
+	newBuilder func() builder.QBuilder
+	idField    string
+	// whereAll 为 true 时不通过查询构建器合并过滤条件，由仓库逐个应用（GORM 构建器无法合并 struct、字符串等条件）
+	whereAll bool
+}
+
+// page 查询一页数据
+// 排序键为 sort 中的字段加上 id（升序）作为唯一的决胜字段，游标记录页首或页尾一行的排序键值
+func (p pager[T]) page(ctx context.Context, filter any, sort *Sort, cursor string, limit int64) (*CursorPage[T], error) {
+	if limit <= 0 {
+		limit = defaultPageLimit
+	}
+
+	keys := p.sortKeys(sort)
+	schema := schemaFor[T]()
+	fields := make([]*fieldInfo, len(keys))
+	for i, k := range keys {
+		f, ok := schema.Field(k.Field)
+		if !ok {
+			return nil, fmt.Errorf("repox: unknown sort field %s of %s", k.Field, schema.Type)
+		}
+		fields[i] = f
+	}
+
+	var c pageCursor
+	if cursor != "" {
+		var err error
+		if c, err = decodeCursor(cursor); err != nil {
+			return nil, err
+		}
+		if len(c.Values) != len(keys) {
+			return nil, ErrInvalidCursor
+		}
+	}
+
+	querySort := &Sort{fields: keys}
+	if c.Backward {
+		querySort = reverseSort(keys)
+	}
+	if cursor != "" {
+		filter = p.andFilter(filter, p.keysetFilter(querySort.fields, c.Values))
+	}
+
+	items, err := p.find(ctx, filter, Find().SetSort(querySort).SetLimit(limit+1))
+	if err != nil {
+		return nil, err
+	}
+	hasMore := int64(len(items)) > limit
+	if hasMore {
+		items = items[:limit]
+	}
+	if c.Backward {
+		slices.Reverse(items)
+	}
+
+	page := &CursorPage[T]{Items: items}
+	if len(items) == 0 {
+		return page, nil
+	}
+	// 向后翻页时 hasMore 表示前面还有数据，向前翻页时表示后面还有数据
+	hasNext, hasPrev := hasMore, cursor != ""
+	if c.Backward {
+		hasNext, hasPrev = true, hasMore
+	}
+	if hasNext {
+		if page.Next, err = encodeRowCursor(fields, items[len(items)-1], false); err != nil {
+			return nil, err
+		}
+	}
+	if hasPrev {
+		if page.Prev, err = encodeRowCursor(fields, items[0], true); err != nil {
+			return nil, err
+		}
+	}
+	return page, nil
+}
+
+// sortKeys 返回排序键，未包含 id 时追加 id 升序
+func (p pager[T]) sortKeys(sort *Sort) []SortField {
+	var keys []SortField
+	if sort != nil {
+		keys = append(keys, sort.fields...)
+	}
+	for _, k := range keys {
+		if k.Field == p.idField {
+			return keys
+		}
+	}
+	return append(keys, SortField{Field: p.idField, Order: Asc})
+}
+
+// keysetFilter 构建排序键之后的条件：
+// (k1 > v1) OR (k1 = v1 AND k2 > v2) OR ...，降序字段使用 <
+func (p pager[T]) keysetFilter(keys []SortField, values []any) any {
+	branches := make([]any, 0, len(keys))
+	for i, k := range keys {
+		b := p.newBuilder()
+		for j := 0; j < i; j++ {
+			b.Eq(keys[j].Field, values[j])
+		}
+		if k.Order == Desc {
+			b.Lt(k.Field, values[i])
+		} else {
+			b.Gt(k.Field, values[i])
+		}
+		branches = append(branches, b)
+	}
+	return p.newBuilder().Or(branches...).Build()
+}
+
+// andFilter 合并用户过滤条件和游标条件
+func (p pager[T]) andFilter(filter any, cond any) any {
+	if filter == nil {
+		return cond
+	}
+	if p.whereAll {
+		return whereAll{filter, cond}
+	}
+	return p.newBuilder().And(filter, cond).Build()
+}
+
+// whereAll 需要同时满足的多个过滤条件，GormRepo 对每个条件分别调用 Where
+type whereAll []any
+
+// reverseSort 返回方向相反的排序
+func reverseSort(keys []SortField) *Sort {
+	s := NewSort()
+	for _, k := range keys {
+		if k.Order == Desc {
+			s.Asc(k.Field)
+		} else {
+			s.Desc(k.Field)
+		}
+	}
+	return s
+}
+
+// encodeRowCursor 根据记录的排序键值生成游标
+func encodeRowCursor(fields []*fieldInfo, row any, backward bool) (string, error) {
+	values := make([]any, len(fields))
+	rv := reflect.ValueOf(row)
+	for i, f := range fields {
+		v, _ := f.Value(rv)
+		values[i] = normalizeValue(v)
+	}
+	return encodeCursor(pageCursor{Values: values, Backward: backward})
+}
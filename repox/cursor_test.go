@@ -0,0 +1,153 @@
+package repox
+
+import (
+	"context"
+	"encoding/base64"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/mbeoliero/kit/builder"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func pageNames(items []*memUser) []string {
+	names := make([]string, len(items))
+	for i, item := range items {
+		names[i] = item.Name
+	}
+	return names
+}
+
+func TestFindPage_Memory(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo[memUser]()
+	require.NoError(t, repo.CreateMany(ctx, []*memUser{
+		{Name: "a", Age: 30},
+		{Name: "b", Age: 20},
+		{Name: "c", Age: 30},
+		{Name: "d", Age: 10},
+		{Name: "e", Age: 20},
+		{Name: "f", Age: 99},
+	}))
+	filter := bson.M{"age": bson.M{"$lt": 99}}
+	sort := NewSort().Desc("age")
+
+	p1, err := repo.FindPage(ctx, filter, sort, "", 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "c"}, pageNames(p1.Items))
+	assert.Empty(t, p1.Prev)
+	require.NotEmpty(t, p1.Next)
+
+	p2, err := repo.FindPage(ctx, filter, sort, p1.Next, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b", "e"}, pageNames(p2.Items))
+	require.NotEmpty(t, p2.Prev)
+	require.NotEmpty(t, p2.Next)
+
+	p3, err := repo.FindPage(ctx, filter, sort, p2.Next, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"d"}, pageNames(p3.Items))
+	assert.Empty(t, p3.Next)
+
+	back, err := repo.FindPage(ctx, filter, sort, p3.Prev, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b", "e"}, pageNames(back.Items))
+
+	first, err := repo.FindPage(ctx, filter, sort, back.Prev, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "c"}, pageNames(first.Items))
+	assert.Empty(t, first.Prev)
+	assert.Equal(t, p1.Next, first.Next)
+
+	_, err = repo.FindPage(ctx, filter, sort, "not-a-cursor", 2)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+	_, err = repo.FindPage(ctx, filter, nil, p1.Next, 2)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestFindPage_Gorm(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewGormRepo[txUser](db)
+	ctx := context.Background()
+
+	cursor, err := encodeCursor(pageCursor{Values: []any{"bob", int64(7)}})
+	require.NoError(t, err)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `tx_users` WHERE (`name` > ? OR (`name` = ? AND `id` > ?)) ORDER BY name ASC, id ASC LIMIT ?")).
+		WithArgs("bob", "bob", int64(7), 3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(8, "bob").AddRow(2, "carl").AddRow(3, "dan"))
+
+	page, err := repo.FindPage(ctx, nil, NewSort().Asc("name"), cursor, 2)
+	require.NoError(t, err)
+	require.Len(t, page.Items, 2)
+	assert.NotEmpty(t, page.Next)
+	assert.NotEmpty(t, page.Prev)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	next, err := decodeCursor(page.Next)
+	require.NoError(t, err)
+	assert.Equal(t, []any{"carl", int64(2)}, next.Values)
+}
+
+func TestFindPage_GormFilter(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewGormRepo[txUser](db)
+	ctx := context.Background()
+
+	cursor, err := encodeCursor(pageCursor{Values: []any{int64(7)}})
+	require.NoError(t, err)
+
+	// struct、字符串和 map 过滤条件在翻页时保留
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `tx_users` WHERE `tx_users`.`name` = ? AND `id` > ? ORDER BY id ASC LIMIT ?")).
+		WithArgs("bob", int64(7), 3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(8, "bob"))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `tx_users` WHERE name <> 'x' AND `id` > ? ORDER BY id ASC LIMIT ?")).
+		WithArgs(int64(7), 3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `tx_users` WHERE `tx_users`.`name` = ? AND `id` > ? ORDER BY id ASC LIMIT ?")).
+		WithArgs("bob", int64(7), 3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}))
+
+	for _, filter := range []any{&txUser{Name: "bob"}, "name <> 'x'", map[string]any{"name": "bob"}} {
+		_, err = repo.FindPage(ctx, filter, nil, cursor, 2)
+		require.NoError(t, err)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCursor_TimePrecision(t *testing.T) {
+	at := time.Date(2024, 5, 1, 10, 0, 0, 123456789, time.UTC)
+	s, err := encodeCursor(pageCursor{Values: []any{at, bson.NewObjectID()}})
+	require.NoError(t, err)
+	c, err := decodeCursor(s)
+	require.NoError(t, err)
+	assert.True(t, at.Equal(c.Values[0].(time.Time)))
+
+	data, err := bson.Marshal(bson.M{"v": bson.A{bson.D{{Key: cursorTimeKey, Value: 1}}}})
+	require.NoError(t, err)
+	_, err = decodeCursor(base64.RawURLEncoding.EncodeToString(data))
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestGormRepo_PostgresQueryBuilder(t *testing.T) {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+		DryRun:               true,
+		DisableAutomaticPing: true,
+		Logger:               logger.Discard,
+	})
+	require.NoError(t, err)
+	repo := NewGormRepo[claimJob](db)
+
+	// 分页、Loader 和缓存使用的内部构建器按方言渲染
+	var jobs []claimJob
+	cond := repo.newQueryBuilder().Like("status", "pend", builder.MatchStartsWith).Build()
+	stmt := db.Where(cond).Find(&jobs).Statement
+	assert.Equal(t, `SELECT * FROM "claim_jobs" WHERE "status" ILIKE $1`, stmt.SQL.String())
+}
@@ -0,0 +1,181 @@
+package repox
+
+import (
+	"context"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type claimJob struct {
+	Id       int64  `bson:"_id" gorm:"primaryKey"`
+	Status   string `bson:"status"`
+	Priority int    `bson:"priority"`
+}
+
+func TestFindOneAndUpdate_Memory(t *testing.T) {
+	ctx := context.Background()
+	repo := newMemUsers(t)
+
+	// 默认返回更新前的记录
+	before, err := repo.FindOneAndUpdate(ctx, bson.M{"age": 30}, map[string]any{"name": "x"}, Update().SetSort(NewSort().Desc("name")))
+	require.NoError(t, err)
+	assert.Equal(t, "dave", before.Name)
+
+	after, err := repo.FindOneAndUpdate(ctx, bson.M{"age": 30}, map[string]any{"age": 31}, Update().SetSort(NewSort().Asc("name")).SetReturnAfter(true))
+	require.NoError(t, err)
+	assert.Equal(t, "bob", after.Name)
+	assert.Equal(t, 31, after.Age)
+
+	_, err = repo.FindOneAndUpdate(ctx, bson.M{"name": "erin"}, map[string]any{"age": 1})
+	assert.ErrorIs(t, err, DataNotFound)
+
+	inserted, err := repo.FindOneAndUpdate(ctx, bson.M{"name": "erin"}, map[string]any{"age": 1}, Update().SetUpsert(true).SetReturnAfter(true))
+	require.NoError(t, err)
+	assert.Equal(t, "erin", inserted.Name)
+	assert.Equal(t, 1, inserted.Age)
+	assert.Equal(t, int64(5), inserted.Id)
+
+	inserted, err = repo.FindOneAndUpdate(ctx, bson.M{"name": "frank"}, map[string]any{"age": 2}, Update().SetUpsert(true))
+	require.NoError(t, err)
+	assert.Nil(t, inserted)
+	n, err := repo.Count(ctx, bson.M{"name": "frank", "age": 2})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+}
+
+func TestFindOneAndUpdate_Claim(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo[claimJob]()
+	for i := range 20 {
+		require.NoError(t, repo.Create(ctx, &claimJob{Status: "pending", Priority: i % 3}))
+	}
+
+	var (
+		mu      sync.Mutex
+		claimed = map[int64]int{}
+		wg      sync.WaitGroup
+	)
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				job, err := repo.FindOneAndUpdate(ctx, bson.M{"status": "pending"}, map[string]any{"status": "running"},
+					Update().SetSort(NewSort().Desc("priority")))
+				if err != nil {
+					assert.ErrorIs(t, err, DataNotFound)
+					return
+				}
+				mu.Lock()
+				claimed[job.Id]++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, claimed, 20)
+	for id, times := range claimed {
+		assert.Equal(t, 1, times, "job %d", id)
+	}
+}
+
+func TestFindOneAndDelete_Memory(t *testing.T) {
+	ctx := context.Background()
+	repo := newMemUsers(t)
+
+	u, err := repo.FindOneAndDelete(ctx, bson.M{"age": 30}, Find().SetSort(NewSort().Desc("name")))
+	require.NoError(t, err)
+	assert.Equal(t, "dave", u.Name)
+	n, err := repo.Count(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+
+	_, err = repo.FindOneAndDelete(ctx, bson.M{"name": "dave"})
+	assert.ErrorIs(t, err, DataNotFound)
+
+	soft := NewMemoryRepo[memUser](Options().SetSoftDelete(""))
+	require.NoError(t, soft.Create(ctx, &memUser{Name: "a"}))
+	u, err = soft.FindOneAndDelete(ctx, bson.M{"name": "a"})
+	require.NoError(t, err)
+	assert.Nil(t, u.DeletedAt)
+	deleted, err := soft.FindOne(ctx, bson.M{"name": "a"}, Find().OnlyDeleted())
+	require.NoError(t, err)
+	assert.NotNil(t, deleted.DeletedAt)
+}
+
+func TestFindOneAndUpdate_Gorm(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewGormRepo[claimJob](db)
+	ctx := context.Background()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `claim_jobs` WHERE `claim_jobs`.`status` = ? ORDER BY priority DESC LIMIT ? FOR UPDATE")).
+		WithArgs("pending", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status", "priority"}).AddRow(2, "pending", 30))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `claim_jobs` SET `priority`=? WHERE `id` = ?")).
+		WithArgs(31, int64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `claim_jobs` WHERE `id` = ? ORDER BY `claim_jobs`.`id` LIMIT ?")).
+		WithArgs(int64(2), 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status", "priority"}).AddRow(2, "pending", 31))
+	mock.ExpectCommit()
+
+	u, err := repo.FindOneAndUpdate(ctx, map[string]any{"status": "pending"}, map[string]any{"priority": 31},
+		Update().SetSort(NewSort().Desc("priority")).SetReturnAfter(true))
+	require.NoError(t, err)
+	assert.Equal(t, 31, u.Priority)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `claim_jobs` WHERE `claim_jobs`.`status` = ? ORDER BY `id` LIMIT ? FOR UPDATE")).
+		WithArgs("pending", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status", "priority"}).AddRow(2, "pending", 31))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `claim_jobs` WHERE `id` = ?")).
+		WithArgs(int64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	u, err = repo.FindOneAndDelete(ctx, map[string]any{"status": "pending"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), u.Id)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT .* FOR UPDATE").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectRollback()
+	_, err = repo.FindOneAndDelete(ctx, map[string]any{"status": "pending"})
+	assert.ErrorIs(t, err, DataNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestFindOneAndUpdate_GormReturning(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{SkipDefaultTransaction: true, Logger: logger.Discard})
+	require.NoError(t, err)
+	repo := NewGormRepo[claimJob](db)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "claim_jobs" WHERE "claim_jobs"."status" = $1 ORDER BY "id" LIMIT $2 FOR UPDATE`)).
+		WithArgs("pending", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status", "priority"}).AddRow(2, "pending", 30))
+	mock.ExpectQuery(regexp.QuoteMeta(`UPDATE "claim_jobs" SET "priority"=$1 WHERE "id" = $2 RETURNING *`)).
+		WithArgs(31, int64(2)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status", "priority"}).AddRow(2, "pending", 31))
+	mock.ExpectCommit()
+
+	u, err := repo.FindOneAndUpdate(context.Background(), map[string]any{"status": "pending"}, map[string]any{"priority": 31}, Update().SetReturnAfter(true))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), u.Id)
+	assert.Equal(t, 31, u.Priority)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -3,22 +3,53 @@ package repox
 import "C"
 import (
 	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/mbeoliero/kit/builder"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
+	"gorm.io/plugin/dbresolver"
 )
 
 // GormRepo GORM 通用仓库实现（基于 gorm.G 泛型 API）
+// 使用 WithTx 传入的 ctx 调用时自动加入事务
+// 启用软删除时由仓库自行处理删除字段，GORM 自带的 DeletedAt 作用域不再生效
+// 启用租户隔离时所有操作限定在 ctx 的当前租户内，Native 返回的连接不受限制
 type GormRepo[T any] struct {
-	db *gorm.DB
+	db         *gorm.DB
+	softDelete softDelete
+	tenancy    tenancy
+	ids        idGeneration
+	findGuard  findGuard
+	batchSize  int
 }
 
 // 确保 GormRepo 实现了 Repo 接口
 var _ Repo[any, *gorm.DB] = (*GormRepo[any])(nil)
 
 // NewGormRepo 创建 GORM 仓库
-func NewGormRepo[T any](db *gorm.DB) *GormRepo[T] {
-	return &GormRepo[T]{db: db}
+func NewGormRepo[T any](db *gorm.DB, opts ...IList[RepoOptions]) *GormRepo[T] {
+	o := NewOptions(opts...)
+	schema := schemaFor[T]()
+	batchSize := o.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+	return &GormRepo[T]{
+		db:         db,
+		softDelete: newSoftDelete(schema, o),
+		tenancy:    newTenancy(schema, o),
+		ids:        newIdGeneration(schema, o),
+		findGuard:  newFindGuard(o),
+		batchSize:  batchSize,
+	}
 }
 
 // Native 返回底层 *gorm.DB
@@ -26,27 +57,89 @@ func (r *GormRepo[T]) Native() *gorm.DB {
 	return r.db
 }
 
-// Create 创建单条记录
+// conn 返回本次调用使用的连接，ctx 中携带同一数据库的事务时使用该事务；启用软删除时关闭 GORM 的 DeletedAt 作用域
+func (r *GormRepo[T]) conn(ctx context.Context) *gorm.DB {
+	db := r.db
+	if tx, ok := gormTxFromContext(ctx, r.db); ok {
+		db = tx
+	}
+	if r.softDelete.enabled() {
+		db = db.Unscoped()
+	}
+	return db
+}
+
+// query 返回应用了过滤条件、删除状态条件和租户条件的 *gorm.DB，缺少租户时语句返回 ErrTenantRequired
+func (r *GormRepo[T]) query(ctx context.Context, filter any, scope DeletedScope) *gorm.DB {
+	db := r.conn(ctx).WithContext(ctx).Model(new(T))
+	if conds, ok := filter.(whereAll); ok {
+		for _, cond := range conds {
+			db = db.Where(cond)
+		}
+	} else {
+		db = db.Where(filter)
+	}
+	if cond := r.softDelete.gormCond(scope); cond != nil {
+		db = db.Where(cond)
+	}
+	cond, err := r.tenancy.gormCond(ctx)
+	if err != nil {
+		_ = db.AddError(err)
+	} else if cond != nil {
+		db = db.Where(cond)
+	}
+	return db
+}
+
+// readQuery 返回应用了过滤条件、读取节点和执行时间选项的 *gorm.DB
+func (r *GormRepo[T]) readQuery(ctx context.Context, filter any, o *FindOptions) *gorm.DB {
+	return r.applyReadToDB(r.query(ctx, filter, o.Deleted), o)
+}
+
+// Create 创建单条记录，填充主键、审计字段和租户
 func (r *GormRepo[T]) Create(ctx context.Context, entity *T) error {
-	return wrapError(gorm.G[T](r.db).Create(ctx, entity))
+	if err := r.ids.stamp(ctx, entity); err != nil {
+		return err
+	}
+	if err := r.tenancy.stamp(ctx, entity); err != nil {
+		return err
+	}
+	if err := r.auditor().stampCreate(ctx, entity, time.Now()); err != nil {
+		return err
+	}
+	return wrapError(gorm.G[T](r.conn(ctx)).Create(ctx, entity))
 }
 
-// CreateMany 批量创建记录
+// CreateMany 批量创建记录，填充主键、审计字段和租户，每条 INSERT 语句的记录数由 SetBatchSize 配置
 func (r *GormRepo[T]) CreateMany(ctx context.Context, entities []*T) error {
 	if len(entities) == 0 {
 		return nil
 	}
+	now := time.Now()
+	for _, entity := range entities {
+		if err := r.ids.stamp(ctx, entity); err != nil {
+			return err
+		}
+		if err := r.tenancy.stamp(ctx, entity); err != nil {
+			return err
+		}
+		if err := r.auditor().stampCreate(ctx, entity, now); err != nil {
+			return err
+		}
+	}
 	v := FromPtrSlice(entities)
-	return wrapError(gorm.G[T](r.db).CreateInBatches(ctx, &v, 10))
+	return wrapError(gorm.G[T](r.conn(ctx)).CreateInBatches(ctx, &v, r.batchSize))
 }
 
 // FindOne 查询单条记录
 func (r *GormRepo[T]) FindOne(ctx context.Context, filter any, opts ...IList[FindOptions]) (*T, error) {
-	g := gorm.G[T](r.db)
+	g := gorm.G[T](r.conn(ctx))
 	o := NewOptions(opts...)
+	ctx, cancel := withMaxTime(ctx, o.MaxTime)
+	defer cancel()
 
 	// 应用条件
-	chain := r.applyFilterToChain(g, filter)
+	chain := r.applyFilterToChain(ctx, g, filter, o.Deleted)
 	chain = r.applyFindOptionsToChain(chain, o)
 
 	result, err := chain.First(ctx)
@@ -56,32 +149,324 @@ func (r *GormRepo[T]) FindOne(ctx context.Context, filter any, opts ...IList[Fin
 	return &result, nil
 }
 
-// Find 查询多条记录
+// Find 查询多条记录，未设置 Limit 时受仓库的 SetUnboundedFindLimit 限制
 func (r *GormRepo[T]) Find(ctx context.Context, filter any, opts ...IList[FindOptions]) ([]*T, error) {
-	g := gorm.G[T](r.db)
+	g := gorm.G[T](r.conn(ctx))
 	o := NewOptions(opts...)
+	ctx, cancel := withMaxTime(ctx, o.MaxTime)
+	defer cancel()
+	guarded := r.findGuard.apply(o)
 
-	chain := r.applyFilterToChain(g, filter)
+	chain := r.applyFilterToChain(ctx, g, filter, o.Deleted)
 	chain = r.applyFindOptionsToChain(chain, o)
 
 	results, err := chain.Find(ctx)
-	return ToPtrSlice(results), wrapError(err)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return checkUnbounded(ctx, r.findGuard, guarded, ToPtrSlice(results))
 }
 
 // Count 统计记录数
+// 设置 Skip/Limit 时通过子查询只统计该范围内的记录；
+// 设置 EstimatedCountThreshold 时先通过 EXPLAIN 估算（仅 MySQL），估算值超过阈值则直接返回
 func (r *GormRepo[T]) Count(ctx context.Context, filter any, opts ...IList[FindOptions]) (int64, error) {
-	g := gorm.G[T](r.db)
-	chain := r.applyFilterToChain(g, filter)
-	return chain.Count(ctx, "id")
+	o := NewOptions(opts...)
+	ctx, cancel := withMaxTime(ctx, o.MaxTime)
+	defer cancel()
+	if o.EstimatedCountThreshold > 0 {
+		if estimated, ok := r.estimateCount(ctx, filter, o); ok && estimated > o.EstimatedCountThreshold {
+			return estimated, nil
+		}
+	}
+
+	if o.Skip > 0 || o.Limit > 0 {
+		// 读取节点和执行时间提示只作用于外层查询，MySQL 不支持子查询中的 MAX_EXECUTION_TIME
+		sub := r.query(ctx, filter, o.Deleted).Select(r.idField())
+		if sub.Error != nil {
+			return 0, wrapError(sub.Error)
+		}
+		if o.Skip > 0 {
+			sub = sub.Offset(int(o.Skip))
+		}
+		if o.Limit > 0 {
+			sub = sub.Limit(int(o.Limit))
+		}
+		var count int64
+		db := r.applyReadToDB(r.conn(ctx).WithContext(ctx), o)
+		err := db.Table("(?) AS t", sub).Count(&count).Error
+		return count, wrapError(err)
+	}
+
+	g := gorm.G[T](r.conn(ctx))
+	chain := r.applyReadToChain(r.applyFilterToChain(ctx, g, filter, o.Deleted), o)
+	return chain.Count(ctx, r.idField())
+}
+
+// FindWithTotal 查询一页数据并同时统计总数，事务中顺序执行
+func (r *GormRepo[T]) FindWithTotal(ctx context.Context, filter any, opts ...IList[FindOptions]) (*Page[T], error) {
+	_, inTx := gormTxFromContext(ctx, r.db)
+	return findWithTotal[T](ctx, r, !inTx, filter, opts...)
+}
+
+// estimateCount 通过 EXPLAIN 的 rows 估算满足条件的记录数，非 MySQL 或执行失败时返回 false
+func (r *GormRepo[T]) estimateCount(ctx context.Context, filter any, o *FindOptions) (int64, bool) {
+	db := r.conn(ctx)
+	if db.Dialector.Name() != "mysql" {
+		return 0, false
+	}
+
+	stmt := r.query(ctx, filter, o.Deleted).Session(&gorm.Session{DryRun: true}).Find(&[]T{}).Statement
+	var plans []map[string]any
+	db = db.WithContext(ctx)
+	if op, ok := gormResolverOp(o); ok {
+		db = db.Clauses(op)
+	}
+	if err := db.Raw("EXPLAIN "+stmt.SQL.String(), stmt.Vars...).Scan(&plans).Error; err != nil || len(plans) == 0 {
+		return 0, false
+	}
+	switch rows := plans[0]["rows"].(type) {
+	case int64:
+		return rows, true
+	case []byte:
+		n, err := strconv.ParseInt(string(rows), 10, 64)
+		return n, err == nil
+	case string:
+		n, err := strconv.ParseInt(rows, 10, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// FindPage 基于游标的分页查询
+func (r *GormRepo[T]) FindPage(ctx context.Context, filter any, sort *Sort, cursor string, limit int64) (*CursorPage[T], error) {
+	return pager[T]{find: r.Find, newBuilder: r.newQueryBuilder, idField: r.idField(), whereAll: true}.page(ctx, filter, sort, cursor, limit)
+}
+
+// Iterate 基于 Rows 逐行扫描，遍历结束或中途退出时关闭 Rows
+func (r *GormRepo[T]) Iterate(ctx context.Context, filter any, opts ...IList[FindOptions]) iter.Seq2[*T, error] {
+	return func(yield func(*T, error) bool) {
+		o := NewOptions(opts...)
+		db := r.readQuery(ctx, filter, o)
+		if len(o.ReturnFields) > 0 {
+			db = db.Select(o.ReturnFields)
+		}
+		if o.Skip > 0 {
+			db = db.Offset(int(o.Skip))
+		}
+		if o.Limit > 0 {
+			db = db.Limit(int(o.Limit))
+		}
+		if o.Sort != nil {
+			db = db.Order(o.Sort.ToSqlStr())
+		}
+
+		rows, err := db.Rows()
+		if err != nil {
+			yield(nil, wrapError(err))
+			return
+		}
+		defer func() { _ = rows.Close() }()
+
+		for rows.Next() {
+			item := new(T)
+			if err = db.ScanRows(rows, item); err != nil {
+				yield(nil, wrapError(err))
+				return
+			}
+			if !yield(item, nil) {
+				return
+			}
+		}
+		if err = rows.Err(); err != nil {
+			yield(nil, wrapError(err))
+		}
+	}
+}
+
+// FindInBatches 基于 GORM FindInBatches 按主键顺序分批查询，忽略 Sort 选项
+func (r *GormRepo[T]) FindInBatches(ctx context.Context, filter any, batchSize int, fn func(batch []*T) error, opts ...IList[FindOptions]) error {
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+	o := NewOptions(opts...)
+	o.Sort = nil
+
+	chain := r.applyFilterToChain(ctx, gorm.G[T](r.conn(ctx)), filter, o.Deleted)
+	chain = r.applyFindOptionsToChain(chain, o)
+	return wrapError(chain.FindInBatches(ctx, batchSize, func(data []T, _ int) error {
+		return fn(ToPtrSlice(data))
+	}))
+}
+
+// aggregate 通过 SELECT ... GROUP BY 聚合，结果按列名扫描到 dest
+func (r *GormRepo[T]) aggregate(ctx context.Context, filter any, o *AggregateOptions, dest any) error {
+	plan, err := newAggregatePlan(schemaFor[T](), o, gormColumn)
+	if err != nil {
+		return err
+	}
+	db := r.query(ctx, filter, o.Deleted)
+	q := db.Statement.Quote
+
+	selects := make([]string, 0, len(plan.groups)+len(plan.accs))
+	groups := make([]string, 0, len(plan.groups))
+	for _, g := range plan.groups {
+		selects = append(selects, q(g))
+		groups = append(groups, q(g))
+	}
+	for _, acc := range plan.accs {
+		expr := "COUNT(*)"
+		if acc.Op != AccCount {
+			expr = strings.ToUpper(string(acc.Op)) + "(" + q(acc.Field) + ")"
+		}
+		selects = append(selects, expr+" AS "+q(acc.As))
+	}
+	db = db.Select(strings.Join(selects, ", "))
+	if len(groups) > 0 {
+		db = db.Group(strings.Join(groups, ", "))
+	}
+	if o.Sort != nil {
+		db = db.Order(o.Sort.ToSqlStr())
+	}
+	if o.Limit > 0 {
+		db = db.Limit(int(o.Limit))
+	}
+	return wrapError(db.Scan(dest).Error)
+}
+
+// distinct 通过 SELECT DISTINCT 查询字段的不同取值
+func (r *GormRepo[T]) distinct(ctx context.Context, field string, filter any, dest any) error {
+	f, ok := schemaFor[T]().Field(field)
+	if !ok {
+		return fmt.Errorf("repox: unknown field %s of %s", field, schemaFor[T]().Type)
+	}
+	return wrapError(r.query(ctx, filter, DeletedExcluded).Distinct().Pluck(f.GormName, dest).Error)
+}
+
+// tenantScope 返回租户隔离配置
+func (r *GormRepo[T]) tenantScope() tenancy {
+	return r.tenancy
+}
+
+// newQueryBuilder 创建与仓库匹配的查询构建器，PostgreSQL 使用 PostgreSQL 方言
+func (r *GormRepo[T]) newQueryBuilder() builder.QBuilder {
+	if r.db.Dialector.Name() == "postgres" {
+		return builder.NewPostgresQueryBuilder()
+	}
+	return builder.NewGormQueryBuilder()
 }
 
-// applyFilterToChain 应用过滤条件到链式调用
-func (r *GormRepo[T]) applyFilterToChain(g gorm.Interface[T], filter any) gorm.ChainInterface[T] {
-	return g.Where(filter)
+// idField 返回主键列名
+func (r *GormRepo[T]) idField() string {
+	if pk := schemaFor[T]().Primary; pk != nil {
+		return pk.GormName
+	}
+	return "id"
+}
+
+// fieldName 返回字段的列名
+func (r *GormRepo[T]) fieldName(f *fieldInfo) string {
+	return f.GormName
+}
+
+// applyFilterToChain 应用过滤条件、删除状态条件和租户条件到链式调用
+func (r *GormRepo[T]) applyFilterToChain(ctx context.Context, g gorm.Interface[T], filter any, scope DeletedScope) gorm.ChainInterface[T] {
+	var chain gorm.ChainInterface[T]
+	if conds, ok := filter.(whereAll); ok {
+		chain = g.Where(conds[0])
+		for _, cond := range conds[1:] {
+			chain = chain.Where(cond)
+		}
+	} else {
+		chain = g.Where(filter)
+	}
+	if r.softDelete.enabled() {
+		// 泛型 API 不继承 conn 中的 Unscoped，需要在语句上重新设置
+		chain = chain.Scopes(func(stmt *gorm.Statement) { stmt.Unscoped = true })
+	}
+	if cond := r.softDelete.gormCond(scope); cond != nil {
+		chain = chain.Where(cond)
+	}
+	return r.scopeTenant(ctx, chain)
+}
+
+// applyReadToChain 按读取节点选项指定 dbresolver 的连接，并追加执行时间提示
+func (r *GormRepo[T]) applyReadToChain(chain gorm.ChainInterface[T], o *FindOptions) gorm.ChainInterface[T] {
+	for _, c := range r.readClauses(o) {
+		chain = chain.Scopes(c.ModifyStatement)
+	}
+	return chain
+}
+
+// applyReadToDB 与 applyReadToChain 相同，作用于 *gorm.DB
+func (r *GormRepo[T]) applyReadToDB(db *gorm.DB, o *FindOptions) *gorm.DB {
+	for _, c := range r.readClauses(o) {
+		db = db.Clauses(c)
+	}
+	return db
+}
+
+// statementClause 可以同时作为子句和语句修改器使用的查询选项
+type statementClause interface {
+	clause.Expression
+	gorm.StatementModifier
+}
+
+// readClauses 返回查询选项对应的子句：dbresolver 的读取节点，以及 MySQL 的 MAX_EXECUTION_TIME 提示
+func (r *GormRepo[T]) readClauses(o *FindOptions) []statementClause {
+	var clauses []statementClause
+	if op, ok := gormResolverOp(o); ok {
+		clauses = append(clauses, op)
+	}
+	if o.MaxTime > 0 && r.db.Dialector.Name() == "mysql" {
+		clauses = append(clauses, maxExecutionTime(o.MaxTime))
+	}
+	return clauses
+}
+
+// maxExecutionTime MySQL 的 MAX_EXECUTION_TIME 优化器提示，写在 SELECT 关键字之后，只对只读的 SELECT 生效
+type maxExecutionTime time.Duration
+
+// ModifyStatement 将提示设置到 SELECT 子句
+func (m maxExecutionTime) ModifyStatement(stmt *gorm.Statement) {
+	c := stmt.Clauses["SELECT"]
+	c.AfterNameExpression = m
+	stmt.Clauses["SELECT"] = c
+}
+
+// Build 输出 /*+ MAX_EXECUTION_TIME(ms) */，不足 1ms 时按 1ms
+func (m maxExecutionTime) Build(builder clause.Builder) {
+	ms := max(time.Duration(m).Milliseconds(), 1)
+	_, _ = builder.WriteString("/*+ MAX_EXECUTION_TIME(" + strconv.FormatInt(ms, 10) + ") */")
+}
+
+// gormResolverOp 返回读取节点对应的 dbresolver 操作，ReadDefault 时返回 false
+// 未注册 dbresolver 时该操作不产生任何影响
+func gormResolverOp(o *FindOptions) (dbresolver.Operation, bool) {
+	switch o.Read {
+	case ReadPrimary:
+		return dbresolver.Write, true
+	case ReadReplica:
+		return dbresolver.Read, true
+	}
+	return "", false
+}
+
+// scopeTenant 追加当前租户条件到链式调用，缺少租户时语句返回 ErrTenantRequired
+func (r *GormRepo[T]) scopeTenant(ctx context.Context, chain gorm.ChainInterface[T]) gorm.ChainInterface[T] {
+	cond, err := r.tenancy.gormCond(ctx)
+	if err != nil {
+		return chain.Scopes(func(stmt *gorm.Statement) { _ = stmt.AddError(err) })
+	}
+	if cond != nil {
+		chain = chain.Where(cond)
+	}
+	return chain
 }
 
 // applyFindOptionsToChain 应用查询选项到链式调用
 func (r *GormRepo[T]) applyFindOptionsToChain(chain gorm.ChainInterface[T], o *FindOptions) gorm.ChainInterface[T] {
+	chain = r.applyReadToChain(chain, o)
 	if len(o.ReturnFields) > 0 {
 		chain = chain.Select(o.ReturnFields[0], ToAnySlice(o.ReturnFields[1:])...)
 	}
@@ -98,19 +483,63 @@ func (r *GormRepo[T]) applyFindOptionsToChain(chain gorm.ChainInterface[T], o *F
 }
 
 // Update 更新整个实体（通过主键）
+// 实体声明了版本号字段时使用乐观锁：版本号作为条件并加一，没有匹配到记录时返回 ErrVersionConflict
 func (r *GormRepo[T]) Update(ctx context.Context, entity *T) error {
-	id, ok := getId(entity)
-	if ok {
-		_, err := gorm.G[T](r.db).Where("id = ?", id).Updates(ctx, *entity)
+	if err := r.tenancy.stamp(ctx, entity); err != nil {
+		return err
+	}
+	if err := r.auditor().stampUpdate(ctx, entity, time.Now()); err != nil {
+		return err
+	}
+	if version := schemaFor[T]().Role(roleVersion); version != nil {
+		return r.updateVersioned(ctx, entity, version)
+	}
+
+	id, ok := schemaFor[T]().PrimaryValue(entity)
+	if ok && !isZeroValue(id) {
+		chain := gorm.G[T](r.conn(ctx)).Where(clause.Eq{Column: clause.Column{Name: r.idField()}, Value: id})
+		_, err := r.scopeTenant(ctx, chain).Updates(ctx, *entity)
 		return wrapError(err)
 	}
 
-	return wrapError(r.db.WithContext(ctx).Save(entity).Error)
+	return wrapError(r.conn(ctx).WithContext(ctx).Save(entity).Error)
+}
+
+// updateVersioned 按主键和版本号更新实体，失败时恢复实体中的版本号
+func (r *GormRepo[T]) updateVersioned(ctx context.Context, entity *T, version *fieldInfo) error {
+	id, ok := schemaFor[T]().PrimaryValue(entity)
+	if !ok {
+		return errors.New("invalid entity")
+	}
+	cur, rollback, err := bumpVersion(version, entity)
+	if err != nil {
+		return err
+	}
+
+	var versionCond clause.Expression = clause.Eq{Column: clause.Column{Name: version.GormName}, Value: cur}
+	if cur == 0 {
+		// 添加版本字段之前写入的记录版本号为 NULL
+		versionCond = clause.Or(clause.Eq{Column: clause.Column{Name: version.GormName}, Value: nil}, versionCond)
+	}
+	chain := gorm.G[T](r.conn(ctx)).
+		Where(clause.Eq{Column: clause.Column{Name: r.idField()}, Value: id}).
+		Where(versionCond)
+	rowsAffected, err := r.scopeTenant(ctx, chain).Updates(ctx, *entity)
+	if err != nil {
+		rollback()
+		return wrapError(err)
+	}
+	if rowsAffected == 0 {
+		rollback()
+		return ErrVersionConflict
+	}
+	return nil
 }
 
 func (r *GormRepo[T]) Incr(ctx context.Context, filter any, incr map[string]int, opts ...IList[UpdateOptions]) error {
-	var t T
-	chain := r.db.WithContext(ctx).Model(t).Where(filter).Updates(r.incrToUpdate(incr))
+	ctx, cancel := withMaxTime(ctx, NewOptions(opts...).MaxTime)
+	defer cancel()
+	chain := r.query(ctx, filter, DeletedExcluded).Updates(r.incrToUpdate(incr))
 	if chain.Error != nil {
 		return wrapError(chain.Error)
 	}
@@ -120,9 +549,13 @@ func (r *GormRepo[T]) Incr(ctx context.Context, filter any, incr map[string]int,
 // UpdateOne 更新单条记录
 func (r *GormRepo[T]) UpdateOne(ctx context.Context, filter any, update map[string]any, opts ...IList[UpdateOptions]) (*UpdateResult, error) {
 	//g := r.buildUpdateG(opts...)
-	//chain := r.applyFilterToChain(g, filter)
-	var t T
-	chain := r.db.WithContext(ctx).Model(t).Clauses().Where(filter).Updates(update)
+	//chain := r.applyFilterToChain(ctx, g, filter)
+	if err := r.tenancy.checkUpdate(ctx, update); err != nil {
+		return nil, err
+	}
+	ctx, cancel := withMaxTime(ctx, NewOptions(opts...).MaxTime)
+	defer cancel()
+	chain := r.query(ctx, filter, DeletedExcluded).Updates(r.withVersion(r.withAudit(ctx, update)))
 	if chain.Error != nil {
 		return nil, wrapError(chain.Error)
 	}
@@ -132,20 +565,90 @@ func (r *GormRepo[T]) UpdateOne(ctx context.Context, filter any, update map[stri
 // UpdateMany 更新多条记录
 func (r *GormRepo[T]) UpdateMany(ctx context.Context, filter any, update map[string]any, opts ...IList[UpdateOptions]) (*UpdateResult, error) {
 	//g := r.buildUpdateG(opts...)
-	//chain := r.applyFilterToChain(g, filter)
+	//chain := r.applyFilterToChain(ctx, g, filter)
 
-	var t T
-	chain := r.db.WithContext(ctx).Model(t).Where(filter).Updates(update)
+	if err := r.tenancy.checkUpdate(ctx, update); err != nil {
+		return nil, err
+	}
+	ctx, cancel := withMaxTime(ctx, NewOptions(opts...).MaxTime)
+	defer cancel()
+	chain := r.query(ctx, filter, DeletedExcluded).Updates(r.withVersion(r.withAudit(ctx, update)))
 	if chain.Error != nil {
 		return nil, wrapError(chain.Error)
 	}
 	return &UpdateResult{UpdateCount: chain.RowsAffected}, wrapError(nil)
 }
 
+// FindOneAndUpdate 在事务中通过 SELECT ... FOR UPDATE 锁定第一条匹配记录，按主键更新后返回
+// 需要返回更新后的记录时，支持 RETURNING 的方言（如 PostgreSQL）通过 RETURNING 取得，否则在事务内重新查询；
+// Upsert 插入时使用过滤条件中的等值条件和更新内容构建新记录，表达式类型的更新值不会写入新记录
+func (r *GormRepo[T]) FindOneAndUpdate(ctx context.Context, filter any, update map[string]any, opts ...IList[UpdateOptions]) (*T, error) {
+	o := NewOptions(opts...)
+	if err := r.tenancy.checkUpdate(ctx, update); err != nil {
+		return nil, err
+	}
+	ctx, cancel := withMaxTime(ctx, o.MaxTime)
+	defer cancel()
+
+	var result *T
+	err := WithTx(ctx, r.db, func(ctx context.Context) error {
+		before, err := r.lockOne(ctx, filter, o.Sort)
+		if errors.Is(err, DataNotFound) && o.Upsert {
+			inserted, err := r.createUpserted(ctx, filter, update)
+			if o.ReturnAfter {
+				result = inserted
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		pk, err := r.primaryCond(before)
+		if err != nil {
+			return err
+		}
+		values := r.withVersion(r.withAudit(ctx, update))
+		after := new(T)
+		db := r.query(ctx, pk, DeletedIncluded).Model(after)
+		switch {
+		case !o.ReturnAfter:
+			result = before
+			return wrapError(db.Updates(values).Error)
+		case supportsReturning(db):
+			result = after
+			return wrapError(db.Clauses(clause.Returning{}).Updates(values).Error)
+		}
+		if err = db.Updates(values).Error; err != nil {
+			return wrapError(err)
+		}
+		result, err = r.FindOne(ctx, pk, Find().WithDeleted())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 // UpsertOne 插入或更新单条记录
+// 启用租户隔离时租户字段会加入冲突字段，对应的唯一索引需要包含租户字段
 func (r *GormRepo[T]) UpsertOne(ctx context.Context, create T, opt UpsertOptions) error {
-	columns := make([]clause.Column, 0, len(opt.ConflictKvs))
-	for k := range opt.ConflictKvs {
+	if err := r.tenancy.checkUpdate(ctx, opt.Set); err != nil {
+		return err
+	}
+	if err := r.ids.stamp(ctx, &create); err != nil {
+		return err
+	}
+	if err := r.tenancy.stamp(ctx, &create); err != nil {
+		return err
+	}
+	conflictKvs, err := r.tenancy.withTenant(ctx, opt.ConflictKvs, gormColumn)
+	if err != nil {
+		return err
+	}
+	columns := make([]clause.Column, 0, len(conflictKvs))
+	for k := range conflictKvs {
 		columns = append(columns, clause.Column{Name: k})
 	}
 
@@ -156,13 +659,184 @@ func (r *GormRepo[T]) UpsertOne(ctx context.Context, create T, opt UpsertOptions
 	for k, v := range opt.Inc {
 		doUpdates[k] = gorm.Expr(k+" + ?", v)
 	}
+	if len(doUpdates) > 0 {
+		doUpdates = r.withAudit(ctx, doUpdates)
+	}
+	if err := r.auditor().stampCreate(ctx, &create, time.Now()); err != nil {
+		return err
+	}
 
-	return wrapError(gorm.G[T](r.db, clause.OnConflict{
+	return wrapError(gorm.G[T](r.conn(ctx), clause.OnConflict{
 		Columns:   columns,
 		DoUpdates: clause.Assignments(doUpdates),
 	}).Create(ctx, &create))
 }
 
+// UpsertMany 在事务中按批大小执行多行 INSERT ... ON DUPLICATE KEY UPDATE（PostgreSQL 为 ON CONFLICT DO UPDATE）
+// 每批写入前以 SELECT ... FOR UPDATE 锁定已存在的冲突键，插入和更新的数量由锁定的记录得出；
+// 实体的冲突键不能重复，否则返回 ErrDuplicateKey；实体中 Inc 字段的值不会被修改；
+// 写入后实体的主键为数据库中记录的主键：命中的记录取已有的主键，插入的记录取生成或自增的主键；
+// 启用租户隔离时租户字段会加入冲突字段，对应的唯一索引需要包含租户字段
+func (r *GormRepo[T]) UpsertMany(ctx context.Context, entities []*T, opt UpsertManyOptions) (*UpsertResult, error) {
+	plan, err := newUpsertPlan(schemaFor[T](), opt, r.tenancy)
+	if err != nil {
+		return nil, err
+	}
+	if len(entities) == 0 {
+		return &UpsertResult{}, nil
+	}
+	if err = checkDistinct(plan, entities); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	rows := make([]*T, len(entities))
+	for i, entity := range entities {
+		if err = r.tenancy.stamp(ctx, entity); err != nil {
+			return nil, err
+		}
+		if err = r.auditor().stampCreate(ctx, entity, now); err != nil {
+			return nil, err
+		}
+		if rows[i], err = insertRow(plan, entity); err != nil {
+			return nil, err
+		}
+		// 生成的主键只写入插入用的副本，命中已有记录时不会保存
+		if err = r.ids.stamp(ctx, rows[i]); err != nil {
+			return nil, err
+		}
+	}
+	onConflict, err := r.upsertClause(ctx, plan)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &UpsertResult{}
+	err = WithTx(ctx, r.db, func(ctx context.Context) error {
+		*result = UpsertResult{}
+		for start := 0; start < len(rows); start += r.batchSize {
+			batch := rows[start:min(start+r.batchSize, len(rows))]
+			existing, err := r.lockConflicts(ctx, plan, batch)
+			if err != nil {
+				return err
+			}
+			if err := r.conn(ctx).WithContext(ctx).Clauses(onConflict).Create(&batch).Error; err != nil {
+				return wrapError(err)
+			}
+			if err := r.syncPrimary(ctx, plan, entities[start:], batch, existing); err != nil {
+				return err
+			}
+			result.UpdateCount += int64(len(existing))
+			result.InsertCount += int64(len(batch) - len(existing))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// upsertClause 构建 UpsertMany 的 ON CONFLICT 子句，命中时覆盖的字段取插入的值
+func (r *GormRepo[T]) upsertClause(ctx context.Context, plan *upsertPlan) (clause.OnConflict, error) {
+	var columns []clause.Column
+	for _, f := range plan.conflict {
+		columns = append(columns, clause.Column{Name: f.GormName})
+	}
+	if _, scoped, err := r.tenancy.current(ctx); err != nil {
+		return clause.OnConflict{}, err
+	} else if scoped {
+		columns = append(columns, clause.Column{Name: r.tenancy.field.GormName})
+	}
+
+	updates := make([]string, 0, len(plan.update))
+	for _, f := range plan.update {
+		updates = append(updates, f.GormName)
+	}
+	set := clause.AssignmentColumns(updates)
+	for f, delta := range plan.inc {
+		set = append(set, clause.Assignment{Column: clause.Column{Name: f.GormName}, Value: gorm.Expr(f.GormName+" + ?", delta)})
+	}
+	return clause.OnConflict{Columns: columns, DoUpdates: set, DoNothing: len(set) == 0}, nil
+}
+
+// syncPrimary 将一批写入的记录在数据库中的主键写回实体：命中的记录取已有的主键，插入的记录取副本中生成的主键，
+// 自增主键在批量 upsert 中无法可靠回填，按冲突键重新读取
+func (r *GormRepo[T]) syncPrimary(ctx context.Context, plan *upsertPlan, entities, batch []*T, existing map[string]*T) error {
+	pk := schemaFor[T]().Primary
+	if pk == nil {
+		return nil
+	}
+	var auto []*T
+	for i, row := range batch {
+		if item, ok := existing[plan.key(row)]; ok {
+			copyField(pk, entities[i], item)
+		} else if id, _ := pk.Value(reflect.ValueOf(entities[i])); r.ids.gen == nil && isZeroValue(id) {
+			auto = append(auto, row)
+		} else {
+			copyField(pk, entities[i], row)
+		}
+	}
+	if len(auto) == 0 {
+		return nil
+	}
+	inserted, err := r.lockConflicts(ctx, plan, auto)
+	if err != nil {
+		return err
+	}
+	for i, row := range batch {
+		if item, ok := inserted[plan.key(row)]; ok {
+			copyField(pk, entities[i], item)
+		}
+	}
+	return nil
+}
+
+// lockConflicts 锁定并读取一批实体的冲突键对应的已有记录，返回冲突键到记录的映射，记录只包含主键和冲突字段；
+// SQLite 不支持行锁，依赖事务本身的写锁
+func (r *GormRepo[T]) lockConflicts(ctx context.Context, plan *upsertPlan, entities []*T) (map[string]*T, error) {
+	columns := make([]string, 0, len(plan.conflict)+1)
+	if pk := schemaFor[T]().Primary; pk != nil {
+		columns = append(columns, pk.GormName)
+	}
+	for _, f := range plan.conflict {
+		columns = append(columns, f.GormName)
+	}
+	db := r.query(ctx, r.conflictCond(plan, entities), DeletedIncluded).Select(columns)
+	if db.Dialector.Name() != "sqlite" {
+		db = db.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate})
+	}
+	var items []*T
+	if err := db.Find(&items).Error; err != nil {
+		return nil, wrapError(err)
+	}
+	existing := make(map[string]*T, len(items))
+	for _, item := range items {
+		existing[plan.key(item)] = item
+	}
+	return existing, nil
+}
+
+// conflictCond 返回匹配一批实体冲突键的条件
+func (r *GormRepo[T]) conflictCond(plan *upsertPlan, entities []*T) clause.Expression {
+	if len(plan.conflict) == 1 {
+		values := make([]any, len(entities))
+		for i, entity := range entities {
+			values[i] = plan.conflictValues(entity)[0]
+		}
+		return clause.IN{Column: clause.Column{Name: plan.conflict[0].GormName}, Values: values}
+	}
+	ors := make([]clause.Expression, len(entities))
+	for i, entity := range entities {
+		values := plan.conflictValues(entity)
+		eqs := make([]clause.Expression, len(values))
+		for j, f := range plan.conflict {
+			eqs[j] = clause.Eq{Column: clause.Column{Name: f.GormName}, Value: values[j]}
+		}
+		ors[i] = clause.And(eqs...)
+	}
+	return clause.Or(ors...)
+}
+
 // buildUpdateG 构建带更新选项的泛型实例
 func (r *GormRepo[T]) buildUpdateG(opts ...IList[UpdateOptions]) gorm.Interface[T] {
 	_ = NewOptions(opts...)
@@ -186,26 +860,336 @@ func (r *GormRepo[T]) buildUpdateG(opts ...IList[UpdateOptions]) gorm.Interface[
 	return gorm.G[T](r.db, clauses...)
 }
 
-// DeleteOne 删除单条记录
+// DeleteOne 删除单条记录，启用软删除时设置删除字段
 func (r *GormRepo[T]) DeleteOne(ctx context.Context, filter any) (*DeleteResult, error) {
-	g := gorm.G[T](r.db)
-	chain := r.applyFilterToChain(g, filter)
+	if r.softDelete.enabled() {
+		return r.markDeleted(r.query(ctx, filter, DeletedExcluded).Limit(1))
+	}
+	g := gorm.G[T](r.conn(ctx))
+	chain := r.applyFilterToChain(ctx, g, filter, DeletedExcluded)
 	rowsAffected, err := chain.Limit(1).Delete(ctx)
 	return &DeleteResult{DeleteCount: int64(rowsAffected)}, err
 }
 
-// DeleteMany 删除多条记录
+// DeleteMany 删除多条记录，启用软删除时设置删除字段
 func (r *GormRepo[T]) DeleteMany(ctx context.Context, filter any) (*DeleteResult, error) {
-	g := gorm.G[T](r.db)
-	chain := r.applyFilterToChain(g, filter)
+	if r.softDelete.enabled() {
+		return r.markDeleted(r.query(ctx, filter, DeletedExcluded))
+	}
+	g := gorm.G[T](r.conn(ctx))
+	chain := r.applyFilterToChain(ctx, g, filter, DeletedExcluded)
 	rowsAffected, err := chain.Delete(ctx)
 	return &DeleteResult{DeleteCount: int64(rowsAffected)}, err
 }
 
+// FindOneAndDelete 在事务中通过 SELECT ... FOR UPDATE 锁定第一条匹配记录，按主键删除后返回，启用软删除时设置删除字段
+func (r *GormRepo[T]) FindOneAndDelete(ctx context.Context, filter any, opts ...IList[FindOptions]) (*T, error) {
+	o := NewOptions(opts...)
+
+	var result *T
+	err := WithTx(ctx, r.db, func(ctx context.Context) error {
+		item, err := r.lockOne(ctx, filter, o.Sort)
+		if err != nil {
+			return err
+		}
+		pk, err := r.primaryCond(item)
+		if err != nil {
+			return err
+		}
+		if r.softDelete.enabled() {
+			_, err = r.markDeleted(r.query(ctx, pk, DeletedIncluded))
+		} else {
+			err = wrapError(r.query(ctx, pk, DeletedIncluded).Delete(new(T)).Error)
+		}
+		result = item
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// BulkWrite 在一个事务中按顺序执行写入操作，连续的插入按批大小合并为一条 INSERT 语句
+// 每个操作（或一批插入）在各自的 savepoint 中执行，失败时只回滚该操作，其它操作照常提交；
+// 一批插入中任一记录失败时整批记为失败。需要全部成功或全部回滚时，在 WithTx 中调用并在返回错误时回滚
+func (r *GormRepo[T]) BulkWrite(ctx context.Context, ops []WriteOp[T], opts ...IList[BulkOptions]) (*BulkResult, error) {
+	o := newBulkOptions(opts)
+	var result *BulkResult
+	err := WithTx(ctx, r.db, func(ctx context.Context) error {
+		result = runBulk[T](ctx, r, ops, o, r.batchSize, func(ctx context.Context, fn func(ctx context.Context) error) error {
+			return WithTx(ctx, r.db, fn)
+		})
+		return nil
+	})
+	if err != nil {
+		result = newBulkResult(len(ops))
+		result.fail(0, len(ops), wrapError(err), false)
+	}
+	return result, result.Err()
+}
+
+// updateOne 锁定第一条匹配记录并按主键更新，调用方需在事务中执行
+func (r *GormRepo[T]) updateOne(ctx context.Context, filter any, update map[string]any) (WriteResult, error) {
+	if err := r.tenancy.checkUpdate(ctx, update); err != nil {
+		return WriteResult{}, err
+	}
+	pk, err := r.lockPrimary(ctx, filter)
+	if pk == nil || err != nil {
+		return WriteResult{}, err
+	}
+	db := r.query(ctx, pk, DeletedIncluded).Updates(r.withVersion(r.withAudit(ctx, update)))
+	if db.Error != nil {
+		return WriteResult{}, wrapError(db.Error)
+	}
+	return WriteResult{MatchedCount: 1, ModifiedCount: db.RowsAffected}, nil
+}
+
+// replaceOne 锁定第一条匹配记录并用 entity 覆盖除主键和 created_at/created_by 以外的所有列，调用方需在事务中执行
+func (r *GormRepo[T]) replaceOne(ctx context.Context, filter any, entity *T) (WriteResult, error) {
+	if err := r.tenancy.stamp(ctx, entity); err != nil {
+		return WriteResult{}, err
+	}
+	if err := r.auditor().stampUpdate(ctx, entity, time.Now()); err != nil {
+		return WriteResult{}, err
+	}
+	pk, err := r.lockPrimary(ctx, filter)
+	if pk == nil || err != nil {
+		return WriteResult{}, err
+	}
+
+	omit := []string{r.idField()}
+	audit := r.auditor()
+	for _, f := range []*fieldInfo{audit.createdAt, audit.createdBy} {
+		if f != nil {
+			omit = append(omit, f.GormName)
+		}
+	}
+	db := r.query(ctx, pk, DeletedIncluded).Select("*").Omit(omit...).Updates(entity)
+	if db.Error != nil {
+		return WriteResult{}, wrapError(db.Error)
+	}
+	return WriteResult{MatchedCount: 1, ModifiedCount: db.RowsAffected}, nil
+}
+
+// lockPrimary 锁定第一条匹配记录并返回按其主键匹配的条件，没有匹配记录时返回 nil
+func (r *GormRepo[T]) lockPrimary(ctx context.Context, filter any) (clause.Expression, error) {
+	item, err := r.lockOne(ctx, filter, nil)
+	if errors.Is(err, DataNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.primaryCond(item)
+}
+
+// Restore 恢复匹配的已软删除记录
+func (r *GormRepo[T]) Restore(ctx context.Context, filter any) (*UpdateResult, error) {
+	if !r.softDelete.enabled() {
+		return nil, ErrSoftDeleteDisabled
+	}
+	chain := r.query(ctx, filter, DeletedOnly).UpdateColumn(r.softDelete.field.GormName, nil)
+	if chain.Error != nil {
+		return nil, wrapError(chain.Error)
+	}
+	return &UpdateResult{UpdateCount: chain.RowsAffected}, nil
+}
+
+// lockOne 查询并锁定排序后的第一条匹配记录，未指定排序时按主键排序；SQLite 不支持行锁，依赖事务本身的写锁
+func (r *GormRepo[T]) lockOne(ctx context.Context, filter any, sort *Sort) (*T, error) {
+	db := r.query(ctx, filter, DeletedExcluded)
+	if db.Dialector.Name() != "sqlite" {
+		db = db.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate})
+	}
+	if sort != nil {
+		db = db.Order(sort.ToSqlStr())
+	} else {
+		db = db.Order(clause.OrderByColumn{Column: clause.Column{Name: r.idField()}})
+	}
+	item := new(T)
+	if err := db.Limit(1).Take(item).Error; err != nil {
+		return nil, wrapError(err)
+	}
+	return item, nil
+}
+
+// primaryCond 返回按实体主键匹配的条件
+func (r *GormRepo[T]) primaryCond(entity *T) (clause.Expression, error) {
+	id, ok := schemaFor[T]().PrimaryValue(entity)
+	if !ok {
+		return nil, errors.New("invalid entity")
+	}
+	return clause.Eq{Column: clause.Column{Name: r.idField()}, Value: id}, nil
+}
+
+// createUpserted 按过滤条件中的等值条件和更新内容创建新记录，忽略表达式类型的值
+func (r *GormRepo[T]) createUpserted(ctx context.Context, filter any, update map[string]any) (*T, error) {
+	values := make(map[string]any, len(update))
+	if kvs, ok := equalityConditions(filter); ok {
+		for k, v := range kvs {
+			values[k] = v
+		}
+	}
+	for k, v := range update {
+		if _, ok := v.(clause.Expression); !ok {
+			values[k] = v
+		}
+	}
+	entity := new(T)
+	if err := schemaFor[T]().SetFields(reflect.ValueOf(entity), values); err != nil {
+		return nil, err
+	}
+	if err := r.Create(ctx, entity); err != nil {
+		return nil, err
+	}
+	return entity, nil
+}
+
+// supportsReturning 判断方言的 UPDATE 是否支持 RETURNING
+func supportsReturning(db *gorm.DB) bool {
+	return slices.Contains(db.Callback().Update().Clauses, "RETURNING")
+}
+
+// markDeleted 将匹配记录的删除字段设置为当前时间
+func (r *GormRepo[T]) markDeleted(db *gorm.DB) (*DeleteResult, error) {
+	chain := db.UpdateColumn(r.softDelete.field.GormName, time.Now())
+	if chain.Error != nil {
+		return nil, wrapError(chain.Error)
+	}
+	return &DeleteResult{DeleteCount: chain.RowsAffected}, nil
+}
+
 func (r *GormRepo[T]) incrToUpdate(incr map[string]int) map[string]any {
 	ret := make(map[string]any)
 	for k, v := range incr {
 		ret[k] = gorm.Expr(k+" + ?", v)
 	}
+	return r.withVersion(ret)
+}
+
+// auditor 返回实体的审计字段
+func (r *GormRepo[T]) auditor() auditor {
+	return auditorOf(schemaFor[T]())
+}
+
+// withAudit 返回附加 updated_at/updated_by 的更新内容
+func (r *GormRepo[T]) withAudit(ctx context.Context, update map[string]any) map[string]any {
+	return mergeValues(update, r.auditor().updateValues(ctx, time.Now(), gormColumn))
+}
+
+// withVersion 实体声明了版本号字段时，返回附加版本号加一的更新内容
+func (r *GormRepo[T]) withVersion(update map[string]any) map[string]any {
+	version := schemaFor[T]().Role(roleVersion)
+	if version == nil {
+		return update
+	}
+	ret := make(map[string]any, len(update)+1)
+	for k, v := range update {
+		ret[k] = v
+	}
+	ret[version.GormName] = gorm.Expr("COALESCE(" + version.GormName + ", 0) + 1")
 	return ret
 }
+
+// resolveIndex 转换为列名，默认索引名为 idx_<列名>；SQL 数据库不支持部分索引和 TTL 索引
+func (r *GormRepo[T]) resolveIndex(idx Index) (Index, error) {
+	idx, err := resolveIndexKeys(schemaFor[T](), idx, gormColumn, func(idx Index) string {
+		cols := make([]string, len(idx.Keys))
+		for i, k := range idx.Keys {
+			cols[i] = k.Field
+		}
+		return "idx_" + strings.Join(cols, "_")
+	})
+	if err != nil {
+		return idx, err
+	}
+	if len(idx.Partial) > 0 {
+		return idx, fmt.Errorf("%w: partial index on %s", ErrIndexUnsupported, r.db.Dialector.Name())
+	}
+	if idx.TTL > 0 {
+		return idx, fmt.Errorf("%w: ttl index on %s", ErrIndexUnsupported, r.db.Dialector.Name())
+	}
+	return idx, nil
+}
+
+// mysqlIndexRow SHOW INDEX 返回的一行，对应索引中的一列
+type mysqlIndexRow struct {
+	KeyName    string  `gorm:"column:Key_name"`
+	NonUnique  int     `gorm:"column:Non_unique"`
+	SeqInIndex int     `gorm:"column:Seq_in_index"`
+	ColumnName *string `gorm:"column:Column_name"`
+	Collation  *string `gorm:"column:Collation"`
+	IndexType  string  `gorm:"column:Index_type"`
+}
+
+// listIndexes 通过 SHOW INDEX 读取表的索引（仅 MySQL），不包括主键
+func (r *GormRepo[T]) listIndexes(ctx context.Context) ([]Index, error) {
+	if name := r.db.Dialector.Name(); name != "mysql" {
+		return nil, fmt.Errorf("%w: list indexes on %s", ErrIndexUnsupported, name)
+	}
+	stmt, err := r.statement()
+	if err != nil {
+		return nil, err
+	}
+	var rows []mysqlIndexRow
+	if err = r.db.WithContext(ctx).Raw("SHOW INDEX FROM " + stmt.Quote(stmt.Table)).Scan(&rows).Error; err != nil {
+		return nil, wrapError(err)
+	}
+	slices.SortStableFunc(rows, func(a, b mysqlIndexRow) int { return a.SeqInIndex - b.SeqInIndex })
+
+	var indexes []Index
+	pos := make(map[string]int)
+	for _, row := range rows {
+		if row.KeyName == "PRIMARY" {
+			continue
+		}
+		i, ok := pos[row.KeyName]
+		if !ok {
+			i = len(indexes)
+			pos[row.KeyName] = i
+			indexes = append(indexes, Index{Name: row.KeyName, Unique: row.NonUnique == 0, Text: row.IndexType == "FULLTEXT"})
+		}
+		// 函数索引没有列名
+		key := IndexKey{Field: "?"}
+		if row.ColumnName != nil {
+			key.Field = *row.ColumnName
+		}
+		key.Desc = row.Collation != nil && *row.Collation == "D"
+		indexes[i].Keys = append(indexes[i].Keys, key)
+	}
+	return indexes, nil
+}
+
+// createIndex 通过 CREATE INDEX 创建索引，DDL 会隐式提交事务，因此不使用 ctx 中的事务
+func (r *GormRepo[T]) createIndex(ctx context.Context, idx Index) error {
+	stmt, err := r.statement()
+	if err != nil {
+		return err
+	}
+	cols := make([]string, len(idx.Keys))
+	for i, k := range idx.Keys {
+		cols[i] = stmt.Quote(k.Field)
+		if k.Desc && !idx.Text {
+			cols[i] += " DESC"
+		}
+	}
+	kind := "INDEX"
+	switch {
+	case idx.Text:
+		kind = "FULLTEXT INDEX"
+	case idx.Unique:
+		kind = "UNIQUE INDEX"
+	}
+	sql := fmt.Sprintf("CREATE %s %s ON %s (%s)", kind, stmt.Quote(idx.Name), stmt.Quote(stmt.Table), strings.Join(cols, ","))
+	return wrapError(r.db.WithContext(ctx).Exec(sql).Error)
+}
+
+// statement 返回解析了实体结构的语句，用于获取表名和引用标识符
+func (r *GormRepo[T]) statement() (*gorm.Statement, error) {
+	stmt := &gorm.Statement{DB: r.db}
+	if err := stmt.Parse(new(T)); err != nil {
+		return nil, wrapError(err)
+	}
+	return stmt, nil
+}
@@ -0,0 +1,181 @@
+package repox
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mbeoliero/kit/idgen"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// IdGenerator 主键生成器，仓库创建记录时为零值的主键生成值并回写到实体
+// 生成的值按主键字段类型转换：字符串字段使用 ObjectID 的 hex、UUID 的标准格式或整数的十进制表示
+type IdGenerator interface {
+	NextId(ctx context.Context) (any, error)
+}
+
+// IdGeneratorFunc 函数形式的主键生成器
+type IdGeneratorFunc func(ctx context.Context) (any, error)
+
+// NextId 调用函数生成主键
+func (f IdGeneratorFunc) NextId(ctx context.Context) (any, error) {
+	return f(ctx)
+}
+
+// ObjectIdGenerator 生成 MongoDB ObjectID
+func ObjectIdGenerator() IdGenerator {
+	return IdGeneratorFunc(func(context.Context) (any, error) {
+		return bson.NewObjectID(), nil
+	})
+}
+
+// UUIDv7Generator 生成按时间有序的 UUIDv7
+func UUIDv7Generator() IdGenerator {
+	return IdGeneratorFunc(func(context.Context) (any, error) {
+		return uuid.NewV7()
+	})
+}
+
+// ULIDGenerator 生成 26 位 Crockford base32 编码的 ULID，同一毫秒内单调递增
+func ULIDGenerator() IdGenerator {
+	return &ulidGenerator{}
+}
+
+// ulidGenerator ULID 生成器，last 为上一次生成的 ULID
+type ulidGenerator struct {
+	mu   sync.Mutex
+	last [16]byte
+	ms   uint64
+}
+
+// crockford ULID 使用的 base32 字母表
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+func (g *ulidGenerator) NextId(context.Context) (any, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ms := uint64(time.Now().UnixMilli())
+	if ms <= g.ms {
+		// 同一毫秒（或时钟回拨）时沿用上一次的时间戳并将随机部分加一
+		ms = g.ms
+		i := 15
+		for ; i >= 6; i-- {
+			g.last[i]++
+			if g.last[i] != 0 {
+				break
+			}
+		}
+		if i < 6 {
+			return nil, errors.New("repox: ulid entropy overflow")
+		}
+	} else {
+		g.ms = ms
+		for i := 0; i < 6; i++ {
+			g.last[i] = byte(ms >> (40 - 8*i))
+		}
+		if _, err := rand.Read(g.last[6:]); err != nil {
+			return nil, err
+		}
+	}
+	return encodeULID(g.last), nil
+}
+
+// encodeULID 将 128 位按 Crockford base32 编码，首字符只使用 3 位
+func encodeULID(b [16]byte) string {
+	var out [26]byte
+	hi := uint64(b[0])<<8 | uint64(b[1])
+	lo := uint64(0)
+	for _, v := range b[2:10] {
+		lo = lo<<8 | uint64(v)
+	}
+	tail := uint64(0)
+	for _, v := range b[10:] {
+		tail = tail<<8 | uint64(v)
+	}
+	// 128 位 = hi(16) + lo(64) + tail(48)，从低位向高位每 5 位取一个字符
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[tail&31]
+		tail = tail>>5 | (lo&31)<<43
+		lo = lo>>5 | (hi&31)<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
+
+// SnowflakeGenerator 使用默认配置的 idgen.Snowflake 生成 64 位有序整数
+// 多实例部署时每个实例的 workerId 必须不同，需要自定义配置或租用 workerId 时直接使用 idgen.NewSnowflake 或 idgen.NewLeasedSnowflake
+func SnowflakeGenerator(workerId int64) (IdGenerator, error) {
+	return idgen.NewSnowflake(workerId, idgen.SnowflakeOptions{})
+}
+
+// idGeneration 仓库的主键生成配置，gen 为 nil 表示不生成
+type idGeneration struct {
+	field *fieldInfo
+	gen   IdGenerator
+}
+
+// newIdGeneration 根据仓库配置创建主键生成配置，配置了生成器但实体没有主键字段时 panic
+func newIdGeneration(schema *entitySchema, o *RepoOptions) idGeneration {
+	if o.IdGenerator == nil {
+		return idGeneration{}
+	}
+	if schema.Primary == nil {
+		panic(fmt.Sprintf("repox: id generator requires a primary key field in %s", schema.Type))
+	}
+	return idGeneration{field: schema.Primary, gen: o.IdGenerator}
+}
+
+// stamp 主键为零值时生成主键并写入实体
+func (g idGeneration) stamp(ctx context.Context, entity any) error {
+	if g.gen == nil {
+		return nil
+	}
+	fv, ok := g.field.reflectValue(reflect.ValueOf(entity), true)
+	if !ok {
+		return fmt.Errorf("repox: field %s is not addressable", g.field.Name)
+	}
+	if !fv.IsZero() {
+		return nil
+	}
+	id, err := g.next(ctx, fv.Kind())
+	if err != nil {
+		return err
+	}
+	if err := assignValue(fv, id); err != nil {
+		return fmt.Errorf("repox: set field %s: %w", g.field.Name, err)
+	}
+	return nil
+}
+
+// next 生成主键值，kind 为主键字段的类型，字符串字段使用 idString 转换
+func (g idGeneration) next(ctx context.Context, kind reflect.Kind) (any, error) {
+	id, err := g.gen.NextId(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("repox: generate id: %w", err)
+	}
+	if kind == reflect.String {
+		id = idString(id)
+	}
+	return id, nil
+}
+
+// idString 将生成的主键转换为字符串主键字段使用的表示
+func idString(id any) any {
+	switch v := id.(type) {
+	case bson.ObjectID:
+		return v.Hex()
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case fmt.Stringer:
+		return v.String()
+	}
+	return id
+}
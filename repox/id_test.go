@@ -0,0 +1,239 @@
+package repox
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/mbeoliero/kit/idgen"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+type idDoc struct {
+	Key  string `bson:"_id"`
+	Name string `bson:"name"`
+}
+
+type skuDoc struct {
+	Code string `gorm:"primaryKey;column:sku_code"`
+	Name string
+}
+
+func TestIdGenerators(t *testing.T) {
+	ctx := context.Background()
+
+	ulid := ULIDGenerator()
+	prev := ""
+	for range 1000 {
+		id, err := ulid.NextId(ctx)
+		require.NoError(t, err)
+		s := id.(string)
+		assert.Regexp(t, "^[0-7][0-9A-HJKMNP-TV-Z]{25}$", s)
+		assert.Greater(t, s, prev)
+		prev = s
+	}
+	assert.Equal(t, "00000000000000000000000000", encodeULID([16]byte{}))
+	assert.Equal(t, "7ZZZZZZZZZZZZZZZZZZZZZZZZZ", encodeULID([16]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}))
+
+	sf, err := SnowflakeGenerator(3)
+	require.NoError(t, err)
+	id, err := sf.NextId(ctx)
+	require.NoError(t, err)
+	_, worker, _ := sf.(*idgen.Snowflake).Decompose(id.(int64))
+	assert.Equal(t, int64(3), worker)
+	_, err = SnowflakeGenerator(1024)
+	assert.Error(t, err)
+
+	id, err = UUIDv7Generator().NextId(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uuid.Version(7), id.(uuid.UUID).Version())
+}
+
+func TestIdGeneration_Memory(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo[idDoc](Options().SetIdGenerator(UUIDv7Generator()))
+
+	// 生成的 UUID 按字符串主键的标准格式回写，已有主键不覆盖
+	docs := []*idDoc{{Name: "a"}, {Key: "fixed", Name: "b"}}
+	require.NoError(t, repo.CreateMany(ctx, docs))
+	_, err := uuid.Parse(docs[0].Key)
+	assert.NoError(t, err)
+	assert.Equal(t, "fixed", docs[1].Key)
+	found, err := repo.FindOne(ctx, bson.M{"_id": docs[0].Key})
+	require.NoError(t, err)
+	assert.Equal(t, "a", found.Name)
+
+	oids := NewMemoryRepo[idDoc](Options().SetIdGenerator(ObjectIdGenerator()))
+	doc := &idDoc{}
+	require.NoError(t, oids.Create(ctx, doc))
+	_, err = bson.ObjectIDFromHex(doc.Key)
+	assert.NoError(t, err)
+
+	// upsert 未命中时同样生成主键
+	require.NoError(t, repo.UpsertOne(ctx, idDoc{Name: "c"}, UpsertOptions{ConflictKvs: map[string]any{"name": "c"}}))
+	res, err := repo.UpsertMany(ctx, []*idDoc{{Name: "d"}}, UpsertManyOptions{ConflictFields: []string{"name"}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), res.InsertCount)
+	upserted, err := repo.FindOneAndUpdate(ctx, bson.M{"name": "e"}, map[string]any{"name": "e"}, Update().SetUpsert(true).SetReturnAfter(true))
+	require.NoError(t, err)
+	for _, name := range []string{"c", "d", "e"} {
+		found, err = repo.FindOne(ctx, bson.M{"name": name})
+		require.NoError(t, err)
+		_, err = uuid.Parse(found.Key)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, found.Key, upserted.Key)
+
+	// 命中已有记录时不为实体生成主键
+	hit := []*idDoc{{Name: "d"}}
+	res, err = repo.UpsertMany(ctx, hit, UpsertManyOptions{ConflictFields: []string{"name"}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), res.UpdateCount)
+	assert.Empty(t, hit[0].Key)
+
+	failing := NewMemoryRepo[idDoc](Options().SetIdGenerator(IdGeneratorFunc(func(context.Context) (any, error) {
+		return nil, idgen.ErrClockRollback
+	})))
+	assert.ErrorIs(t, failing.Create(ctx, &idDoc{}), idgen.ErrClockRollback)
+
+	assert.Panics(t, func() {
+		NewMemoryRepo[struct{ Name string }](Options().SetIdGenerator(ULIDGenerator()))
+	})
+}
+
+func TestIdGeneration_Gorm(t *testing.T) {
+	db, mock := newMockDB(t)
+	ctx := context.Background()
+	repo := NewGormRepo[claimJob](db, Options().SetIdGenerator(IdGeneratorFunc(func(context.Context) (any, error) {
+		return int64(42), nil
+	})))
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `claim_jobs` (`status`,`priority`,`id`) VALUES (?,?,?)")).
+		WithArgs("new", 0, int64(42)).
+		WillReturnResult(sqlmock.NewResult(42, 1))
+	job := &claimJob{Status: "new"}
+	require.NoError(t, repo.Create(ctx, job))
+	assert.Equal(t, int64(42), job.Id)
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `claim_jobs` (`status`,`priority`,`id`) VALUES (?,?,?) ON DUPLICATE KEY UPDATE")).
+		WithArgs("new", 0, int64(42), "new").
+		WillReturnResult(sqlmock.NewResult(42, 1))
+	require.NoError(t, repo.UpsertOne(ctx, claimJob{Status: "new"}, UpsertOptions{
+		ConflictKvs: map[string]any{"priority": 0},
+		Set:         map[string]any{"status": "new"},
+	}))
+
+	// Update 按 tag 声明的主键列更新
+	skus := NewGormRepo[skuDoc](db)
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `sku_docs` SET `sku_code`=?,`name`=? WHERE `sku_code` = ? AND `sku_code` = ?")).
+		WithArgs("A1", "apple", "A1", "A1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	require.NoError(t, skus.Update(ctx, &skuDoc{Code: "A1", Name: "apple"}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestIdGeneration_GormUpsertMany(t *testing.T) {
+	db, mock := newMockDB(t)
+	ctx := context.Background()
+	next := int64(40)
+	repo := NewGormRepo[syncItem](db, Options().SetIdGenerator(IdGeneratorFunc(func(context.Context) (any, error) {
+		next++
+		return next, nil
+	})))
+
+	// 命中的记录取已有的主键，插入的记录取生成的主键
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`sku` FROM `sync_items` WHERE `sku` IN (?,?) FOR UPDATE")).
+		WithArgs("a", "b").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "sku"}).AddRow(7, "a"))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `sync_items` (`sku`,`name`,`seen`,`notes`,`id`) VALUES (?,?,?,?,?),(?,?,?,?,?)")).
+		WithArgs("a", "", int64(0), "", int64(41), "b", "", int64(0), "", int64(42)).
+		WillReturnResult(sqlmock.NewResult(42, 3))
+	mock.ExpectCommit()
+	items := []*syncItem{{Sku: "a"}, {Sku: "b"}}
+	res, err := repo.UpsertMany(ctx, items, UpsertManyOptions{ConflictFields: []string{"sku"}, UpdateFields: []string{"name"}})
+	require.NoError(t, err)
+	assert.Equal(t, &UpsertResult{InsertCount: 1, UpdateCount: 1}, res)
+	assert.Equal(t, int64(7), items[0].Id)
+	assert.Equal(t, int64(42), items[1].Id)
+
+	// 自增主键按冲突键重新读取
+	auto := NewGormRepo[syncItem](db)
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`sku` FROM `sync_items` WHERE `sku` IN (?,?) FOR UPDATE")).
+		WithArgs("a", "c").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "sku"}).AddRow(7, "a"))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `sync_items` (`sku`,`name`,`seen`,`notes`) VALUES (?,?,?,?),(?,?,?,?)")).
+		WillReturnResult(sqlmock.NewResult(8, 3))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`sku` FROM `sync_items` WHERE `sku` = ? FOR UPDATE")).
+		WithArgs("c").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "sku"}).AddRow(12, "c"))
+	mock.ExpectCommit()
+	items = []*syncItem{{Sku: "a"}, {Sku: "c"}}
+	_, err = auto.UpsertMany(ctx, items, UpsertManyOptions{ConflictFields: []string{"sku"}, UpdateFields: []string{"name"}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), items[0].Id)
+	assert.Equal(t, int64(12), items[1].Id)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestIdGeneration_MongoUpsert(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMongoRepo[idDoc](nil, Options().SetIdGenerator(IdGeneratorFunc(func(context.Context) (any, error) {
+		return "gen", nil
+	})))
+
+	// 生成的主键只在插入时写入，不会覆盖已有记录的主键
+	filter, update, err := repo.upsertDoc(ctx, &idDoc{Name: "a"}, UpsertOptions{ConflictKvs: map[string]any{"name": "a"}})
+	require.NoError(t, err)
+	assert.Equal(t, bson.M{"name": "a"}, filter)
+	assert.Equal(t, bson.M{"name": "a"}, update["$set"])
+	assert.Equal(t, map[string]any{"_id": "gen"}, update["$setOnInsert"])
+
+	_, update, err = repo.upsertDoc(ctx, &idDoc{Name: "b"}, UpsertOptions{ConflictKvs: map[string]any{"_id": "b"}, Set: map[string]any{"name": "b"}})
+	require.NoError(t, err)
+	assert.NotContains(t, update, "$setOnInsert")
+
+	model, err := repo.writeModel(ctx, UpsertOp(idDoc{Name: "c"}, UpsertOptions{ConflictKvs: map[string]any{"name": "c"}}))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"_id": "gen"}, model.(*mongo.UpdateOneModel).Update.(bson.M)["$setOnInsert"])
+}
+
+func TestIdGeneration_MongoWrites(t *testing.T) {
+	coll, commands := newMockColl(t,
+		bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: bson.D{{Key: "_id", Value: "g1"}, {Key: "name", Value: "e"}}}},
+		bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: bson.D{{Key: "_id", Value: "k"}, {Key: "name", Value: "f"}}}},
+		bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 2}, {Key: "nModified", Value: 0},
+			{Key: "upserted", Value: bson.A{bson.D{{Key: "index", Value: 1}, {Key: "_id", Value: "g4"}}}}},
+	)
+	ctx := context.Background()
+	n := 0
+	repo := NewMongoRepo[idDoc](coll, Options().SetIdGenerator(IdGeneratorFunc(func(context.Context) (any, error) {
+		n++
+		return fmt.Sprintf("g%d", n), nil
+	})))
+
+	// FindOneAndUpdate upsert 时生成的主键写入 $setOnInsert，过滤条件包含主键时不生成
+	doc, err := repo.FindOneAndUpdate(ctx, bson.M{"name": "e"}, map[string]any{"name": "e"}, Update().SetUpsert(true).SetReturnAfter(true))
+	require.NoError(t, err)
+	assert.Equal(t, "g1", doc.Key)
+	assert.Equal(t, "g1", commands()[0].Lookup("update", "$setOnInsert", "_id").StringValue())
+	_, err = repo.FindOneAndUpdate(ctx, bson.M{"_id": "k"}, map[string]any{"name": "f"}, Update().SetUpsert(true))
+	require.NoError(t, err)
+	_, err = commands()[1].LookupErr("update", "$setOnInsert", "_id")
+	assert.Error(t, err)
+
+	// UpsertMany 只为插入的记录写回生成的主键
+	items := []*idDoc{{Name: "a"}, {Name: "b"}}
+	res, err := repo.UpsertMany(ctx, items, UpsertManyOptions{ConflictFields: []string{"name"}})
+	require.NoError(t, err)
+	assert.Equal(t, &UpsertResult{InsertCount: 1, UpdateCount: 1}, res)
+	assert.Empty(t, items[0].Key)
+	assert.Equal(t, "g4", items[1].Key)
+}
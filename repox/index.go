@@ -0,0 +1,371 @@
+package repox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+var ErrIndexUnsupported = errors.New("repository does not support the index")
+
+// IndexKey 索引字段，Desc 为 true 时降序
+type IndexKey struct {
+	Field string
+	Desc  bool
+}
+
+// Index 索引定义，字段名可以使用数据库字段名、snake_case 或 Go 字段名
+type Index struct {
+	Name   string     // 索引名，为空时按字段生成：MongoDB 与驱动的默认名称一致（如 a_1_b_-1），MySQL 为 idx_a_b
+	Keys   []IndexKey // 索引字段，复合索引按顺序排列
+	Unique bool       // 唯一索引
+	Text   bool       // 全文索引：MongoDB text 索引，MySQL FULLTEXT 索引
+	// TTL 记录在字段时间之后多久过期，只能用于单字段索引（仅 MongoDB，MySQL 报告为 IndexUnsupported）
+	TTL time.Duration
+	// Partial 部分索引的过滤条件，使用数据库字段名（仅 MongoDB partialFilterExpression，MySQL 不支持）
+	Partial map[string]any
+}
+
+// IndexDeclarer 实体通过 Indexes 方法声明索引，与 index tag 声明的索引合并
+// 部分索引只能通过该方法声明
+type IndexDeclarer interface {
+	Indexes() []Index
+}
+
+// String 返回索引的描述，如 idx_a_b(a, b desc) unique
+func (idx Index) String() string {
+	keys := make([]string, len(idx.Keys))
+	for i, k := range idx.Keys {
+		keys[i] = k.Field
+		if k.Desc {
+			keys[i] += " desc"
+		}
+	}
+	s := idx.Name + "(" + strings.Join(keys, ", ") + ")"
+	if idx.Unique {
+		s += " unique"
+	}
+	if idx.Text {
+		s += " text"
+	}
+	if idx.TTL > 0 {
+		s += " ttl=" + idx.TTL.String()
+	}
+	if len(idx.Partial) > 0 {
+		s += " partial=" + canonicalDoc(idx.Partial)
+	}
+	return s
+}
+
+// IndexAction 索引的比对结果
+type IndexAction string
+
+const (
+	IndexExists      IndexAction = "exists"      // 已存在相同定义的索引
+	IndexCreate      IndexAction = "create"      // 缺少的索引，非 DryRun 时已创建
+	IndexConflict    IndexAction = "conflict"    // 同名索引的定义不同，需要手动处理
+	IndexUnsupported IndexAction = "unsupported" // 当前数据库不支持的索引，已跳过
+	IndexExtra       IndexAction = "extra"       // 数据库中存在但没有声明的索引，不会删除
+)
+
+// IndexChange 单个索引的比对结果
+type IndexChange struct {
+	Action IndexAction
+	Index  Index  // 声明的索引，IndexExtra 时为数据库中的索引
+	Reason string // IndexExists 时匹配的索引名不同、IndexConflict 时数据库中的定义、IndexUnsupported 时的原因
+}
+
+// IndexReport EnsureIndexes 的比对报告
+type IndexReport struct {
+	DryRun  bool
+	Changes []IndexChange
+}
+
+// Drift 判断声明的索引与数据库中的索引是否不一致
+func (r *IndexReport) Drift() bool {
+	return slices.ContainsFunc(r.Changes, func(c IndexChange) bool { return c.Action != IndexExists })
+}
+
+// String 每行输出一个索引的比对结果
+func (r *IndexReport) String() string {
+	var b strings.Builder
+	for _, c := range r.Changes {
+		b.WriteString(string(c.Action))
+		b.WriteByte(' ')
+		b.WriteString(c.Index.String())
+		if c.Reason != "" {
+			b.WriteString(": ")
+			b.WriteString(c.Reason)
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// EnsureIndexOptions 存储 EnsureIndexes 配置
+type EnsureIndexOptions struct {
+	DryRun bool // 只比对不创建
+}
+
+// EnsureIndexOptionsBuilder 链式构建器
+type EnsureIndexOptionsBuilder struct {
+	Opts []func(*EnsureIndexOptions)
+}
+
+// Ensure 创建新的构建器
+func Ensure() *EnsureIndexOptionsBuilder {
+	return &EnsureIndexOptionsBuilder{}
+}
+
+// List 返回所有配置函数
+func (e *EnsureIndexOptionsBuilder) List() []func(*EnsureIndexOptions) {
+	return e.Opts
+}
+
+// SetDryRun 只比对声明的索引和数据库中的索引，不创建缺少的索引
+func (e *EnsureIndexOptionsBuilder) SetDryRun(dryRun bool) *EnsureIndexOptionsBuilder {
+	e.Opts = append(e.Opts, func(opts *EnsureIndexOptions) {
+		opts.DryRun = dryRun
+	})
+	return e
+}
+
+// indexRepo 仓库的内部能力：解析声明的索引、读取和创建数据库中的索引
+type indexRepo interface {
+	// resolveIndex 将字段名转换为仓库使用的字段名并补全索引名，不支持的索引返回 ErrIndexUnsupported
+	resolveIndex(idx Index) (Index, error)
+	listIndexes(ctx context.Context) ([]Index, error)
+	createIndex(ctx context.Context, idx Index) error
+}
+
+// EnsureIndexes 比对实体声明的索引和数据库中的索引，创建缺少的索引并返回比对报告
+// 索引通过 index tag 或 IndexDeclarer 声明；定义不同的同名索引和未声明的索引只出现在报告中，不会被修改或删除。
+// index tag 的格式为 "名称,选项..."，多个索引以分号分隔，名称相同的字段组成复合索引，名称为空时创建单字段索引；
+// 选项包括 unique、desc、text、ttl=<duration> 和 priority=<n>（复合索引中的顺序，默认按字段声明顺序），如：
+//
+//	UserId    int64     `index:"idx_user_created,unique"`
+//	CreatedAt time.Time `index:"idx_user_created,desc;,ttl=720h"`
+func EnsureIndexes[T any](ctx context.Context, repo IFinder[T], opts ...IList[EnsureIndexOptions]) (*IndexReport, error) {
+	ir, ok := repo.(indexRepo)
+	if !ok {
+		return nil, ErrIndexUnsupported
+	}
+	o := NewOptions(opts...)
+	declared, err := declaredIndexes(schemaFor[T]())
+	if err != nil {
+		return nil, err
+	}
+	live, err := ir.listIndexes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &IndexReport{DryRun: o.DryRun}
+	matched := make([]bool, len(live))
+	for _, d := range declared {
+		idx, err := ir.resolveIndex(d)
+		if errors.Is(err, ErrIndexUnsupported) {
+			report.Changes = append(report.Changes, IndexChange{Action: IndexUnsupported, Index: idx, Reason: err.Error()})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		change := IndexChange{Action: IndexCreate, Index: idx}
+		if i := slices.IndexFunc(live, func(l Index) bool { return l.Name == idx.Name }); i >= 0 {
+			matched[i] = true
+			change.Action = IndexExists
+			if !sameIndex(idx, live[i]) {
+				change.Action, change.Reason = IndexConflict, "live "+live[i].String()
+			}
+		} else if i = slices.IndexFunc(live, func(l Index) bool { return sameIndex(idx, l) }); i >= 0 {
+			matched[i] = true
+			change.Action, change.Reason = IndexExists, "named "+live[i].Name
+		}
+		if change.Action == IndexCreate && !o.DryRun {
+			if err = ir.createIndex(ctx, idx); err != nil {
+				return report, fmt.Errorf("repox: create index %s: %w", idx.Name, err)
+			}
+		}
+		report.Changes = append(report.Changes, change)
+	}
+	for i, l := range live {
+		if !matched[i] {
+			report.Changes = append(report.Changes, IndexChange{Action: IndexExtra, Index: l})
+		}
+	}
+	return report, nil
+}
+
+// declaredIndexes 返回实体通过 index tag 和 IndexDeclarer 声明的索引
+func declaredIndexes(schema *entitySchema) ([]Index, error) {
+	type taggedKey struct {
+		key      IndexKey
+		priority int
+		seq      int
+	}
+	var (
+		indexes []Index
+		byName  = make(map[string]int)
+		keys    = make(map[string][]taggedKey)
+	)
+	for seq, f := range schema.Fields {
+		tag, ok := schema.Type.FieldByIndex(f.Index).Tag.Lookup("index")
+		if !ok {
+			continue
+		}
+		for _, spec := range strings.Split(tag, ";") {
+			parts := strings.Split(spec, ",")
+			idx := Index{Name: strings.TrimSpace(parts[0])}
+			tk := taggedKey{key: IndexKey{Field: f.Name}, seq: seq}
+			for _, opt := range parts[1:] {
+				k, v, _ := strings.Cut(strings.TrimSpace(opt), "=")
+				switch k {
+				case "unique":
+					idx.Unique = true
+				case "text":
+					idx.Text = true
+				case "desc":
+					tk.key.Desc = true
+				case "ttl":
+					d, err := time.ParseDuration(v)
+					if err != nil {
+						return nil, fmt.Errorf("repox: invalid ttl of index tag on %s.%s: %w", schema.Type, f.Name, err)
+					}
+					idx.TTL = d
+				case "priority":
+					n, err := strconv.Atoi(v)
+					if err != nil {
+						return nil, fmt.Errorf("repox: invalid priority of index tag on %s.%s: %w", schema.Type, f.Name, err)
+					}
+					tk.priority = n
+				case "":
+				default:
+					return nil, fmt.Errorf("repox: unknown option %s of index tag on %s.%s", k, schema.Type, f.Name)
+				}
+			}
+
+			if idx.Name == "" {
+				idx.Keys = []IndexKey{tk.key}
+				indexes = append(indexes, idx)
+				continue
+			}
+			// 复合索引中任一字段声明的 unique、text 和 ttl 作用于整个索引
+			i, ok := byName[idx.Name]
+			if !ok {
+				i = len(indexes)
+				byName[idx.Name] = i
+				indexes = append(indexes, Index{Name: idx.Name})
+			}
+			indexes[i].Unique = indexes[i].Unique || idx.Unique
+			indexes[i].Text = indexes[i].Text || idx.Text
+			indexes[i].TTL = max(indexes[i].TTL, idx.TTL)
+			keys[idx.Name] = append(keys[idx.Name], tk)
+		}
+	}
+	for name, tks := range keys {
+		sort.SliceStable(tks, func(i, j int) bool {
+			if tks[i].priority != tks[j].priority {
+				return tks[i].priority < tks[j].priority
+			}
+			return tks[i].seq < tks[j].seq
+		})
+		idx := &indexes[byName[name]]
+		for _, tk := range tks {
+			idx.Keys = append(idx.Keys, tk.key)
+		}
+	}
+
+	if d, ok := reflect.New(schema.Type).Interface().(IndexDeclarer); ok {
+		indexes = append(indexes, d.Indexes()...)
+	}
+	for _, idx := range indexes {
+		if len(idx.Keys) == 0 {
+			return nil, fmt.Errorf("repox: index %s of %s has no keys", idx.Name, schema.Type)
+		}
+		if idx.TTL > 0 && len(idx.Keys) > 1 {
+			return nil, fmt.Errorf("repox: ttl index %s of %s must have a single key", idx.Name, schema.Type)
+		}
+	}
+	return indexes, nil
+}
+
+// resolveIndexKeys 将索引字段转换为仓库使用的字段名，name 为空时使用 defaultName 生成索引名
+func resolveIndexKeys(schema *entitySchema, idx Index, fieldName func(*fieldInfo) string, defaultName func(Index) string) (Index, error) {
+	keys := make([]IndexKey, len(idx.Keys))
+	for i, k := range idx.Keys {
+		f, ok := schema.Field(k.Field)
+		if !ok {
+			return idx, fmt.Errorf("repox: unknown index field %s of %s", k.Field, schema.Type)
+		}
+		keys[i] = IndexKey{Field: fieldName(f), Desc: k.Desc}
+	}
+	idx.Keys = keys
+	if idx.Name == "" {
+		idx.Name = defaultName(idx)
+	}
+	return idx, nil
+}
+
+// mongoIndexName 返回与 MongoDB 驱动一致的默认索引名
+func mongoIndexName(idx Index) string {
+	parts := make([]string, len(idx.Keys))
+	for i, k := range idx.Keys {
+		switch {
+		case idx.Text:
+			parts[i] = k.Field + "_text"
+		case k.Desc:
+			parts[i] = k.Field + "_-1"
+		default:
+			parts[i] = k.Field + "_1"
+		}
+	}
+	return strings.Join(parts, "_")
+}
+
+// sameIndex 比较两个索引的定义，不比较索引名；全文索引不比较字段顺序
+func sameIndex(a, b Index) bool {
+	if a.Unique != b.Unique || a.Text != b.Text || a.TTL != b.TTL || len(a.Keys) != len(b.Keys) {
+		return false
+	}
+	if canonicalDoc(a.Partial) != canonicalDoc(b.Partial) {
+		return false
+	}
+	ak, bk := slices.Clone(a.Keys), slices.Clone(b.Keys)
+	if a.Text {
+		for i := range ak {
+			ak[i].Desc, bk[i].Desc = false, false
+		}
+		byField := func(x, y IndexKey) int { return strings.Compare(x.Field, y.Field) }
+		slices.SortFunc(ak, byField)
+		slices.SortFunc(bk, byField)
+	}
+	return slices.Equal(ak, bk)
+}
+
+// canonicalDoc 将过滤条件转换为与字段顺序和整数类型无关的字符串，用于比较部分索引的条件
+func canonicalDoc(doc map[string]any) string {
+	if len(doc) == 0 {
+		return ""
+	}
+	raw, err := bson.MarshalExtJSON(doc, false, false)
+	if err != nil {
+		return fmt.Sprint(doc)
+	}
+	var v any
+	if err = json.Unmarshal(raw, &v); err != nil {
+		return string(raw)
+	}
+	out, _ := json.Marshal(v)
+	return string(out)
+}
@@ -0,0 +1,134 @@
+package repox
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+type indexedDoc struct {
+	Id        int64     `bson:"_id"`
+	Email     string    `bson:"email" index:",unique"`
+	UserId    int64     `bson:"user_id" index:"idx_user_created,priority=1"`
+	CreatedAt time.Time `bson:"created_at" index:"idx_user_created,desc,priority=2;,ttl=720h"`
+	Title     string    `bson:"title" index:"idx_search,text"`
+	Status    string    `bson:"status"`
+}
+
+func (indexedDoc) Indexes() []Index {
+	return []Index{{Name: "active_title", Keys: []IndexKey{{Field: "Title"}}, Partial: map[string]any{"status": "active"}}}
+}
+
+func TestDeclaredIndexes(t *testing.T) {
+	indexes, err := declaredIndexes(schemaFor[indexedDoc]())
+	require.NoError(t, err)
+	assert.Equal(t, []Index{
+		{Keys: []IndexKey{{Field: "Email"}}, Unique: true},
+		{Name: "idx_user_created", Keys: []IndexKey{{Field: "UserId"}, {Field: "CreatedAt", Desc: true}}},
+		{Keys: []IndexKey{{Field: "CreatedAt"}}, TTL: 720 * time.Hour},
+		{Name: "idx_search", Keys: []IndexKey{{Field: "Title"}}, Text: true},
+		{Name: "active_title", Keys: []IndexKey{{Field: "Title"}}, Partial: map[string]any{"status": "active"}},
+	}, indexes)
+
+	_, err = declaredIndexes(schemaFor[struct {
+		A string `index:",ttl=forever"`
+	}]())
+	assert.Error(t, err)
+}
+
+func TestEnsureIndexes_Memory(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo[indexedDoc]()
+
+	report, err := EnsureIndexes(ctx, repo, Ensure().SetDryRun(true))
+	require.NoError(t, err)
+	assert.True(t, report.Drift())
+	assert.Len(t, report.Changes, 5)
+	assert.Equal(t, "email_1", report.Changes[0].Index.Name)
+	assert.Equal(t, "created_at_1", report.Changes[2].Index.Name)
+	live, _ := repo.listIndexes(ctx)
+	assert.Empty(t, live)
+
+	_, err = EnsureIndexes(ctx, repo)
+	require.NoError(t, err)
+	report, err = EnsureIndexes(ctx, repo)
+	require.NoError(t, err)
+	assert.False(t, report.Drift(), report.String())
+}
+
+func TestEnsureIndexes_Gorm(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewGormRepo[indexedDoc](db)
+	ctx := context.Background()
+
+	cols := []string{"Table", "Non_unique", "Key_name", "Seq_in_index", "Column_name", "Collation", "Index_type"}
+	mock.ExpectQuery(regexp.QuoteMeta("SHOW INDEX FROM `indexed_docs`")).
+		WillReturnRows(sqlmock.NewRows(cols).
+			AddRow("indexed_docs", 0, "PRIMARY", 1, "id", "A", "BTREE").
+			AddRow("indexed_docs", 0, "uniq_email", 1, "email", "A", "BTREE").
+			AddRow("indexed_docs", 1, "idx_user_created", 2, "created_at", "A", "BTREE").
+			AddRow("indexed_docs", 1, "idx_user_created", 1, "user_id", "A", "BTREE").
+			AddRow("indexed_docs", 1, "idx_legacy", 1, "status", "A", "BTREE"))
+	mock.ExpectExec(regexp.QuoteMeta("CREATE FULLTEXT INDEX `idx_search` ON `indexed_docs` (`title`)")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	report, err := EnsureIndexes(ctx, repo)
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	actions := make(map[string]IndexAction)
+	for _, c := range report.Changes {
+		actions[c.Index.Name] = c.Action
+	}
+	assert.Equal(t, map[string]IndexAction{
+		"idx_email":        IndexExists,
+		"idx_user_created": IndexConflict,
+		"idx_created_at":   IndexUnsupported,
+		"idx_search":       IndexCreate,
+		"active_title":     IndexUnsupported,
+		"idx_legacy":       IndexExtra,
+	}, actions)
+	assert.Equal(t, "named uniq_email", report.Changes[0].Reason)
+}
+
+func TestEnsureIndexes_MongoSpec(t *testing.T) {
+	idx := Index{Name: "expires", Keys: []IndexKey{{Field: "created_at"}}, TTL: time.Hour, Partial: map[string]any{"status": "active"}}
+	model := mongoIndexModel(idx)
+	assert.Equal(t, bson.D{{Key: "created_at", Value: 1}}, model.Keys)
+	var o options.IndexOptions
+	for _, set := range model.Options.List() {
+		require.NoError(t, set(&o))
+	}
+	assert.Equal(t, int32(3600), *o.ExpireAfterSeconds)
+
+	// listIndexes 返回的索引与声明的索引比较时忽略整数类型
+	raw, err := bson.Marshal(bson.D{
+		{Key: "name", Value: "expires"},
+		{Key: "key", Value: bson.D{{Key: "created_at", Value: int32(1)}}},
+		{Key: "expireAfterSeconds", Value: int32(3600)},
+		{Key: "partialFilterExpression", Value: bson.D{{Key: "status", Value: "active"}}},
+	})
+	require.NoError(t, err)
+	var spec mongoIndexSpec
+	require.NoError(t, bson.Unmarshal(raw, &spec))
+	assert.True(t, sameIndex(idx, spec.index()))
+
+	raw, err = bson.Marshal(bson.D{
+		{Key: "name", Value: "title_text_body_text"},
+		{Key: "key", Value: bson.D{{Key: "_fts", Value: "text"}, {Key: "_ftsx", Value: int32(1)}}},
+		{Key: "weights", Value: bson.D{{Key: "body", Value: int32(1)}, {Key: "title", Value: int32(1)}}},
+	})
+	require.NoError(t, err)
+	var textSpec mongoIndexSpec
+	require.NoError(t, bson.Unmarshal(raw, &textSpec))
+	text := Index{Keys: []IndexKey{{Field: "title"}, {Field: "body"}}, Text: true}
+	assert.Equal(t, "title_text_body_text", mongoIndexName(text))
+	assert.True(t, sameIndex(text, textSpec.index()))
+}
@@ -0,0 +1,444 @@
+package repox
+
+import (
+	"context"
+	"iter"
+	"reflect"
+
+	"github.com/mbeoliero/kit/builder"
+)
+
+// 操作名
+const (
+	OpCreate        = "Create"
+	OpCreateMany    = "CreateMany"
+	OpFindOne       = "FindOne"
+	OpFind          = "Find"
+	OpCount         = "Count"
+	OpFindWithTotal = "FindWithTotal"
+	OpFindPage      = "FindPage"
+	OpIterate       = "Iterate"
+	OpFindInBatches = "FindInBatches"
+	OpUpdate        = "Update"
+	OpIncr          = "Incr"
+	OpUpdateOne     = "UpdateOne"
+	OpUpsertOne     = "UpsertOne"
+	OpUpsertMany    = "UpsertMany"
+	OpUpdateMany    = "UpdateMany"
+	OpDeleteOne     = "DeleteOne"
+	OpDeleteMany    = "DeleteMany"
+	OpRestore       = "Restore"
+
+	OpFindOneAndUpdate = "FindOneAndUpdate"
+	OpFindOneAndDelete = "FindOneAndDelete"
+	OpBulkWrite        = "BulkWrite"
+	OpAggregate        = "Aggregate"
+	OpDistinct         = "Distinct"
+	OpCreateIndex      = "CreateIndex"
+)
+
+// Operation 一次仓库操作
+// 拦截器可以在调用 next 之前修改 Filter 和 Args（如追加访问控制条件），修改后的值会传给底层仓库；
+// next 返回后 Result 为操作结果
+type Operation struct {
+	Name   string       // 操作名，如 OpFind
+	Entity reflect.Type // 实体类型
+	Filter any          // 过滤条件，没有过滤条件的操作为 nil
+	// Args 操作的其它参数：
+	// 写入操作为实体（*T、[]*T 或 T）；查询操作和 FindOneAndDelete 为 *FindOptions；FindPage 为 *PageArgs；
+	// Incr 为 map[string]int；UpdateOne/UpdateMany/FindOneAndUpdate 为 map[string]any；UpsertOne 为 *UpsertArgs；
+	// UpsertMany 为 *UpsertManyArgs；BulkWrite 为 []WriteOp[T]；Aggregate 为 *AggregateOptions；Distinct 为字段名；CreateIndex 为 Index
+	Args   any
+	Result any
+}
+
+// PageArgs FindPage 的参数
+type PageArgs struct {
+	Sort   *Sort
+	Cursor string
+	Limit  int64
+}
+
+// UpsertArgs UpsertOne 的参数
+type UpsertArgs[T any] struct {
+	Create  T
+	Options UpsertOptions
+}
+
+// UpsertManyArgs UpsertMany 的参数
+type UpsertManyArgs[T any] struct {
+	Entities []*T
+	Options  UpsertManyOptions
+}
+
+// Invoker 执行一次操作
+type Invoker func(ctx context.Context, op *Operation) error
+
+// Interceptor 仓库操作拦截器，用于实现校验、监控、链路追踪、访问控制和查询日志等通用逻辑
+type Interceptor interface {
+	// Intercept 拦截一次操作，调用 next 继续执行，不调用则操作不会执行
+	Intercept(ctx context.Context, op *Operation, next Invoker) error
+}
+
+// InterceptorFunc 函数形式的拦截器
+type InterceptorFunc func(ctx context.Context, op *Operation, next Invoker) error
+
+func (f InterceptorFunc) Intercept(ctx context.Context, op *Operation, next Invoker) error {
+	return f(ctx, op, next)
+}
+
+// wrappedRepo 在仓库的每个操作外包裹拦截器链
+type wrappedRepo[T any, C any] struct {
+	repo         Repo[T, C]
+	interceptors []Interceptor
+	entity       reflect.Type
+}
+
+// 确保 wrappedRepo 实现了 Repo 接口
+var _ Repo[any, any] = (*wrappedRepo[any, any])(nil)
+
+// Wrap 返回经过拦截器包装的仓库，拦截器按传入顺序由外到内执行
+func Wrap[T any, C any](repo Repo[T, C], interceptors ...Interceptor) Repo[T, C] {
+	if len(interceptors) == 0 {
+		return repo
+	}
+	// 对已包装的仓库合并拦截器链，新的拦截器在外层，与多层包装的顺序一致
+	if w, ok := repo.(*wrappedRepo[T, C]); ok {
+		return &wrappedRepo[T, C]{
+			repo:         w.repo,
+			interceptors: append(append([]Interceptor{}, interceptors...), w.interceptors...),
+			entity:       w.entity,
+		}
+	}
+	return &wrappedRepo[T, C]{repo: repo, interceptors: interceptors, entity: reflect.TypeFor[T]()}
+}
+
+// invoke 依次经过拦截器后执行 fn
+func (w *wrappedRepo[T, C]) invoke(ctx context.Context, op *Operation, fn Invoker) error {
+	next := fn
+	for i := len(w.interceptors) - 1; i >= 0; i-- {
+		interceptor, inner := w.interceptors[i], next
+		next = func(ctx context.Context, op *Operation) error {
+			return interceptor.Intercept(ctx, op, inner)
+		}
+	}
+	return next(ctx, op)
+}
+
+func (w *wrappedRepo[T, C]) op(name string, filter any, args any) *Operation {
+	return &Operation{Name: name, Entity: w.entity, Filter: filter, Args: args}
+}
+
+// findOptions 取出拦截器处理后的查询选项
+func findOptions(op *Operation) IList[FindOptions] {
+	o, _ := op.Args.(*FindOptions)
+	if o == nil {
+		o = &FindOptions{}
+	}
+	return resolved(o)
+}
+
+// Native 返回底层连接，不经过拦截器
+func (w *wrappedRepo[T, C]) Native() C {
+	return w.repo.Native()
+}
+
+// newQueryBuilder 转发底层仓库的查询构建器
+func (w *wrappedRepo[T, C]) newQueryBuilder() builder.QBuilder {
+	if p, ok := w.repo.(queryBuilderRepo); ok {
+		return p.newQueryBuilder()
+	}
+	return builder.NewMongoQueryBuilder()
+}
+
+// tenantScope 转发底层仓库的租户隔离配置
+func (w *wrappedRepo[T, C]) tenantScope() tenancy {
+	if p, ok := w.repo.(tenantScopedRepo); ok {
+		return p.tenantScope()
+	}
+	return tenancy{}
+}
+
+// idField 转发底层仓库的主键字段名
+func (w *wrappedRepo[T, C]) idField() string {
+	if p, ok := w.repo.(queryBuilderRepo); ok {
+		return p.idField()
+	}
+	return "_id"
+}
+
+// fieldName 转发底层仓库的字段名
+func (w *wrappedRepo[T, C]) fieldName(f *fieldInfo) string {
+	if p, ok := w.repo.(queryBuilderRepo); ok {
+		return p.fieldName(f)
+	}
+	return f.BsonName
+}
+
+// aggregate 经过拦截器链后执行底层仓库的聚合，Result 为解码目标 *[]R
+func (w *wrappedRepo[T, C]) aggregate(ctx context.Context, filter any, o *AggregateOptions, dest any) error {
+	a, ok := w.repo.(aggregateRepo)
+	if !ok {
+		return ErrAggregateUnsupported
+	}
+	return w.invoke(ctx, w.op(OpAggregate, filter, o), func(ctx context.Context, op *Operation) error {
+		op.Result = dest
+		return a.aggregate(ctx, op.Filter, op.Args.(*AggregateOptions), dest)
+	})
+}
+
+// distinct 经过拦截器链后执行底层仓库的去重查询，Result 为解码目标 *[]V
+func (w *wrappedRepo[T, C]) distinct(ctx context.Context, field string, filter any, dest any) error {
+	a, ok := w.repo.(aggregateRepo)
+	if !ok {
+		return ErrAggregateUnsupported
+	}
+	return w.invoke(ctx, w.op(OpDistinct, filter, field), func(ctx context.Context, op *Operation) error {
+		op.Result = dest
+		return a.distinct(ctx, op.Args.(string), op.Filter, dest)
+	})
+}
+
+// resolveIndex 转发底层仓库的索引解析
+func (w *wrappedRepo[T, C]) resolveIndex(idx Index) (Index, error) {
+	ir, ok := w.repo.(indexRepo)
+	if !ok {
+		return idx, ErrIndexUnsupported
+	}
+	return ir.resolveIndex(idx)
+}
+
+// listIndexes 转发底层仓库的索引查询
+func (w *wrappedRepo[T, C]) listIndexes(ctx context.Context) ([]Index, error) {
+	ir, ok := w.repo.(indexRepo)
+	if !ok {
+		return nil, ErrIndexUnsupported
+	}
+	return ir.listIndexes(ctx)
+}
+
+// createIndex 经过拦截器链后创建索引
+func (w *wrappedRepo[T, C]) createIndex(ctx context.Context, idx Index) error {
+	ir, ok := w.repo.(indexRepo)
+	if !ok {
+		return ErrIndexUnsupported
+	}
+	return w.invoke(ctx, w.op(OpCreateIndex, nil, idx), func(ctx context.Context, op *Operation) error {
+		return ir.createIndex(ctx, op.Args.(Index))
+	})
+}
+
+func (w *wrappedRepo[T, C]) Create(ctx context.Context, entity *T) error {
+	return w.invoke(ctx, w.op(OpCreate, nil, entity), func(ctx context.Context, op *Operation) error {
+		return w.repo.Create(ctx, op.Args.(*T))
+	})
+}
+
+func (w *wrappedRepo[T, C]) CreateMany(ctx context.Context, entities []*T) error {
+	return w.invoke(ctx, w.op(OpCreateMany, nil, entities), func(ctx context.Context, op *Operation) error {
+		return w.repo.CreateMany(ctx, op.Args.([]*T))
+	})
+}
+
+func (w *wrappedRepo[T, C]) FindOne(ctx context.Context, filter any, opts ...IList[FindOptions]) (*T, error) {
+	op := w.op(OpFindOne, filter, NewOptions(opts...))
+	err := w.invoke(ctx, op, func(ctx context.Context, op *Operation) error {
+		result, err := w.repo.FindOne(ctx, op.Filter, findOptions(op))
+		op.Result = result
+		return err
+	})
+	result, _ := op.Result.(*T)
+	return result, err
+}
+
+func (w *wrappedRepo[T, C]) Find(ctx context.Context, filter any, opts ...IList[FindOptions]) ([]*T, error) {
+	op := w.op(OpFind, filter, NewOptions(opts...))
+	err := w.invoke(ctx, op, func(ctx context.Context, op *Operation) error {
+		result, err := w.repo.Find(ctx, op.Filter, findOptions(op))
+		op.Result = result
+		return err
+	})
+	result, _ := op.Result.([]*T)
+	return result, err
+}
+
+func (w *wrappedRepo[T, C]) Count(ctx context.Context, filter any, opts ...IList[FindOptions]) (int64, error) {
+	op := w.op(OpCount, filter, NewOptions(opts...))
+	err := w.invoke(ctx, op, func(ctx context.Context, op *Operation) error {
+		result, err := w.repo.Count(ctx, op.Filter, findOptions(op))
+		op.Result = result
+		return err
+	})
+	result, _ := op.Result.(int64)
+	return result, err
+}
+
+func (w *wrappedRepo[T, C]) FindWithTotal(ctx context.Context, filter any, opts ...IList[FindOptions]) (*Page[T], error) {
+	op := w.op(OpFindWithTotal, filter, NewOptions(opts...))
+	err := w.invoke(ctx, op, func(ctx context.Context, op *Operation) error {
+		result, err := w.repo.FindWithTotal(ctx, op.Filter, findOptions(op))
+		op.Result = result
+		return err
+	})
+	result, _ := op.Result.(*Page[T])
+	return result, err
+}
+
+func (w *wrappedRepo[T, C]) FindPage(ctx context.Context, filter any, sort *Sort, cursor string, limit int64) (*CursorPage[T], error) {
+	op := w.op(OpFindPage, filter, &PageArgs{Sort: sort, Cursor: cursor, Limit: limit})
+	err := w.invoke(ctx, op, func(ctx context.Context, op *Operation) error {
+		args := op.Args.(*PageArgs)
+		result, err := w.repo.FindPage(ctx, op.Filter, args.Sort, args.Cursor, args.Limit)
+		op.Result = result
+		return err
+	})
+	result, _ := op.Result.(*CursorPage[T])
+	return result, err
+}
+
+// Iterate 拦截器包裹整个遍历过程，遍历开始时才会执行
+func (w *wrappedRepo[T, C]) Iterate(ctx context.Context, filter any, opts ...IList[FindOptions]) iter.Seq2[*T, error] {
+	return func(yield func(*T, error) bool) {
+		stopped := false
+		err := w.invoke(ctx, w.op(OpIterate, filter, NewOptions(opts...)), func(ctx context.Context, op *Operation) error {
+			for item, err := range w.repo.Iterate(ctx, op.Filter, findOptions(op)) {
+				if err != nil {
+					return err
+				}
+				if !yield(item, nil) {
+					stopped = true
+					return nil
+				}
+			}
+			return nil
+		})
+		if err != nil && !stopped {
+			yield(nil, err)
+		}
+	}
+}
+
+func (w *wrappedRepo[T, C]) FindInBatches(ctx context.Context, filter any, batchSize int, fn func(batch []*T) error, opts ...IList[FindOptions]) error {
+	return w.invoke(ctx, w.op(OpFindInBatches, filter, NewOptions(opts...)), func(ctx context.Context, op *Operation) error {
+		return w.repo.FindInBatches(ctx, op.Filter, batchSize, fn, findOptions(op))
+	})
+}
+
+func (w *wrappedRepo[T, C]) Update(ctx context.Context, entity *T) error {
+	return w.invoke(ctx, w.op(OpUpdate, nil, entity), func(ctx context.Context, op *Operation) error {
+		return w.repo.Update(ctx, op.Args.(*T))
+	})
+}
+
+func (w *wrappedRepo[T, C]) Incr(ctx context.Context, filter any, incr map[string]int, opts ...IList[UpdateOptions]) error {
+	return w.invoke(ctx, w.op(OpIncr, filter, incr), func(ctx context.Context, op *Operation) error {
+		return w.repo.Incr(ctx, op.Filter, op.Args.(map[string]int), opts...)
+	})
+}
+
+func (w *wrappedRepo[T, C]) UpdateOne(ctx context.Context, filter any, update map[string]any, opts ...IList[UpdateOptions]) (*UpdateResult, error) {
+	op := w.op(OpUpdateOne, filter, update)
+	err := w.invoke(ctx, op, func(ctx context.Context, op *Operation) error {
+		result, err := w.repo.UpdateOne(ctx, op.Filter, op.Args.(map[string]any), opts...)
+		op.Result = result
+		return err
+	})
+	result, _ := op.Result.(*UpdateResult)
+	return result, err
+}
+
+func (w *wrappedRepo[T, C]) UpsertOne(ctx context.Context, create T, opt UpsertOptions) error {
+	return w.invoke(ctx, w.op(OpUpsertOne, nil, &UpsertArgs[T]{Create: create, Options: opt}), func(ctx context.Context, op *Operation) error {
+		args := op.Args.(*UpsertArgs[T])
+		return w.repo.UpsertOne(ctx, args.Create, args.Options)
+	})
+}
+
+func (w *wrappedRepo[T, C]) UpsertMany(ctx context.Context, entities []*T, opt UpsertManyOptions) (*UpsertResult, error) {
+	op := w.op(OpUpsertMany, nil, &UpsertManyArgs[T]{Entities: entities, Options: opt})
+	err := w.invoke(ctx, op, func(ctx context.Context, op *Operation) error {
+		args := op.Args.(*UpsertManyArgs[T])
+		result, err := w.repo.UpsertMany(ctx, args.Entities, args.Options)
+		op.Result = result
+		return err
+	})
+	result, _ := op.Result.(*UpsertResult)
+	return result, err
+}
+
+func (w *wrappedRepo[T, C]) UpdateMany(ctx context.Context, filter any, update map[string]any, opts ...IList[UpdateOptions]) (*UpdateResult, error) {
+	op := w.op(OpUpdateMany, filter, update)
+	err := w.invoke(ctx, op, func(ctx context.Context, op *Operation) error {
+		result, err := w.repo.UpdateMany(ctx, op.Filter, op.Args.(map[string]any), opts...)
+		op.Result = result
+		return err
+	})
+	result, _ := op.Result.(*UpdateResult)
+	return result, err
+}
+
+func (w *wrappedRepo[T, C]) FindOneAndUpdate(ctx context.Context, filter any, update map[string]any, opts ...IList[UpdateOptions]) (*T, error) {
+	op := w.op(OpFindOneAndUpdate, filter, update)
+	err := w.invoke(ctx, op, func(ctx context.Context, op *Operation) error {
+		result, err := w.repo.FindOneAndUpdate(ctx, op.Filter, op.Args.(map[string]any), opts...)
+		op.Result = result
+		return err
+	})
+	result, _ := op.Result.(*T)
+	return result, err
+}
+
+func (w *wrappedRepo[T, C]) DeleteOne(ctx context.Context, filter any) (*DeleteResult, error) {
+	op := w.op(OpDeleteOne, filter, nil)
+	err := w.invoke(ctx, op, func(ctx context.Context, op *Operation) error {
+		result, err := w.repo.DeleteOne(ctx, op.Filter)
+		op.Result = result
+		return err
+	})
+	result, _ := op.Result.(*DeleteResult)
+	return result, err
+}
+
+func (w *wrappedRepo[T, C]) DeleteMany(ctx context.Context, filter any) (*DeleteResult, error) {
+	op := w.op(OpDeleteMany, filter, nil)
+	err := w.invoke(ctx, op, func(ctx context.Context, op *Operation) error {
+		result, err := w.repo.DeleteMany(ctx, op.Filter)
+		op.Result = result
+		return err
+	})
+	result, _ := op.Result.(*DeleteResult)
+	return result, err
+}
+
+func (w *wrappedRepo[T, C]) FindOneAndDelete(ctx context.Context, filter any, opts ...IList[FindOptions]) (*T, error) {
+	op := w.op(OpFindOneAndDelete, filter, NewOptions(opts...))
+	err := w.invoke(ctx, op, func(ctx context.Context, op *Operation) error {
+		result, err := w.repo.FindOneAndDelete(ctx, op.Filter, findOptions(op))
+		op.Result = result
+		return err
+	})
+	result, _ := op.Result.(*T)
+	return result, err
+}
+
+func (w *wrappedRepo[T, C]) BulkWrite(ctx context.Context, ops []WriteOp[T], opts ...IList[BulkOptions]) (*BulkResult, error) {
+	op := w.op(OpBulkWrite, nil, ops)
+	err := w.invoke(ctx, op, func(ctx context.Context, op *Operation) error {
+		result, err := w.repo.BulkWrite(ctx, op.Args.([]WriteOp[T]), opts...)
+		op.Result = result
+		return err
+	})
+	result, _ := op.Result.(*BulkResult)
+	return result, err
+}
+
+func (w *wrappedRepo[T, C]) Restore(ctx context.Context, filter any) (*UpdateResult, error) {
+	op := w.op(OpRestore, filter, nil)
+	err := w.invoke(ctx, op, func(ctx context.Context, op *Operation) error {
+		result, err := w.repo.Restore(ctx, op.Filter)
+		op.Result = result
+		return err
+	})
+	result, _ := op.Result.(*UpdateResult)
+	return result, err
+}
@@ -0,0 +1,90 @@
+package repox
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestWrap(t *testing.T) {
+	ctx := context.Background()
+	var calls []string
+	record := func(name string) Interceptor {
+		return InterceptorFunc(func(ctx context.Context, op *Operation, next Invoker) error {
+			calls = append(calls, name+">"+op.Name)
+			err := next(ctx, op)
+			calls = append(calls, name+"<"+op.Name)
+			return err
+		})
+	}
+	// 只允许访问 age >= 25 的记录
+	acl := InterceptorFunc(func(ctx context.Context, op *Operation, next Invoker) error {
+		cond := bson.M{"age": bson.M{"$gte": 25}}
+		if op.Filter == nil {
+			op.Filter = cond
+		} else {
+			op.Filter = bson.M{"$and": bson.A{op.Filter, cond}}
+		}
+		return next(ctx, op)
+	})
+
+	repo := Wrap[memUser, []*memUser](newMemUsers(t), record("a"), record("b"), acl)
+
+	users, err := repo.Find(ctx, nil, Find().SetSort(NewSort().Asc("name")))
+	require.NoError(t, err)
+	require.Len(t, users, 3)
+	assert.Equal(t, "bob", users[0].Name)
+	assert.Equal(t, []string{"a>Find", "b>Find", "b<Find", "a<Find"}, calls)
+
+	count, err := repo.Count(ctx, bson.M{"name": "alice"})
+	require.NoError(t, err)
+	assert.Zero(t, count)
+
+	var names []string
+	for u, err := range repo.Iterate(ctx, bson.M{"age": 30}) {
+		require.NoError(t, err)
+		names = append(names, u.Name)
+	}
+	assert.Len(t, names, 2)
+
+	res, err := repo.DeleteMany(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), res.DeleteCount)
+}
+
+func TestWrap_Validation(t *testing.T) {
+	ctx := context.Background()
+	errInvalid := errors.New("name required")
+	validate := InterceptorFunc(func(ctx context.Context, op *Operation, next Invoker) error {
+		if u, ok := op.Args.(*memUser); ok && u.Name == "" {
+			return errInvalid
+		}
+		return next(ctx, op)
+	})
+
+	var results []any
+	observe := InterceptorFunc(func(ctx context.Context, op *Operation, next Invoker) error {
+		err := next(ctx, op)
+		results = append(results, op.Result)
+		return err
+	})
+
+	inner := NewMemoryRepo[memUser]()
+	repo := Wrap(Wrap[memUser, []*memUser](inner, validate), observe)
+
+	assert.ErrorIs(t, repo.Create(ctx, &memUser{}), errInvalid)
+	require.NoError(t, repo.Create(ctx, &memUser{Name: "alice"}))
+
+	u, err := repo.FindOne(ctx, bson.M{"name": "alice"})
+	require.NoError(t, err)
+	assert.Equal(t, "alice", u.Name)
+	require.Len(t, results, 3)
+	assert.Same(t, u, results[2])
+
+	_, err = repo.FindOne(ctx, bson.M{"name": "bob"})
+	assert.ErrorIs(t, err, DataNotFound)
+}
@@ -0,0 +1,99 @@
+package repox
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestIterate_Memory(t *testing.T) {
+	ctx := context.Background()
+	repo := newMemUsers(t)
+
+	var names []string
+	for u, err := range repo.Iterate(ctx, bson.M{"age": bson.M{"$gte": 25}}, Find().SetSort(NewSort().Asc("name"))) {
+		require.NoError(t, err)
+		names = append(names, u.Name)
+		if len(names) == 2 {
+			break
+		}
+	}
+	assert.Equal(t, []string{"bob", "carol"}, names)
+
+	for _, err := range repo.Iterate(ctx, bson.M{"unknown": 1}) {
+		assert.Error(t, err)
+	}
+}
+
+func TestFindInBatches_Memory(t *testing.T) {
+	ctx := context.Background()
+	repo := newMemUsers(t)
+
+	var sizes []int
+	err := repo.FindInBatches(ctx, nil, 3, func(batch []*memUser) error {
+		sizes = append(sizes, len(batch))
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []int{3, 1}, sizes)
+
+	stop := errors.New("stop")
+	calls := 0
+	err = repo.FindInBatches(ctx, nil, 1, func([]*memUser) error {
+		calls++
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, 1, calls)
+}
+
+func TestIterate_Gorm(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewGormRepo[txUser](db)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `tx_users` WHERE `tx_users`.`name` = ?")).
+		WithArgs("bob").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "bob").AddRow(2, "bob").AddRow(3, "bob"))
+
+	var ids []int64
+	for u, err := range repo.Iterate(context.Background(), map[string]any{"name": "bob"}) {
+		require.NoError(t, err)
+		ids = append(ids, u.Id)
+		if len(ids) == 2 {
+			break
+		}
+	}
+	assert.Equal(t, []int64{1, 2}, ids)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestFindInBatches_Gorm(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewGormRepo[txUser](db)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `tx_users` ORDER BY `tx_users`.`id` LIMIT ?")).
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "a").AddRow(2, "b"))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `tx_users` WHERE `tx_users`.`id` > ? ORDER BY `tx_users`.`id` LIMIT ?")).
+		WithArgs(2, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(3, "c"))
+
+	var batches [][]string
+	err := repo.FindInBatches(context.Background(), nil, 2, func(batch []*txUser) error {
+		names := make([]string, len(batch))
+		for i, u := range batch {
+			names[i] = u.Name
+		}
+		batches = append(batches, names)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"a", "b"}, {"c"}}, batches)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,73 @@
+package repox
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mbeoliero/kit/log"
+)
+
+var ErrUnboundedFind = errors.New("unbounded find exceeds the limit")
+
+// withMaxTime 为单次操作设置超时，d 不大于 0 时返回原 ctx
+// MongoDB 驱动会根据 ctx 的截止时间为命令设置 maxTimeMS，返回游标的查询除外，由 findCursor 显式发送
+func withMaxTime(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// findGuard 仓库的无 Limit 查询限制，max 为 0 表示不限制
+type findGuard struct {
+	max    int64
+	reject bool
+}
+
+// newFindGuard 根据仓库配置创建无 Limit 查询限制
+func newFindGuard(o *RepoOptions) findGuard {
+	return findGuard{max: o.MaxUnboundedFind, reject: o.RejectUnboundedFind}
+}
+
+// apply 未设置 Limit 时将 Limit 设置为上限加一，用于判断结果是否超过上限，返回是否设置
+func (g findGuard) apply(o *FindOptions) bool {
+	if g.max <= 0 || o.Limit > 0 {
+		return false
+	}
+	o.Limit = g.max + 1
+	return true
+}
+
+// check 检查设置了上限的查询结果，超过上限时记录调用方，拒绝时返回 ErrUnboundedFind，否则截断到上限
+func checkUnbounded[T any](ctx context.Context, g findGuard, guarded bool, results []*T) ([]*T, error) {
+	if !guarded || int64(len(results)) <= g.max {
+		return results, nil
+	}
+	caller := externalCaller()
+	if g.reject {
+		log.CtxError(ctx, "repox: reject unbounded find of %T over %d documents, caller %s", *new(T), g.max, caller)
+		return nil, ErrUnboundedFind
+	}
+	log.CtxWarn(ctx, "repox: unbounded find of %T capped to %d documents, caller %s", *new(T), g.max, caller)
+	return results[:g.max], nil
+}
+
+// externalCaller 返回调用栈中第一个 repox 之外（或测试文件中）的调用位置
+func externalCaller() string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "github.com/mbeoliero/kit/repox.") || strings.HasSuffix(frame.File, "_test.go") {
+			return frame.Function + " " + frame.File + ":" + strconv.Itoa(frame.Line)
+		}
+		if !more {
+			return "unknown"
+		}
+	}
+}
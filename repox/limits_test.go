@@ -0,0 +1,121 @@
+package repox
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestMaxTime_Gorm(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewGormRepo[claimJob](db)
+	ctx := context.Background()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT /*+ MAX_EXECUTION_TIME(1500) */ * FROM `claim_jobs` WHERE `claim_jobs`.`status` = ? ORDER BY `claim_jobs`.`id` LIMIT ?")).
+		WithArgs("new", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow(1, "new"))
+	_, err := repo.FindOne(ctx, map[string]any{"status": "new"}, Find().SetMaxTime(1500*time.Millisecond))
+	require.NoError(t, err)
+
+	// 提示只加在外层查询
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT /*+ MAX_EXECUTION_TIME(1) */ count(*) FROM (SELECT `id` FROM `claim_jobs` LIMIT ?) AS t")).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	_, err = repo.Count(ctx, nil, Find().SetLimit(10).SetMaxTime(time.Microsecond*100))
+	require.NoError(t, err)
+
+	// 超时后取消执行
+	mock.ExpectExec("UPDATE").WillDelayFor(50 * time.Millisecond).WillReturnResult(sqlmock.NewResult(0, 1))
+	_, err = repo.UpdateMany(ctx, map[string]any{"status": "new"}, map[string]any{"status": "done"}, Update().SetMaxTime(5*time.Millisecond))
+	assert.ErrorIs(t, err, sqlmock.ErrCancelled)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMaxTime_Mongo(t *testing.T) {
+	doc := bson.D{{Key: "_id", Value: 1}, {Key: "status", Value: "new"}}
+	coll, commands := newMockColl(t, cursorReply(doc), cursorReply(doc), cursorReply(doc), cursorReply(doc))
+	repo := NewMongoRepo[claimJob](coll)
+	ctx := context.Background()
+
+	// 返回游标的查询改用聚合管道并显式发送 maxTimeMS
+	opt := Find().SetMaxTime(1500 * time.Millisecond).SetSort(NewSort().Desc("priority")).SetSkip(1).SetLimit(2)
+	got, err := repo.Find(ctx, bson.M{"status": "new"}, opt)
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	for _, err = range repo.Iterate(ctx, nil, opt) {
+		require.NoError(t, err)
+	}
+	require.NoError(t, repo.FindInBatches(ctx, nil, 10, func([]*claimJob) error { return nil }, opt))
+	// 未设置 MaxTime 时仍使用 find 命令
+	_, err = repo.Find(ctx, nil, Find().SetLimit(1))
+	require.NoError(t, err)
+
+	cmds := commands()
+	require.Len(t, cmds, 4)
+	for _, cmd := range cmds[:3] {
+		assert.Equal(t, "aggregate", cmd.Index(0).Key())
+		assert.Equal(t, int64(1500), cmd.Lookup("maxTimeMS").AsInt64())
+	}
+	var pipeline []bson.D
+	require.NoError(t, cmds[0].Lookup("pipeline").Unmarshal(&pipeline))
+	assert.Equal(t, []bson.D{
+		{{Key: "$match", Value: bson.D{{Key: "status", Value: "new"}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "priority", Value: int32(-1)}}}},
+		{{Key: "$skip", Value: int64(1)}},
+		{{Key: "$limit", Value: int64(2)}},
+	}, pipeline)
+	assert.Equal(t, int64(10), cmds[2].Lookup("cursor", "batchSize").AsInt64())
+	assert.Equal(t, "find", cmds[3].Index(0).Key())
+	_, err = cmds[3].LookupErr("maxTimeMS")
+	assert.Error(t, err)
+}
+
+func TestUnboundedFind_Memory(t *testing.T) {
+	ctx := context.Background()
+	users := newMemUsers(t).Native()
+
+	capped := NewMemoryRepo[memUser](Options().SetUnboundedFindLimit(3, false))
+	require.NoError(t, capped.CreateMany(ctx, users))
+	got, err := capped.Find(ctx, bson.M{})
+	require.NoError(t, err)
+	assert.Len(t, got, 3)
+
+	// 设置了 Limit 的查询、Iterate 和 FindInBatches 不受限制
+	got, err = capped.Find(ctx, bson.M{}, Find().SetLimit(10))
+	require.NoError(t, err)
+	assert.Len(t, got, 4)
+	n := 0
+	for _, err := range capped.Iterate(ctx, bson.M{}) {
+		require.NoError(t, err)
+		n++
+	}
+	assert.Equal(t, 4, n)
+
+	rejecting := NewMemoryRepo[memUser](Options().SetUnboundedFindLimit(3, true))
+	require.NoError(t, rejecting.CreateMany(ctx, users))
+	_, err = rejecting.Find(ctx, bson.M{})
+	assert.ErrorIs(t, err, ErrUnboundedFind)
+	got, err = rejecting.Find(ctx, bson.M{"age": 30})
+	require.NoError(t, err)
+	assert.Len(t, got, 2)
+}
+
+func TestUnboundedFind_Gorm(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewGormRepo[claimJob](db, Options().SetUnboundedFindLimit(2, true))
+	ctx := context.Background()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `claim_jobs` LIMIT ?")).
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2).AddRow(3))
+	_, err := repo.Find(ctx, nil)
+	assert.ErrorIs(t, err, ErrUnboundedFind)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	assert.Contains(t, externalCaller(), "TestUnboundedFind_Gorm")
+}
@@ -0,0 +1,241 @@
+package repox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// defaultLoaderWait 默认的批量等待时间
+const defaultLoaderWait = time.Millisecond
+
+var ErrLoaderUnsupported = errors.New("repository does not support batched loading")
+
+// LoaderOptions 批量加载器配置
+type LoaderOptions struct {
+	Wait     time.Duration // 收集同一批主键的等待时间，默认 1ms
+	MaxBatch int           // 每批最多的主键数，达到后立即查询，默认 500
+}
+
+// LoaderOptionsBuilder 链式构建器
+type LoaderOptionsBuilder struct {
+	Opts []func(*LoaderOptions)
+}
+
+// Load 创建新的构建器
+func Load() *LoaderOptionsBuilder {
+	return &LoaderOptionsBuilder{}
+}
+
+// List 返回所有配置函数
+func (b *LoaderOptionsBuilder) List() []func(*LoaderOptions) {
+	return b.Opts
+}
+
+func (b *LoaderOptionsBuilder) SetWait(wait time.Duration) *LoaderOptionsBuilder {
+	b.Opts = append(b.Opts, func(opts *LoaderOptions) {
+		opts.Wait = wait
+	})
+	return b
+}
+
+func (b *LoaderOptionsBuilder) SetMaxBatch(size int) *LoaderOptionsBuilder {
+	b.Opts = append(b.Opts, func(opts *LoaderOptions) {
+		opts.MaxBatch = size
+	})
+	return b
+}
+
+// Loader 请求级的按主键批量加载器，用于消除 N+1 查询
+// 等待时间内并发的 Load 合并为一次按主键的 In 查询，相同主键只查询一次；
+// 查询成功的结果（包括 DataNotFound）在加载器的生命周期内缓存，查询失败的主键下次 Load 时重新查询。
+// 查询使用创建加载器时的 ctx（租户、事务等均取自该 ctx），Load 的 ctx 只控制等待；
+// 加载器不感知写操作，应为每个请求创建新的加载器，或在写入后调用 Clear
+type Loader[T any] struct {
+	ctx    context.Context
+	repo   IFinder[T]
+	opts   *LoaderOptions
+	schema *entitySchema
+
+	mu    sync.Mutex
+	calls map[string]*loadCall[T]
+	batch *loadBatch[T]
+}
+
+// loadCall 一个主键的加载结果，done 关闭后 item 和 err 可读
+type loadCall[T any] struct {
+	done chan struct{}
+	item *T
+	err  error
+}
+
+// loadBatch 等待查询的一批主键
+type loadBatch[T any] struct {
+	ids   []any
+	keys  []string
+	calls []*loadCall[T]
+	full  chan struct{}
+}
+
+// NewLoader 创建批量加载器，ctx 为请求的 ctx
+func NewLoader[T any](ctx context.Context, repo IFinder[T], opts ...IList[LoaderOptions]) *Loader[T] {
+	o := NewOptions(opts...)
+	if o.Wait <= 0 {
+		o.Wait = defaultLoaderWait
+	}
+	if o.MaxBatch <= 0 {
+		o.MaxBatch = defaultBatchSize
+	}
+	return &Loader[T]{
+		ctx:    ctx,
+		repo:   repo,
+		opts:   o,
+		schema: schemaFor[T](),
+		calls:  make(map[string]*loadCall[T]),
+	}
+}
+
+// Load 按主键加载一条记录，记录不存在时返回 DataNotFound
+func (l *Loader[T]) Load(ctx context.Context, id any) (*T, error) {
+	return l.enqueue(id).wait(ctx)
+}
+
+// LoadMany 按主键加载多条记录，结果和错误与 ids 一一对应，不存在的记录对应 DataNotFound
+func (l *Loader[T]) LoadMany(ctx context.Context, ids []any) ([]*T, []error) {
+	calls := make([]*loadCall[T], len(ids))
+	for i, id := range ids {
+		calls[i] = l.enqueue(id)
+	}
+	items := make([]*T, len(ids))
+	errs := make([]error, len(ids))
+	for i, call := range calls {
+		items[i], errs[i] = call.wait(ctx)
+	}
+	return items, errs
+}
+
+// Clear 清除主键的缓存结果，下次 Load 时重新查询
+func (l *Loader[T]) Clear(id any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.calls, loaderKey(id))
+}
+
+// enqueue 返回主键的加载结果，没有缓存时加入当前批次
+func (l *Loader[T]) enqueue(id any) *loadCall[T] {
+	id = l.coerce(id)
+	key := loaderKey(id)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if call, ok := l.calls[key]; ok {
+		return call
+	}
+	call := &loadCall[T]{done: make(chan struct{})}
+	l.calls[key] = call
+
+	b := l.batch
+	if b == nil {
+		b = &loadBatch[T]{full: make(chan struct{})}
+		l.batch = b
+		go l.dispatch(b)
+	}
+	b.ids = append(b.ids, id)
+	b.keys = append(b.keys, key)
+	b.calls = append(b.calls, call)
+	if len(b.ids) >= l.opts.MaxBatch {
+		l.batch = nil
+		close(b.full)
+	}
+	return call
+}
+
+// dispatch 等待批次收集完成后执行查询
+func (l *Loader[T]) dispatch(b *loadBatch[T]) {
+	timer := time.NewTimer(l.opts.Wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		l.mu.Lock()
+		if l.batch == b {
+			l.batch = nil
+		}
+		l.mu.Unlock()
+	case <-b.full:
+	}
+
+	items, err := l.fetch(b.ids)
+	if err != nil {
+		l.mu.Lock()
+		for i, key := range b.keys {
+			if l.calls[key] == b.calls[i] {
+				delete(l.calls, key)
+			}
+		}
+		l.mu.Unlock()
+		for _, call := range b.calls {
+			call.err = err
+			close(call.done)
+		}
+		return
+	}
+
+	found := make(map[string]*T, len(items))
+	for _, item := range items {
+		id, _ := l.schema.Primary.Value(reflect.ValueOf(item))
+		found[loaderKey(id)] = item
+	}
+	for i, call := range b.calls {
+		if item, ok := found[b.keys[i]]; ok {
+			call.item = item
+		} else {
+			call.err = DataNotFound
+		}
+		close(call.done)
+	}
+}
+
+// fetch 按主键查询一批记录
+func (l *Loader[T]) fetch(ids []any) ([]*T, error) {
+	p, ok := l.repo.(queryBuilderRepo)
+	if !ok || l.schema.Primary == nil {
+		return nil, ErrLoaderUnsupported
+	}
+	return l.repo.Find(l.ctx, p.newQueryBuilder().In(p.idField(), ids...).Build(), Find().SetLimit(int64(len(ids))))
+}
+
+// coerce 主键为 ObjectID 时将十六进制字符串转换为 ObjectID，使其能匹配 MongoDB 中的记录
+func (l *Loader[T]) coerce(id any) any {
+	s, ok := id.(string)
+	if !ok || l.schema.Primary == nil || l.schema.Primary.Type != reflect.TypeFor[bson.ObjectID]() {
+		return id
+	}
+	if oid, err := bson.ObjectIDFromHex(s); err == nil {
+		return oid
+	}
+	return id
+}
+
+// wait 等待加载完成，ctx 结束时返回 ctx 的错误
+func (c *loadCall[T]) wait(ctx context.Context) (*T, error) {
+	select {
+	case <-c.done:
+		return c.item, c.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// loaderKey 规范化主键，使 int 和 int64 等等价的主键合并，ObjectID 与其十六进制字符串合并
+func loaderKey(id any) string {
+	v := normalizeValue(id)
+	if oid, ok := v.(bson.ObjectID); ok {
+		return oid.Hex()
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,183 @@
+package repox
+
+import (
+	"context"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/event"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.mongodb.org/mongo-driver/v2/x/mongo/driver/drivertest"
+	"go.mongodb.org/mongo-driver/v2/x/mongo/driver/xoptions"
+)
+
+func TestLoader_Memory(t *testing.T) {
+	ctx := context.Background()
+	var finds [][]any
+	var mu sync.Mutex
+	repo := Wrap[memUser, []*memUser](newMemUsers(t), InterceptorFunc(func(ctx context.Context, op *Operation, next Invoker) error {
+		mu.Lock()
+		finds = append(finds, []any{op.Name, op.Filter})
+		mu.Unlock()
+		return next(ctx, op)
+	}))
+	loader := NewLoader[memUser](ctx, repo, Load().SetWait(20*time.Millisecond))
+
+	// 并发的 Load 合并为一次查询，相同主键只查询一次
+	ids := []any{3, int64(1), 3, 9, 2}
+	items := make([]*memUser, len(ids))
+	errs := make([]error, len(ids))
+	var wg sync.WaitGroup
+	for i, id := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			items[i], errs[i] = loader.Load(ctx, id)
+		}()
+	}
+	wg.Wait()
+	require.Len(t, finds, 1)
+	assert.Equal(t, OpFind, finds[0][0])
+	for i, name := range []string{"carol", "alice", "carol", "", "bob"} {
+		if name == "" {
+			assert.ErrorIs(t, errs[i], DataNotFound)
+			assert.Nil(t, items[i])
+			continue
+		}
+		require.NoError(t, errs[i])
+		assert.Equal(t, name, items[i].Name)
+	}
+
+	// 已加载的结果直接返回，LoadMany 按主键顺序返回
+	got, errs := loader.LoadMany(ctx, []any{2, 4, 9})
+	assert.Len(t, finds, 2)
+	assert.Equal(t, "bob", got[0].Name)
+	assert.Equal(t, "dave", got[1].Name)
+	assert.Nil(t, got[2])
+	assert.Equal(t, []error{nil, nil, DataNotFound}, errs)
+
+	loader.Clear(2)
+	_, err := loader.Load(ctx, 2)
+	require.NoError(t, err)
+	assert.Len(t, finds, 3)
+}
+
+func TestLoader_MaxBatch(t *testing.T) {
+	ctx := context.Background()
+	loader := NewLoader[memUser](ctx, newMemUsers(t), Load().SetWait(time.Hour).SetMaxBatch(2))
+
+	// 达到 MaxBatch 时不等待立即查询
+	got, errs := loader.LoadMany(ctx, []any{1, 4})
+	assert.Equal(t, []error{nil, nil}, errs)
+	assert.Equal(t, "dave", got[1].Name)
+
+	// 未满的批次等待结束前 ctx 取消
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err := loader.Load(cctx, 2)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestLoader_Gorm(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewGormRepo[claimJob](db)
+	ctx := context.Background()
+	loader := NewLoader[claimJob](ctx, repo)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `claim_jobs` WHERE `id` IN (?,?) LIMIT ?")).
+		WithArgs(7, 5, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow(5, "done").AddRow(7, "pending"))
+	got, errs := loader.LoadMany(ctx, []any{7, 5, 7})
+	assert.Equal(t, []error{nil, nil, nil}, errs)
+	assert.Equal(t, "pending", got[0].Status)
+	assert.Equal(t, "done", got[1].Status)
+	assert.Same(t, got[0], got[2])
+
+	// 查询失败的主键不缓存
+	mock.ExpectQuery("SELECT").WillReturnError(assert.AnError)
+	_, err := loader.Load(ctx, 8)
+	assert.ErrorIs(t, err, assert.AnError)
+	mock.ExpectQuery("SELECT").WithArgs(8, 1).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(8))
+	item, err := loader.Load(ctx, 8)
+	require.NoError(t, err)
+	assert.Equal(t, int64(8), item.Id)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+type oidDoc struct {
+	Id   bson.ObjectID `bson:"_id"`
+	Name string        `bson:"name"`
+}
+
+// newMockColl 创建基于预设响应的集合，返回的函数获取已发送的命令
+func newMockColl(t *testing.T, responses ...bson.D) (*mongo.Collection, func() []bson.Raw) {
+	t.Helper()
+	var mu sync.Mutex
+	var commands []bson.Raw
+	opts := options.Client().SetMonitor(&event.CommandMonitor{Started: func(_ context.Context, e *event.CommandStartedEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		commands = append(commands, e.Command)
+	}})
+	require.NoError(t, xoptions.SetInternalClientOptions(opts, "deployment", drivertest.NewMockDeployment(responses...)))
+	client, err := mongo.Connect(opts)
+	require.NoError(t, err)
+	return client.Database("db").Collection("docs"), func() []bson.Raw {
+		mu.Lock()
+		defer mu.Unlock()
+		return commands
+	}
+}
+
+// cursorReply 返回 find/aggregate 的单批次响应
+func cursorReply(docs ...any) bson.D {
+	return bson.D{{Key: "ok", Value: 1}, {Key: "cursor", Value: bson.D{
+		{Key: "id", Value: int64(0)}, {Key: "ns", Value: "db.docs"}, {Key: "firstBatch", Value: bson.A(docs)},
+	}}}
+}
+
+func TestLoader_Mongo(t *testing.T) {
+	a, b := bson.NewObjectID(), bson.NewObjectID()
+	coll, commands := newMockColl(t, cursorReply(
+		bson.D{{Key: "_id", Value: a}, {Key: "name", Value: "a"}},
+		bson.D{{Key: "_id", Value: b}, {Key: "name", Value: "b"}},
+	))
+	ctx := context.Background()
+	loader := NewLoader[oidDoc](ctx, NewMongoRepo[oidDoc](coll))
+
+	// 十六进制字符串转换为 ObjectID 查询，并与相同的 ObjectID 合并
+	got, errs := loader.LoadMany(ctx, []any{a.Hex(), b, a})
+	assert.Equal(t, []error{nil, nil, nil}, errs)
+	assert.Equal(t, "a", got[0].Name)
+	assert.Equal(t, "b", got[1].Name)
+	assert.Same(t, got[0], got[2])
+
+	require.Len(t, commands(), 1)
+	ids := commands()[0].Lookup("filter", "_id", "$in").Array()
+	values, err := ids.Values()
+	require.NoError(t, err)
+	require.Len(t, values, 2)
+	assert.Equal(t, a, values[0].ObjectID())
+	assert.Equal(t, b, values[1].ObjectID())
+}
+
+func TestLoader_MongoStringId(t *testing.T) {
+	hex := bson.NewObjectID().Hex()
+	coll, commands := newMockColl(t, cursorReply(bson.D{{Key: "_id", Value: hex}, {Key: "name", Value: "a"}}))
+	ctx := context.Background()
+	loader := NewLoader[idDoc](ctx, NewMongoRepo[idDoc](coll))
+
+	// 字符串主键中的 hex 值按字符串查询
+	got, err := loader.Load(ctx, hex)
+	require.NoError(t, err)
+	assert.Equal(t, "a", got.Name)
+	require.Len(t, commands(), 1)
+	assert.Equal(t, hex, commands()[0].Lookup("filter", "_id", "$in", "0").StringValue())
+}
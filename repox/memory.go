@@ -0,0 +1,1189 @@
+package repox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"reflect"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mbeoliero/kit/builder"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+var ErrDuplicateKey = errors.New("duplicate key")
+
+// MemoryRepo 内存仓库实现，过滤条件在进程内求值，用于单元测试
+// 过滤条件支持 builder 构建的 bson.M 和 clause.Expression，字段名可以是 bson 名、gorm column、snake_case 或 Go 字段名
+// 并发安全；写入和返回的实体均为浅拷贝
+type MemoryRepo[T any] struct {
+	mu         sync.RWMutex
+	items      []*T
+	seq        int64
+	schema     *entitySchema
+	matcher    memoryMatcher
+	softDelete softDelete
+	tenancy    tenancy
+	ids        idGeneration
+	findGuard  findGuard
+	indexes    []Index
+}
+
+// 确保 MemoryRepo 实现了 Repo 接口
+var _ Repo[any, []*any] = (*MemoryRepo[any])(nil)
+
+// NewMemoryRepo 创建内存仓库
+func NewMemoryRepo[T any](opts ...IList[RepoOptions]) *MemoryRepo[T] {
+	o := NewOptions(opts...)
+	schema := schemaFor[T]()
+	return &MemoryRepo[T]{
+		schema:     schema,
+		matcher:    memoryMatcher{schema: schema},
+		softDelete: newSoftDelete(schema, o),
+		tenancy:    newTenancy(schema, o),
+		ids:        newIdGeneration(schema, o),
+		findGuard:  newFindGuard(o),
+	}
+}
+
+// Native 返回当前数据的快照
+func (r *MemoryRepo[T]) Native() []*T {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	ret := make([]*T, len(r.items))
+	for i, item := range r.items {
+		ret[i] = clonePtr(item)
+	}
+	return ret
+}
+
+// Create 创建单条记录，主键为零值时使用配置的生成器或自动生成（整数自增、ObjectID）并回写到实体
+func (r *MemoryRepo[T]) Create(ctx context.Context, entity *T) error {
+	return r.CreateMany(ctx, []*T{entity})
+}
+
+// CreateMany 批量创建记录，任一记录主键冲突时不写入任何记录
+func (r *MemoryRepo[T]) CreateMany(ctx context.Context, entities []*T) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(entities) == 0 {
+		return nil
+	}
+	now := time.Now()
+	for _, entity := range entities {
+		if err := r.ids.stamp(ctx, entity); err != nil {
+			return err
+		}
+		if err := r.tenancy.stamp(ctx, entity); err != nil {
+			return err
+		}
+		if err := r.auditor().stampCreate(ctx, entity, now); err != nil {
+			return err
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	seq := r.seq
+	seen := make([]any, 0, len(entities))
+	for _, entity := range entities {
+		id, err := r.prepareId(entity, &seq)
+		if err != nil {
+			return err
+		}
+		if id == nil {
+			continue
+		}
+		if containsValue(seen, id) || r.indexOfId(id) >= 0 {
+			return ErrDuplicateKey
+		}
+		seen = append(seen, id)
+	}
+
+	r.seq = seq
+	for _, entity := range entities {
+		r.items = append(r.items, clonePtr(entity))
+	}
+	return nil
+}
+
+// FindOne 查询单条记录
+func (r *MemoryRepo[T]) FindOne(ctx context.Context, filter any, opts ...IList[FindOptions]) (*T, error) {
+	o := NewOptions(opts...)
+	o.Limit = 1
+
+	results, err := r.find(ctx, filter, o)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, DataNotFound
+	}
+	return results[0], nil
+}
+
+// Find 查询多条记录，未设置 Limit 时受仓库的 SetUnboundedFindLimit 限制
+func (r *MemoryRepo[T]) Find(ctx context.Context, filter any, opts ...IList[FindOptions]) ([]*T, error) {
+	o := NewOptions(opts...)
+	guarded := r.findGuard.apply(o)
+	results, err := r.find(ctx, filter, o)
+	if err != nil {
+		return nil, err
+	}
+	return checkUnbounded(ctx, r.findGuard, guarded, results)
+}
+
+// Count 统计记录数，设置 Skip/Limit 时只统计该范围内的记录
+func (r *MemoryRepo[T]) Count(ctx context.Context, filter any, opts ...IList[FindOptions]) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	o := NewOptions(opts...)
+	f, err := r.scoped(ctx, filter, o.Deleted)
+	if err != nil {
+		return 0, err
+	}
+	matched, err := r.query(f, &FindOptions{Skip: o.Skip, Limit: o.Limit})
+	return int64(len(matched)), err
+}
+
+// FindWithTotal 查询一页数据并同时统计总数
+func (r *MemoryRepo[T]) FindWithTotal(ctx context.Context, filter any, opts ...IList[FindOptions]) (*Page[T], error) {
+	return findWithTotal[T](ctx, r, true, filter, opts...)
+}
+
+// Iterate 逐条遍历查询结果，遍历的是调用时的快照
+func (r *MemoryRepo[T]) Iterate(ctx context.Context, filter any, opts ...IList[FindOptions]) iter.Seq2[*T, error] {
+	return func(yield func(*T, error) bool) {
+		results, err := r.find(ctx, filter, NewOptions(opts...))
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		for _, item := range results {
+			if !yield(item, nil) {
+				return
+			}
+		}
+	}
+}
+
+// FindInBatches 分批查询，遍历的是调用时的快照
+func (r *MemoryRepo[T]) FindInBatches(ctx context.Context, filter any, batchSize int, fn func(batch []*T) error, opts ...IList[FindOptions]) error {
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+	results, err := r.find(ctx, filter, NewOptions(opts...))
+	if err != nil {
+		return err
+	}
+	for batch := range slices.Chunk(results, batchSize) {
+		if err = fn(batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FindPage 基于游标的分页查询
+func (r *MemoryRepo[T]) FindPage(ctx context.Context, filter any, sort *Sort, cursor string, limit int64) (*CursorPage[T], error) {
+	return pager[T]{find: r.Find, newBuilder: r.newQueryBuilder, idField: r.idField()}.page(ctx, filter, sort, cursor, limit)
+}
+
+// aggregate 在进程内分组计算，语义与 MongoRepo 一致，结果通过 bson 解码到 dest
+func (r *MemoryRepo[T]) aggregate(ctx context.Context, filter any, o *AggregateOptions, dest any) error {
+	plan, err := newAggregatePlan(r.schema, o, r.fieldName)
+	if err != nil {
+		return err
+	}
+	items, err := r.find(ctx, filter, &FindOptions{Deleted: o.Deleted})
+	if err != nil {
+		return err
+	}
+
+	type group struct {
+		row    bson.M
+		states []accState
+	}
+	var groups []*group
+	index := make(map[string]*group)
+	for _, item := range items {
+		rv := reflect.ValueOf(item)
+		row := bson.M{}
+		keys := make([]any, len(plan.groups))
+		for i, g := range plan.groups {
+			f, _ := r.schema.Field(g)
+			row[g], _ = f.Value(rv)
+			keys[i] = row[g]
+		}
+		key := fmt.Sprint(normalizeValues(keys))
+		grp, ok := index[key]
+		if !ok {
+			grp = &group{row: row, states: make([]accState, len(plan.accs))}
+			index[key] = grp
+			groups = append(groups, grp)
+		}
+		for i, acc := range plan.accs {
+			var v any
+			if acc.Op != AccCount {
+				f, _ := r.schema.Field(acc.Field)
+				v, _ = f.Value(rv)
+			}
+			grp.states[i].add(v)
+		}
+	}
+
+	rows := make([]bson.M, len(groups))
+	for i, grp := range groups {
+		for j, acc := range plan.accs {
+			grp.row[acc.As] = grp.states[j].result(acc.Op)
+		}
+		rows[i] = grp.row
+	}
+	if o.Sort != nil {
+		sort.SliceStable(rows, func(i, j int) bool {
+			for _, sf := range o.Sort.fields {
+				c, _ := compareValues(rows[i][sf.Field], rows[j][sf.Field])
+				if c == 0 {
+					continue
+				}
+				if sf.Order == Desc {
+					return c > 0
+				}
+				return c < 0
+			}
+			return false
+		})
+	}
+	if o.Limit > 0 && int64(len(rows)) > o.Limit {
+		rows = rows[:o.Limit]
+	}
+	return decodeValues(rows, dest)
+}
+
+// distinct 返回匹配记录中字段的不同取值，结果通过 bson 解码到 dest
+func (r *MemoryRepo[T]) distinct(ctx context.Context, field string, filter any, dest any) error {
+	f, ok := r.schema.Field(field)
+	if !ok {
+		return fmt.Errorf("repox: unknown field %s of %s", field, r.schema.Type)
+	}
+	items, err := r.find(ctx, filter, &FindOptions{})
+	if err != nil {
+		return err
+	}
+	values := make([]any, 0)
+	for _, item := range items {
+		v, _ := f.Value(reflect.ValueOf(item))
+		if !slices.ContainsFunc(values, func(e any) bool { return equalValues(e, v) }) {
+			values = append(values, v)
+		}
+	}
+	return decodeValues(values, dest)
+}
+
+// tenantScope 返回租户隔离配置
+func (r *MemoryRepo[T]) tenantScope() tenancy {
+	return r.tenancy
+}
+
+// newQueryBuilder 创建与仓库匹配的查询构建器，内存仓库使用 MongoDB 语法求值
+func (r *MemoryRepo[T]) newQueryBuilder() builder.QBuilder {
+	return builder.NewMongoQueryBuilder()
+}
+
+// idField 返回主键字段名
+func (r *MemoryRepo[T]) idField() string {
+	if r.schema.Primary != nil {
+		return r.schema.Primary.Column
+	}
+	return "_id"
+}
+
+// fieldName 返回字段的通用字段名
+func (r *MemoryRepo[T]) fieldName(f *fieldInfo) string {
+	return f.Column
+}
+
+// resolveIndex 转换为通用字段名，默认索引名与 MongoDB 一致
+func (r *MemoryRepo[T]) resolveIndex(idx Index) (Index, error) {
+	return resolveIndexKeys(r.schema, idx, r.fieldName, mongoIndexName)
+}
+
+// listIndexes 返回通过 EnsureIndexes 创建的索引
+func (r *MemoryRepo[T]) listIndexes(context.Context) ([]Index, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return slices.Clone(r.indexes), nil
+}
+
+// createIndex 只记录索引定义，内存仓库不使用索引，也不校验唯一约束
+func (r *MemoryRepo[T]) createIndex(_ context.Context, idx Index) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.indexes = append(r.indexes, idx)
+	return nil
+}
+
+// Update 更新整个实体（通过主键）
+// 实体声明了版本号字段时使用乐观锁：版本号不一致或记录不存在时返回 ErrVersionConflict
+func (r *MemoryRepo[T]) Update(ctx context.Context, entity *T) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	id, ok := r.primaryValue(entity)
+	if !ok {
+		return errors.New("invalid entity")
+	}
+	if err := r.tenancy.stamp(ctx, entity); err != nil {
+		return err
+	}
+	if err := r.auditor().stampUpdate(ctx, entity, time.Now()); err != nil {
+		return err
+	}
+	scope, err := r.scoped(ctx, nil, DeletedIncluded)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	version := r.schema.Role(roleVersion)
+	i := r.indexOfId(id)
+	if i >= 0 {
+		// 其它租户的记录视为不存在
+		if ok, err = r.matcher.match(reflect.ValueOf(r.items[i]), scope); err != nil {
+			return err
+		} else if !ok {
+			i = -1
+		}
+	}
+	if version == nil {
+		if i >= 0 {
+			r.items[i] = clonePtr(entity)
+		}
+		return nil
+	}
+
+	cur, rollback, err := bumpVersion(version, entity)
+	if err != nil {
+		return err
+	}
+	if i >= 0 {
+		stored, _ := version.Value(reflect.ValueOf(r.items[i]))
+		if equalValues(stored, cur) {
+			r.items[i] = clonePtr(entity)
+			return nil
+		}
+	}
+	rollback()
+	return ErrVersionConflict
+}
+
+// Incr 对第一条匹配记录的字段做自增
+func (r *MemoryRepo[T]) Incr(ctx context.Context, filter any, incr map[string]int, opts ...IList[UpdateOptions]) error {
+	f, err := r.scoped(ctx, filter, DeletedExcluded)
+	if err != nil {
+		return err
+	}
+	_, err = r.update(ctx, f, 1, func(v reflect.Value) error {
+		for k, delta := range incr {
+			field, err := r.field(v, k)
+			if err != nil {
+				return err
+			}
+			if err = addValue(field, delta); err != nil {
+				return err
+			}
+		}
+		return r.incrVersion(v)
+	})
+	return err
+}
+
+// UpdateOne 更新第一条匹配记录
+func (r *MemoryRepo[T]) UpdateOne(ctx context.Context, filter any, update map[string]any, opts ...IList[UpdateOptions]) (*UpdateResult, error) {
+	if err := r.tenancy.checkUpdate(ctx, update); err != nil {
+		return nil, err
+	}
+	f, err := r.scoped(ctx, filter, DeletedExcluded)
+	if err != nil {
+		return nil, err
+	}
+	return r.update(ctx, f, 1, func(v reflect.Value) error {
+		if err := r.setFields(v, r.withAudit(ctx, update)); err != nil {
+			return err
+		}
+		return r.incrVersion(v)
+	})
+}
+
+// UpdateMany 更新所有匹配记录
+func (r *MemoryRepo[T]) UpdateMany(ctx context.Context, filter any, update map[string]any, opts ...IList[UpdateOptions]) (*UpdateResult, error) {
+	if err := r.tenancy.checkUpdate(ctx, update); err != nil {
+		return nil, err
+	}
+	f, err := r.scoped(ctx, filter, DeletedExcluded)
+	if err != nil {
+		return nil, err
+	}
+	return r.update(ctx, f, 0, func(v reflect.Value) error {
+		if err := r.setFields(v, r.withAudit(ctx, update)); err != nil {
+			return err
+		}
+		return r.incrVersion(v)
+	})
+}
+
+// FindOneAndUpdate 更新排序后的第一条匹配记录并返回
+// Upsert 插入时使用过滤条件中的等值条件和更新内容构建新记录
+func (r *MemoryRepo[T]) FindOneAndUpdate(ctx context.Context, filter any, update map[string]any, opts ...IList[UpdateOptions]) (*T, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	o := NewOptions(opts...)
+	if err := r.tenancy.checkUpdate(ctx, update); err != nil {
+		return nil, err
+	}
+	f, err := r.scoped(ctx, filter, DeletedExcluded)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	matched, err := r.query(f, &FindOptions{Sort: o.Sort, Limit: 1})
+	if err != nil {
+		return nil, err
+	}
+	if len(matched) == 0 {
+		if !o.Upsert {
+			return nil, DataNotFound
+		}
+		inserted, err := r.insertUpserted(ctx, filter, update)
+		if err != nil || !o.ReturnAfter {
+			return nil, err
+		}
+		return inserted, nil
+	}
+
+	before, target := clonePtr(matched[0]), clonePtr(matched[0])
+	v := reflect.ValueOf(target).Elem()
+	if err = r.setFields(v, r.withAudit(ctx, update)); err != nil {
+		return nil, err
+	}
+	if err = r.incrVersion(v); err != nil {
+		return nil, err
+	}
+	*matched[0] = *target
+	if o.ReturnAfter {
+		return clonePtr(target), nil
+	}
+	return before, nil
+}
+
+// UpsertOne 插入或更新单条记录，语义与 MongoRepo 一致：
+// 命中时应用 Set 和 Inc（未指定 Set 时用 create 整体覆盖）；未命中时插入 create 并应用冲突字段、Set 和 Inc
+// 审计字段 created_at/created_by 只在插入时填充
+func (r *MemoryRepo[T]) UpsertOne(ctx context.Context, create T, opt UpsertOptions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := r.tenancy.checkUpdate(ctx, opt.Set); err != nil {
+		return err
+	}
+	if err := r.tenancy.stamp(ctx, &create); err != nil {
+		return err
+	}
+	conflictKvs, err := r.tenancy.withTenant(ctx, opt.ConflictKvs, bsonField)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	filter := bson.M{}
+	for k, v := range conflictKvs {
+		filter[k] = v
+	}
+	matched, err := r.filter(filter)
+	if err != nil {
+		return err
+	}
+
+	apply := func(target *T) error {
+		v := reflect.ValueOf(target).Elem()
+		if err := r.setFields(v, r.withAudit(ctx, opt.Set)); err != nil {
+			return err
+		}
+		for k, delta := range opt.Inc {
+			field, err := r.field(v, k)
+			if err != nil {
+				return err
+			}
+			if err = addValue(field, delta); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if len(matched) > 0 {
+		target := clonePtr(matched[0])
+		if len(opt.Set) == 0 {
+			// 整体覆盖时保留主键和创建审计字段
+			kept := make(map[string]any)
+			audit := r.auditor()
+			for _, f := range []*fieldInfo{r.schema.Primary, audit.createdAt, audit.createdBy} {
+				if f != nil {
+					kept[f.Name], _ = f.Value(reflect.ValueOf(target))
+				}
+			}
+			target = clonePtr(&create)
+			if err = r.setFields(reflect.ValueOf(target).Elem(), kept); err != nil {
+				return err
+			}
+		}
+		if err = apply(target); err != nil {
+			return err
+		}
+		*matched[0] = *target
+		return nil
+	}
+
+	target := clonePtr(&create)
+	if err = r.setFields(reflect.ValueOf(target).Elem(), conflictKvs); err != nil {
+		return err
+	}
+	if err = apply(target); err != nil {
+		return err
+	}
+	if err = r.auditor().stampCreate(ctx, target, time.Now()); err != nil {
+		return err
+	}
+	if err = r.ids.stamp(ctx, target); err != nil {
+		return err
+	}
+	seq := r.seq
+	id, err := r.prepareId(target, &seq)
+	if err != nil {
+		return err
+	}
+	if id != nil && r.indexOfId(id) >= 0 {
+		return ErrDuplicateKey
+	}
+	r.seq = seq
+	r.items = append(r.items, target)
+	return nil
+}
+
+// UpsertMany 逐条按冲突字段插入或更新记录，语义与 MongoRepo 一致；出错时之前的记录已经写入
+func (r *MemoryRepo[T]) UpsertMany(ctx context.Context, entities []*T, opt UpsertManyOptions) (*UpsertResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	plan, err := newUpsertPlan(r.schema, opt, r.tenancy)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkDistinct(plan, entities); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for _, entity := range entities {
+		if err = r.tenancy.stamp(ctx, entity); err != nil {
+			return nil, err
+		}
+		if err = r.auditor().stampCreate(ctx, entity, now); err != nil {
+			return nil, err
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := &UpsertResult{}
+	for _, entity := range entities {
+		kvs := make(map[string]any, len(plan.conflict))
+		for i, v := range plan.conflictValues(entity) {
+			kvs[plan.conflict[i].BsonName] = v
+		}
+		filter, err := r.tenancy.withTenant(ctx, kvs, bsonField)
+		if err != nil {
+			return result, err
+		}
+		matched, err := r.filter(bson.M(filter))
+		if err != nil {
+			return result, err
+		}
+
+		if len(matched) == 0 {
+			if err = r.ids.stamp(ctx, entity); err != nil {
+				return result, err
+			}
+			id, err := r.prepareId(entity, &r.seq)
+			if err != nil {
+				return result, err
+			}
+			if id != nil && r.indexOfId(id) >= 0 {
+				return result, ErrDuplicateKey
+			}
+			row, err := insertRow(plan, entity)
+			if err != nil {
+				return result, err
+			}
+			r.items = append(r.items, row)
+			result.InsertCount++
+			continue
+		}
+
+		target := clonePtr(matched[0])
+		v := reflect.ValueOf(target).Elem()
+		values := make(map[string]any, len(plan.update))
+		for _, f := range plan.update {
+			values[f.Name], _ = f.Value(reflect.ValueOf(entity))
+		}
+		if err = r.setFields(v, values); err != nil {
+			return result, err
+		}
+		for f, delta := range plan.inc {
+			field, err := r.field(v, f.Name)
+			if err != nil {
+				return result, err
+			}
+			if err = addValue(field, delta); err != nil {
+				return result, err
+			}
+		}
+		*matched[0] = *target
+		result.UpdateCount++
+	}
+	return result, nil
+}
+
+// FindOneAndDelete 删除排序后的第一条匹配记录并返回，启用软删除时设置删除字段
+func (r *MemoryRepo[T]) FindOneAndDelete(ctx context.Context, filter any, opts ...IList[FindOptions]) (*T, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	o := NewOptions(opts...)
+	f, err := r.scoped(ctx, filter, DeletedExcluded)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	matched, err := r.query(f, &FindOptions{Sort: o.Sort, Limit: 1})
+	if err != nil {
+		return nil, err
+	}
+	if len(matched) == 0 {
+		return nil, DataNotFound
+	}
+	item := matched[0]
+	result := clonePtr(item)
+	if r.softDelete.enabled() {
+		target := clonePtr(item)
+		if err = r.setFields(reflect.ValueOf(target).Elem(), map[string]any{r.softDelete.field.BsonName: time.Now()}); err != nil {
+			return nil, err
+		}
+		*item = *target
+		return result, nil
+	}
+	r.items = slices.DeleteFunc(r.items, func(v *T) bool { return v == item })
+	return result, nil
+}
+
+// DeleteOne 删除第一条匹配记录，启用软删除时设置删除字段
+func (r *MemoryRepo[T]) DeleteOne(ctx context.Context, filter any) (*DeleteResult, error) {
+	if r.softDelete.enabled() {
+		return r.markDeleted(ctx, filter, 1)
+	}
+	return r.delete(ctx, filter, 1)
+}
+
+// DeleteMany 删除所有匹配记录，启用软删除时设置删除字段
+func (r *MemoryRepo[T]) DeleteMany(ctx context.Context, filter any) (*DeleteResult, error) {
+	if r.softDelete.enabled() {
+		return r.markDeleted(ctx, filter, 0)
+	}
+	return r.delete(ctx, filter, 0)
+}
+
+// BulkWrite 按顺序逐个执行写入操作，连续的插入合并为一次 CreateMany；操作之间不保证原子性
+func (r *MemoryRepo[T]) BulkWrite(ctx context.Context, ops []WriteOp[T], opts ...IList[BulkOptions]) (*BulkResult, error) {
+	result := runBulk[T](ctx, r, ops, newBulkOptions(opts), 0, func(ctx context.Context, fn func(ctx context.Context) error) error {
+		return fn(ctx)
+	})
+	return result, result.Err()
+}
+
+// updateOne 更新第一条匹配记录
+func (r *MemoryRepo[T]) updateOne(ctx context.Context, filter any, update map[string]any) (WriteResult, error) {
+	res, err := r.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return WriteResult{}, err
+	}
+	return WriteResult{MatchedCount: res.UpdateCount, ModifiedCount: res.UpdateCount}, nil
+}
+
+// replaceOne 用 entity 覆盖第一条匹配记录，保留主键和创建审计字段
+func (r *MemoryRepo[T]) replaceOne(ctx context.Context, filter any, entity *T) (WriteResult, error) {
+	if err := r.tenancy.stamp(ctx, entity); err != nil {
+		return WriteResult{}, err
+	}
+	if err := r.auditor().stampUpdate(ctx, entity, time.Now()); err != nil {
+		return WriteResult{}, err
+	}
+	f, err := r.scoped(ctx, filter, DeletedExcluded)
+	if err != nil {
+		return WriteResult{}, err
+	}
+	res, err := r.update(ctx, f, 1, func(v reflect.Value) error {
+		kept := make(map[string]any)
+		audit := r.auditor()
+		for _, field := range []*fieldInfo{r.schema.Primary, audit.createdAt, audit.createdBy} {
+			if field != nil {
+				kept[field.Name], _ = field.Value(v)
+			}
+		}
+		v.Set(reflect.ValueOf(entity).Elem())
+		return r.setFields(v, kept)
+	})
+	if err != nil {
+		return WriteResult{}, err
+	}
+	return WriteResult{MatchedCount: res.UpdateCount, ModifiedCount: res.UpdateCount}, nil
+}
+
+// Restore 恢复匹配的已软删除记录
+func (r *MemoryRepo[T]) Restore(ctx context.Context, filter any) (*UpdateResult, error) {
+	if !r.softDelete.enabled() {
+		return nil, ErrSoftDeleteDisabled
+	}
+	f, err := r.scoped(ctx, filter, DeletedOnly)
+	if err != nil {
+		return nil, err
+	}
+	return r.update(ctx, f, 0, func(v reflect.Value) error {
+		return r.setFields(v, map[string]any{r.softDelete.field.BsonName: nil})
+	})
+}
+
+// markDeleted 将匹配记录的删除字段设置为当前时间
+func (r *MemoryRepo[T]) markDeleted(ctx context.Context, filter any, limit int) (*DeleteResult, error) {
+	f, err := r.scoped(ctx, filter, DeletedExcluded)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	res, err := r.update(ctx, f, limit, func(v reflect.Value) error {
+		return r.setFields(v, map[string]any{r.softDelete.field.BsonName: now})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &DeleteResult{DeleteCount: res.UpdateCount}, nil
+}
+
+// find 查询并返回拷贝后的结果
+func (r *MemoryRepo[T]) find(ctx context.Context, filter any, o *FindOptions) ([]*T, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	f, err := r.scoped(ctx, filter, o.Deleted)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	matched, err := r.query(f, o)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]*T, len(matched))
+	for i, item := range matched {
+		if results[i], err = r.project(item, o.ReturnFields); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// insertUpserted 按过滤条件中的等值条件和更新内容插入新记录，调用方需持有锁
+func (r *MemoryRepo[T]) insertUpserted(ctx context.Context, filter any, update map[string]any) (*T, error) {
+	target := new(T)
+	v := reflect.ValueOf(target).Elem()
+	if kvs, ok := equalityConditions(filter); ok {
+		if err := r.setFields(v, kvs); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.setFields(v, update); err != nil {
+		return nil, err
+	}
+	if err := r.tenancy.stamp(ctx, target); err != nil {
+		return nil, err
+	}
+	if err := r.auditor().stampCreate(ctx, target, time.Now()); err != nil {
+		return nil, err
+	}
+	if err := r.ids.stamp(ctx, target); err != nil {
+		return nil, err
+	}
+
+	seq := r.seq
+	id, err := r.prepareId(target, &seq)
+	if err != nil {
+		return nil, err
+	}
+	if id != nil && r.indexOfId(id) >= 0 {
+		return nil, ErrDuplicateKey
+	}
+	r.seq = seq
+	r.items = append(r.items, target)
+	return clonePtr(target), nil
+}
+
+// scoped 合并删除状态条件和租户条件
+func (r *MemoryRepo[T]) scoped(ctx context.Context, filter any, scope DeletedScope) (any, error) {
+	return r.tenancy.bsonFilter(ctx, r.softDelete.bsonFilter(filter, scope))
+}
+
+// query 按过滤条件、排序、分页返回存储中的记录，调用方需持有锁
+func (r *MemoryRepo[T]) query(filter any, o *FindOptions) ([]*T, error) {
+	matched, err := r.filter(filter)
+	if err != nil {
+		return nil, err
+	}
+	if err = r.sort(matched, o.Sort); err != nil {
+		return nil, err
+	}
+	if o.Skip > 0 {
+		if o.Skip >= int64(len(matched)) {
+			return nil, nil
+		}
+		matched = matched[o.Skip:]
+	}
+	if o.Limit > 0 && o.Limit < int64(len(matched)) {
+		matched = matched[:o.Limit]
+	}
+	return matched, nil
+}
+
+// filter 返回所有满足过滤条件的记录，调用方需持有锁
+func (r *MemoryRepo[T]) filter(filter any) ([]*T, error) {
+	var matched []*T
+	for _, item := range r.items {
+		ok, err := r.matcher.match(reflect.ValueOf(item), filter)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matched = append(matched, item)
+		}
+	}
+	return matched, nil
+}
+
+// sort 按排序条件对记录做稳定排序
+func (r *MemoryRepo[T]) sort(items []*T, s *Sort) error {
+	if s == nil || len(s.fields) == 0 {
+		return nil
+	}
+	fields := make([]*fieldInfo, len(s.fields))
+	for i, sf := range s.fields {
+		f, ok := r.schema.Field(sf.Field)
+		if !ok {
+			return fmt.Errorf("repox: unknown sort field %s of %s", sf.Field, r.schema.Type)
+		}
+		fields[i] = f
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		vi, vj := reflect.ValueOf(items[i]), reflect.ValueOf(items[j])
+		for k, f := range fields {
+			a, _ := f.Value(vi)
+			b, _ := f.Value(vj)
+			c, _ := compareValues(a, b)
+			if c == 0 {
+				continue
+			}
+			if s.fields[k].Order == Desc {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+	return nil
+}
+
+// update 对匹配记录应用修改，limit 为 0 时不限制条数
+func (r *MemoryRepo[T]) update(ctx context.Context, filter any, limit int, fn func(v reflect.Value) error) (*UpdateResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	matched, err := r.filter(filter)
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 && len(matched) > limit {
+		matched = matched[:limit]
+	}
+
+	// 先在拷贝上修改，全部成功后再写回，避免部分更新
+	updated := make([]*T, len(matched))
+	for i, item := range matched {
+		updated[i] = clonePtr(item)
+		if err = fn(reflect.ValueOf(updated[i]).Elem()); err != nil {
+			return nil, err
+		}
+	}
+
+	var count int64
+	for i, item := range matched {
+		if !reflect.DeepEqual(*item, *updated[i]) {
+			count++
+		}
+		*item = *updated[i]
+	}
+	return &UpdateResult{UpdateCount: count}, nil
+}
+
+// delete 删除匹配记录，limit 为 0 时不限制条数
+func (r *MemoryRepo[T]) delete(ctx context.Context, filter any, limit int) (*DeleteResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	filter, err := r.scoped(ctx, filter, DeletedIncluded)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := make([]*T, 0, len(r.items))
+	var count int64
+	for _, item := range r.items {
+		if limit <= 0 || count < int64(limit) {
+			ok, err := r.matcher.match(reflect.ValueOf(item), filter)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				count++
+				continue
+			}
+		}
+		kept = append(kept, item)
+	}
+	r.items = kept
+	return &DeleteResult{DeleteCount: count}, nil
+}
+
+// project 返回记录的拷贝，指定返回字段时仅保留这些字段和主键
+func (r *MemoryRepo[T]) project(item *T, fields []string) (*T, error) {
+	if len(fields) == 0 {
+		return clonePtr(item), nil
+	}
+
+	src := reflect.ValueOf(item)
+	dst := new(T)
+	dv := reflect.ValueOf(dst)
+	if r.schema.Primary != nil {
+		fields = append([]string{r.schema.Primary.Column}, fields...)
+	}
+	for _, name := range fields {
+		f, ok := r.schema.Field(name)
+		if !ok {
+			return nil, fmt.Errorf("repox: unknown field %s of %s", name, r.schema.Type)
+		}
+		sv, ok := f.reflectValue(src, false)
+		if !ok {
+			continue
+		}
+		if fv, ok := f.reflectValue(dv, true); ok {
+			fv.Set(sv)
+		}
+	}
+	return dst, nil
+}
+
+// setFields 按字段名批量赋值
+func (r *MemoryRepo[T]) setFields(v reflect.Value, values map[string]any) error {
+	return r.schema.SetFields(v, values)
+}
+
+// auditor 返回实体的审计字段
+func (r *MemoryRepo[T]) auditor() auditor {
+	return auditorOf(r.schema)
+}
+
+// withAudit 返回附加 updated_at/updated_by 的更新内容
+func (r *MemoryRepo[T]) withAudit(ctx context.Context, update map[string]any) map[string]any {
+	return mergeValues(update, r.auditor().updateValues(ctx, time.Now(), bsonField))
+}
+
+// incrVersion 实体声明了版本号字段时将其加一
+func (r *MemoryRepo[T]) incrVersion(v reflect.Value) error {
+	version := r.schema.Role(roleVersion)
+	if version == nil {
+		return nil
+	}
+	field, err := r.field(v, version.Name)
+	if err != nil {
+		return err
+	}
+	return addValue(field, 1)
+}
+
+// field 获取可写的字段
+func (r *MemoryRepo[T]) field(v reflect.Value, name string) (reflect.Value, error) {
+	f, ok := r.schema.Field(name)
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("repox: unknown field %s of %s", name, r.schema.Type)
+	}
+	fv, ok := f.reflectValue(v, true)
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("repox: field %s of %s is not addressable", name, r.schema.Type)
+	}
+	return fv, nil
+}
+
+// prepareId 为零值主键生成 ID 并回写，返回最终的主键值；实体没有主键时返回 nil
+func (r *MemoryRepo[T]) prepareId(entity *T, seq *int64) (any, error) {
+	pk := r.schema.Primary
+	if pk == nil {
+		return nil, nil
+	}
+	fv, ok := pk.reflectValue(reflect.ValueOf(entity), true)
+	if !ok {
+		return nil, nil
+	}
+
+	if fv.IsZero() {
+		switch {
+		case isNumberKind(fv.Kind()):
+			*seq++
+			if err := assignValue(fv, *seq); err != nil {
+				return nil, err
+			}
+		case fv.Type() == reflect.TypeFor[bson.ObjectID]():
+			fv.Set(reflect.ValueOf(bson.NewObjectID()))
+		default:
+			return fv.Interface(), nil
+		}
+	} else if n, ok := normalizeValue(fv.Interface()).(int64); ok && n > *seq {
+		*seq = n
+	}
+	return fv.Interface(), nil
+}
+
+// primaryValue 获取实体主键值
+func (r *MemoryRepo[T]) primaryValue(entity *T) (any, bool) {
+	return r.schema.PrimaryValue(entity)
+}
+
+// indexOfId 按主键查找记录下标，调用方需持有锁
+func (r *MemoryRepo[T]) indexOfId(id any) int {
+	for i, item := range r.items {
+		if itemId, ok := r.primaryValue(item); ok && equalValues(itemId, id) {
+			return i
+		}
+	}
+	return -1
+}
+
+// clonePtr 浅拷贝实体
+func clonePtr[T any](v *T) *T {
+	c := *v
+	return &c
+}
+
+// accState 内存聚合中一个分组的一项计算状态
+type accState struct {
+	count    int64
+	n        int64 // 参与求和的数值个数
+	sumInt   int64
+	sumFloat float64
+	float    bool
+	min, max any
+}
+
+// add 累加一条记录的字段值，非数值不参与求和，nil 不参与最值
+func (s *accState) add(v any) {
+	s.count++
+	switch x := normalizeValue(v).(type) {
+	case int64:
+		s.sumInt += x
+		s.n++
+	case float64:
+		s.sumFloat += x
+		s.float = true
+		s.n++
+	}
+	if v == nil {
+		return
+	}
+	if c, ok := compareValues(v, s.min); s.min == nil || ok && c < 0 {
+		s.min = v
+	}
+	if c, ok := compareValues(v, s.max); s.max == nil || ok && c > 0 {
+		s.max = v
+	}
+}
+
+// result 返回聚合结果，整数求和结果为 int64，平均值为 float64，没有数值时平均值为 nil
+func (s *accState) result(op AccOp) any {
+	switch op {
+	case AccCount:
+		return s.count
+	case AccSum:
+		if s.float {
+			return s.sumFloat + float64(s.sumInt)
+		}
+		return s.sumInt
+	case AccAvg:
+		if s.n == 0 {
+			return nil
+		}
+		return (s.sumFloat + float64(s.sumInt)) / float64(s.n)
+	case AccMin:
+		return s.min
+	case AccMax:
+		return s.max
+	}
+	return nil
+}
+
+// decodeValues 将值列表经 bson 编码后解码到 dest，使解码规则与 MongoDB 一致
+func decodeValues(values any, dest any) error {
+	data, err := bson.Marshal(bson.M{"v": values})
+	if err != nil {
+		return err
+	}
+	return bson.Raw(data).Lookup("v").Unmarshal(dest)
+}
@@ -0,0 +1,379 @@
+package repox
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/mbeoliero/kit/builder"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"gorm.io/gorm/clause"
+)
+
+// memoryMatcher 在进程内对实体求值过滤条件
+// 支持 builder 构建的 bson.M（MongoDB 语法）和 clause.Expression（GORM 语法）
+type memoryMatcher struct {
+	schema *entitySchema
+}
+
+// match 判断实体 v 是否满足 filter
+func (m memoryMatcher) match(v reflect.Value, filter any) (bool, error) {
+	switch f := filter.(type) {
+	case nil:
+		return true, nil
+	case bson.M:
+		return m.matchDoc(v, map[string]any(f))
+	case map[string]any:
+		return m.matchDoc(v, f)
+	case bson.D:
+		return m.matchDoc(v, dToMap(f))
+	case clause.Expression:
+		return m.matchExpr(v, f)
+	default:
+		return false, fmt.Errorf("repox: unsupported memory filter %T", filter)
+	}
+}
+
+// matchDoc 对 MongoDB 风格的文档条件求值，多个 key 之间为与关系
+func (m memoryMatcher) matchDoc(v reflect.Value, doc map[string]any) (bool, error) {
+	for key, cond := range doc {
+		var (
+			ok  bool
+			err error
+		)
+		switch key {
+		case "$and", "$or", "$nor":
+			ok, err = m.matchLogical(v, key, cond)
+		default:
+			ok, err = m.matchField(v, key, cond)
+		}
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// matchLogical 对 $and/$or/$nor 求值
+func (m memoryMatcher) matchLogical(v reflect.Value, op string, cond any) (bool, error) {
+	items, err := toAnyList(cond)
+	if err != nil {
+		return false, err
+	}
+	for _, item := range items {
+		ok, err := m.match(v, item)
+		if err != nil {
+			return false, err
+		}
+		switch {
+		case op == "$and" && !ok:
+			return false, nil
+		case op == "$or" && ok:
+			return true, nil
+		case op == "$nor" && ok:
+			return false, nil
+		}
+	}
+	return op != "$or" || len(items) == 0, nil
+}
+
+// matchField 对单个字段条件求值，cond 为操作符文档或直接的相等值
+func (m memoryMatcher) matchField(v reflect.Value, key string, cond any) (bool, error) {
+	actual, exists, err := m.fieldValue(v, key)
+	if err != nil {
+		return false, err
+	}
+
+	ops, isOps := operatorDoc(cond)
+	if !isOps {
+		return equalValues(actual, cond), nil
+	}
+
+	for op, expected := range ops {
+		var ok bool
+		switch op {
+		case "$eq":
+			ok = equalValues(actual, expected)
+		case "$ne":
+			ok = !equalValues(actual, expected)
+		case "$gt", "$gte", "$lt", "$lte":
+			c, comparable := compareValues(actual, expected)
+			ok = comparable && normalizeValue(actual) != nil && compareResult(op, c)
+		case "$in", "$nin":
+			list, err := toAnyList(expected)
+			if err != nil {
+				return false, err
+			}
+			ok = containsValue(list, actual) == (op == "$in")
+		case "$exists":
+			want, _ := expected.(bool)
+			ok = exists == want
+		case "$regex":
+			options, _ := ops["$options"].(string)
+			ok, err = matchRegex(actual, expected, options)
+			if err != nil {
+				return false, err
+			}
+		case "$options":
+			ok = true
+		case "$not":
+			ok, err = m.matchField(v, key, expected)
+			if err != nil {
+				return false, err
+			}
+			ok = !ok
+		default:
+			return false, fmt.Errorf("repox: unsupported memory filter operator %s", op)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// matchExpr 对 GORM clause 表达式求值
+func (m memoryMatcher) matchExpr(v reflect.Value, expr clause.Expression) (bool, error) {
+	switch e := expr.(type) {
+	case clause.Eq:
+		return m.matchColumn(v, e.Column, func(actual any) bool { return equalValues(actual, e.Value) })
+	case clause.Neq:
+		return m.matchColumn(v, e.Column, func(actual any) bool { return !equalValues(actual, e.Value) })
+	case clause.Gt:
+		return m.matchCompare(v, e.Column, "$gt", e.Value)
+	case clause.Gte:
+		return m.matchCompare(v, e.Column, "$gte", e.Value)
+	case clause.Lt:
+		return m.matchCompare(v, e.Column, "$lt", e.Value)
+	case clause.Lte:
+		return m.matchCompare(v, e.Column, "$lte", e.Value)
+	case clause.IN:
+		return m.matchColumn(v, e.Column, func(actual any) bool { return containsValue(e.Values, actual) })
+	case builder.AnyIn:
+		return m.matchColumn(v, e.Column, func(actual any) bool { return containsValue(e.Values, actual) })
+	case clause.Like:
+		return m.matchLike(v, e.Column, e.Value, false)
+	case builder.ILike:
+		return m.matchLike(v, e.Column, e.Value, true)
+	case clause.AndConditions:
+		for _, sub := range e.Exprs {
+			if ok, err := m.matchExpr(v, sub); err != nil || !ok {
+				return false, err
+			}
+		}
+		return true, nil
+	case clause.OrConditions:
+		for _, sub := range e.Exprs {
+			ok, err := m.matchExpr(v, sub)
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				return true, nil
+			}
+		}
+		return len(e.Exprs) == 0, nil
+	case clause.NotConditions:
+		for _, sub := range e.Exprs {
+			ok, err := m.matchExpr(v, sub)
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				return false, nil
+			}
+		}
+		return true, nil
+	default:
+		return false, fmt.Errorf("repox: unsupported memory filter expression %T", expr)
+	}
+}
+
+func (m memoryMatcher) matchColumn(v reflect.Value, column any, pred func(actual any) bool) (bool, error) {
+	actual, _, err := m.fieldValue(v, columnName(column))
+	if err != nil {
+		return false, err
+	}
+	return pred(actual), nil
+}
+
+func (m memoryMatcher) matchCompare(v reflect.Value, column any, op string, expected any) (bool, error) {
+	return m.matchColumn(v, column, func(actual any) bool {
+		c, ok := compareValues(actual, expected)
+		return ok && normalizeValue(actual) != nil && compareResult(op, c)
+	})
+}
+
+func (m memoryMatcher) matchLike(v reflect.Value, column any, pattern any, ignoreCase bool) (bool, error) {
+	p, _ := pattern.(string)
+	var sb strings.Builder
+	sb.WriteString("^")
+	for _, r := range p {
+		switch r {
+		case '%':
+			sb.WriteString(".*")
+		case '_':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	sb.WriteString("$")
+	options := ""
+	if ignoreCase {
+		options = "i"
+	}
+	actual, _, err := m.fieldValue(v, columnName(column))
+	if err != nil {
+		return false, err
+	}
+	return matchRegex(actual, sb.String(), options)
+}
+
+// fieldValue 获取字段值，支持以 . 分隔的嵌套字段
+func (m memoryMatcher) fieldValue(v reflect.Value, key string) (any, bool, error) {
+	schema := m.schema
+	cur := v
+	parts := strings.Split(key, ".")
+	for i, part := range parts {
+		f, ok := schema.Field(part)
+		if !ok {
+			if i == 0 {
+				return nil, false, fmt.Errorf("repox: unknown field %s of %s", key, schema.Type)
+			}
+			return nil, false, nil
+		}
+		fv, ok := f.reflectValue(cur, false)
+		if !ok {
+			return nil, false, nil
+		}
+		if i == len(parts)-1 {
+			return fv.Interface(), true, nil
+		}
+		for fv.Kind() == reflect.Ptr {
+			if fv.IsNil() {
+				return nil, false, nil
+			}
+			fv = fv.Elem()
+		}
+		if fv.Kind() != reflect.Struct {
+			return nil, false, nil
+		}
+		cur = fv
+		schema = schemaOf(fv.Type())
+	}
+	return nil, false, nil
+}
+
+// operatorDoc 判断条件是否为操作符文档（所有 key 以 $ 开头）
+func operatorDoc(cond any) (map[string]any, bool) {
+	var doc map[string]any
+	switch c := cond.(type) {
+	case bson.M:
+		doc = c
+	case map[string]any:
+		doc = c
+	case bson.D:
+		doc = dToMap(c)
+	default:
+		return nil, false
+	}
+	if len(doc) == 0 {
+		return nil, false
+	}
+	for k := range doc {
+		if !strings.HasPrefix(k, "$") {
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+func compareResult(op string, c int) bool {
+	switch op {
+	case "$gt":
+		return c > 0
+	case "$gte":
+		return c >= 0
+	case "$lt":
+		return c < 0
+	case "$lte":
+		return c <= 0
+	default:
+		return false
+	}
+}
+
+func containsValue(list []any, actual any) bool {
+	for _, item := range list {
+		if equalValues(actual, item) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchRegex(actual any, pattern any, options string) (bool, error) {
+	s, ok := normalizeValue(actual).(string)
+	if !ok {
+		return false, nil
+	}
+	var expr string
+	switch p := pattern.(type) {
+	case string:
+		expr = p
+	case bson.Regex:
+		expr, options = p.Pattern, options+p.Options
+	default:
+		return false, fmt.Errorf("repox: unsupported regex %T", pattern)
+	}
+	if strings.Contains(options, "i") {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return false, err
+	}
+	return re.MatchString(s), nil
+}
+
+// toAnyList 将切片类型的条件转换为 []any
+func toAnyList(value any) ([]any, error) {
+	switch l := value.(type) {
+	case []any:
+		return l, nil
+	case bson.A:
+		return l, nil
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("repox: expected list, got %T", value)
+	}
+	list := make([]any, rv.Len())
+	for i := range list {
+		list[i] = rv.Index(i).Interface()
+	}
+	return list, nil
+}
+
+// dToMap 将 bson.D 转换为 map
+func dToMap(d bson.D) map[string]any {
+	m := make(map[string]any, len(d))
+	for _, e := range d {
+		m[e.Key] = e.Value
+	}
+	return m
+}
+
+// columnName 获取 clause 中的列名
+func columnName(column any) string {
+	switch c := column.(type) {
+	case clause.Column:
+		return c.Name
+	case string:
+		return c
+	default:
+		return fmt.Sprint(column)
+	}
+}
@@ -0,0 +1,242 @@
+package repox
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mbeoliero/kit/builder"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+type memUser struct {
+	Id        int64      `bson:"_id" gorm:"primaryKey"`
+	Name      string     `bson:"name"`
+	Age       int        `bson:"age"`
+	Tags      []string   `bson:"tags"`
+	CreatedAt time.Time  `bson:"created_at"`
+	DeletedAt *time.Time `bson:"deleted_at"`
+}
+
+type memDoc struct {
+	Id    bson.ObjectID `bson:"_id"`
+	Title string        `bson:"title"`
+	Views int64         `bson:"views"`
+}
+
+func newMemUsers(t *testing.T) *MemoryRepo[memUser] {
+	t.Helper()
+	repo := NewMemoryRepo[memUser]()
+	err := repo.CreateMany(context.Background(), []*memUser{
+		{Name: "alice", Age: 20},
+		{Name: "bob", Age: 30},
+		{Name: "carol", Age: 25},
+		{Name: "dave", Age: 30},
+	})
+	require.NoError(t, err)
+	return repo
+}
+
+func TestMemoryRepo_Create(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo[memUser]()
+
+	u := &memUser{Name: "alice"}
+	require.NoError(t, repo.Create(ctx, u))
+	assert.Equal(t, int64(1), u.Id)
+
+	assert.ErrorIs(t, repo.Create(ctx, &memUser{Id: 1, Name: "dup"}), ErrDuplicateKey)
+
+	require.NoError(t, repo.Create(ctx, &memUser{Id: 10, Name: "x"}))
+	u2 := &memUser{Name: "y"}
+	require.NoError(t, repo.Create(ctx, u2))
+	assert.Equal(t, int64(11), u2.Id)
+
+	docs := NewMemoryRepo[memDoc]()
+	d := &memDoc{Title: "t"}
+	require.NoError(t, docs.Create(ctx, d))
+	assert.False(t, d.Id.IsZero())
+
+	found, err := docs.FindOne(ctx, builder.NewMongoQueryBuilder().Id(d.Id.Hex()).Build())
+	require.NoError(t, err)
+	assert.Equal(t, "t", found.Title)
+}
+
+func TestMemoryRepo_Find(t *testing.T) {
+	ctx := context.Background()
+	repo := newMemUsers(t)
+
+	tests := []struct {
+		name     string
+		filter   any
+		opts     []IList[FindOptions]
+		expected []string
+	}{
+		{
+			name:     "nil filter",
+			filter:   nil,
+			expected: []string{"alice", "bob", "carol", "dave"},
+		},
+		{
+			name:     "mongo eq",
+			filter:   builder.NewMongoQueryBuilder().Eq("age", 30).Build(),
+			expected: []string{"bob", "dave"},
+		},
+		{
+			name:     "mongo range and like",
+			filter:   builder.NewMongoQueryBuilder().Gte("age", 25).Like("name", "AR", builder.MatchContains).Build(),
+			expected: []string{"carol"},
+		},
+		{
+			name:     "mongo or",
+			filter:   builder.Or(bson.M{"name": "alice"}, builder.NewMongoQueryBuilder().In("age", 25)),
+			expected: []string{"alice", "carol"},
+		},
+		{
+			name:     "gorm expression",
+			filter:   builder.NewGormQueryBuilder().Nin("name", "bob").Lt("age", 30).Build(),
+			expected: []string{"alice", "carol"},
+		},
+		{
+			name:     "gorm like",
+			filter:   builder.NewGormQueryBuilder().Like("name", "a", builder.MatchStartsWith).Build(),
+			expected: []string{"alice"},
+		},
+		{
+			name:     "sort skip limit",
+			filter:   nil,
+			opts:     []IList[FindOptions]{Find().SetSort(NewSort().Desc("age").Asc("name")).SetSkip(1).SetLimit(2)},
+			expected: []string{"dave", "carol"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := repo.Find(ctx, tt.filter, tt.opts...)
+			require.NoError(t, err)
+			names := make([]string, len(results))
+			for i, r := range results {
+				names[i] = r.Name
+			}
+			assert.Equal(t, tt.expected, names)
+		})
+	}
+}
+
+func TestMemoryRepo_FindOneAndCount(t *testing.T) {
+	ctx := context.Background()
+	repo := newMemUsers(t)
+
+	u, err := repo.FindOne(ctx, bson.M{"age": 30}, Find().SetSort(NewSort().Desc("name")).SetReturnFields("name"))
+	require.NoError(t, err)
+	assert.Equal(t, "dave", u.Name)
+	assert.Equal(t, int64(4), u.Id)
+	assert.Zero(t, u.Age)
+
+	_, err = repo.FindOne(ctx, bson.M{"name": "nobody"})
+	assert.ErrorIs(t, err, DataNotFound)
+
+	count, err := repo.Count(ctx, bson.M{"age": bson.M{"$gt": 20}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), count)
+
+	_, err = repo.Find(ctx, bson.M{"unknown": 1})
+	assert.Error(t, err)
+}
+
+func TestMemoryRepo_Update(t *testing.T) {
+	ctx := context.Background()
+	repo := newMemUsers(t)
+
+	res, err := repo.UpdateOne(ctx, bson.M{"name": "alice"}, map[string]any{"age": 21})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), res.UpdateCount)
+
+	res, err = repo.UpdateMany(ctx, bson.M{"age": 30}, map[string]any{"age": int64(31)})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), res.UpdateCount)
+
+	require.NoError(t, repo.Incr(ctx, bson.M{"name": "carol"}, map[string]int{"age": 5}))
+
+	now := time.Now()
+	_, err = repo.UpdateOne(ctx, bson.M{"name": "dave"}, map[string]any{"deleted_at": now})
+	require.NoError(t, err)
+
+	u, err := repo.FindOne(ctx, bson.M{"name": "alice"})
+	require.NoError(t, err)
+	u.Name = "alice2"
+	require.NoError(t, repo.Update(ctx, u))
+
+	results, err := repo.Find(ctx, nil, Find().SetSort(NewSort().Asc("id")))
+	require.NoError(t, err)
+	assert.Equal(t, "alice2", results[0].Name)
+	assert.Equal(t, 21, results[0].Age)
+	assert.Equal(t, 31, results[1].Age)
+	assert.Equal(t, 30, results[2].Age)
+	require.NotNil(t, results[3].DeletedAt)
+	assert.True(t, now.Equal(*results[3].DeletedAt))
+
+	_, err = repo.UpdateOne(ctx, bson.M{"name": "bob"}, map[string]any{"age": "old"})
+	assert.Error(t, err)
+}
+
+func TestMemoryRepo_UpsertOne(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo[memDoc]()
+
+	opt := UpsertOptions{
+		ConflictKvs: map[string]any{"title": "a"},
+		Set:         map[string]any{"title": "a"},
+		Inc:         map[string]int64{"views": 1},
+	}
+	require.NoError(t, repo.UpsertOne(ctx, memDoc{}, opt))
+	require.NoError(t, repo.UpsertOne(ctx, memDoc{}, opt))
+
+	docs, err := repo.Find(ctx, nil)
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	assert.Equal(t, int64(2), docs[0].Views)
+	assert.False(t, docs[0].Id.IsZero())
+}
+
+func TestMemoryRepo_Delete(t *testing.T) {
+	ctx := context.Background()
+	repo := newMemUsers(t)
+
+	res, err := repo.DeleteOne(ctx, bson.M{"age": 30})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), res.DeleteCount)
+
+	res, err = repo.DeleteMany(ctx, bson.M{"age": bson.M{"$gte": 25}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), res.DeleteCount)
+
+	count, err := repo.Count(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestMemoryRepo_Concurrent(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo[memDoc]()
+	doc := &memDoc{Title: "hot"}
+	require.NoError(t, repo.Create(ctx, doc))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = repo.Incr(ctx, bson.M{"_id": doc.Id}, map[string]int{"views": 1})
+			_, _ = repo.Find(ctx, nil)
+		}()
+	}
+	wg.Wait()
+
+	got, err := repo.FindOne(ctx, bson.M{"_id": doc.Id})
+	require.NoError(t, err)
+	assert.Equal(t, int64(50), got.Views)
+}
@@ -3,23 +3,44 @@ package repox
 import (
 	"context"
 	"errors"
+	"fmt"
+	"iter"
+	"reflect"
+	"time"
 
+	"github.com/mbeoliero/kit/builder"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.mongodb.org/mongo-driver/v2/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/v2/mongo/readpref"
 )
 
 // MongoRepo MongoDB 通用仓库实现
+// 使用 WithMongoTx 传入的 ctx 调用时自动加入事务
+// 启用租户隔离时所有操作限定在 ctx 的当前租户内，Native 返回的集合不受限制
 type MongoRepo[T any] struct {
-	coll *mongo.Collection
+	coll       *mongo.Collection
+	softDelete softDelete
+	tenancy    tenancy
+	ids        idGeneration
+	findGuard  findGuard
 }
 
 // 确保 MongoRepo 实现了 Repo 接口
 var _ Repo[any, *mongo.Collection] = (*MongoRepo[any])(nil)
 
 // NewMongoRepo 创建 MongoDB 仓库
-func NewMongoRepo[T any](coll *mongo.Collection) *MongoRepo[T] {
-	return &MongoRepo[T]{coll: coll}
+func NewMongoRepo[T any](coll *mongo.Collection, opts ...IList[RepoOptions]) *MongoRepo[T] {
+	o := NewOptions(opts...)
+	schema := schemaFor[T]()
+	return &MongoRepo[T]{
+		coll:       coll,
+		softDelete: newSoftDelete(schema, o),
+		tenancy:    newTenancy(schema, o),
+		ids:        newIdGeneration(schema, o),
+		findGuard:  newFindGuard(o),
+	}
 }
 
 // Native 返回底层 *mongo.Collection
@@ -27,17 +48,38 @@ func (r *MongoRepo[T]) Native() *mongo.Collection {
 	return r.coll
 }
 
-// Create 创建单条记录
+// Create 创建单条记录，填充主键、审计字段和租户
 func (r *MongoRepo[T]) Create(ctx context.Context, entity *T) error {
+	if err := r.ids.stamp(ctx, entity); err != nil {
+		return err
+	}
+	if err := r.tenancy.stamp(ctx, entity); err != nil {
+		return err
+	}
+	if err := r.auditor().stampCreate(ctx, entity, time.Now()); err != nil {
+		return err
+	}
 	_, err := r.coll.InsertOne(ctx, entity)
 	return wrapError(err)
 }
 
-// CreateMany 批量创建记录
+// CreateMany 批量创建记录，填充主键、审计字段和租户
 func (r *MongoRepo[T]) CreateMany(ctx context.Context, entities []*T) error {
 	if len(entities) == 0 {
 		return nil
 	}
+	now := time.Now()
+	for _, entity := range entities {
+		if err := r.ids.stamp(ctx, entity); err != nil {
+			return err
+		}
+		if err := r.tenancy.stamp(ctx, entity); err != nil {
+			return err
+		}
+		if err := r.auditor().stampCreate(ctx, entity, now); err != nil {
+			return err
+		}
+	}
 	_, err := r.coll.InsertMany(ctx, entities)
 	return wrapError(err)
 }
@@ -45,22 +87,34 @@ func (r *MongoRepo[T]) CreateMany(ctx context.Context, entities []*T) error {
 // FindOne 查询单条记录
 func (r *MongoRepo[T]) FindOne(ctx context.Context, filter any, opts ...IList[FindOptions]) (*T, error) {
 	o := NewOptions(opts...)
+	ctx, cancel := withMaxTime(ctx, o.MaxTime)
+	defer cancel()
 	findOpts := r.buildFindOneOptions(o)
 
+	f, err := r.scopedFilter(ctx, filter, o.Deleted)
+	if err != nil {
+		return nil, err
+	}
 	var result *T
-	err := r.coll.FindOne(ctx, r.normalizeFilter(filter), findOpts).Decode(&result)
+	err = r.readColl(ctx, o).FindOne(ctx, f, findOpts).Decode(&result)
 	if err != nil {
 		return nil, wrapError(err)
 	}
 	return result, nil
 }
 
-// Find 查询多条记录
+// Find 查询多条记录，未设置 Limit 时受仓库的 SetUnboundedFindLimit 限制
 func (r *MongoRepo[T]) Find(ctx context.Context, filter any, opts ...IList[FindOptions]) ([]*T, error) {
 	o := NewOptions(opts...)
-	findOpts := r.buildFindOptions(o)
+	ctx, cancel := withMaxTime(ctx, o.MaxTime)
+	defer cancel()
+	guarded := r.findGuard.apply(o)
 
-	cursor, err := r.coll.Find(ctx, r.normalizeFilter(filter), findOpts)
+	f, err := r.scopedFilter(ctx, filter, o.Deleted)
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := r.findCursor(ctx, f, o, 0)
 	if err != nil {
 		return nil, wrapError(err)
 	}
@@ -70,30 +124,310 @@ func (r *MongoRepo[T]) Find(ctx context.Context, filter any, opts ...IList[FindO
 	if err = cursor.All(ctx, &results); err != nil {
 		return nil, wrapError(err)
 	}
-	return results, nil
+	return checkUnbounded(ctx, r.findGuard, guarded, results)
 }
 
-// Count 统计记录数
+// Count 统计记录数，设置 Skip/Limit 时只统计该范围内的记录
+// 设置 EstimatedCountThreshold 且过滤条件为空时先使用集合元数据估算，估算值超过阈值则直接返回（事务中不可用）
 func (r *MongoRepo[T]) Count(ctx context.Context, filter any, opts ...IList[FindOptions]) (int64, error) {
-	count, err := r.coll.CountDocuments(ctx, r.normalizeFilter(filter))
+	o := NewOptions(opts...)
+	ctx, cancel := withMaxTime(ctx, o.MaxTime)
+	defer cancel()
+	f, err := r.scopedFilter(ctx, filter, o.Deleted)
+	if err != nil {
+		return 0, err
+	}
+	if o.EstimatedCountThreshold > 0 && isEmptyFilter(f) && mongo.SessionFromContext(ctx) == nil {
+		estimated, err := r.readColl(ctx, o).EstimatedDocumentCount(ctx)
+		if err == nil && estimated > o.EstimatedCountThreshold {
+			return estimated, nil
+		}
+	}
+
+	countOpts := options.Count()
+	if o.Skip > 0 {
+		countOpts.SetSkip(o.Skip)
+	}
+	if o.Limit > 0 {
+		countOpts.SetLimit(o.Limit)
+	}
+	count, err := r.readColl(ctx, o).CountDocuments(ctx, f, countOpts)
 	return count, wrapError(err)
 }
 
+// FindWithTotal 查询一页数据并同时统计总数，会话（事务）中顺序执行
+func (r *MongoRepo[T]) FindWithTotal(ctx context.Context, filter any, opts ...IList[FindOptions]) (*Page[T], error) {
+	return findWithTotal[T](ctx, r, mongo.SessionFromContext(ctx) == nil, filter, opts...)
+}
+
+// FindPage 基于游标的分页查询
+func (r *MongoRepo[T]) FindPage(ctx context.Context, filter any, sort *Sort, cursor string, limit int64) (*CursorPage[T], error) {
+	return pager[T]{find: r.Find, newBuilder: r.newQueryBuilder, idField: r.idField()}.page(ctx, filter, sort, cursor, limit)
+}
+
+// Iterate 基于游标逐条解码，遍历结束或中途退出时关闭游标
+func (r *MongoRepo[T]) Iterate(ctx context.Context, filter any, opts ...IList[FindOptions]) iter.Seq2[*T, error] {
+	return func(yield func(*T, error) bool) {
+		o := NewOptions(opts...)
+		f, err := r.scopedFilter(ctx, filter, o.Deleted)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		cursor, err := r.findCursor(ctx, f, o, 0)
+		if err != nil {
+			yield(nil, wrapError(err))
+			return
+		}
+		defer func() { _ = cursor.Close(context.WithoutCancel(ctx)) }()
+
+		for cursor.Next(ctx) {
+			item := new(T)
+			if err = cursor.Decode(item); err != nil {
+				yield(nil, wrapError(err))
+				return
+			}
+			if !yield(item, nil) {
+				return
+			}
+		}
+		if err = cursor.Err(); err != nil {
+			yield(nil, wrapError(err))
+		}
+	}
+}
+
+// FindInBatches 基于游标分批查询，游标的 batchSize 与批大小一致
+func (r *MongoRepo[T]) FindInBatches(ctx context.Context, filter any, batchSize int, fn func(batch []*T) error, opts ...IList[FindOptions]) error {
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+	o := NewOptions(opts...)
+	f, err := r.scopedFilter(ctx, filter, o.Deleted)
+	if err != nil {
+		return err
+	}
+	cursor, err := r.findCursor(ctx, f, o, int32(batchSize))
+	if err != nil {
+		return wrapError(err)
+	}
+	defer func() { _ = cursor.Close(context.WithoutCancel(ctx)) }()
+
+	batch := make([]*T, 0, batchSize)
+	for cursor.Next(ctx) {
+		item := new(T)
+		if err = cursor.Decode(item); err != nil {
+			return wrapError(err)
+		}
+		if batch = append(batch, item); len(batch) == batchSize {
+			if err = fn(batch); err != nil {
+				return err
+			}
+			batch = make([]*T, 0, batchSize)
+		}
+	}
+	if err = cursor.Err(); err != nil {
+		return wrapError(err)
+	}
+	if len(batch) > 0 {
+		return fn(batch)
+	}
+	return nil
+}
+
+// aggregate 通过 $match、$group 和 $project 管道聚合，分组字段从 _id 中展开到结果顶层
+func (r *MongoRepo[T]) aggregate(ctx context.Context, filter any, o *AggregateOptions, dest any) error {
+	pipeline, err := r.aggregatePipeline(ctx, filter, o)
+	if err != nil {
+		return err
+	}
+	cursor, err := r.coll.Aggregate(ctx, pipeline)
+	if err != nil {
+		return wrapError(err)
+	}
+	return wrapError(cursor.All(ctx, dest))
+}
+
+// aggregatePipeline 构建聚合管道
+func (r *MongoRepo[T]) aggregatePipeline(ctx context.Context, filter any, o *AggregateOptions) (mongo.Pipeline, error) {
+	plan, err := newAggregatePlan(schemaFor[T](), o, bsonField)
+	if err != nil {
+		return nil, err
+	}
+	f, err := r.scopedFilter(ctx, filter, o.Deleted)
+	if err != nil {
+		return nil, err
+	}
+
+	var id any
+	project := bson.D{{Key: "_id", Value: 0}}
+	if len(plan.groups) > 0 {
+		keys := bson.D{}
+		for _, g := range plan.groups {
+			keys = append(keys, bson.E{Key: g, Value: "$" + g})
+			project = append(project, bson.E{Key: g, Value: "$_id." + g})
+		}
+		id = keys
+	}
+	group := bson.D{{Key: "_id", Value: id}}
+	for _, acc := range plan.accs {
+		var expr bson.M
+		if acc.Op == AccCount {
+			expr = bson.M{"$sum": 1}
+		} else {
+			expr = bson.M{"$" + string(acc.Op): "$" + acc.Field}
+		}
+		group = append(group, bson.E{Key: acc.As, Value: expr})
+		project = append(project, bson.E{Key: acc.As, Value: 1})
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: f}},
+		{{Key: "$group", Value: group}},
+		{{Key: "$project", Value: project}},
+	}
+	if o.Sort != nil {
+		pipeline = append(pipeline, bson.D{{Key: "$sort", Value: o.Sort.ToBson()}})
+	}
+	if o.Limit > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: o.Limit}})
+	}
+	return pipeline, nil
+}
+
+// distinct 通过 distinct 命令查询字段的不同取值
+func (r *MongoRepo[T]) distinct(ctx context.Context, field string, filter any, dest any) error {
+	fi, ok := schemaFor[T]().Field(field)
+	if !ok {
+		return fmt.Errorf("repox: unknown field %s of %s", field, schemaFor[T]().Type)
+	}
+	f, err := r.scopedFilter(ctx, filter, DeletedExcluded)
+	if err != nil {
+		return err
+	}
+	return wrapError(r.coll.Distinct(ctx, fi.BsonName, f).Decode(dest))
+}
+
+// tenantScope 返回租户隔离配置
+func (r *MongoRepo[T]) tenantScope() tenancy {
+	return r.tenancy
+}
+
+// newQueryBuilder 创建与仓库匹配的查询构建器，主键为 ObjectID 时将 hex 字符串转换为 ObjectID，否则不转换
+func (r *MongoRepo[T]) newQueryBuilder() builder.QBuilder {
+	b := builder.NewMongoQueryBuilder()
+	if pk := schemaFor[T]().Primary; pk != nil && pk.Type == reflect.TypeFor[bson.ObjectID]() {
+		return b.WithObjectId()
+	}
+	return b.Coerce(r.idField(), nil)
+}
+
+// readColl 返回应用了读偏好和读关注的集合，未设置或在会话中时返回原集合
+func (r *MongoRepo[T]) readColl(ctx context.Context, o *FindOptions) *mongo.Collection {
+	if mongo.SessionFromContext(ctx) != nil {
+		return r.coll
+	}
+	if co, ok := mongoReadOptions(o); ok {
+		return r.coll.Clone(co)
+	}
+	return r.coll
+}
+
+// mongoReadOptions 将读取选项转换为集合选项，没有需要设置的选项时返回 false
+func mongoReadOptions(o *FindOptions) (*options.CollectionOptionsBuilder, bool) {
+	if o.Read == ReadDefault && o.ReadConcern == "" {
+		return nil, false
+	}
+	co := options.Collection()
+	switch o.Read {
+	case ReadPrimary:
+		co.SetReadPreference(readpref.Primary())
+	case ReadReplica:
+		var rpOpts []readpref.Option
+		if o.MaxStaleness > 0 {
+			rpOpts = append(rpOpts, readpref.WithMaxStaleness(o.MaxStaleness))
+		}
+		co.SetReadPreference(readpref.SecondaryPreferred(rpOpts...))
+	}
+	if o.ReadConcern != "" {
+		co.SetReadConcern(&readconcern.ReadConcern{Level: string(o.ReadConcern)})
+	}
+	return co, true
+}
+
+// idField 返回主键字段名
+func (r *MongoRepo[T]) idField() string {
+	return "_id"
+}
+
+// fieldName 返回字段的 MongoDB 字段名
+func (r *MongoRepo[T]) fieldName(f *fieldInfo) string {
+	return f.BsonName
+}
+
 // Update 更新整个实体（通过 _id）
+// 实体声明了版本号字段时使用乐观锁：版本号作为条件并加一，没有匹配到记录时返回 ErrVersionConflict
 func (r *MongoRepo[T]) Update(ctx context.Context, entity *T) error {
-	id, ok := getId(entity)
+	if err := r.tenancy.stamp(ctx, entity); err != nil {
+		return err
+	}
+	if err := r.auditor().stampUpdate(ctx, entity, time.Now()); err != nil {
+		return err
+	}
+	if version := schemaFor[T]().Role(roleVersion); version != nil {
+		return r.updateVersioned(ctx, entity, version)
+	}
+
+	id, ok := schemaFor[T]().PrimaryValue(entity)
 	if !ok {
 		return errors.New("invalid entity")
 	}
-	_, err := r.coll.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": entity})
+	f, err := r.tenancy.bsonFilter(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	_, err = r.coll.UpdateOne(ctx, f, bson.M{"$set": entity})
 	return wrapError(err)
 }
 
+// updateVersioned 按 _id 和版本号更新实体，失败时恢复实体中的版本号
+func (r *MongoRepo[T]) updateVersioned(ctx context.Context, entity *T, version *fieldInfo) error {
+	id, ok := schemaFor[T]().PrimaryValue(entity)
+	if !ok {
+		return errors.New("invalid entity")
+	}
+	cur, rollback, err := bumpVersion(version, entity)
+	if err != nil {
+		return err
+	}
+
+	f, err := r.tenancy.bsonFilter(ctx, bson.M{"_id": id, version.BsonName: versionMatch(cur)})
+	if err != nil {
+		rollback()
+		return err
+	}
+	result, err := r.coll.UpdateOne(ctx, f, bson.M{"$set": entity})
+	if err != nil {
+		rollback()
+		return wrapError(err)
+	}
+	if result.MatchedCount == 0 {
+		rollback()
+		return ErrVersionConflict
+	}
+	return nil
+}
+
 func (r *MongoRepo[T]) Incr(ctx context.Context, filter any, incr map[string]int, opts ...IList[UpdateOptions]) error {
-	_ = NewOptions(opts...)
+	ctx, cancel := withMaxTime(ctx, NewOptions(opts...).MaxTime)
+	defer cancel()
 	updateOpts := options.UpdateOne()
 
-	_, err := r.coll.UpdateOne(ctx, r.normalizeFilter(filter), r.incrToUpdate(incr), updateOpts)
+	f, err := r.scopedFilter(ctx, filter, DeletedExcluded)
+	if err != nil {
+		return err
+	}
+	_, err = r.coll.UpdateOne(ctx, f, r.incrToUpdate(incr), updateOpts)
 	if err != nil {
 		return wrapError(err)
 	}
@@ -102,10 +436,18 @@ func (r *MongoRepo[T]) Incr(ctx context.Context, filter any, incr map[string]int
 
 // UpdateOne 更新单条记录
 func (r *MongoRepo[T]) UpdateOne(ctx context.Context, filter any, update map[string]any, opts ...IList[UpdateOptions]) (*UpdateResult, error) {
-	_ = NewOptions(opts...)
+	ctx, cancel := withMaxTime(ctx, NewOptions(opts...).MaxTime)
+	defer cancel()
 	updateOpts := options.UpdateOne()
 
-	result, err := r.coll.UpdateOne(ctx, r.normalizeFilter(filter), r.mapToUpdate(update), updateOpts)
+	if err := r.tenancy.checkUpdate(ctx, update); err != nil {
+		return nil, err
+	}
+	f, err := r.scopedFilter(ctx, filter, DeletedExcluded)
+	if err != nil {
+		return nil, err
+	}
+	result, err := r.coll.UpdateOne(ctx, f, r.mapToUpdate(ctx, update), updateOpts)
 	if err != nil {
 		return nil, wrapError(err)
 	}
@@ -114,58 +456,543 @@ func (r *MongoRepo[T]) UpdateOne(ctx context.Context, filter any, update map[str
 
 // UpdateMany 更新多条记录
 func (r *MongoRepo[T]) UpdateMany(ctx context.Context, filter any, update map[string]any, opts ...IList[UpdateOptions]) (*UpdateResult, error) {
+	ctx, cancel := withMaxTime(ctx, NewOptions(opts...).MaxTime)
+	defer cancel()
 	updateOpts := options.UpdateMany()
 
-	result, err := r.coll.UpdateMany(ctx, r.normalizeFilter(filter), r.mapToUpdate(update), updateOpts)
+	if err := r.tenancy.checkUpdate(ctx, update); err != nil {
+		return nil, err
+	}
+	f, err := r.scopedFilter(ctx, filter, DeletedExcluded)
+	if err != nil {
+		return nil, err
+	}
+	result, err := r.coll.UpdateMany(ctx, f, r.mapToUpdate(ctx, update), updateOpts)
 	if err != nil {
 		return nil, wrapError(err)
 	}
 	return &UpdateResult{UpdateCount: result.ModifiedCount}, nil
 }
 
+// FindOneAndUpdate 基于 findAndModify 原子地更新第一条匹配记录并返回
+// Upsert 插入时 created_at/created_by 和生成的主键通过 $setOnInsert 写入，过滤条件中的等值条件由 MongoDB 写入新文档
+func (r *MongoRepo[T]) FindOneAndUpdate(ctx context.Context, filter any, update map[string]any, opts ...IList[UpdateOptions]) (*T, error) {
+	o := NewOptions(opts...)
+	if err := r.tenancy.checkUpdate(ctx, update); err != nil {
+		return nil, err
+	}
+	ctx, cancel := withMaxTime(ctx, o.MaxTime)
+	defer cancel()
+	f, err := r.scopedFilter(ctx, filter, DeletedExcluded)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := r.mapToUpdate(ctx, update)
+	findOpts := options.FindOneAndUpdate().SetUpsert(o.Upsert)
+	if o.Upsert {
+		onInsert := r.auditor().insertValues(ctx, time.Now(), bsonField)
+		for k := range update {
+			delete(onInsert, k)
+		}
+		// 过滤条件和更新内容都没有主键时，插入的记录使用生成的主键
+		if pk := r.ids.field; r.ids.gen != nil && !hasField(filter, pk.BsonName) {
+			if _, ok := update[pk.BsonName]; !ok {
+				if onInsert[pk.BsonName], err = r.ids.next(ctx, pk.Type.Kind()); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if len(onInsert) > 0 {
+			doc["$setOnInsert"] = onInsert
+		}
+	}
+	if o.ReturnAfter {
+		findOpts.SetReturnDocument(options.After)
+	}
+	if o.Sort != nil {
+		findOpts.SetSort(o.Sort.ToBson())
+	}
+
+	var result *T
+	err = r.coll.FindOneAndUpdate(ctx, f, doc, findOpts).Decode(&result)
+	if o.Upsert && errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return result, nil
+}
+
 // UpsertOne 插入或更新单条记录
+// 审计字段中 updated_at/updated_by 通过 $set 写入，created_at/created_by 只在插入时通过 $setOnInsert 写入
+// 启用租户隔离时冲突字段附加当前租户，只在当前租户内匹配
 func (r *MongoRepo[T]) UpsertOne(ctx context.Context, create T, opt UpsertOptions) error {
+	filter, update, err := r.upsertDoc(ctx, &create, opt)
+	if err != nil {
+		return err
+	}
+	updateOpts := options.UpdateOne().SetUpsert(true)
+	_, err = r.coll.UpdateOne(ctx, filter, update, updateOpts)
+	return wrapError(err)
+}
+
+// UpsertMany 基于无序的 BulkWrite 在一次请求中执行多个 upsert，插入和更新的数量取自服务端返回的结果
+// 命中时通过 $set 覆盖字段、$inc 自增字段，其它字段（包括 created_at/created_by）只在插入时通过 $setOnInsert 写入；
+// 启用租户隔离时冲突字段附加当前租户，只在当前租户内匹配；实体的冲突键不能重复，否则返回 ErrDuplicateKey；
+// 插入的记录的主键（生成的主键或服务端创建的 ObjectID）写回实体，命中的记录不修改实体的主键
+func (r *MongoRepo[T]) UpsertMany(ctx context.Context, entities []*T, opt UpsertManyOptions) (*UpsertResult, error) {
+	schema := schemaFor[T]()
+	plan, err := newUpsertPlan(schema, opt, r.tenancy)
+	if err != nil {
+		return nil, err
+	}
+	if len(entities) == 0 {
+		return &UpsertResult{}, nil
+	}
+	if err = checkDistinct(plan, entities); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	models := make([]mongo.WriteModel, 0, len(entities))
+	for _, entity := range entities {
+		if err = r.tenancy.stamp(ctx, entity); err != nil {
+			return nil, err
+		}
+		if err = r.auditor().stampCreate(ctx, entity, now); err != nil {
+			return nil, err
+		}
+		// 生成的主键只写入 $setOnInsert，插入成功后才写回实体
+		row := clonePtr(entity)
+		if err = r.ids.stamp(ctx, row); err != nil {
+			return nil, err
+		}
+		doc, err := marshalDoc(row)
+		if err != nil {
+			return nil, err
+		}
+
+		kvs := make(map[string]any, len(plan.conflict))
+		for i, v := range plan.conflictValues(entity) {
+			kvs[plan.conflict[i].BsonName] = v
+		}
+		filter, err := r.tenancy.withTenant(ctx, kvs, bsonField)
+		if err != nil {
+			return nil, err
+		}
+		for k := range filter {
+			delete(doc, k)
+		}
+		if pk := schema.Primary; pk != nil {
+			if id, ok := pk.Value(reflect.ValueOf(row)); ok && reflect.ValueOf(id).IsZero() {
+				delete(doc, pk.BsonName)
+			}
+		}
+
+		update := bson.M{}
+		set := bson.M{}
+		for _, f := range plan.update {
+			if v, ok := doc[f.BsonName]; ok {
+				set[f.BsonName] = v
+				delete(doc, f.BsonName)
+			}
+		}
+		if len(set) > 0 {
+			update["$set"] = set
+		}
+		if len(plan.inc) > 0 {
+			inc := bson.M{}
+			for f, delta := range plan.inc {
+				inc[f.BsonName] = delta
+				delete(doc, f.BsonName)
+			}
+			update["$inc"] = inc
+		}
+		if len(doc) > 0 {
+			update["$setOnInsert"] = doc
+		}
+		if len(update) == 0 {
+			update["$setOnInsert"] = bson.M(filter)
+		}
+		models = append(models, mongo.NewUpdateOneModel().SetFilter(bson.M(filter)).SetUpdate(update).SetUpsert(true))
+	}
+
+	res, err := r.coll.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	if res == nil {
+		return nil, wrapError(err)
+	}
+	if pk := schema.Primary; pk != nil {
+		for i, id := range res.UpsertedIDs {
+			if fv, ok := pk.reflectValue(reflect.ValueOf(entities[i]), true); ok {
+				_ = assignValue(fv, id)
+			}
+		}
+	}
+	return &UpsertResult{InsertCount: res.UpsertedCount, UpdateCount: res.MatchedCount}, wrapError(err)
+}
+
+// upsertDoc 构建 UpsertOne 的过滤条件和更新文档
+func (r *MongoRepo[T]) upsertDoc(ctx context.Context, create *T, opt UpsertOptions) (bson.M, bson.M, error) {
+	if err := r.tenancy.checkUpdate(ctx, opt.Set); err != nil {
+		return nil, nil, err
+	}
+	if err := r.ids.stamp(ctx, create); err != nil {
+		return nil, nil, err
+	}
+	if err := r.tenancy.stamp(ctx, create); err != nil {
+		return nil, nil, err
+	}
+	conflictKvs, err := r.tenancy.withTenant(ctx, opt.ConflictKvs, bsonField)
+	if err != nil {
+		return nil, nil, err
+	}
 	// 根据冲突字段构建 filter
 	filter := bson.M{}
-	for col, val := range opt.ConflictKvs {
+	for col, val := range conflictKvs {
 		filter[col] = val
 	}
+	// 生成的主键只在插入时通过 $setOnInsert 写入，冲突字段包含主键时以冲突字段为准
+	var pk *fieldInfo
+	if r.ids.gen != nil {
+		if _, ok := filter[r.ids.field.BsonName]; !ok {
+			pk = r.ids.field
+		}
+	}
+
+	now := time.Now()
+	audit := r.auditor()
+	updated := audit.updateValues(ctx, now, bsonField)
+	onInsert := audit.insertValues(ctx, now, bsonField)
 
 	update := bson.M{}
 	if len(opt.Set) > 0 {
-		update["$set"] = opt.Set
+		update["$set"] = mergeValues(opt.Set, updated)
+		for k := range opt.Set {
+			delete(onInsert, k)
+		}
 	}
 	if len(opt.Inc) > 0 {
 		update["$inc"] = opt.Inc
 	}
 	// 如果没有指定 Set，则用整个 create 对象作为 $set
 	if len(opt.Set) == 0 {
-		update["$set"] = create
+		if len(updated)+len(onInsert) == 0 && pk == nil {
+			update["$set"] = create
+		} else {
+			set, created, err := r.splitUpsertDoc(ctx, create, now)
+			if err != nil {
+				return nil, nil, err
+			}
+			if pk != nil {
+				delete(set, pk.BsonName)
+			}
+			update["$set"] = set
+			onInsert = created
+		}
 	}
-
-	updateOpts := options.UpdateOne().SetUpsert(true)
-	_, err := r.coll.UpdateOne(ctx, filter, update, updateOpts)
-	return wrapError(err)
+	if pk != nil {
+		onInsert[pk.BsonName], _ = pk.Value(reflect.ValueOf(create))
+	}
+	if len(onInsert) > 0 {
+		update["$setOnInsert"] = onInsert
+	}
+	return filter, update, nil
 }
 
-// DeleteOne 删除单条记录
+// DeleteOne 删除单条记录，启用软删除时设置删除字段
 func (r *MongoRepo[T]) DeleteOne(ctx context.Context, filter any) (*DeleteResult, error) {
-	result, err := r.coll.DeleteOne(ctx, r.normalizeFilter(filter))
+	f, err := r.scopedFilter(ctx, filter, DeletedExcluded)
+	if err != nil {
+		return nil, err
+	}
+	if r.softDelete.enabled() {
+		result, err := r.coll.UpdateOne(ctx, f, r.deletedUpdate(time.Now()))
+		if err != nil {
+			return nil, wrapError(err)
+		}
+		return &DeleteResult{DeleteCount: result.ModifiedCount}, nil
+	}
+	result, err := r.coll.DeleteOne(ctx, f)
 	if err != nil {
 		return nil, wrapError(err)
 	}
 	return &DeleteResult{DeleteCount: result.DeletedCount}, nil
 }
 
-// DeleteMany 删除多条记录
+// DeleteMany 删除多条记录，启用软删除时设置删除字段
 func (r *MongoRepo[T]) DeleteMany(ctx context.Context, filter any) (*DeleteResult, error) {
-	result, err := r.coll.DeleteMany(ctx, r.normalizeFilter(filter))
+	f, err := r.scopedFilter(ctx, filter, DeletedExcluded)
+	if err != nil {
+		return nil, err
+	}
+	if r.softDelete.enabled() {
+		result, err := r.coll.UpdateMany(ctx, f, r.deletedUpdate(time.Now()))
+		if err != nil {
+			return nil, wrapError(err)
+		}
+		return &DeleteResult{DeleteCount: result.ModifiedCount}, nil
+	}
+	result, err := r.coll.DeleteMany(ctx, f)
 	if err != nil {
 		return nil, wrapError(err)
 	}
 	return &DeleteResult{DeleteCount: result.DeletedCount}, nil
 }
 
+// FindOneAndDelete 基于 findAndModify 原子地删除第一条匹配记录并返回，启用软删除时设置删除字段
+func (r *MongoRepo[T]) FindOneAndDelete(ctx context.Context, filter any, opts ...IList[FindOptions]) (*T, error) {
+	o := NewOptions(opts...)
+	f, err := r.scopedFilter(ctx, filter, DeletedExcluded)
+	if err != nil {
+		return nil, err
+	}
+
+	var result *T
+	if r.softDelete.enabled() {
+		updateOpts := options.FindOneAndUpdate()
+		if o.Sort != nil {
+			updateOpts.SetSort(o.Sort.ToBson())
+		}
+		err = r.coll.FindOneAndUpdate(ctx, f, r.deletedUpdate(time.Now()), updateOpts).Decode(&result)
+	} else {
+		deleteOpts := options.FindOneAndDelete()
+		if o.Sort != nil {
+			deleteOpts.SetSort(o.Sort.ToBson())
+		}
+		err = r.coll.FindOneAndDelete(ctx, f, deleteOpts).Decode(&result)
+	}
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return result, nil
+}
+
+// BulkWrite 基于 MongoDB BulkWrite 在一次请求中执行写入操作，不在事务中执行时失败前已完成的操作不会回滚
+// 构建失败的操作（如缺少租户）不会发送到服务端，Ordered 时其后的操作也不会执行；
+// 启用软删除时删除操作计入 MatchedCount 和 ModifiedCount，开启 Verbose 时计入 DeletedCount
+func (r *MongoRepo[T]) BulkWrite(ctx context.Context, ops []WriteOp[T], opts ...IList[BulkOptions]) (*BulkResult, error) {
+	o := newBulkOptions(opts)
+	result := newBulkResult(len(ops))
+
+	models := make([]mongo.WriteModel, 0, len(ops))
+	indexes := make([]int, 0, len(ops))
+	for i, op := range ops {
+		model, err := r.writeModel(ctx, op)
+		if err != nil {
+			result.fail(i, i+1, err, o.Ordered)
+			if o.Ordered {
+				break
+			}
+			continue
+		}
+		models = append(models, model)
+		indexes = append(indexes, i)
+	}
+	if len(models) == 0 {
+		return result, result.Err()
+	}
+
+	if o.Verbose {
+		r.clientBulkWrite(ctx, ops, models, indexes, o, result)
+	} else {
+		r.collectionBulkWrite(ctx, ops, models, indexes, o, result)
+	}
+	return result, result.Err()
+}
+
+// collectionBulkWrite 基于集合级别的 BulkWrite 执行，服务端只返回总数和 upsert 插入的 _id，
+// 因此每个操作的结果只包含插入和 upsert 插入的数量
+func (r *MongoRepo[T]) collectionBulkWrite(ctx context.Context, ops []WriteOp[T], models []mongo.WriteModel, indexes []int, o *BulkOptions, result *BulkResult) {
+	res, err := r.coll.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(o.Ordered))
+	var writeErrs map[int]error
+	var bwe mongo.BulkWriteException
+	if errors.As(err, &bwe) && len(bwe.WriteErrors) > 0 {
+		writeErrs = make(map[int]error, len(bwe.WriteErrors))
+		for _, we := range bwe.WriteErrors {
+			writeErrs[we.Index] = we.WriteError
+		}
+	}
+	succeeded := failBulk(result, indexes, err, writeErrs, o.Ordered)
+	if res == nil {
+		return
+	}
+	result.InsertedCount = res.InsertedCount
+	result.MatchedCount = res.MatchedCount
+	result.ModifiedCount = res.ModifiedCount
+	result.DeletedCount = res.DeletedCount
+	result.UpsertedCount = res.UpsertedCount
+	for _, k := range succeeded {
+		i := indexes[k]
+		switch ops[i].Kind {
+		case WriteInsert:
+			result.Results[i].InsertedCount = 1
+		case WriteUpsert:
+			if _, ok := res.UpsertedIDs[int64(k)]; ok {
+				result.Results[i].UpsertedCount = 1
+			}
+		}
+	}
+}
+
+// clientBulkWrite 基于客户端级别的 bulkWrite 命令执行并返回每个操作的结果，需要 MongoDB 8.0 以上
+func (r *MongoRepo[T]) clientBulkWrite(ctx context.Context, ops []WriteOp[T], models []mongo.WriteModel, indexes []int, o *BulkOptions, result *BulkResult) {
+	db := r.coll.Database()
+	writes := make([]mongo.ClientBulkWrite, len(models))
+	for k, model := range models {
+		writes[k] = mongo.ClientBulkWrite{Database: db.Name(), Collection: r.coll.Name(), Model: clientWriteModel(model)}
+	}
+	res, err := db.Client().BulkWrite(ctx, writes, options.ClientBulkWrite().SetOrdered(o.Ordered).SetVerboseResults(true))
+	var writeErrs map[int]error
+	var cbe mongo.ClientBulkWriteException
+	if errors.As(err, &cbe) {
+		res = cbe.PartialResult
+		if len(cbe.WriteErrors) > 0 {
+			writeErrs = make(map[int]error, len(cbe.WriteErrors))
+			for k, we := range cbe.WriteErrors {
+				writeErrs[k] = we
+			}
+		}
+	}
+	succeeded := failBulk(result, indexes, err, writeErrs, o.Ordered)
+	if res == nil {
+		return
+	}
+	for _, k := range succeeded {
+		i := indexes[k]
+		result.set(i, clientWriteResult(res, k, ops[i].Kind, r.softDelete.enabled()))
+	}
+}
+
+// failBulk 将服务端返回的错误记录到对应的操作，writeErrs 以模型下标为 key；返回执行成功的模型下标
+// 无法定位到单个操作的错误（如写关注错误）将所有已发送的操作记为失败
+func failBulk(result *BulkResult, indexes []int, err error, writeErrs map[int]error, ordered bool) []int {
+	if err != nil && len(writeErrs) == 0 {
+		for _, i := range indexes {
+			result.Errors[i] = wrapError(err)
+		}
+		return nil
+	}
+	first := len(indexes)
+	for k, we := range writeErrs {
+		result.Errors[indexes[k]] = wrapError(we)
+		first = min(first, k)
+	}
+	if ordered && first < len(indexes) {
+		for i := indexes[first] + 1; i < len(result.Errors); i++ {
+			result.Errors[i] = ErrWriteSkipped
+		}
+	}
+	succeeded := make([]int, 0, len(indexes))
+	for k := range indexes {
+		if _, failed := writeErrs[k]; !failed && (!ordered || k < first) {
+			succeeded = append(succeeded, k)
+		}
+	}
+	return succeeded
+}
+
+// clientWriteModel 将集合级别的 WriteModel 转换为客户端级别 bulkWrite 的模型
+func clientWriteModel(model mongo.WriteModel) mongo.ClientWriteModel {
+	switch m := model.(type) {
+	case *mongo.InsertOneModel:
+		return &mongo.ClientInsertOneModel{Document: m.Document}
+	case *mongo.UpdateOneModel:
+		return &mongo.ClientUpdateOneModel{Filter: m.Filter, Update: m.Update, Upsert: m.Upsert}
+	case *mongo.UpdateManyModel:
+		return &mongo.ClientUpdateManyModel{Filter: m.Filter, Update: m.Update, Upsert: m.Upsert}
+	case *mongo.DeleteOneModel:
+		return &mongo.ClientDeleteOneModel{Filter: m.Filter}
+	case *mongo.DeleteManyModel:
+		return &mongo.ClientDeleteManyModel{Filter: m.Filter}
+	}
+	return nil
+}
+
+// clientWriteResult 从客户端级别 bulkWrite 的详细结果中取出第 k 个模型的结果，软删除以更新实现，修改数即删除数
+func clientWriteResult(res *mongo.ClientBulkWriteResult, k int, kind WriteKind, softDelete bool) WriteResult {
+	var w WriteResult
+	if _, ok := res.InsertResults[k]; ok {
+		w.InsertedCount = 1
+	}
+	if u, ok := res.UpdateResults[k]; ok {
+		w.MatchedCount, w.ModifiedCount = u.MatchedCount, u.ModifiedCount
+		if u.UpsertedID != nil {
+			w.UpsertedCount = 1
+		}
+	}
+	if d, ok := res.DeleteResults[k]; ok {
+		w.DeletedCount = d.DeletedCount
+	}
+	if softDelete && (kind == WriteDeleteOne || kind == WriteDeleteMany) {
+		w = WriteResult{DeletedCount: w.ModifiedCount}
+	}
+	return w
+}
+
+// writeModel 将写入操作转换为 BulkWrite 的 WriteModel，应用删除状态条件、租户和审计字段
+func (r *MongoRepo[T]) writeModel(ctx context.Context, op WriteOp[T]) (mongo.WriteModel, error) {
+	if err := op.validate(); err != nil {
+		return nil, err
+	}
+	switch op.Kind {
+	case WriteInsert:
+		if err := r.ids.stamp(ctx, op.Entity); err != nil {
+			return nil, err
+		}
+		if err := r.tenancy.stamp(ctx, op.Entity); err != nil {
+			return nil, err
+		}
+		if err := r.auditor().stampCreate(ctx, op.Entity, time.Now()); err != nil {
+			return nil, err
+		}
+		return mongo.NewInsertOneModel().SetDocument(op.Entity), nil
+	case WriteUpsert:
+		filter, update, err := r.upsertDoc(ctx, op.Entity, op.Upsert)
+		if err != nil {
+			return nil, err
+		}
+		return mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update).SetUpsert(true), nil
+	}
+
+	f, err := r.scopedFilter(ctx, op.Filter, DeletedExcluded)
+	if err != nil {
+		return nil, err
+	}
+	switch op.Kind {
+	case WriteUpdateOne, WriteUpdateMany:
+		if err = r.tenancy.checkUpdate(ctx, op.Update); err != nil {
+			return nil, err
+		}
+		if op.Kind == WriteUpdateOne {
+			return mongo.NewUpdateOneModel().SetFilter(f).SetUpdate(r.mapToUpdate(ctx, op.Update)), nil
+		}
+		return mongo.NewUpdateManyModel().SetFilter(f).SetUpdate(r.mapToUpdate(ctx, op.Update)), nil
+	case WriteReplaceOne:
+		if err = r.tenancy.stamp(ctx, op.Entity); err != nil {
+			return nil, err
+		}
+		// 以 $set 覆盖所有字段，保留原记录的 _id 和 created_at/created_by
+		set, _, err := r.splitUpsertDoc(ctx, op.Entity, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		delete(set, "_id")
+		return mongo.NewUpdateOneModel().SetFilter(f).SetUpdate(bson.M{"$set": set}), nil
+	case WriteDeleteOne:
+		if r.softDelete.enabled() {
+			return mongo.NewUpdateOneModel().SetFilter(f).SetUpdate(r.deletedUpdate(time.Now())), nil
+		}
+		return mongo.NewDeleteOneModel().SetFilter(f), nil
+	default:
+		if r.softDelete.enabled() {
+			return mongo.NewUpdateManyModel().SetFilter(f).SetUpdate(r.deletedUpdate(time.Now())), nil
+		}
+		return mongo.NewDeleteManyModel().SetFilter(f), nil
+	}
+}
+
 // buildFindOneOptions 构建 FindOne 选项
 func (r *MongoRepo[T]) buildFindOneOptions(o *FindOptions) *options.FindOneOptionsBuilder {
 	opts := options.FindOne()
@@ -185,15 +1012,55 @@ func (r *MongoRepo[T]) buildFindOneOptions(o *FindOptions) *options.FindOneOptio
 	return opts
 }
 
+// findCursor 执行查询并返回游标，batchSize 为 0 时使用驱动的默认值
+// 驱动不会为返回游标的 find 命令设置 maxTimeMS，设置 MaxTime 时改用等价的聚合管道并显式发送 maxTimeMS，
+// 服务端的时间限制作用于游标的整个生命周期（包括后续的 getMore）
+func (r *MongoRepo[T]) findCursor(ctx context.Context, filter any, o *FindOptions, batchSize int32) (*mongo.Cursor, error) {
+	coll := r.readColl(ctx, o)
+	if o.MaxTime <= 0 {
+		findOpts := r.buildFindOptions(o)
+		if batchSize > 0 {
+			findOpts.SetBatchSize(batchSize)
+		}
+		return coll.Find(ctx, filter, findOpts)
+	}
+
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: filter}}}
+	if o.Sort != nil {
+		if sort := o.Sort.ToBson(); len(sort) > 0 {
+			pipeline = append(pipeline, bson.D{{Key: "$sort", Value: sort}})
+		}
+	}
+	if o.Skip > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$skip", Value: o.Skip}})
+	}
+	if o.Limit > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: o.Limit}})
+	}
+	if len(o.ReturnFields) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$project", Value: projectionOf(o.ReturnFields)}})
+	}
+	aggOpts := options.Aggregate().SetCustom(bson.M{"maxTimeMS": max(o.MaxTime.Milliseconds(), 1)})
+	if batchSize > 0 {
+		aggOpts.SetBatchSize(batchSize)
+	}
+	return coll.Aggregate(ctx, pipeline, aggOpts)
+}
+
+// projectionOf 返回只包含指定字段的投影
+func projectionOf(fields []string) bson.M {
+	projection := bson.M{}
+	for _, f := range fields {
+		projection[f] = 1
+	}
+	return projection
+}
+
 // buildFindOptions 构建 Find 选项
 func (r *MongoRepo[T]) buildFindOptions(o *FindOptions) *options.FindOptionsBuilder {
 	opts := options.Find()
 	if len(o.ReturnFields) > 0 {
-		projection := bson.M{}
-		for _, f := range o.ReturnFields {
-			projection[f] = 1
-		}
-		opts.SetProjection(projection)
+		opts.SetProjection(projectionOf(o.ReturnFields))
 	}
 	if o.Skip > 0 {
 		opts.SetSkip(o.Skip)
@@ -208,13 +1075,86 @@ func (r *MongoRepo[T]) buildFindOptions(o *FindOptions) *options.FindOptionsBuil
 }
 
 func (r *MongoRepo[T]) incrToUpdate(incr map[string]int) bson.M {
+	inc := bson.M{}
+	for k, v := range incr {
+		inc[k] = v
+	}
+	if version := schemaFor[T]().Role(roleVersion); version != nil {
+		inc[version.BsonName] = 1
+	}
 	return bson.M{
-		"$inc": incr,
+		"$inc": inc,
+	}
+}
+
+func (r *MongoRepo[T]) mapToUpdate(ctx context.Context, update map[string]any) bson.M {
+	ret := bson.M{"$set": mergeValues(update, r.auditor().updateValues(ctx, time.Now(), bsonField))}
+	if version := schemaFor[T]().Role(roleVersion); version != nil {
+		ret["$inc"] = bson.M{version.BsonName: 1}
+	}
+	return ret
+}
+
+// splitUpsertDoc 将 create 转为 $set 文档，并拆出只在插入时写入的 created_at/created_by
+func (r *MongoRepo[T]) splitUpsertDoc(ctx context.Context, create *T, now time.Time) (bson.M, bson.M, error) {
+	audit := r.auditor()
+	if err := audit.stampCreate(ctx, create, now); err != nil {
+		return nil, nil, err
+	}
+	if err := audit.stampUpdate(ctx, create, now); err != nil {
+		return nil, nil, err
+	}
+
+	set, err := marshalDoc(create)
+	if err != nil {
+		return nil, nil, err
+	}
+	created := bson.M{}
+	for _, f := range []*fieldInfo{audit.createdAt, audit.createdBy} {
+		if f == nil {
+			continue
+		}
+		if v, ok := set[f.BsonName]; ok {
+			created[f.BsonName] = v
+			delete(set, f.BsonName)
+		}
+	}
+	return set, created, nil
+}
+
+// auditor 返回实体的审计字段
+func (r *MongoRepo[T]) auditor() auditor {
+	return auditorOf(schemaFor[T]())
+}
+
+// Restore 恢复匹配的已软删除记录
+func (r *MongoRepo[T]) Restore(ctx context.Context, filter any) (*UpdateResult, error) {
+	if !r.softDelete.enabled() {
+		return nil, ErrSoftDeleteDisabled
+	}
+	f, err := r.scopedFilter(ctx, filter, DeletedOnly)
+	if err != nil {
+		return nil, err
 	}
+	result, err := r.coll.UpdateMany(ctx, f, r.deletedUpdate(nil))
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return &UpdateResult{UpdateCount: result.ModifiedCount}, nil
+}
+
+// deletedUpdate 设置删除字段的更新文档
+func (r *MongoRepo[T]) deletedUpdate(value any) bson.M {
+	return bson.M{"$set": bson.M{r.softDelete.field.BsonName: value}}
 }
 
-func (r *MongoRepo[T]) mapToUpdate(update map[string]any) bson.M {
-	return bson.M{"$set": update}
+// scopedFilter 规范化过滤条件并合并删除状态条件和租户条件
+func (r *MongoRepo[T]) scopedFilter(ctx context.Context, filter any, scope DeletedScope) (any, error) {
+	f, err := r.tenancy.bsonFilter(ctx, r.softDelete.bsonFilter(filter, scope))
+	if err != nil {
+		return nil, err
+	}
+	return r.normalizeFilter(f), nil
 }
 
 // normalizeFilter 规范化过滤条件
@@ -225,6 +1165,32 @@ func (r *MongoRepo[T]) normalizeFilter(filter any) any {
 	return filter
 }
 
+// isEmptyFilter 判断过滤条件是否为空文档
+func isEmptyFilter(filter any) bool {
+	switch f := filter.(type) {
+	case bson.M:
+		return len(f) == 0
+	case bson.D:
+		return len(f) == 0
+	case map[string]any:
+		return len(f) == 0
+	}
+	return false
+}
+
+// marshalDoc 将实体转为 bson.M
+func marshalDoc(entity any) (bson.M, error) {
+	data, err := bson.Marshal(entity)
+	if err != nil {
+		return nil, err
+	}
+	var doc bson.M
+	if err = bson.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
 // getId 从实体中获取 _id 字段
 func getId(entity any) (any, bool) {
 	if e, ok := entity.(interface{ GetId() any }); ok {
@@ -233,3 +1199,95 @@ func getId(entity any) (any, bool) {
 
 	return nil, false
 }
+
+// resolveIndex 转换为 bson 字段名，默认索引名与驱动一致，TTL 精确到秒
+func (r *MongoRepo[T]) resolveIndex(idx Index) (Index, error) {
+	idx.TTL = idx.TTL.Truncate(time.Second)
+	return resolveIndexKeys(schemaFor[T](), idx, bsonField, mongoIndexName)
+}
+
+// listIndexes 读取集合的索引，不包括 _id 索引
+func (r *MongoRepo[T]) listIndexes(ctx context.Context) ([]Index, error) {
+	cursor, err := r.coll.Indexes().List(ctx)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	var specs []mongoIndexSpec
+	if err = cursor.All(ctx, &specs); err != nil {
+		return nil, wrapError(err)
+	}
+	indexes := make([]Index, 0, len(specs))
+	for _, spec := range specs {
+		if spec.Name != "_id_" {
+			indexes = append(indexes, spec.index())
+		}
+	}
+	return indexes, nil
+}
+
+// createIndex 创建索引
+func (r *MongoRepo[T]) createIndex(ctx context.Context, idx Index) error {
+	_, err := r.coll.Indexes().CreateOne(ctx, mongoIndexModel(idx))
+	return wrapError(err)
+}
+
+// mongoIndexModel 将索引定义转换为 IndexModel
+func mongoIndexModel(idx Index) mongo.IndexModel {
+	keys := make(bson.D, len(idx.Keys))
+	for i, k := range idx.Keys {
+		var v any = 1
+		switch {
+		case idx.Text:
+			v = "text"
+		case k.Desc:
+			v = -1
+		}
+		keys[i] = bson.E{Key: k.Field, Value: v}
+	}
+	opts := options.Index().SetName(idx.Name)
+	if idx.Unique {
+		opts.SetUnique(true)
+	}
+	if idx.TTL > 0 {
+		opts.SetExpireAfterSeconds(int32(idx.TTL / time.Second))
+	}
+	if len(idx.Partial) > 0 {
+		opts.SetPartialFilterExpression(idx.Partial)
+	}
+	return mongo.IndexModel{Keys: keys, Options: opts}
+}
+
+// mongoIndexSpec listIndexes 命令返回的索引信息
+type mongoIndexSpec struct {
+	Name                    string `bson:"name"`
+	Key                     bson.D `bson:"key"`
+	Unique                  bool   `bson:"unique"`
+	ExpireAfterSeconds      any    `bson:"expireAfterSeconds"`
+	PartialFilterExpression bson.M `bson:"partialFilterExpression"`
+	Weights                 bson.D `bson:"weights"`
+}
+
+// index 转换为索引定义，text 索引的字段取自 weights
+func (s mongoIndexSpec) index() Index {
+	idx := Index{Name: s.Name, Unique: s.Unique}
+	if len(s.PartialFilterExpression) > 0 {
+		idx.Partial = s.PartialFilterExpression
+	}
+	if secs, ok := toFloat(normalizeValue(s.ExpireAfterSeconds)); ok {
+		idx.TTL = time.Duration(secs) * time.Second
+	}
+	for _, e := range s.Key {
+		if e.Key == "_fts" || e.Key == "_ftsx" {
+			idx.Text = true
+			continue
+		}
+		n, _ := toFloat(normalizeValue(e.Value))
+		idx.Keys = append(idx.Keys, IndexKey{Field: e.Key, Desc: n < 0})
+	}
+	if idx.Text {
+		for _, w := range s.Weights {
+			idx.Keys = append(idx.Keys, IndexKey{Field: w.Key})
+		}
+	}
+	return idx
+}
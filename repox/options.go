@@ -17,3 +17,17 @@ func NewOptions[T any](opts ...IList[T]) *T {
 	}
 	return o
 }
+
+// resolvedOptions 将已合并的选项重新包装为 IList
+type resolvedOptions[T any] struct {
+	opts *T
+}
+
+// resolved 返回一个将选项整体设置为 o 的 IList
+func resolved[T any](o *T) IList[T] {
+	return resolvedOptions[T]{opts: o}
+}
+
+func (r resolvedOptions[T]) List() []func(*T) {
+	return []func(*T){func(o *T) { *o = *r.opts }}
+}
@@ -0,0 +1,54 @@
+package repox
+
+import (
+	"context"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Page 分页查询结果
+type Page[T any] struct {
+	Items []*T
+	Total int64 // 满足条件的总记录数，设置 EstimatedCountThreshold 时可能为估算值
+	Skip  int64
+	Limit int64
+}
+
+// findWithTotal 查询一页数据及总数
+// concurrent 为 true 时 Find 和 Count 并发执行，任一失败会取消另一个；
+// 在事务中连接不能并发使用，调用方需传 false 改为顺序执行
+func findWithTotal[T any](ctx context.Context, f IFinder[T], concurrent bool, filter any, opts ...IList[FindOptions]) (*Page[T], error) {
+	o := NewOptions(opts...)
+
+	// 统计总数时去掉分页、排序和投影
+	countOpts := *o
+	countOpts.Skip, countOpts.Limit, countOpts.Sort, countOpts.ReturnFields = 0, 0, nil, nil
+
+	page := &Page[T]{Skip: o.Skip, Limit: o.Limit}
+	find := func(ctx context.Context) (err error) {
+		page.Items, err = f.Find(ctx, filter, resolved(o))
+		return err
+	}
+	count := func(ctx context.Context) (err error) {
+		page.Total, err = f.Count(ctx, filter, resolved(&countOpts))
+		return err
+	}
+
+	if !concurrent {
+		if err := find(ctx); err != nil {
+			return nil, err
+		}
+		if err := count(ctx); err != nil {
+			return nil, err
+		}
+		return page, nil
+	}
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.Go(func() error { return find(gctx) })
+	g.Go(func() error { return count(gctx) })
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
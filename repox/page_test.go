@@ -0,0 +1,82 @@
+package repox
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestFindWithTotal_Memory(t *testing.T) {
+	ctx := context.Background()
+	repo := newMemUsers(t)
+
+	page, err := repo.FindWithTotal(ctx, bson.M{"age": bson.M{"$gte": 25}},
+		Find().SetSort(NewSort().Asc("name")).SetSkip(1).SetLimit(1))
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), page.Total)
+	assert.Equal(t, int64(1), page.Skip)
+	assert.Equal(t, int64(1), page.Limit)
+	require.Len(t, page.Items, 1)
+	assert.Equal(t, "carol", page.Items[0].Name)
+
+	count, err := repo.Count(ctx, nil, Find().SetSkip(1).SetLimit(2))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = repo.FindWithTotal(cctx, nil)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestFindWithTotal_Gorm(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.MatchExpectationsInOrder(false)
+	repo := NewGormRepo[txUser](db)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `tx_users` WHERE `tx_users`.`name` = ? LIMIT ? OFFSET ?")).
+		WithArgs("bob", 2, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(3, "bob").AddRow(4, "bob"))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(`id`) FROM `tx_users` WHERE `tx_users`.`name` = ?")).
+		WithArgs("bob").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(7))
+
+	page, err := repo.FindWithTotal(context.Background(), map[string]any{"name": "bob"}, Find().SetSkip(2).SetLimit(2))
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), page.Total)
+	assert.Len(t, page.Items, 2)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCount_GormOptions(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewGormRepo[txUser](db)
+	ctx := context.Background()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT count(*) FROM (SELECT `id` FROM `tx_users` WHERE `tx_users`.`name` = ? LIMIT ? OFFSET ?) AS t")).
+		WithArgs("bob", 5, 10).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(5))
+	count, err := repo.Count(ctx, map[string]any{"name": "bob"}, Find().SetSkip(10).SetLimit(5))
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), count)
+
+	mock.ExpectQuery(regexp.QuoteMeta("EXPLAIN SELECT * FROM `tx_users`")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "table", "rows"}).AddRow(1, "tx_users", 2000000))
+	count, err = repo.Count(ctx, nil, Find().SetEstimatedCountThreshold(100000))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2000000), count)
+
+	mock.ExpectQuery(regexp.QuoteMeta("EXPLAIN SELECT * FROM `tx_users`")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "table", "rows"}).AddRow(1, "tx_users", 10))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(`id`) FROM `tx_users`")).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(12))
+	count, err = repo.Count(ctx, nil, Find().SetEstimatedCountThreshold(100000))
+	require.NoError(t, err)
+	assert.Equal(t, int64(12), count)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,85 @@
+package repox
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.mongodb.org/mongo-driver/v2/mongo/readpref"
+	gormmysql "gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+func TestReadMode_Gorm(t *testing.T) {
+	db, source := newMockDB(t)
+	replicaDB, replica, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = replicaDB.Close() })
+	require.NoError(t, db.Use(dbresolver.Register(dbresolver.Config{
+		Replicas: []gorm.Dialector{gormmysql.New(gormmysql.Config{Conn: replicaDB, SkipInitializeWithVersion: true})},
+	})))
+	repo := NewGormRepo[claimJob](db)
+	ctx := context.Background()
+	rows := func() *sqlmock.Rows { return sqlmock.NewRows([]string{"id", "status"}).AddRow(1, "done") }
+
+	// 默认读取从库，ReadFromPrimary 读取主库
+	replica.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `claim_jobs`")).WillReturnRows(rows())
+	_, err = repo.Find(ctx, nil)
+	require.NoError(t, err)
+	source.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `claim_jobs`")).WillReturnRows(rows())
+	_, err = repo.FindOne(ctx, nil, Find().ReadFromPrimary())
+	require.NoError(t, err)
+	source.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(`id`) FROM `claim_jobs`")).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	_, err = repo.Count(ctx, nil, Find().ReadFromPrimary())
+	require.NoError(t, err)
+	source.ExpectQuery(regexp.QuoteMeta("SELECT count(*) FROM (SELECT `id` FROM `claim_jobs` LIMIT ?) AS t")).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	_, err = repo.Count(ctx, nil, Find().SetLimit(10).ReadFromPrimary())
+	require.NoError(t, err)
+	source.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `claim_jobs`")).WillReturnRows(rows())
+	for _, err := range repo.Iterate(ctx, nil, Find().ReadFromPrimary()) {
+		require.NoError(t, err)
+	}
+	replica.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `claim_jobs`")).WillReturnRows(rows())
+	_, err = repo.Find(ctx, nil, Find().ReadFromReplica(time.Minute))
+	require.NoError(t, err)
+
+	assert.NoError(t, source.ExpectationsWereMet())
+	assert.NoError(t, replica.ExpectationsWereMet())
+}
+
+func TestReadMode_MongoOptions(t *testing.T) {
+	apply := func(o *FindOptions) *options.CollectionOptions {
+		co, ok := mongoReadOptions(o)
+		if !ok {
+			return nil
+		}
+		ret := &options.CollectionOptions{}
+		for _, set := range co.List() {
+			require.NoError(t, set(ret))
+		}
+		return ret
+	}
+
+	assert.Nil(t, apply(NewOptions[FindOptions]()))
+
+	co := apply(NewOptions(Find().ReadFromPrimary()))
+	assert.Equal(t, readpref.PrimaryMode, co.ReadPreference.Mode())
+	assert.Nil(t, co.ReadConcern)
+
+	co = apply(NewOptions(Find().ReadFromReplica(2 * time.Minute).SetReadConcern(ReadConcernMajority)))
+	assert.Equal(t, readpref.SecondaryPreferredMode, co.ReadPreference.Mode())
+	staleness, ok := co.ReadPreference.MaxStaleness()
+	assert.True(t, ok)
+	assert.Equal(t, 2*time.Minute, staleness)
+	assert.Equal(t, "majority", co.ReadConcern.Level)
+
+	co = apply(NewOptions(Find().SetReadConcern(ReadConcernLocal)))
+	assert.Nil(t, co.ReadPreference)
+	assert.Equal(t, "local", co.ReadConcern.Level)
+}
@@ -0,0 +1,273 @@
+package repox
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	gormschema "gorm.io/gorm/schema"
+)
+
+// fieldInfo 实体字段信息
+type fieldInfo struct {
+	Name     string // Go 字段名
+	Column   string // 通用字段名：bson 名优先，其次 gorm column，最后按 gorm 命名策略转换
+	BsonName string // MongoDB 字段名：bson tag，未指定时为小写的 Go 字段名
+	GormName string // SQL 列名：gorm column tag，未指定时按 gorm 命名策略转换
+	Index    []int
+	Type     reflect.Type
+	Primary  bool
+	Roles    []string // repox tag 声明的字段用途，如 version
+}
+
+// entitySchema 实体结构信息，通过 struct tag 解析并缓存
+type entitySchema struct {
+	Type    reflect.Type
+	Fields  []*fieldInfo
+	Primary *fieldInfo
+
+	byName map[string]*fieldInfo
+	byRole map[string]*fieldInfo
+}
+
+var (
+	schemaCache  sync.Map
+	namingPolicy = gormschema.NamingStrategy{}
+)
+
+// schemaFor 获取实体类型 T 的结构信息
+func schemaFor[T any]() *entitySchema {
+	return schemaOf(reflect.TypeFor[T]())
+}
+
+// schemaOf 获取类型的结构信息，指针类型取其元素类型
+func schemaOf(typ reflect.Type) *entitySchema {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if s, ok := schemaCache.Load(typ); ok {
+		return s.(*entitySchema)
+	}
+
+	s := &entitySchema{Type: typ, byName: make(map[string]*fieldInfo), byRole: make(map[string]*fieldInfo)}
+	if typ.Kind() == reflect.Struct {
+		s.parseFields(typ, nil)
+	}
+	s.index()
+	actual, _ := schemaCache.LoadOrStore(typ, s)
+	return actual.(*entitySchema)
+}
+
+// parseFields 解析结构体字段，匿名嵌入的结构体字段会被展开
+func (s *entitySchema) parseFields(typ reflect.Type, parent []int) {
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		index := append(append([]int{}, parent...), i)
+
+		bsonName, bsonInline := parseBsonTag(sf.Tag.Get("bson"))
+		gormTag := parseGormTag(sf.Tag.Get("gorm"))
+		if bsonName == "-" || gormTag["-"] != "" {
+			continue
+		}
+
+		ft := sf.Type
+		if sf.Anonymous && (bsonInline || bsonName == "") && gormTag["column"] == "" {
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct && !isScalarStruct(ft) {
+				s.parseFields(ft, index)
+				continue
+			}
+		}
+
+		f := &fieldInfo{
+			Name:     sf.Name,
+			BsonName: bsonName,
+			GormName: gormTag["column"],
+			Index:    index,
+			Type:     sf.Type,
+			Roles:    parseRepoxTag(sf.Tag.Get("repox")),
+		}
+		if f.BsonName == "" {
+			f.BsonName = strings.ToLower(sf.Name)
+		}
+		if f.GormName == "" {
+			f.GormName = namingPolicy.ColumnName("", sf.Name)
+		}
+		f.Column = f.GormName
+		if bsonName != "" {
+			f.Column = bsonName
+		}
+		_, gormPrimary := gormTag["primarykey"]
+		_, gormPrimary2 := gormTag["primary_key"]
+		f.Primary = bsonName == "_id" || gormPrimary || gormPrimary2
+		s.Fields = append(s.Fields, f)
+	}
+}
+
+// index 建立名称索引并确定主键
+func (s *entitySchema) index() {
+	for _, f := range s.Fields {
+		if f.Primary && s.Primary == nil {
+			s.Primary = f
+		}
+	}
+	if s.Primary == nil {
+		for _, f := range s.Fields {
+			if f.Name == "ID" || f.Name == "Id" {
+				f.Primary = true
+				s.Primary = f
+				break
+			}
+		}
+	}
+
+	add := func(name string, f *fieldInfo) {
+		if name == "" {
+			return
+		}
+		if _, ok := s.byName[name]; !ok {
+			s.byName[name] = f
+		}
+	}
+	for _, f := range s.Fields {
+		add(f.Column, f)
+	}
+	for _, f := range s.Fields {
+		add(f.GormName, f)
+		add(f.BsonName, f)
+		add(f.Name, f)
+	}
+	if s.Primary != nil {
+		add("_id", s.Primary)
+		add("id", s.Primary)
+	}
+
+	for _, f := range s.Fields {
+		for _, role := range f.Roles {
+			if _, ok := s.byRole[role]; !ok {
+				s.byRole[role] = f
+			}
+		}
+	}
+}
+
+// Field 按字段名（数据库字段名、snake_case 或 Go 字段名）查找字段
+func (s *entitySchema) Field(name string) (*fieldInfo, bool) {
+	f, ok := s.byName[name]
+	return f, ok
+}
+
+// PrimaryValue 获取实体的主键值，实体没有主键字段时尝试 GetId 方法
+func (s *entitySchema) PrimaryValue(entity any) (any, bool) {
+	if s.Primary != nil {
+		if id, ok := s.Primary.Value(reflect.ValueOf(entity)); ok {
+			return id, true
+		}
+	}
+	return getId(entity)
+}
+
+// SetFields 按字段名设置实体字段，v 为结构体或结构体指针
+func (s *entitySchema) SetFields(v reflect.Value, values map[string]any) error {
+	for k, val := range values {
+		f, ok := s.Field(k)
+		if !ok {
+			return fmt.Errorf("repox: unknown field %s of %s", k, s.Type)
+		}
+		fv, ok := f.reflectValue(v, true)
+		if !ok {
+			return fmt.Errorf("repox: field %s of %s is not addressable", k, s.Type)
+		}
+		if err := assignValue(fv, val); err != nil {
+			return fmt.Errorf("repox: set field %s: %w", k, err)
+		}
+	}
+	return nil
+}
+
+// Role 返回 repox tag 声明为指定用途的字段，不存在时返回 nil
+func (s *entitySchema) Role(role string) *fieldInfo {
+	return s.byRole[role]
+}
+
+// Value 获取实体中字段的值，v 为结构体或结构体指针
+func (f *fieldInfo) Value(v reflect.Value) (any, bool) {
+	fv, ok := f.reflectValue(v, false)
+	if !ok {
+		return nil, false
+	}
+	return fv.Interface(), true
+}
+
+// reflectValue 获取字段的 reflect.Value，alloc 为 true 时为 nil 的嵌入指针分配内存
+func (f *fieldInfo) reflectValue(v reflect.Value, alloc bool) (reflect.Value, bool) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return reflect.Value{}, false
+		}
+		v = v.Elem()
+	}
+	for i, idx := range f.Index {
+		if i > 0 {
+			for v.Kind() == reflect.Ptr {
+				if v.IsNil() {
+					if !alloc || !v.CanSet() {
+						return reflect.Value{}, false
+					}
+					v.Set(reflect.New(v.Type().Elem()))
+				}
+				v = v.Elem()
+			}
+		}
+		v = v.Field(idx)
+	}
+	return v, true
+}
+
+// parseBsonTag 解析 bson tag，返回字段名和是否 inline
+func parseBsonTag(tag string) (string, bool) {
+	parts := strings.Split(tag, ",")
+	inline := false
+	for _, p := range parts[1:] {
+		if p == "inline" {
+			inline = true
+		}
+	}
+	return parts[0], inline
+}
+
+// parseRepoxTag 解析 repox tag，多个用途以逗号分隔
+func parseRepoxTag(tag string) []string {
+	var roles []string
+	for _, p := range strings.Split(tag, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			roles = append(roles, p)
+		}
+	}
+	return roles
+}
+
+// parseGormTag 解析 gorm tag，key 统一转为小写
+func parseGormTag(tag string) map[string]string {
+	settings := gormschema.ParseTagSetting(tag, ";")
+	ret := make(map[string]string, len(settings))
+	for k, v := range settings {
+		if v == "" {
+			v = k
+		}
+		ret[strings.ToLower(k)] = v
+	}
+	return ret
+}
+
+// isScalarStruct 判断结构体是否应被视为单个值（如 time.Time）
+func isScalarStruct(typ reflect.Type) bool {
+	return typ.PkgPath() == "time" || typ.PkgPath() == "database/sql" ||
+		reflect.PointerTo(typ).Implements(scannerType)
+}
@@ -0,0 +1,75 @@
+package repox
+
+import (
+	"errors"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"gorm.io/gorm/clause"
+)
+
+var ErrSoftDeleteDisabled = errors.New("soft delete is not enabled")
+
+// defaultSoftDeleteField 默认的软删除字段
+const defaultSoftDeleteField = "deleted_at"
+
+// DeletedScope 已软删除记录的查询范围
+type DeletedScope int
+
+const (
+	DeletedExcluded DeletedScope = iota // 排除已删除的记录
+	DeletedIncluded                     // 包含已删除的记录
+	DeletedOnly                         // 只查询已删除的记录
+)
+
+// softDelete 仓库的软删除配置，field 为 nil 表示未启用
+type softDelete struct {
+	field *fieldInfo
+}
+
+// newSoftDelete 根据仓库配置解析软删除字段，字段不在实体中时按原名使用
+func newSoftDelete(schema *entitySchema, o *RepoOptions) softDelete {
+	if o.SoftDeleteField == "" {
+		return softDelete{}
+	}
+	if f, ok := schema.Field(o.SoftDeleteField); ok {
+		return softDelete{field: f}
+	}
+	name := o.SoftDeleteField
+	return softDelete{field: &fieldInfo{Name: name, Column: name, BsonName: name, GormName: name}}
+}
+
+func (s softDelete) enabled() bool {
+	return s.field != nil
+}
+
+// gormCond 返回 SQL 中限定删除状态的条件，不需要限定时返回 nil
+func (s softDelete) gormCond(scope DeletedScope) clause.Expression {
+	if !s.enabled() {
+		return nil
+	}
+	col := clause.Column{Name: s.field.GormName}
+	switch scope {
+	case DeletedExcluded:
+		return clause.Eq{Column: col, Value: nil}
+	case DeletedOnly:
+		return clause.Neq{Column: col, Value: nil}
+	}
+	return nil
+}
+
+// bsonFilter 将删除状态条件合并到 bson 过滤条件，不需要限定时原样返回 filter
+func (s softDelete) bsonFilter(filter any, scope DeletedScope) any {
+	if !s.enabled() || scope == DeletedIncluded {
+		return filter
+	}
+	var cond bson.M
+	if scope == DeletedOnly {
+		cond = bson.M{s.field.BsonName: bson.M{"$ne": nil}}
+	} else {
+		cond = bson.M{s.field.BsonName: nil}
+	}
+	if filter == nil || isEmptyFilter(filter) {
+		return cond
+	}
+	return bson.M{"$and": bson.A{filter, cond}}
+}
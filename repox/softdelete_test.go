@@ -0,0 +1,106 @@
+package repox
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"gorm.io/gorm"
+)
+
+type sdUser struct {
+	Id        int64 `gorm:"primaryKey"`
+	Name      string
+	DeletedAt gorm.DeletedAt
+}
+
+func TestSoftDelete_Memory(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo[memUser](Options().SetSoftDelete(""))
+	require.NoError(t, repo.CreateMany(ctx, []*memUser{
+		{Name: "alice", Age: 20},
+		{Name: "bob", Age: 30},
+		{Name: "carol", Age: 30},
+	}))
+
+	res, err := repo.DeleteMany(ctx, bson.M{"age": 30})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), res.DeleteCount)
+
+	count, err := repo.Count(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+
+	_, err = repo.FindOne(ctx, bson.M{"name": "bob"})
+	assert.ErrorIs(t, err, DataNotFound)
+
+	all, err := repo.Find(ctx, nil, Find().WithDeleted())
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+
+	deleted, err := repo.Find(ctx, nil, Find().OnlyDeleted().SetSort(NewSort().Asc("name")))
+	require.NoError(t, err)
+	require.Len(t, deleted, 2)
+	assert.NotNil(t, deleted[0].DeletedAt)
+
+	// 已删除的记录不会被更新或重复删除
+	upd, err := repo.UpdateMany(ctx, nil, map[string]any{"age": 40})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), upd.UpdateCount)
+	res, err = repo.DeleteOne(ctx, bson.M{"name": "bob"})
+	require.NoError(t, err)
+	assert.Zero(t, res.DeleteCount)
+
+	upd, err = repo.Restore(ctx, bson.M{"name": "bob"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), upd.UpdateCount)
+	bob, err := repo.FindOne(ctx, bson.M{"name": "bob"})
+	require.NoError(t, err)
+	assert.Nil(t, bob.DeletedAt)
+	assert.Equal(t, 30, bob.Age)
+
+	_, err = NewMemoryRepo[memUser]().Restore(ctx, nil)
+	assert.ErrorIs(t, err, ErrSoftDeleteDisabled)
+}
+
+func TestSoftDelete_Gorm(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewGormRepo[sdUser](db, Options().SetSoftDelete("DeletedAt"))
+	ctx := context.Background()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `sd_users` WHERE `sd_users`.`name` = ? AND `deleted_at` IS NULL")).
+		WithArgs("bob").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "bob"))
+	_, err := repo.Find(ctx, map[string]any{"name": "bob"})
+	require.NoError(t, err)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `sd_users` WHERE `deleted_at` IS NOT NULL")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}))
+	_, err = repo.Find(ctx, nil, Find().OnlyDeleted())
+	require.NoError(t, err)
+
+	// WithDeleted 不附加任何删除条件，包括 GORM 自带的 DeletedAt 作用域
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `sd_users`") + "$").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}))
+	_, err = repo.Find(ctx, nil, Find().WithDeleted())
+	require.NoError(t, err)
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `sd_users` SET `deleted_at`=? WHERE `sd_users`.`name` = ? AND `deleted_at` IS NULL LIMIT ?")).
+		WithArgs(sqlmock.AnyArg(), "bob", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	res, err := repo.DeleteOne(ctx, map[string]any{"name": "bob"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), res.DeleteCount)
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `sd_users` SET `deleted_at`=? WHERE `sd_users`.`name` = ? AND `deleted_at` IS NOT NULL")).
+		WithArgs(nil, "bob").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	upd, err := repo.Restore(ctx, map[string]any{"name": "bob"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), upd.UpdateCount)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
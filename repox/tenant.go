@@ -0,0 +1,174 @@
+package repox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrTenantRequired = errors.New("tenant is required")
+	ErrTenantMismatch = errors.New("tenant mismatch")
+)
+
+// defaultTenantField 默认的租户字段
+const defaultTenantField = "tenant_id"
+
+// TenantExtractor 从 ctx 中获取当前租户，ok 为 false 表示 ctx 中没有租户
+type TenantExtractor func(ctx context.Context) (tenant any, ok bool)
+
+type tenantKey struct{}
+
+type crossTenantKey struct{}
+
+// WithTenant 在 ctx 中携带当前租户，配合默认的 TenantFromContext 使用
+func WithTenant(ctx context.Context, tenant any) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext 获取 WithTenant 携带的租户，是仓库默认的租户提取器
+func TenantFromContext(ctx context.Context) (any, bool) {
+	tenant := ctx.Value(tenantKey{})
+	return tenant, tenant != nil
+}
+
+// CrossTenant 返回跳过租户隔离的 ctx，仅用于后台任务、运营工具等明确需要跨租户访问的场景
+// 使用该 ctx 时不追加租户条件，创建时也不写入租户字段
+func CrossTenant(ctx context.Context) context.Context {
+	return context.WithValue(ctx, crossTenantKey{}, true)
+}
+
+// IsCrossTenant 判断 ctx 是否跳过租户隔离
+func IsCrossTenant(ctx context.Context) bool {
+	cross, _ := ctx.Value(crossTenantKey{}).(bool)
+	return cross
+}
+
+// tenancy 仓库的租户隔离配置，field 为 nil 表示未启用
+type tenancy struct {
+	field   *fieldInfo
+	extract TenantExtractor
+}
+
+// newTenancy 根据仓库配置解析租户字段，字段不在实体中时按原名使用（此时无法写入实体）
+func newTenancy(schema *entitySchema, o *RepoOptions) tenancy {
+	if o.TenantField == "" {
+		return tenancy{}
+	}
+	extract := o.TenantExtractor
+	if extract == nil {
+		extract = TenantFromContext
+	}
+	if f, ok := schema.Field(o.TenantField); ok {
+		return tenancy{field: f, extract: extract}
+	}
+	name := o.TenantField
+	return tenancy{field: &fieldInfo{Name: name, Column: name, BsonName: name, GormName: name}, extract: extract}
+}
+
+func (t tenancy) enabled() bool {
+	return t.field != nil
+}
+
+// current 返回 ctx 的当前租户；未启用或跨租户访问时 scoped 为 false，缺少租户时返回 ErrTenantRequired
+func (t tenancy) current(ctx context.Context) (tenant any, scoped bool, err error) {
+	if !t.enabled() || IsCrossTenant(ctx) {
+		return nil, false, nil
+	}
+	tenant, ok := t.extract(ctx)
+	if !ok || tenant == nil {
+		return nil, false, ErrTenantRequired
+	}
+	return tenant, true, nil
+}
+
+// gormCond 返回 SQL 中限定当前租户的条件，不需要限定时返回 nil
+func (t tenancy) gormCond(ctx context.Context) (clause.Expression, error) {
+	tenant, scoped, err := t.current(ctx)
+	if err != nil || !scoped {
+		return nil, err
+	}
+	return clause.Eq{Column: clause.Column{Name: t.field.GormName}, Value: tenant}, nil
+}
+
+// bsonFilter 将当前租户条件合并到 bson 过滤条件，不需要限定时原样返回 filter
+func (t tenancy) bsonFilter(ctx context.Context, filter any) (any, error) {
+	tenant, scoped, err := t.current(ctx)
+	if err != nil || !scoped {
+		return filter, err
+	}
+	cond := bson.M{t.field.BsonName: tenant}
+	if filter == nil || isEmptyFilter(filter) {
+		return cond, nil
+	}
+	return bson.M{"$and": bson.A{filter, cond}}, nil
+}
+
+// stamp 为写入的实体设置当前租户，实体已属于其它租户时返回 ErrTenantMismatch
+func (t tenancy) stamp(ctx context.Context, entity any) error {
+	tenant, scoped, err := t.current(ctx)
+	if err != nil || !scoped {
+		return err
+	}
+	if t.field.Index == nil {
+		return fmt.Errorf("repox: tenant field %s is not declared on %T", t.field.Name, entity)
+	}
+	fv, ok := t.field.reflectValue(reflect.ValueOf(entity), true)
+	if !ok {
+		return fmt.Errorf("repox: tenant field %s is not addressable", t.field.Name)
+	}
+	if !fv.IsZero() {
+		if !equalValues(fv.Interface(), tenant) {
+			return ErrTenantMismatch
+		}
+		return nil
+	}
+	if err = assignValue(fv, tenant); err != nil {
+		return fmt.Errorf("repox: set tenant field %s: %w", t.field.Name, err)
+	}
+	return nil
+}
+
+// checkUpdate 更新内容把租户字段改为其它租户时返回 ErrTenantMismatch
+func (t tenancy) checkUpdate(ctx context.Context, update map[string]any) error {
+	tenant, scoped, err := t.current(ctx)
+	if err != nil || !scoped {
+		return err
+	}
+	for k, v := range update {
+		if t.isField(k) && !equalValues(v, tenant) {
+			return ErrTenantMismatch
+		}
+	}
+	return nil
+}
+
+// withTenant 返回附加当前租户的冲突字段，用于 upsert 时限定在当前租户内匹配，name 决定使用的字段名
+func (t tenancy) withTenant(ctx context.Context, kvs map[string]any, name func(*fieldInfo) string) (map[string]any, error) {
+	tenant, scoped, err := t.current(ctx)
+	if err != nil || !scoped {
+		return kvs, err
+	}
+	ret := make(map[string]any, len(kvs)+1)
+	for k, v := range kvs {
+		if t.isField(k) {
+			if !equalValues(v, tenant) {
+				return nil, ErrTenantMismatch
+			}
+			continue
+		}
+		ret[k] = v
+	}
+	ret[name(t.field)] = tenant
+	return ret, nil
+}
+
+// isField 判断字段名是否指向租户字段
+func (t tenancy) isField(name string) bool {
+	f := t.field
+	return name == f.Name || name == f.Column || name == f.BsonName || name == f.GormName
+}
@@ -0,0 +1,141 @@
+package repox
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+type tenantDoc struct {
+	Id       int64  `bson:"_id" gorm:"primaryKey"`
+	TenantId string `bson:"tenant_id"`
+	Title    string `bson:"title"`
+}
+
+func TestTenant_Memory(t *testing.T) {
+	repo := NewMemoryRepo[tenantDoc](Options().SetTenant("", nil))
+	a := WithTenant(context.Background(), "a")
+	b := WithTenant(context.Background(), "b")
+
+	require.NoError(t, repo.CreateMany(a, []*tenantDoc{{Title: "a1"}, {Title: "a2"}}))
+	require.NoError(t, repo.Create(b, &tenantDoc{Title: "b1"}))
+	assert.ErrorIs(t, repo.Create(a, &tenantDoc{TenantId: "b", Title: "x"}), ErrTenantMismatch)
+
+	items, err := repo.Find(a, nil)
+	require.NoError(t, err)
+	assert.Len(t, items, 2)
+	assert.Equal(t, "a", items[0].TenantId)
+	_, err = repo.FindOne(a, bson.M{"_id": 3})
+	assert.ErrorIs(t, err, DataNotFound)
+
+	// 缺少租户时直接报错，CrossTenant 可以访问所有租户
+	_, err = repo.Find(context.Background(), nil)
+	assert.ErrorIs(t, err, ErrTenantRequired)
+	assert.ErrorIs(t, repo.Create(context.Background(), &tenantDoc{}), ErrTenantRequired)
+	n, err := repo.Count(CrossTenant(context.Background()), nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+
+	res, err := repo.UpdateMany(b, nil, map[string]any{"title": "changed"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), res.UpdateCount)
+	_, err = repo.UpdateOne(b, bson.M{"_id": 3}, map[string]any{"tenant_id": "a"})
+	assert.ErrorIs(t, err, ErrTenantMismatch)
+
+	// 其它租户的记录按主键更新和删除都不会生效
+	require.NoError(t, repo.Update(b, &tenantDoc{Id: 1, Title: "hijack"}))
+	del, err := repo.DeleteMany(b, bson.M{"_id": 1})
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), del.DeleteCount)
+	got, err := repo.FindOne(a, bson.M{"_id": 1})
+	require.NoError(t, err)
+	assert.Equal(t, "a1", got.Title)
+
+	// upsert 只在当前租户内匹配
+	require.NoError(t, repo.UpsertOne(b, tenantDoc{}, UpsertOptions{
+		ConflictKvs: map[string]any{"title": "a1"},
+		Set:         map[string]any{"title": "a1"},
+	}))
+	n, err = repo.Count(a, bson.M{"title": "a1"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	n, err = repo.Count(b, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+}
+
+func TestTenant_Extractor(t *testing.T) {
+	type orgKey struct{}
+	repo := NewMemoryRepo[tenantDoc](Options().SetTenant("TenantId", func(ctx context.Context) (any, bool) {
+		org, ok := ctx.Value(orgKey{}).(string)
+		return org, ok && org != ""
+	}))
+	ctx := context.WithValue(context.Background(), orgKey{}, "org1")
+
+	doc := &tenantDoc{Title: "t"}
+	require.NoError(t, repo.Create(ctx, doc))
+	assert.Equal(t, "org1", doc.TenantId)
+	_, err := repo.Find(WithTenant(context.Background(), "org1"), nil)
+	assert.ErrorIs(t, err, ErrTenantRequired)
+}
+
+func TestTenant_Gorm(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewGormRepo[tenantDoc](db, Options().SetTenant("", nil))
+	ctx := WithTenant(context.Background(), "a")
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `tenant_docs` WHERE `tenant_docs`.`title` = ? AND `tenant_id` = ?")).
+		WithArgs("x", "a").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "tenant_id", "title"}).AddRow(1, "a", "x"))
+	_, err := repo.Find(ctx, map[string]any{"title": "x"})
+	require.NoError(t, err)
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `tenant_docs` SET `title`=? WHERE `tenant_docs`.`id` = ? AND `tenant_id` = ?")).
+		WithArgs("y", 1, "a").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	_, err = repo.UpdateMany(ctx, map[string]any{"id": 1}, map[string]any{"title": "y"})
+	require.NoError(t, err)
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `tenant_docs` WHERE `tenant_docs`.`id` = ? AND `tenant_id` = ?")).
+		WithArgs(1, "a").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	_, err = repo.DeleteMany(ctx, map[string]any{"id": 1})
+	require.NoError(t, err)
+
+	// 缺少租户时不会执行 SQL
+	_, err = repo.Find(context.Background(), nil)
+	assert.ErrorIs(t, err, ErrTenantRequired)
+	_, err = repo.Count(context.Background(), nil)
+	assert.ErrorIs(t, err, ErrTenantRequired)
+	_, err = repo.UpdateMany(context.Background(), nil, map[string]any{"title": "z"})
+	assert.ErrorIs(t, err, ErrTenantRequired)
+	_, err = repo.DeleteOne(context.Background(), map[string]any{"id": 1})
+	assert.ErrorIs(t, err, ErrTenantRequired)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTenant_MongoFilter(t *testing.T) {
+	repo := NewMongoRepo[tenantDoc](nil, Options().SetTenant("", nil).SetSoftDelete(""))
+	ctx := WithTenant(context.Background(), "a")
+
+	f, err := repo.scopedFilter(ctx, bson.M{"title": "x"}, DeletedExcluded)
+	require.NoError(t, err)
+	assert.Equal(t, bson.M{"$and": bson.A{
+		bson.M{"$and": bson.A{bson.M{"title": "x"}, bson.M{"deleted_at": nil}}},
+		bson.M{"tenant_id": "a"},
+	}}, f)
+
+	f, err = repo.scopedFilter(CrossTenant(ctx), nil, DeletedIncluded)
+	require.NoError(t, err)
+	assert.Equal(t, bson.M{}, f)
+
+	_, err = repo.scopedFilter(context.Background(), nil, DeletedIncluded)
+	assert.ErrorIs(t, err, ErrTenantRequired)
+	_, err = repo.FindOne(context.Background(), nil)
+	assert.ErrorIs(t, err, ErrTenantRequired)
+}
@@ -0,0 +1,104 @@
+package repox
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"gorm.io/gorm"
+)
+
+const (
+	// maxTxAttempts GORM 事务遇到临时错误时的最大尝试次数
+	maxTxAttempts = 3
+	// txRetryBackoff GORM 事务重试的基础退避时间
+	txRetryBackoff = 20 * time.Millisecond
+)
+
+type gormTxKey struct{}
+
+// gormTx ctx 中携带的 GORM 事务
+type gormTx struct {
+	pool gorm.ConnPool // 事务所属数据库的连接池，用于判断事务是否属于同一个数据库
+	tx   *gorm.DB
+}
+
+// WithTx 在 GORM 事务中执行 fn，fn 内使用传入的 ctx 调用 GormRepo 方法时会自动加入该事务
+// ctx 中已有同一数据库的事务时，通过 savepoint 嵌套执行，fn 出错只回滚到 savepoint
+// 最外层事务遇到死锁、锁等待超时、序列化失败等临时错误时会整体重试，因此 fn 需要可重复执行
+func WithTx(ctx context.Context, db *gorm.DB, fn func(ctx context.Context) error, opts ...*sql.TxOptions) error {
+	if outer, ok := gormTxFromContext(ctx, db); ok {
+		return outer.Transaction(func(tx *gorm.DB) error {
+			return fn(withGormTx(ctx, tx))
+		})
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return fn(withGormTx(ctx, tx))
+		}, opts...)
+		if err == nil || attempt >= maxTxAttempts || !isTransientTxError(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(attempt) * txRetryBackoff):
+		}
+	}
+}
+
+// WithMongoTx 在 MongoDB 事务中执行 fn，fn 内使用传入的 ctx 调用 MongoRepo 方法时会自动加入该事务
+// ctx 中已有事务时直接加入外层事务（MongoDB 不支持 savepoint）
+// TransientTransactionError 和 UnknownTransactionCommitResult 由驱动自动重试，因此 fn 需要可重复执行
+func WithMongoTx(ctx context.Context, client *mongo.Client, fn func(ctx context.Context) error, opts ...options.Lister[options.TransactionOptions]) error {
+	if mongo.SessionFromContext(ctx) != nil {
+		return fn(ctx)
+	}
+
+	sess, err := client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer sess.EndSession(context.WithoutCancel(ctx))
+
+	_, err = sess.WithTransaction(ctx, func(ctx context.Context) (any, error) {
+		return nil, fn(ctx)
+	}, opts...)
+	return wrapError(err)
+}
+
+// gormTxFromContext 获取 ctx 中属于 db 的事务
+func gormTxFromContext(ctx context.Context, db *gorm.DB) (*gorm.DB, bool) {
+	v, ok := ctx.Value(gormTxKey{}).(gormTx)
+	if !ok || v.pool != db.Config.ConnPool {
+		return nil, false
+	}
+	return v.tx, true
+}
+
+func withGormTx(ctx context.Context, tx *gorm.DB) context.Context {
+	return context.WithValue(ctx, gormTxKey{}, gormTx{pool: tx.Config.ConnPool, tx: tx})
+}
+
+// isTransientTxError 判断是否为可重试的事务错误
+func isTransientTxError(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		// 1213: 死锁；1205: 锁等待超时
+		return mysqlErr.Number == 1213 || mysqlErr.Number == 1205
+	}
+
+	var pgErr interface{ SQLState() string }
+	if errors.As(err, &pgErr) {
+		// 40001: 序列化失败；40P01: 死锁
+		return pgErr.SQLState() == "40001" || pgErr.SQLState() == "40P01"
+	}
+	return false
+}
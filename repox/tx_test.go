@@ -0,0 +1,102 @@
+package repox
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	gormmysql "gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type txUser struct {
+	Id   int64 `gorm:"primaryKey"`
+	Name string
+}
+
+func newMockDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	t.Helper()
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	db, err := gorm.Open(gormmysql.New(gormmysql.Config{
+		Conn:                      sqlDB,
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{SkipDefaultTransaction: true, Logger: logger.Discard})
+	require.NoError(t, err)
+	return db, mock
+}
+
+func TestWithTx_JoinAndSavepoint(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewGormRepo[txUser](db)
+	ctx := context.Background()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `tx_users`")).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("SAVEPOINT sp").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `tx_users`")).WillReturnError(errors.New("boom"))
+	mock.ExpectExec("ROLLBACK TO SAVEPOINT sp").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	err := WithTx(ctx, db, func(ctx context.Context) error {
+		if err := repo.Create(ctx, &txUser{Name: "a"}); err != nil {
+			return err
+		}
+		nestedErr := WithTx(ctx, db, func(ctx context.Context) error {
+			return repo.Create(ctx, &txUser{Name: "b"})
+		})
+		assert.Error(t, nestedErr)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWithTx_RetryTransient(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewGormRepo[txUser](db)
+	ctx := context.Background()
+
+	deadlock := &mysql.MySQLError{Number: 1213, Message: "Deadlock found"}
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `tx_users`")).WillReturnError(deadlock)
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `tx_users`")).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	attempts := 0
+	err := WithTx(ctx, db, func(ctx context.Context) error {
+		attempts++
+		return repo.Create(ctx, &txUser{Name: "a"})
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWithTx_NoRetryOnBusinessError(t *testing.T) {
+	db, mock := newMockDB(t)
+	ctx := context.Background()
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	bizErr := errors.New("biz")
+	attempts := 0
+	err := WithTx(ctx, db, func(ctx context.Context) error {
+		attempts++
+		return bizErr
+	})
+	assert.ErrorIs(t, err, bizErr)
+	assert.Equal(t, 1, attempts)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
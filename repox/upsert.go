@@ -0,0 +1,145 @@
+package repox
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+)
+
+// upsertPlan UpsertMany 解析后的字段
+type upsertPlan struct {
+	conflict []*fieldInfo         // 冲突字段，不含租户字段
+	update   []*fieldInfo         // 命中时覆盖的字段
+	inc      map[*fieldInfo]int64 // 命中时自增的字段
+}
+
+// newUpsertPlan 解析 UpsertMany 的冲突字段、覆盖字段和自增字段
+func newUpsertPlan(schema *entitySchema, opt UpsertManyOptions, t tenancy) (*upsertPlan, error) {
+	if len(opt.ConflictFields) == 0 {
+		return nil, errors.New("repox: upsert requires conflict fields")
+	}
+	lookup := func(name string) (*fieldInfo, error) {
+		f, ok := schema.Field(name)
+		if !ok {
+			return nil, fmt.Errorf("repox: unknown field %s of %s", name, schema.Type)
+		}
+		return f, nil
+	}
+
+	p := &upsertPlan{inc: make(map[*fieldInfo]int64, len(opt.Inc))}
+	for _, name := range opt.ConflictFields {
+		f, err := lookup(name)
+		if err != nil {
+			return nil, err
+		}
+		if !t.enabled() || t.field != f {
+			p.conflict = append(p.conflict, f)
+		}
+	}
+	if len(p.conflict) == 0 {
+		return nil, errors.New("repox: upsert requires conflict fields besides the tenant field")
+	}
+	for name, delta := range opt.Inc {
+		f, err := lookup(name)
+		if err != nil {
+			return nil, err
+		}
+		p.inc[f] = delta
+	}
+
+	audit := auditorOf(schema)
+	skip := func(f *fieldInfo) bool {
+		_, isInc := p.inc[f]
+		return f.Primary || isInc || slices.Contains(p.conflict, f) || (t.enabled() && t.field == f) ||
+			f == audit.createdAt || f == audit.createdBy
+	}
+	if len(opt.UpdateFields) == 0 {
+		for _, f := range schema.Fields {
+			if !skip(f) {
+				p.update = append(p.update, f)
+			}
+		}
+		return p, nil
+	}
+	for _, name := range opt.UpdateFields {
+		f, err := lookup(name)
+		if err != nil {
+			return nil, err
+		}
+		if !skip(f) && !slices.Contains(p.update, f) {
+			p.update = append(p.update, f)
+		}
+	}
+	for _, f := range []*fieldInfo{audit.updatedAt, audit.updatedBy} {
+		if f != nil && !slices.Contains(p.update, f) {
+			p.update = append(p.update, f)
+		}
+	}
+	return p, nil
+}
+
+// insertRow 返回插入用的实体副本，自增字段设置为增量，使插入的记录与 MongoDB 的 $inc 语义一致；不修改传入的实体
+func insertRow[T any](p *upsertPlan, entity *T) (*T, error) {
+	row := clonePtr(entity)
+	v := reflect.ValueOf(row)
+	for f, delta := range p.inc {
+		fv, ok := f.reflectValue(v, true)
+		if !ok {
+			return nil, fmt.Errorf("repox: field %s is not addressable", f.Name)
+		}
+		if err := assignValue(fv, delta); err != nil {
+			return nil, fmt.Errorf("repox: set field %s: %w", f.Name, err)
+		}
+	}
+	return row, nil
+}
+
+// conflictValues 返回实体中冲突字段的值
+func (p *upsertPlan) conflictValues(entity any) []any {
+	v := reflect.ValueOf(entity)
+	values := make([]any, len(p.conflict))
+	for i, f := range p.conflict {
+		values[i], _ = f.Value(v)
+	}
+	return values
+}
+
+// copyField 将 src 中字段的值复制到 dst
+func copyField(f *fieldInfo, dst, src any) {
+	sv, ok := f.reflectValue(reflect.ValueOf(src), false)
+	if !ok {
+		return
+	}
+	if dv, ok := f.reflectValue(reflect.ValueOf(dst), true); ok && dv.CanSet() {
+		dv.Set(sv)
+	}
+}
+
+// key 返回实体冲突键的比较形式
+func (p *upsertPlan) key(entity any) string {
+	return fmt.Sprint(normalizeValues(p.conflictValues(entity)))
+}
+
+// checkDistinct 检查实体的冲突键互不相同：PostgreSQL 的 ON CONFLICT DO UPDATE 不能在一条语句中更新同一行两次，
+// MongoDB 的无序写入也不保证重复冲突键的执行顺序
+func checkDistinct[T any](p *upsertPlan, entities []*T) error {
+	seen := make(map[string]int, len(entities))
+	for i, entity := range entities {
+		key := p.key(entity)
+		if j, ok := seen[key]; ok {
+			return fmt.Errorf("repox: upsert entities %d and %d have the same conflict key %s: %w", j, i, key, ErrDuplicateKey)
+		}
+		seen[key] = i
+	}
+	return nil
+}
+
+// normalizeValues 规范化一组值，用于比较冲突键
+func normalizeValues(values []any) []any {
+	ret := make([]any, len(values))
+	for i, v := range values {
+		ret[i] = normalizeValue(v)
+	}
+	return ret
+}
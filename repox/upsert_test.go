@@ -0,0 +1,121 @@
+package repox
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+type syncItem struct {
+	Id    int64  `bson:"_id" gorm:"primaryKey"`
+	Sku   string `bson:"sku"`
+	Name  string `bson:"name"`
+	Seen  int64  `bson:"seen"`
+	Notes string `bson:"notes"`
+}
+
+func TestUpsertMany_Memory(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo[syncItem]()
+	require.NoError(t, repo.Create(ctx, &syncItem{Sku: "a", Name: "old", Seen: 5, Notes: "keep"}))
+
+	opt := UpsertManyOptions{ConflictFields: []string{"sku"}, UpdateFields: []string{"name"}, Inc: map[string]int64{"seen": 1}}
+	items := []*syncItem{
+		{Sku: "a", Name: "new", Notes: "ignored"},
+		{Sku: "b", Name: "b1", Notes: "n", Seen: 7},
+	}
+	res, err := repo.UpsertMany(ctx, items, opt)
+	require.NoError(t, err)
+	assert.Equal(t, &UpsertResult{InsertCount: 1, UpdateCount: 1}, res)
+	// 不修改实体中自增字段的值
+	assert.Equal(t, int64(7), items[1].Seen)
+
+	a, err := repo.FindOne(ctx, bson.M{"sku": "a"})
+	require.NoError(t, err)
+	assert.Equal(t, syncItem{Id: 1, Sku: "a", Name: "new", Seen: 6, Notes: "keep"}, *a)
+	// 插入时自增字段为增量本身
+	b, err := repo.FindOne(ctx, bson.M{"sku": "b"})
+	require.NoError(t, err)
+	assert.Equal(t, syncItem{Id: 2, Sku: "b", Name: "b1", Seen: 1, Notes: "n"}, *b)
+
+	// 冲突键重复时不写入
+	_, err = repo.UpsertMany(ctx, []*syncItem{{Sku: "c"}, {Sku: "c"}}, opt)
+	assert.ErrorIs(t, err, ErrDuplicateKey)
+	_, err = repo.FindOne(ctx, bson.M{"sku": "c"})
+	assert.ErrorIs(t, err, DataNotFound)
+
+	// 未指定 UpdateFields 时覆盖除主键、冲突字段和自增字段以外的字段
+	_, err = repo.UpsertMany(ctx, []*syncItem{{Sku: "a", Name: "all"}}, UpsertManyOptions{ConflictFields: []string{"sku"}})
+	require.NoError(t, err)
+	a, err = repo.FindOne(ctx, bson.M{"sku": "a"})
+	require.NoError(t, err)
+	assert.Equal(t, syncItem{Id: 1, Sku: "a", Name: "all", Seen: 0}, *a)
+
+	_, err = repo.UpsertMany(ctx, nil, UpsertManyOptions{})
+	assert.Error(t, err)
+	_, err = repo.UpsertMany(ctx, nil, UpsertManyOptions{ConflictFields: []string{"missing"}})
+	assert.Error(t, err)
+}
+
+func TestUpsertMany_Tenant(t *testing.T) {
+	repo := NewMemoryRepo[tenantDoc](Options().SetTenant("", nil))
+	a := WithTenant(context.Background(), "a")
+	b := WithTenant(context.Background(), "b")
+	require.NoError(t, repo.Create(a, &tenantDoc{Title: "x"}))
+
+	res, err := repo.UpsertMany(b, []*tenantDoc{{Title: "x"}}, UpsertManyOptions{ConflictFields: []string{"title"}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), res.InsertCount)
+	n, err := repo.Count(CrossTenant(context.Background()), bson.M{"title": "x"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	// 冲突字段只有租户字段时无法区分记录
+	_, err = repo.UpsertMany(b, []*tenantDoc{{Title: "y"}}, UpsertManyOptions{ConflictFields: []string{"tenant_id"}})
+	assert.Error(t, err)
+}
+
+func TestUpsertMany_Gorm(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewGormRepo[syncItem](db, Options().SetBatchSize(2))
+	ctx := context.Background()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`sku` FROM `sync_items` WHERE `sku` IN (?,?) FOR UPDATE")).
+		WithArgs("a", "b").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "sku"}).AddRow(1, "a"))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `sync_items` (`sku`,`name`,`seen`,`notes`) VALUES (?,?,?,?),(?,?,?,?) "+
+		"ON DUPLICATE KEY UPDATE `name`=VALUES(`name`),`seen`=seen + ?")).
+		WithArgs("a", "A", int64(1), "", "b", "B", int64(1), "", int64(1)).
+		WillReturnResult(sqlmock.NewResult(10, 3))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`sku` FROM `sync_items` WHERE `sku` = ? FOR UPDATE")).
+		WithArgs("b").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "sku"}).AddRow(10, "b"))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`sku` FROM `sync_items` WHERE `sku` = ? FOR UPDATE")).
+		WithArgs("c").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "sku"}))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `sync_items`")).
+		WillReturnResult(sqlmock.NewResult(12, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`sku` FROM `sync_items` WHERE `sku` = ? FOR UPDATE")).
+		WithArgs("c").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "sku"}).AddRow(12, "c"))
+	mock.ExpectCommit()
+
+	opt := UpsertManyOptions{ConflictFields: []string{"sku"}, UpdateFields: []string{"name"}, Inc: map[string]int64{"seen": 1}}
+	items := []*syncItem{{Sku: "a", Name: "A", Seen: 5}, {Sku: "b", Name: "B"}, {Sku: "c", Name: "C"}}
+	res, err := repo.UpsertMany(ctx, items, opt)
+	require.NoError(t, err)
+	assert.Equal(t, &UpsertResult{InsertCount: 2, UpdateCount: 1}, res)
+	assert.Equal(t, int64(5), items[0].Seen)
+	assert.Equal(t, []int64{1, 10, 12}, []int64{items[0].Id, items[1].Id, items[2].Id})
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// 冲突键重复时不执行任何语句
+	_, err = repo.UpsertMany(ctx, []*syncItem{{Sku: "a"}, {Sku: "a"}}, opt)
+	assert.ErrorIs(t, err, ErrDuplicateKey)
+}
@@ -0,0 +1,326 @@
+package repox
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"gorm.io/gorm/clause"
+)
+
+var scannerType = reflect.TypeFor[sql.Scanner]()
+
+// normalizeValue 将值规范化为可比较的基础类型：
+// 整数 -> int64，无符号整数 -> uint64，浮点数 -> float64，指针解引用，driver.Valuer 取其 Value
+func normalizeValue(value any) any {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case time.Time, bson.ObjectID, string, bool, int64, float64:
+		return v
+	case bson.DateTime:
+		return v.Time()
+	case driver.Valuer:
+		rv := reflect.ValueOf(v)
+		if rv.Kind() == reflect.Ptr && rv.IsNil() {
+			return nil
+		}
+		dv, err := v.Value()
+		if err != nil {
+			return value
+		}
+		return normalizeValue(dv)
+	}
+
+	rv := reflect.ValueOf(value)
+	derefed := false
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+		derefed = true
+	}
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return rv.Uint()
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	case reflect.String:
+		return rv.String()
+	case reflect.Bool:
+		return rv.Bool()
+	}
+	if derefed && rv.CanInterface() {
+		return normalizeValue(rv.Interface())
+	}
+	return value
+}
+
+// compareValues 比较两个值，返回 -1/0/1，ok 为 false 表示两者不可比较
+// nil 小于任何非 nil 值，与 MongoDB 排序规则一致
+func compareValues(a, b any) (int, bool) {
+	a, b = normalizeValue(a), normalizeValue(b)
+	switch {
+	case a == nil && b == nil:
+		return 0, true
+	case a == nil:
+		return -1, true
+	case b == nil:
+		return 1, true
+	}
+
+	if af, ok := toFloat(a); ok {
+		bf, ok := toFloat(b)
+		if !ok {
+			return 0, false
+		}
+		if ai, ok := a.(int64); ok {
+			if bi, ok := b.(int64); ok {
+				return cmpOrdered(ai, bi), true
+			}
+		}
+		return cmpOrdered(af, bf), true
+	}
+
+	switch av := a.(type) {
+	case string:
+		if bv, ok := b.(string); ok {
+			return cmpOrdered(av, bv), true
+		}
+	case bool:
+		if bv, ok := b.(bool); ok {
+			switch {
+			case av == bv:
+				return 0, true
+			case !av:
+				return -1, true
+			default:
+				return 1, true
+			}
+		}
+	case time.Time:
+		if bv, ok := b.(time.Time); ok {
+			return av.Compare(bv), true
+		}
+	case bson.ObjectID:
+		if bv, ok := b.(bson.ObjectID); ok {
+			return bytes.Compare(av[:], bv[:]), true
+		}
+		if bv, ok := b.(string); ok {
+			return cmpOrdered(av.Hex(), bv), true
+		}
+	case []byte:
+		if bv, ok := b.([]byte); ok {
+			return bytes.Compare(av, bv), true
+		}
+	}
+	if reflect.DeepEqual(a, b) {
+		return 0, true
+	}
+	return 0, false
+}
+
+// equalValues 判断两个值是否相等
+func equalValues(a, b any) bool {
+	c, ok := compareValues(a, b)
+	return ok && c == 0
+}
+
+func cmpOrdered[V int64 | float64 | string](a, b V) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float64:
+		return n, true
+	default:
+		return 0, false
+	}
+}
+
+// assignValue 将 value 赋值给字段，支持数值类型转换、指针字段和 sql.Scanner
+func assignValue(field reflect.Value, value any) error {
+	if value == nil {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+
+	rv := reflect.ValueOf(value)
+	ft := field.Type()
+	if rv.Type().AssignableTo(ft) {
+		field.Set(rv)
+		return nil
+	}
+	if field.CanAddr() && reflect.PointerTo(ft).Implements(scannerType) {
+		return field.Addr().Interface().(sql.Scanner).Scan(normalizeValue(value))
+	}
+	if ft.Kind() == reflect.Ptr {
+		if rv.Kind() == reflect.Ptr {
+			if rv.IsNil() {
+				field.Set(reflect.Zero(ft))
+				return nil
+			}
+			rv = rv.Elem()
+		}
+		elem := reflect.New(ft.Elem())
+		if err := assignValue(elem.Elem(), rv.Interface()); err != nil {
+			return err
+		}
+		field.Set(elem)
+		return nil
+	}
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			field.Set(reflect.Zero(ft))
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if isNumberKind(rv.Kind()) && isNumberKind(ft.Kind()) || rv.Kind() == ft.Kind() && rv.Type().ConvertibleTo(ft) {
+		field.Set(rv.Convert(ft))
+		return nil
+	}
+	if dv, ok := value.(driver.Valuer); ok {
+		v, err := dv.Value()
+		if err != nil {
+			return err
+		}
+		return assignValue(field, v)
+	}
+	return fmt.Errorf("repox: cannot assign %T to field of type %s", value, ft)
+}
+
+// addValue 在数值字段上累加 delta
+func addValue(field reflect.Value, delta any) error {
+	target := field
+	if target.Kind() == reflect.Ptr {
+		if target.IsNil() {
+			target.Set(reflect.New(target.Type().Elem()))
+		}
+		target = target.Elem()
+	}
+	d := reflect.ValueOf(normalizeValue(delta))
+	if !d.IsValid() || !isNumberKind(d.Kind()) {
+		return fmt.Errorf("repox: cannot increase by %T", delta)
+	}
+	switch target.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		target.SetInt(target.Int() + d.Convert(reflect.TypeFor[int64]()).Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		target.SetUint(uint64(int64(target.Uint()) + d.Convert(reflect.TypeFor[int64]()).Int()))
+	case reflect.Float32, reflect.Float64:
+		target.SetFloat(target.Float() + d.Convert(reflect.TypeFor[float64]()).Float())
+	default:
+		return fmt.Errorf("repox: cannot increase field of type %s", target.Type())
+	}
+	return nil
+}
+
+func isNumberKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	default:
+		return false
+	}
+}
+
+// isZeroValue 判断值是否为零值
+func isZeroValue(value any) bool {
+	if value == nil {
+		return true
+	}
+	return reflect.ValueOf(value).IsZero()
+}
+
+// equalityConditions 解析只包含等值条件的过滤条件（map、bson.D 或 GORM 的等值表达式），包含操作符或嵌套条件时返回 false
+func equalityConditions(filter any) (map[string]any, bool) {
+	var kvs map[string]any
+	switch f := filter.(type) {
+	case bson.M:
+		kvs = f
+	case map[string]any:
+		kvs = f
+	case bson.D:
+		kvs = dToMap(f)
+	case clause.Eq:
+		kvs = map[string]any{columnName(f.Column): f.Value}
+	case clause.AndConditions:
+		// GormQueryBuilder 构建的多个等值条件
+		kvs = make(map[string]any, len(f.Exprs))
+		for _, expr := range f.Exprs {
+			eq, ok := expr.(clause.Eq)
+			if !ok {
+				return nil, false
+			}
+			name := columnName(eq.Column)
+			if _, dup := kvs[name]; dup {
+				return nil, false
+			}
+			kvs[name] = eq.Value
+		}
+	default:
+		return nil, false
+	}
+	if len(kvs) == 0 {
+		return nil, false
+	}
+	for k, v := range kvs {
+		if strings.HasPrefix(k, "$") || !isScalarValue(v) {
+			return nil, false
+		}
+	}
+	return kvs, true
+}
+
+// hasField 判断 map 或 bson.D 类型的过滤条件的顶层是否包含字段
+func hasField(filter any, name string) bool {
+	var ok bool
+	switch f := filter.(type) {
+	case bson.M:
+		_, ok = f[name]
+	case map[string]any:
+		_, ok = f[name]
+	case bson.D:
+		_, ok = dToMap(f)[name]
+	}
+	return ok
+}
+
+// isScalarValue 判断值是否为单个值（而不是 map、切片等条件表达式）
+func isScalarValue(v any) bool {
+	if v == nil {
+		return false
+	}
+	switch v.(type) {
+	case bson.ObjectID, time.Time, []byte:
+		return true
+	}
+	switch reflect.Indirect(reflect.ValueOf(v)).Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array, reflect.Struct, reflect.Invalid:
+		return false
+	}
+	return true
+}
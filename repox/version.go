@@ -0,0 +1,78 @@
+package repox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// ErrVersionConflict 乐观锁冲突：按主键和版本号没有匹配到记录
+var ErrVersionConflict = errors.New("version conflict")
+
+const (
+	// roleVersion 乐观锁版本号字段，通过 `repox:"version"` 声明，类型应为整数
+	roleVersion = "version"
+	// maxConflictAttempts RetryOnConflict 未指定次数时的最大尝试次数
+	maxConflictAttempts = 3
+	// conflictRetryBackoff RetryOnConflict 重试的基础退避时间
+	conflictRetryBackoff = 10 * time.Millisecond
+)
+
+// RetryOnConflict 执行读取-修改-写入的 fn，返回 ErrVersionConflict 时重新执行，最多执行 attempts 次
+// fn 每次都需要重新读取实体，attempts <= 0 时使用默认次数
+func RetryOnConflict(ctx context.Context, attempts int, fn func(ctx context.Context) error) error {
+	if attempts <= 0 {
+		attempts = maxConflictAttempts
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn(ctx)
+		if err == nil || attempt >= attempts || !errors.Is(err, ErrVersionConflict) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(attempt) * conflictRetryBackoff):
+		}
+	}
+}
+
+// bumpVersion 将实体的版本号加一，返回原版本号和回滚函数
+func bumpVersion(f *fieldInfo, entity any) (int64, func(), error) {
+	fv, ok := f.reflectValue(reflect.ValueOf(entity), true)
+	if !ok {
+		return 0, nil, fmt.Errorf("repox: version field %s is not addressable", f.Name)
+	}
+	var cur int64
+	switch v := normalizeValue(fv.Interface()).(type) {
+	case nil:
+	case int64:
+		cur = v
+	case uint64:
+		cur = int64(v)
+	default:
+		return 0, nil, fmt.Errorf("repox: version field %s must be an integer", f.Name)
+	}
+
+	old := reflect.New(fv.Type()).Elem()
+	old.Set(fv)
+	if err := addValue(fv, 1); err != nil {
+		return 0, nil, err
+	}
+	return cur, func() { fv.Set(old) }, nil
+}
+
+// versionMatch 返回 MongoDB 中版本号的匹配条件，版本号为 0 时同时匹配添加版本字段之前写入的、缺少该字段或为 null 的文档
+func versionMatch(cur int64) any {
+	if cur == 0 {
+		return bson.M{"$in": bson.A{int64(0), nil}}
+	}
+	return cur
+}
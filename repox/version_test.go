@@ -0,0 +1,123 @@
+package repox
+
+import (
+	"context"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+type verDoc struct {
+	Id      int64  `bson:"_id" gorm:"primaryKey"`
+	Title   string `bson:"title"`
+	Views   int64  `bson:"views"`
+	Version int64  `bson:"version" repox:"version"`
+}
+
+func TestVersion_Memory(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo[verDoc]()
+	require.NoError(t, repo.Create(ctx, &verDoc{Title: "a"}))
+
+	first, err := repo.FindOne(ctx, bson.M{"_id": 1})
+	require.NoError(t, err)
+	second, err := repo.FindOne(ctx, bson.M{"_id": 1})
+	require.NoError(t, err)
+
+	first.Title = "first"
+	require.NoError(t, repo.Update(ctx, first))
+	assert.Equal(t, int64(1), first.Version)
+
+	second.Title = "second"
+	assert.ErrorIs(t, repo.Update(ctx, second), ErrVersionConflict)
+	assert.Equal(t, int64(0), second.Version)
+
+	_, err = repo.UpdateOne(ctx, bson.M{"_id": 1}, map[string]any{"title": "third"})
+	require.NoError(t, err)
+	require.NoError(t, repo.Incr(ctx, bson.M{"_id": 1}, map[string]int{"views": 1}))
+	got, err := repo.FindOne(ctx, bson.M{"_id": 1})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), got.Version)
+	assert.ErrorIs(t, repo.Update(ctx, first), ErrVersionConflict)
+}
+
+func TestRetryOnConflict(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo[verDoc]()
+	require.NoError(t, repo.Create(ctx, &verDoc{Title: "hot"}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := RetryOnConflict(ctx, 100, func(ctx context.Context) error {
+				doc, err := repo.FindOne(ctx, bson.M{"_id": 1})
+				if err != nil {
+					return err
+				}
+				doc.Views++
+				return repo.Update(ctx, doc)
+			})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	got, err := repo.FindOne(ctx, bson.M{"_id": 1})
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), got.Views)
+	assert.Equal(t, int64(10), got.Version)
+
+	calls := 0
+	err = RetryOnConflict(ctx, 2, func(context.Context) error {
+		calls++
+		return ErrVersionConflict
+	})
+	assert.ErrorIs(t, err, ErrVersionConflict)
+	assert.Equal(t, 2, calls)
+}
+
+func TestVersion_Gorm(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewGormRepo[verDoc](db)
+	ctx := context.Background()
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `ver_docs` SET `id`=?,`title`=?,`version`=? WHERE `id` = ? AND `version` = ? AND `id` = ?")).
+		WithArgs(int64(1), "a", int64(3), int64(1), int64(2), int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	doc := &verDoc{Id: 1, Title: "a", Version: 2}
+	require.NoError(t, repo.Update(ctx, doc))
+	assert.Equal(t, int64(3), doc.Version)
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `ver_docs` SET `id`=?,`title`=?,`version`=? WHERE `id` = ? AND `version` = ? AND `id` = ?")).
+		WithArgs(int64(1), "b", int64(4), int64(1), int64(3), int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	doc.Title = "b"
+	assert.ErrorIs(t, repo.Update(ctx, doc), ErrVersionConflict)
+	assert.Equal(t, int64(3), doc.Version)
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `ver_docs` SET `title`=?,`version`=COALESCE(version, 0) + 1 WHERE `ver_docs`.`id` = ?")).
+		WithArgs("c", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	_, err := repo.UpdateMany(ctx, map[string]any{"id": 1}, map[string]any{"title": "c"})
+	require.NoError(t, err)
+
+	// 添加版本字段之前写入的记录版本号为 NULL
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `ver_docs` SET `id`=?,`title`=?,`version`=? WHERE `id` = ? AND (`version` IS NULL OR `version` = ?) AND `id` = ?")).
+		WithArgs(int64(2), "d", int64(1), int64(2), int64(0), int64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	require.NoError(t, repo.Update(ctx, &verDoc{Id: 2, Title: "d"}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestVersionMatch(t *testing.T) {
+	assert.Equal(t, int64(3), versionMatch(3))
+	// 版本号为 0 时匹配缺少版本字段或为 null 的文档
+	assert.Equal(t, bson.M{"$in": bson.A{int64(0), nil}}, versionMatch(0))
+}
@@ -0,0 +1,404 @@
+package repox
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/mbeoliero/kit/log"
+	"github.com/mbeoliero/kit/redisx"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	minWatchBackoff = 100 * time.Millisecond
+	maxWatchBackoff = 10 * time.Second
+)
+
+// ChangeOp 变更事件的操作类型
+type ChangeOp string
+
+const (
+	ChangeInsert     ChangeOp = "insert"
+	ChangeUpdate     ChangeOp = "update"
+	ChangeReplace    ChangeOp = "replace"
+	ChangeDelete     ChangeOp = "delete"
+	ChangeInvalidate ChangeOp = "invalidate" // 集合被删除或重命名，之后不再产生事件
+)
+
+// ChangeEvent 集合的一次变更
+type ChangeEvent[T any] struct {
+	Op  ChangeOp
+	Id  any // 变更记录的 _id
+	Doc *T  // 变更后的完整记录，删除事件或查询时记录已被删除时为 nil
+	// UpdatedFields 和 RemovedFields 为 update 事件修改和删除的字段
+	UpdatedFields map[string]any
+	RemovedFields []string
+	ClusterTime   time.Time
+	ResumeToken   bson.Raw
+	// Err 不为 nil 时监听因不可恢复的错误结束，这是 channel 关闭前的最后一个事件
+	Err error
+}
+
+// CheckpointStore 保存变更流的恢复令牌，重启后从上次的位置继续监听
+type CheckpointStore interface {
+	// Load 读取恢复令牌，没有保存过时返回 nil
+	Load(ctx context.Context, key string) (bson.Raw, error)
+	Save(ctx context.Context, key string, token bson.Raw) error
+}
+
+// redisCheckpoints 基于 redis 的恢复令牌存储
+type redisCheckpoints struct {
+	cli redis.UniversalClient
+}
+
+// RedisCheckpoints 创建基于 redis 的恢复令牌存储，令牌不过期
+func RedisCheckpoints(cli redis.UniversalClient) CheckpointStore {
+	return redisCheckpoints{cli: cli}
+}
+
+func (s redisCheckpoints) Load(ctx context.Context, key string) (bson.Raw, error) {
+	token, found, err := redisx.GetExistByClient[string](ctx, s.cli, key)
+	if err != nil || !found {
+		return nil, err
+	}
+	return bson.Raw(token), nil
+}
+
+func (s redisCheckpoints) Save(ctx context.Context, key string, token bson.Raw) error {
+	return redisx.SetByClient(ctx, s.cli, key, string(token), 0)
+}
+
+// WatchOptions 存储变更流配置
+type WatchOptions struct {
+	Ops []ChangeOp // 只接收这些操作类型，为空时接收全部
+	// Checkpoints 恢复令牌存储，为 nil 时每次从当前时间开始监听
+	Checkpoints CheckpointStore
+	// CheckpointKey 恢复令牌的 key，默认为 repox:watch:<数据库>.<集合>，同一集合有多个消费者时需要区分
+	CheckpointKey string
+	// BufferSize 事件 channel 的缓冲大小，默认 0；不能与 Checkpoints 同时使用
+	BufferSize int
+}
+
+// WatchOptionsBuilder 链式构建器
+type WatchOptionsBuilder struct {
+	Opts []func(*WatchOptions)
+}
+
+// Watch 创建新的构建器
+func Watch() *WatchOptionsBuilder {
+	return &WatchOptionsBuilder{}
+}
+
+// List 返回所有配置函数
+func (w *WatchOptionsBuilder) List() []func(*WatchOptions) {
+	return w.Opts
+}
+
+// SetOps 只接收指定操作类型的事件
+func (w *WatchOptionsBuilder) SetOps(ops ...ChangeOp) *WatchOptionsBuilder {
+	w.Opts = append(w.Opts, func(opts *WatchOptions) {
+		opts.Ops = ops
+	})
+	return w
+}
+
+// SetCheckpoints 设置恢复令牌存储和 key，key 为空时使用默认值
+func (w *WatchOptionsBuilder) SetCheckpoints(store CheckpointStore, key string) *WatchOptionsBuilder {
+	w.Opts = append(w.Opts, func(opts *WatchOptions) {
+		opts.Checkpoints = store
+		opts.CheckpointKey = key
+	})
+	return w
+}
+
+// SetBufferSize 设置事件 channel 的缓冲大小，设置 Checkpoints 时必须为 0，
+// 否则缓冲中还没有被消费者读取的事件会被当作已处理保存令牌
+func (w *WatchOptionsBuilder) SetBufferSize(size int) *WatchOptionsBuilder {
+	w.Opts = append(w.Opts, func(opts *WatchOptions) {
+		opts.BufferSize = size
+	})
+	return w
+}
+
+// changeStream 变更流，由 *mongo.ChangeStream 实现
+type changeStream interface {
+	Next(ctx context.Context) bool
+	Decode(v any) error
+	Err() error
+	Close(ctx context.Context) error
+	// ResumeToken 返回最后一个读取的事件或批次结束位置的令牌
+	ResumeToken() bson.Raw
+}
+
+// Watch 监听集合的变更，返回的 channel 在 ctx 结束或发生不可恢复的错误时关闭
+// filter 作用于变更后的完整记录，并附加租户条件；删除事件没有完整记录，不受 filter 限制。
+// 启用租户隔离时删除事件按删除前的记录（pre-image）匹配 filter 和租户条件，
+// 集合必须开启 changeStreamPreAndPostImages，否则打开变更流失败；跨租户访问时不受此限制。
+// update 事件通过 updateLookup 查询完整记录，Doc 为查询时的最新值。
+// 连接中断等可恢复的错误会按退避时间重新连接，并从最后一个事件继续；
+// 设置 Checkpoints 时，事件的恢复令牌在消费者读取下一个事件后保存，重启后至少投递一次
+func (r *MongoRepo[T]) Watch(ctx context.Context, filter any, opts ...IList[WatchOptions]) (<-chan ChangeEvent[T], error) {
+	o := NewOptions(opts...)
+	if o.Checkpoints != nil && o.BufferSize > 0 {
+		return nil, errors.New("repox: watch checkpoints require an unbuffered channel")
+	}
+	_, scoped, err := r.tenancy.current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	f, err := r.scopedFilter(ctx, filter, DeletedIncluded)
+	if err != nil {
+		return nil, err
+	}
+	pipeline, err := watchPipeline(f, o.Ops, scoped)
+	if err != nil {
+		return nil, err
+	}
+	if o.Checkpoints != nil && o.CheckpointKey == "" {
+		o.CheckpointKey = "repox:watch:" + r.coll.Database().Name() + "." + r.coll.Name()
+	}
+
+	w := &watcher[T]{
+		opts: o,
+		open: func(ctx context.Context, token bson.Raw) (changeStream, error) {
+			csOpts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+			if scoped {
+				csOpts.SetFullDocumentBeforeChange(options.Required)
+			}
+			if token != nil {
+				csOpts.SetResumeAfter(token)
+			}
+			return r.coll.Watch(ctx, pipeline, csOpts)
+		},
+	}
+	return w.start(ctx)
+}
+
+// watchPipeline 构建变更流的 $match 阶段，filter 中的字段改为 fullDocument 下的字段
+// preImage 为 true 时删除事件按 fullDocumentBeforeChange 匹配 filter，否则删除事件全部通过
+func watchPipeline(filter any, ops []ChangeOp, preImage bool) (mongo.Pipeline, error) {
+	var match bson.D
+	if len(ops) > 0 {
+		match = append(match, bson.E{Key: "operationType", Value: bson.M{"$in": ops}})
+	}
+	if filter != nil && !isEmptyFilter(filter) {
+		data, err := bson.Marshal(filter)
+		if err != nil {
+			return nil, err
+		}
+		var doc bson.D
+		if err = bson.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		if len(doc) > 0 {
+			deletes := bson.D{{Key: "operationType", Value: ChangeDelete}}
+			if preImage {
+				deletes = append(deletes, prefixFields(doc, "fullDocumentBeforeChange.")...)
+			}
+			match = append(match, bson.E{Key: "$or", Value: bson.A{deletes, prefixFields(doc, "fullDocument.")}})
+		}
+	}
+	if len(match) == 0 {
+		return mongo.Pipeline{}, nil
+	}
+	return mongo.Pipeline{{{Key: "$match", Value: match}}}, nil
+}
+
+// prefixFields 为过滤条件中的字段名添加前缀，递归处理 $and/$or/$nor
+func prefixFields(doc bson.D, prefix string) bson.D {
+	ret := make(bson.D, len(doc))
+	for i, e := range doc {
+		switch {
+		case e.Key == "$and" || e.Key == "$or" || e.Key == "$nor":
+			arr, _ := e.Value.(bson.A)
+			items := make(bson.A, len(arr))
+			for j, item := range arr {
+				if d, ok := item.(bson.D); ok {
+					item = prefixFields(d, prefix)
+				}
+				items[j] = item
+			}
+			ret[i] = bson.E{Key: e.Key, Value: items}
+		case strings.HasPrefix(e.Key, "$"):
+			ret[i] = e
+		default:
+			ret[i] = bson.E{Key: prefix + e.Key, Value: e.Value}
+		}
+	}
+	return ret
+}
+
+// changeDoc 变更流返回的事件
+type changeDoc[T any] struct {
+	Token         bson.Raw `bson:"_id"`
+	OperationType ChangeOp `bson:"operationType"`
+	DocumentKey   struct {
+		Id any `bson:"_id"`
+	} `bson:"documentKey"`
+	FullDocument      *T             `bson:"fullDocument"`
+	ClusterTime       bson.Timestamp `bson:"clusterTime"`
+	UpdateDescription *struct {
+		UpdatedFields bson.M   `bson:"updatedFields"`
+		RemovedFields []string `bson:"removedFields"`
+	} `bson:"updateDescription"`
+}
+
+// event 转换为 ChangeEvent
+func (d *changeDoc[T]) event() ChangeEvent[T] {
+	ev := ChangeEvent[T]{
+		Op:          d.OperationType,
+		Id:          d.DocumentKey.Id,
+		Doc:         d.FullDocument,
+		ClusterTime: time.Unix(int64(d.ClusterTime.T), 0),
+		ResumeToken: d.Token,
+	}
+	if d.UpdateDescription != nil {
+		ev.UpdatedFields = d.UpdateDescription.UpdatedFields
+		ev.RemovedFields = d.UpdateDescription.RemovedFields
+	}
+	return ev
+}
+
+// watcher 变更流的消费循环，负责重连和保存恢复令牌
+type watcher[T any] struct {
+	opts *WatchOptions
+	open func(ctx context.Context, token bson.Raw) (changeStream, error)
+
+	token   bson.Raw // 最后一个发出的事件或批次结束位置的令牌，重连时从这里继续
+	pending bson.Raw // 已发出但还没有保存的令牌
+}
+
+// start 读取保存的令牌并打开变更流，打开失败时直接返回错误
+func (w *watcher[T]) start(ctx context.Context) (<-chan ChangeEvent[T], error) {
+	if w.opts.Checkpoints != nil {
+		token, err := w.opts.Checkpoints.Load(ctx, w.opts.CheckpointKey)
+		if err != nil {
+			return nil, err
+		}
+		w.token = token
+	}
+	stream, err := w.open(ctx, w.token)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	ch := make(chan ChangeEvent[T], w.opts.BufferSize)
+	go w.run(ctx, stream, ch)
+	return ch, nil
+}
+
+// run 循环读取事件，可恢复的错误按退避时间重连
+func (w *watcher[T]) run(ctx context.Context, stream changeStream, ch chan<- ChangeEvent[T]) {
+	defer close(ch)
+	backoff := minWatchBackoff
+	for {
+		err := w.consume(ctx, stream, ch, &backoff)
+		_ = stream.Close(context.WithoutCancel(ctx))
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			return
+		}
+		if !resumableWatchError(err) {
+			w.fail(ctx, ch, err)
+			return
+		}
+		// 事件都已发出，批次结束位置的令牌不会跳过事件；还没有事件时避免从当前时间重新开始而丢失中断期间的事件
+		if token := stream.ResumeToken(); token != nil {
+			w.token = token
+		}
+
+		for {
+			log.CtxWarn(ctx, "repox: change stream interrupted, reconnect in %s: %v", backoff, err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, maxWatchBackoff)
+			if stream, err = w.open(ctx, w.token); err == nil {
+				break
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			if !resumableWatchError(err) {
+				w.fail(ctx, ch, err)
+				return
+			}
+		}
+	}
+}
+
+// fail 发送带有错误的最后一个事件
+func (w *watcher[T]) fail(ctx context.Context, ch chan<- ChangeEvent[T], err error) {
+	log.CtxError(ctx, "repox: change stream stopped: %v", err)
+	select {
+	case ch <- ChangeEvent[T]{Err: wrapError(err)}:
+	case <-ctx.Done():
+	}
+}
+
+// consume 发送变更流中的事件直到出错或集合失效，集合失效时返回 nil
+func (w *watcher[T]) consume(ctx context.Context, stream changeStream, ch chan<- ChangeEvent[T], backoff *time.Duration) error {
+	for stream.Next(ctx) {
+		var doc changeDoc[T]
+		if err := stream.Decode(&doc); err != nil {
+			return &nonResumableError{err: err}
+		}
+		select {
+		case ch <- doc.event():
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		*backoff = minWatchBackoff
+		w.token = doc.Token
+		w.checkpoint(ctx, doc.Token)
+		if doc.OperationType == ChangeInvalidate {
+			return nil
+		}
+	}
+	return stream.Err()
+}
+
+// checkpoint 保存上一个事件的令牌：发送当前事件成功说明消费者已处理完上一个事件
+func (w *watcher[T]) checkpoint(ctx context.Context, token bson.Raw) {
+	if w.opts.Checkpoints == nil {
+		return
+	}
+	if w.pending != nil {
+		if err := w.opts.Checkpoints.Save(ctx, w.opts.CheckpointKey, w.pending); err != nil {
+			log.CtxWarn(ctx, "repox: save change stream checkpoint %s failed: %v", w.opts.CheckpointKey, err)
+		}
+	}
+	w.pending = token
+}
+
+// nonResumableError 重连后仍会失败的错误，例如事件无法解码为 T
+type nonResumableError struct {
+	err error
+}
+
+func (e *nonResumableError) Error() string { return e.err.Error() }
+
+func (e *nonResumableError) Unwrap() error { return e.err }
+
+// resumableWatchError 判断变更流的错误能否通过重连恢复：恢复令牌失效和数据解码错误不能恢复
+func resumableWatchError(err error) bool {
+	var ne *nonResumableError
+	if errors.As(err, &ne) {
+		return false
+	}
+	var se mongo.ServerError
+	if errors.As(err, &se) {
+		// 286 ChangeStreamHistoryLost，280 ChangeStreamFatalError，260 InvalidResumeToken
+		return !se.HasErrorCode(286) && !se.HasErrorCode(280) && !se.HasErrorCode(260) &&
+			!se.HasErrorLabel("NonResumableChangeStreamError")
+	}
+	return true
+}
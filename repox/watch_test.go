@@ -0,0 +1,295 @@
+package repox
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// fakeStream 依次返回 docs 中的事件，之后返回 err，resume 为批次结束位置的令牌
+type fakeStream struct {
+	docs   []bson.Raw
+	cur    bson.Raw
+	err    error
+	resume bson.Raw
+}
+
+func (s *fakeStream) Next(context.Context) bool {
+	if len(s.docs) == 0 {
+		return false
+	}
+	s.cur, s.docs = s.docs[0], s.docs[1:]
+	return true
+}
+
+func (s *fakeStream) Decode(v any) error { return bson.Unmarshal(s.cur, v) }
+
+func (s *fakeStream) Err() error { return s.err }
+
+func (s *fakeStream) Close(context.Context) error { return nil }
+
+func (s *fakeStream) ResumeToken() bson.Raw { return s.resume }
+
+// memCheckpoints 内存恢复令牌存储
+type memCheckpoints struct {
+	mu     sync.Mutex
+	tokens map[string]bson.Raw
+}
+
+func (m *memCheckpoints) Load(_ context.Context, key string) (bson.Raw, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.tokens[key], nil
+}
+
+func (m *memCheckpoints) Save(_ context.Context, key string, token bson.Raw) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tokens[key] = token
+	return nil
+}
+
+func changeRaw(t *testing.T, token string, op ChangeOp, id int64, doc any) bson.Raw {
+	t.Helper()
+	m := bson.M{
+		"_id":           bson.M{"_data": token},
+		"operationType": op,
+		"documentKey":   bson.M{"_id": id},
+		"clusterTime":   bson.Timestamp{T: 1700000000, I: 1},
+	}
+	if doc != nil {
+		m["fullDocument"] = doc
+	}
+	if op == ChangeUpdate {
+		m["updateDescription"] = bson.M{"updatedFields": bson.M{"age": 21}, "removedFields": bson.A{"tags"}}
+	}
+	data, err := bson.Marshal(m)
+	require.NoError(t, err)
+	return data
+}
+
+func tokenData(t *testing.T, token bson.Raw) string {
+	t.Helper()
+	if token == nil {
+		return ""
+	}
+	return token.Lookup("_data").StringValue()
+}
+
+func TestWatchPipeline(t *testing.T) {
+	pipeline, err := watchPipeline(bson.M{}, nil, false)
+	require.NoError(t, err)
+	assert.Empty(t, pipeline)
+
+	pipeline, err = watchPipeline(bson.D{
+		{Key: "age", Value: bson.D{{Key: "$gte", Value: 18}}},
+		{Key: "$or", Value: bson.A{bson.D{{Key: "name", Value: "alice"}}, bson.D{{Key: "tags", Value: "vip"}}}},
+	}, []ChangeOp{ChangeInsert, ChangeDelete}, false)
+	require.NoError(t, err)
+	assert.Equal(t, mongo.Pipeline{{{Key: "$match", Value: bson.D{
+		{Key: "operationType", Value: bson.M{"$in": []ChangeOp{ChangeInsert, ChangeDelete}}},
+		{Key: "$or", Value: bson.A{
+			bson.D{{Key: "operationType", Value: ChangeDelete}},
+			bson.D{
+				{Key: "fullDocument.age", Value: bson.D{{Key: "$gte", Value: int32(18)}}},
+				{Key: "$or", Value: bson.A{
+					bson.D{{Key: "fullDocument.name", Value: "alice"}},
+					bson.D{{Key: "fullDocument.tags", Value: "vip"}},
+				}},
+			},
+		}},
+	}}}}, pipeline)
+}
+
+func TestWatch_Tenant(t *testing.T) {
+	// 空批次的 firstBatch 必须是数组
+	empty := bson.D{{Key: "ok", Value: 1}, {Key: "cursor", Value: bson.D{
+		{Key: "id", Value: int64(0)}, {Key: "ns", Value: "db.docs"}, {Key: "firstBatch", Value: bson.A{}},
+	}}}
+	coll, commands := newMockColl(t, empty, empty, empty)
+	repo := NewMongoRepo[tenantDoc](coll, Options().SetTenant("", nil))
+
+	// 每个租户的删除事件只按删除前的记录匹配本租户
+	for _, tenant := range []string{"a", "b"} {
+		ch, err := repo.Watch(WithTenant(context.Background(), tenant), bson.M{})
+		require.NoError(t, err)
+		for range ch {
+		}
+	}
+	_, err := repo.Watch(context.Background(), bson.M{})
+	assert.ErrorIs(t, err, ErrTenantRequired)
+
+	cmds := commands()
+	require.Len(t, cmds, 2)
+	for i, tenant := range []string{"a", "b"} {
+		var cmd struct {
+			Pipeline []bson.D `bson:"pipeline"`
+		}
+		require.NoError(t, bson.Unmarshal(cmds[i], &cmd))
+		require.Len(t, cmd.Pipeline, 2)
+		assert.Equal(t, bson.D{{Key: "$changeStream", Value: bson.D{
+			{Key: "fullDocument", Value: "updateLookup"},
+			{Key: "fullDocumentBeforeChange", Value: "required"},
+		}}}, cmd.Pipeline[0])
+		assert.Equal(t, bson.D{{Key: "$match", Value: bson.D{{Key: "$or", Value: bson.A{
+			bson.D{{Key: "operationType", Value: "delete"}, {Key: "fullDocumentBeforeChange.tenant_id", Value: tenant}},
+			bson.D{{Key: "fullDocument.tenant_id", Value: tenant}},
+		}}}}}, cmd.Pipeline[1])
+	}
+
+	// 跨租户访问时不需要 pre-image
+	ch, err := repo.Watch(CrossTenant(context.Background()), bson.M{})
+	require.NoError(t, err)
+	for range ch {
+	}
+	var cmd struct {
+		Pipeline []bson.D `bson:"pipeline"`
+	}
+	require.NoError(t, bson.Unmarshal(commands()[2], &cmd))
+	assert.Equal(t, bson.D{{Key: "$changeStream", Value: bson.D{{Key: "fullDocument", Value: "updateLookup"}}}}, cmd.Pipeline[0])
+
+	// 保存令牌时不能缓冲事件
+	_, err = repo.Watch(WithTenant(context.Background(), "a"), bson.M{},
+		Watch().SetCheckpoints(&memCheckpoints{}, "users").SetBufferSize(8))
+	assert.Error(t, err)
+}
+
+func TestWatcher(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	alice := memUser{Id: 1, Name: "alice", Age: 21}
+	streams := []*fakeStream{
+		{docs: []bson.Raw{
+			changeRaw(t, "t1", ChangeInsert, 1, alice),
+			changeRaw(t, "t2", ChangeUpdate, 1, alice),
+		}, err: errors.New("connection reset")},
+		{docs: []bson.Raw{changeRaw(t, "t3", ChangeDelete, 1, nil)}},
+	}
+	store := &memCheckpoints{tokens: map[string]bson.Raw{"users": changeRaw(t, "t0", ChangeInsert, 0, nil).Lookup("_id").Document()}}
+	saved := func() string {
+		token, _ := store.Load(ctx, "users")
+		return tokenData(t, token)
+	}
+	var resumed []string
+	w := &watcher[memUser]{
+		opts: NewOptions(Watch().SetCheckpoints(store, "users")),
+		open: func(_ context.Context, token bson.Raw) (changeStream, error) {
+			resumed = append(resumed, tokenData(t, token))
+			s := streams[0]
+			streams = streams[1:]
+			return s, nil
+		},
+	}
+	ch, err := w.start(ctx)
+	require.NoError(t, err)
+
+	ev := <-ch
+	assert.Equal(t, ChangeInsert, ev.Op)
+	assert.Equal(t, &alice, ev.Doc)
+	assert.Equal(t, int64(1700000000), ev.ClusterTime.Unix())
+	assert.Equal(t, "t0", saved())
+
+	ev = <-ch
+	assert.Equal(t, ChangeUpdate, ev.Op)
+	assert.Equal(t, map[string]any{"age": int32(21)}, ev.UpdatedFields)
+	assert.Equal(t, []string{"tags"}, ev.RemovedFields)
+	// 读到 t2 说明 t1 已处理完成
+	assert.Eventually(t, func() bool { return saved() == "t1" }, time.Second, time.Millisecond)
+
+	// 连接中断后从 t2 继续
+	ev = <-ch
+	assert.Equal(t, ChangeDelete, ev.Op)
+	assert.Equal(t, int64(1), ev.Id)
+	assert.Nil(t, ev.Doc)
+	assert.Equal(t, []string{"t0", "t2"}, resumed)
+	assert.Eventually(t, func() bool { return saved() == "t2" }, time.Second, time.Millisecond)
+
+	cancel()
+	for range ch {
+	}
+}
+
+func TestWatcher_Terminal(t *testing.T) {
+	ctx := context.Background()
+	opened := 0
+	w := &watcher[memUser]{
+		opts: NewOptions[WatchOptions](),
+		open: func(context.Context, bson.Raw) (changeStream, error) {
+			opened++
+			return &fakeStream{err: mongo.CommandError{Code: 286, Message: "history lost"}}, nil
+		},
+	}
+	ch, err := w.start(ctx)
+	require.NoError(t, err)
+	ev := <-ch
+	assert.ErrorContains(t, ev.Err, "history lost")
+	_, ok := <-ch
+	assert.False(t, ok)
+	assert.Equal(t, 1, opened)
+
+	// 还没有事件时从批次结束位置的令牌重连
+	var resumed []string
+	streams := []*fakeStream{
+		{err: errors.New("connection reset"), resume: changeRaw(t, "pb1", ChangeInsert, 0, nil).Lookup("_id").Document()},
+		{docs: []bson.Raw{changeRaw(t, "t1", ChangeDelete, 1, nil)}},
+	}
+	w.open = func(_ context.Context, token bson.Raw) (changeStream, error) {
+		resumed = append(resumed, tokenData(t, token))
+		s := streams[0]
+		streams = streams[1:]
+		return s, nil
+	}
+	ch, err = w.start(ctx)
+	require.NoError(t, err)
+	ev = <-ch
+	assert.Equal(t, ChangeDelete, ev.Op)
+	assert.Equal(t, []string{"", "pb1"}, resumed)
+	for range ch {
+	}
+
+	// 事件无法解码时不重连
+	bad, err := bson.Marshal(bson.M{"_id": bson.M{"_data": "t1"}, "operationType": "insert", "fullDocument": bson.M{"age": "x"}})
+	require.NoError(t, err)
+	w.open = func(context.Context, bson.Raw) (changeStream, error) {
+		return &fakeStream{docs: []bson.Raw{bad}}, nil
+	}
+	ch, err = w.start(ctx)
+	require.NoError(t, err)
+	ev = <-ch
+	assert.Error(t, ev.Err)
+	_, ok = <-ch
+	assert.False(t, ok)
+
+	// 首次打开失败时直接返回错误
+	w.open = func(context.Context, bson.Raw) (changeStream, error) { return nil, assert.AnError }
+	_, err = w.start(ctx)
+	assert.ErrorIs(t, err, assert.AnError)
+}
+
+func TestRedisCheckpoints(t *testing.T) {
+	mr := miniredis.RunT(t)
+	cli := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = cli.Close() })
+	ctx := context.Background()
+	store := RedisCheckpoints(cli)
+
+	token, err := store.Load(ctx, "watch:users")
+	require.NoError(t, err)
+	assert.Nil(t, token)
+
+	raw := changeRaw(t, "t9", ChangeInsert, 0, nil).Lookup("_id").Document()
+	require.NoError(t, store.Save(ctx, "watch:users", raw))
+	token, err = store.Load(ctx, "watch:users")
+	require.NoError(t, err)
+	assert.Equal(t, raw, token)
+	assert.Equal(t, time.Duration(0), mr.TTL("watch:users"))
+}